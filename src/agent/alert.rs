@@ -0,0 +1,239 @@
+use std::collections::HashMap;
+
+use anyhow::{Context, Result};
+use regex::Regex;
+
+use crate::agent::approve::in_workspace;
+use crate::agent::backend::{Backend, backend_of};
+use crate::agent::config::{AlertRule, config};
+use crate::agent::persist::set_pane_tags;
+use crate::agent::{Pane, expand_home, log, notify, tmux};
+
+const ALERT_LINES: usize = 30;
+
+struct Rule {
+    name: String,
+    provider: String,
+    workspace: String,
+    pattern: Regex,
+    tag: String,
+    notify: bool,
+}
+
+impl Rule {
+    fn compile(index: usize, rule: &AlertRule) -> Result<Self> {
+        let name = if rule.name.is_empty() {
+            format!("alert {}", index + 1)
+        } else {
+            rule.name.clone()
+        };
+        let pattern = Regex::new(&rule.pattern).with_context(|| format!("{name}: pattern"))?;
+        Ok(Self {
+            name,
+            provider: rule.provider.clone(),
+            workspace: expand_home(&rule.workspace),
+            pattern,
+            tag: rule.tag.clone(),
+            notify: rule.notify,
+        })
+    }
+
+    /// A watch set on one pane, named after its pattern.
+    fn for_pane(pattern: &str) -> Result<Self> {
+        Self::compile(
+            0,
+            &AlertRule {
+                name: pattern.to_string(),
+                pattern: pattern.to_string(),
+                ..AlertRule::default()
+            },
+        )
+    }
+
+    fn applies_to(&self, pane: &Pane) -> bool {
+        !self.pattern.as_str().is_empty()
+            && (self.provider.is_empty() || self.provider == pane.provider)
+            && (self.workspace.is_empty() || in_workspace(&pane.path, &self.workspace))
+    }
+}
+
+/// Watches pane output for the configured `alerts` and each pane's own
+/// patterns. A match tags the pane and sends a notification; the same line
+/// only alerts again after it has left the screen.
+#[derive(Default)]
+pub struct Alerter {
+    rules: Vec<Rule>,
+    /// Per-pane patterns, compiled once; `None` when invalid.
+    pane_rules: HashMap<String, Option<Rule>>,
+    /// The content hash each pane was last checked at.
+    checked: HashMap<String, String>,
+    /// The line each (pane, rule) last alerted on.
+    fired: HashMap<(String, String), String>,
+}
+
+impl Alerter {
+    pub fn from_config() -> Self {
+        let rules = config()
+            .alerts
+            .iter()
+            .enumerate()
+            .filter_map(|(i, rule)| match Rule::compile(i, rule) {
+                Ok(rule) => Some(rule),
+                Err(err) => {
+                    log::error("invalid alert rule", &[("err", &format!("{err:#}"))]);
+                    None
+                }
+            })
+            .collect();
+        Self {
+            rules,
+            ..Self::default()
+        }
+    }
+
+    pub fn run(&mut self, panes: &[Pane]) {
+        self.checked
+            .retain(|id, _| panes.iter().any(|pane| pane.pane_id == *id));
+        self.fired
+            .retain(|(id, _), _| panes.iter().any(|pane| pane.pane_id == *id));
+        for pane in panes {
+            if pane.terminated || backend_of(&pane.target) != Backend::Tmux {
+                continue;
+            }
+            for pattern in &pane.alerts {
+                self.pane_rules.entry(pattern.clone()).or_insert_with(|| {
+                    match Rule::for_pane(pattern) {
+                        Ok(rule) => Some(rule),
+                        Err(err) => {
+                            log::warn("invalid pane alert", &[("err", &format!("{err:#}"))]);
+                            None
+                        }
+                    }
+                });
+            }
+            let rules: Vec<&Rule> = self
+                .rules
+                .iter()
+                .filter(|rule| rule.applies_to(pane))
+                .chain(
+                    pane.alerts
+                        .iter()
+                        .filter_map(|pattern| self.pane_rules.get(pattern)?.as_ref()),
+                )
+                .collect();
+            if rules.is_empty() || self.checked.get(&pane.pane_id) == Some(&pane.content_hash) {
+                continue;
+            }
+            self.checked
+                .insert(pane.pane_id.clone(), pane.content_hash.clone());
+            let text = match tmux::capture_text(&pane.pane_id, ALERT_LINES) {
+                Ok(text) => text,
+                Err(err) => {
+                    log::warn(
+                        "alert capture failed",
+                        &[("pane", &pane.pane_id), ("err", &format!("{err:#}"))],
+                    );
+                    continue;
+                }
+            };
+            let alerts = new_matches(&mut self.fired, &pane.pane_id, &rules, &text);
+            raise(pane, &alerts);
+        }
+    }
+}
+
+/// The rules whose match in `text` is new since the last check, with the
+/// line that matched.
+fn new_matches<'a>(
+    fired: &mut HashMap<(String, String), String>,
+    pane_id: &str,
+    rules: &[&'a Rule],
+    text: &str,
+) -> Vec<(&'a Rule, String)> {
+    let mut alerts = Vec::new();
+    for rule in rules {
+        let key = (pane_id.to_string(), rule.name.clone());
+        match tmux::matching_line(&rule.pattern, text) {
+            Some(line) if fired.get(&key).map(String::as_str) != Some(line) => {
+                fired.insert(key, line.to_string());
+                alerts.push((*rule, line.to_string()));
+            }
+            Some(_) => {}
+            None => {
+                fired.remove(&key);
+            }
+        }
+    }
+    alerts
+}
+
+fn raise(pane: &Pane, alerts: &[(&Rule, String)]) {
+    let mut tags = pane.tags.clone();
+    for (rule, line) in alerts {
+        log::info(
+            "output alert",
+            &[
+                ("pane", &pane.pane_id),
+                ("rule", &rule.name),
+                ("line", line),
+            ],
+        );
+        if !rule.tag.is_empty() && !tags.contains(&rule.tag) {
+            tags.push(rule.tag.clone());
+        }
+        if rule.notify {
+            let pane = pane.clone();
+            let message = format!("{}: {line}", rule.name);
+            std::thread::spawn(move || {
+                if let Err(err) = notify::announce(&pane, &message) {
+                    log::warn(
+                        "alert notification failed",
+                        &[("pane", &pane.pane_id), ("err", &format!("{err:#}"))],
+                    );
+                }
+            });
+        }
+    }
+    if tags != pane.tags
+        && let Err(err) = set_pane_tags(pane, tags)
+    {
+        log::warn(
+            "tag alerted pane failed",
+            &[("pane", &pane.pane_id), ("err", &format!("{err:#}"))],
+        );
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn alerts_once_per_line_until_it_leaves_the_screen() {
+        let failed = Rule::for_pane("FAILED|panicked").unwrap();
+        let passed = Rule::for_pane("All tests passed").unwrap();
+        let rules = [&failed, &passed];
+        let mut fired = HashMap::new();
+        let lines = |alerts: Vec<(&Rule, String)>| -> Vec<String> {
+            alerts.into_iter().map(|(_, line)| line).collect()
+        };
+
+        let screen = "running 3 tests\ntest a ... FAILED\n";
+        assert_eq!(
+            lines(new_matches(&mut fired, "%1", &rules, screen)),
+            ["test a ... FAILED"]
+        );
+        assert!(new_matches(&mut fired, "%1", &rules, screen).is_empty());
+        assert_eq!(new_matches(&mut fired, "%2", &rules, screen).len(), 1);
+
+        let fixed = "running 3 tests\nAll tests passed\n";
+        assert_eq!(
+            lines(new_matches(&mut fired, "%1", &rules, fixed)),
+            ["All tests passed"]
+        );
+        assert_eq!(
+            lines(new_matches(&mut fired, "%1", &rules, screen)),
+            ["test a ... FAILED"]
+        );
+    }
+}
@@ -0,0 +1,338 @@
+use std::collections::HashMap;
+use std::fs::{self, OpenOptions};
+use std::io::Write;
+use std::path::PathBuf;
+use std::sync::OnceLock;
+
+use anyhow::{Context, Result, bail};
+use regex::Regex;
+use serde_json::json;
+
+use crate::agent::backend::{Backend, backend_of};
+use crate::agent::config::{ApproveRule, config};
+use crate::agent::persist::state_dir;
+use crate::agent::{Pane, PaneStatus, expand_home, log, tmux};
+
+/// How far back to look for the header of the prompt on screen, so a long
+/// command cannot push it out of view.
+const PROMPT_SCROLLBACK: usize = 200;
+
+/// The titles agents put above a permission prompt, naming the tool it asks
+/// about. A rule's `tool` must be one of them.
+const TOOL_HEADERS: &[&str] = &[
+    "Bash command",
+    "Edit file",
+    "Create file",
+    "Write file",
+    "Read file",
+    "Fetch",
+    "Web search",
+    "Tool use",
+    "Notebook edit",
+    "Allow command?",
+    "Allow execution",
+];
+
+fn tool_header_re() -> &'static Regex {
+    static RE: OnceLock<Regex> = OnceLock::new();
+    RE.get_or_init(|| {
+        let headers: Vec<String> = TOOL_HEADERS.iter().map(|h| regex::escape(h)).collect();
+        Regex::new(&format!(r"(?m)^[\s│╭]*({})", headers.join("|")))
+            .expect("valid tool header regex")
+    })
+}
+
+/// The prompt at the bottom of `text`: the tool its header names, and the
+/// block from that header down. `None` when no header is in view.
+fn prompt_block(text: &str) -> Option<(&str, &str)> {
+    let header = tool_header_re().captures_iter(text).last()?;
+    let start = header.get(0)?.start();
+    Some((header.get(1)?.as_str(), text[start..].trim()))
+}
+
+struct Rule {
+    name: String,
+    provider: String,
+    workspace: String,
+    tool: String,
+    prompt: Regex,
+    unless: Option<Regex>,
+    keys: Vec<String>,
+}
+
+impl Rule {
+    fn compile(index: usize, rule: &ApproveRule) -> Result<Self> {
+        let name = if rule.name.is_empty() {
+            format!("rule {}", index + 1)
+        } else {
+            rule.name.clone()
+        };
+        if !TOOL_HEADERS.contains(&rule.tool.as_str()) {
+            bail!(
+                "{name}: tool must be one of {}, not {:?}",
+                TOOL_HEADERS.join(", "),
+                rule.tool
+            );
+        }
+        let prompt = Regex::new(&rule.prompt).with_context(|| format!("{name}: prompt"))?;
+        let unless = if rule.unless.is_empty() {
+            None
+        } else {
+            Some(Regex::new(&rule.unless).with_context(|| format!("{name}: unless"))?)
+        };
+        Ok(Self {
+            name,
+            provider: rule.provider.clone(),
+            workspace: expand_home(&rule.workspace),
+            tool: rule.tool.clone(),
+            prompt,
+            unless,
+            keys: rule.keys.clone(),
+        })
+    }
+
+    fn applies_to(&self, pane: &Pane) -> bool {
+        (self.provider.is_empty() || self.provider == pane.provider)
+            && (self.workspace.is_empty() || in_workspace(&pane.path, &self.workspace))
+    }
+
+    /// Returns the line that matched, for the audit log. `tool` is the
+    /// prompt's header and `block` the whole prompt, header included; only
+    /// the header decides which tool is asking, never the command text.
+    fn matches<'a>(&self, tool: &str, block: &'a str) -> Option<&'a str> {
+        if tool != self.tool
+            || self.prompt.as_str().is_empty()
+            || self.unless.as_ref().is_some_and(|re| re.is_match(block))
+        {
+            return None;
+        }
+        tmux::matching_line(&self.prompt, block)
+    }
+}
+
+/// The prompt last answered in a pane.
+struct Answered {
+    /// The pane's content hash when it was last checked, to skip capturing
+    /// a screen that has not changed.
+    content_hash: String,
+    /// The prompt block's hash, which stays the same while the prompt is
+    /// showing.
+    prompt: String,
+}
+
+/// Answers permission prompts that match the configured `autoApprove` rules.
+/// Each prompt (pane and prompt block) is answered at most once, and every
+/// answer is appended to the audit log. A prompt whose tool header is out of
+/// view is never answered.
+#[derive(Default)]
+pub struct Approver {
+    rules: Vec<Rule>,
+    answered: HashMap<String, Answered>,
+}
+
+impl Approver {
+    pub fn from_config() -> Self {
+        let rules = config()
+            .auto_approve
+            .iter()
+            .enumerate()
+            .filter_map(|(i, rule)| match Rule::compile(i, rule) {
+                Ok(rule) => Some(rule),
+                Err(err) => {
+                    log::error("invalid auto-approve rule", &[("err", &format!("{err:#}"))]);
+                    None
+                }
+            })
+            .collect();
+        Self {
+            rules,
+            answered: HashMap::new(),
+        }
+    }
+
+    pub fn run(&mut self, panes: &[Pane]) {
+        self.answered.retain(|id, _| {
+            panes
+                .iter()
+                .any(|pane| pane.pane_id == *id && pane.status == PaneStatus::NeedsAttention)
+        });
+        for pane in panes {
+            if pane.status != PaneStatus::NeedsAttention
+                || pane.terminated
+                || backend_of(&pane.target) != Backend::Tmux
+                || self
+                    .answered
+                    .get(&pane.pane_id)
+                    .is_some_and(|a| a.content_hash == pane.content_hash)
+            {
+                continue;
+            }
+            let rules: Vec<&Rule> = self.rules.iter().filter(|r| r.applies_to(pane)).collect();
+            if rules.is_empty() {
+                continue;
+            }
+            let text = match tmux::capture_text(&pane.pane_id, PROMPT_SCROLLBACK) {
+                Ok(text) => text,
+                Err(err) => {
+                    log::warn(
+                        "auto-approve capture failed",
+                        &[("pane", &pane.pane_id), ("err", &format!("{err:#}"))],
+                    );
+                    continue;
+                }
+            };
+            let Some((tool, block)) = prompt_block(&text) else {
+                continue;
+            };
+            let prompt = tmux::short_hash(block.as_bytes());
+            if let Some(answered) = self.answered.get_mut(&pane.pane_id)
+                && answered.prompt == prompt
+            {
+                answered.content_hash = pane.content_hash.clone();
+                continue;
+            }
+            let Some((rule, line)) = rules
+                .into_iter()
+                .find_map(|rule| rule.matches(tool, block).map(|line| (rule, line)))
+            else {
+                continue;
+            };
+            self.answered.insert(
+                pane.pane_id.clone(),
+                Answered {
+                    content_hash: pane.content_hash.clone(),
+                    prompt,
+                },
+            );
+            let result = tmux::send_keys(&pane.pane_id, &rule.keys);
+            if let Err(err) = audit(pane, rule, line, &result) {
+                log::warn(
+                    "write approvals log failed",
+                    &[("err", &format!("{err:#}"))],
+                );
+            }
+            log::info(
+                "auto-approved prompt",
+                &[
+                    ("pane", &pane.pane_id),
+                    ("rule", &rule.name),
+                    ("prompt", &line),
+                    ("ok", &result.is_ok()),
+                ],
+            );
+        }
+    }
+}
+
+pub fn audit_log_path() -> PathBuf {
+    state_dir().join("approvals.log")
+}
+
+fn audit(pane: &Pane, rule: &Rule, line: &str, result: &Result<()>) -> Result<()> {
+    let record = json!({
+        "at": chrono::Utc::now(),
+        "paneId": pane.pane_id,
+        "target": pane.target,
+        "provider": pane.provider,
+        "path": pane.path,
+        "rule": rule.name,
+        "tool": rule.tool,
+        "prompt": line,
+        "keys": rule.keys,
+        "error": result.as_ref().err().map(|err| format!("{err:#}")),
+    });
+    fs::create_dir_all(state_dir()).context("create state dir")?;
+    let mut file = OpenOptions::new()
+        .create(true)
+        .append(true)
+        .open(audit_log_path())
+        .context("open approvals log")?;
+    writeln!(file, "{record}").context("write approvals log")
+}
+
+/// Whether `path` is `workspace` or inside it.
+pub fn in_workspace(path: &str, workspace: &str) -> bool {
+    let workspace = workspace.trim_end_matches('/');
+    path == workspace
+        || path
+            .strip_prefix(workspace)
+            .is_some_and(|rest| rest.starts_with('/'))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn rule(tool: &str, prompt: &str, unless: &str) -> Rule {
+        Rule::compile(
+            0,
+            &ApproveRule {
+                provider: "claude".to_string(),
+                workspace: "/src/api".to_string(),
+                tool: tool.to_string(),
+                prompt: prompt.to_string(),
+                unless: unless.to_string(),
+                ..ApproveRule::default()
+            },
+        )
+        .unwrap()
+    }
+
+    #[test]
+    fn matches_prompt_unless_excluded() {
+        let block = "Read file\n  src/main.rs\nDo you want to proceed?\n❯ 1. Yes";
+        let rule = rule("Read file", r"Do you want to proceed\?", r"\.env");
+
+        assert_eq!(
+            rule.matches("Read file", block),
+            Some("Do you want to proceed?")
+        );
+        assert_eq!(
+            rule.matches("Read file", &block.replace("main.rs", ".env")),
+            None
+        );
+    }
+
+    #[test]
+    fn only_the_header_names_the_tool() {
+        let screen = "│ Fetch\n  https://example.com/Read file\nDo you want to proceed?\n❯ 1. Yes";
+        let (tool, block) = prompt_block(screen).unwrap();
+        let rule = rule("Read file", r"Do you want to proceed\?", "");
+
+        assert_eq!(tool, "Fetch");
+        assert_eq!(rule.matches(tool, block), None);
+        let no_tool = ApproveRule {
+            prompt: "proceed".to_string(),
+            ..ApproveRule::default()
+        };
+        assert!(Rule::compile(0, &no_tool).is_err());
+    }
+
+    #[test]
+    fn prompt_block_reaches_back_to_the_tool_header() {
+        let command = "  echo step\n".repeat(40);
+        let screen = format!(
+            "● Read file src/lib.rs\n╭──\n│ Bash command\n{command}Do you want to proceed?\n❯ 1. Yes"
+        );
+        let (tool, block) = prompt_block(&screen).unwrap();
+        let rule = rule("Read file", r"Do you want to proceed\?", "");
+
+        assert!(block.starts_with("│ Bash command"));
+        assert_eq!(rule.matches(tool, block), None);
+        assert_eq!(prompt_block("Do you want to proceed?\n❯ 1. Yes"), None);
+    }
+
+    #[test]
+    fn scopes_rules_by_provider_and_workspace() {
+        let rule = rule("Read file", "proceed", "");
+        let pane = |provider: &str, path: &str| Pane {
+            provider: provider.to_string(),
+            path: path.to_string(),
+            ..Pane::default()
+        };
+
+        assert!(rule.applies_to(&pane("claude", "/src/api/handlers")));
+        assert!(!rule.applies_to(&pane("claude", "/src/api-v2")));
+        assert!(!rule.applies_to(&pane("codex", "/src/api")));
+    }
+}
@@ -0,0 +1,175 @@
+use std::fs::{self, OpenOptions};
+use std::io::Write;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+
+use anyhow::{Context, Result};
+use chrono::{DateTime, Local, Utc};
+use serde::{Deserialize, Serialize};
+
+use crate::agent::config::config;
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt};
+use crate::agent::log;
+use crate::agent::persist::state_dir;
+use crate::agent::remote::shell_quote;
+use crate::agent::transcript::project_key;
+
+/// The scrollback of a killed pane, saved under
+/// `archive/<date>/<workspace>-<time>.log.gz`.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct Entry {
+    pub at: DateTime<Utc>,
+    pub target: String,
+    pub path: String,
+    pub lines: usize,
+    pub file: PathBuf,
+}
+
+pub fn archive_dir() -> PathBuf {
+    state_dir().join("archive")
+}
+
+fn index_path() -> PathBuf {
+    archive_dir().join("index.jsonl")
+}
+
+/// Saves `content` and records it in the index. Compression is left to the
+/// system `gzip`; without it the output is kept as plain text.
+pub fn store(target: &str, path: &str, content: &str, now: DateTime<Utc>) -> Result<Entry> {
+    let local = now.with_timezone(&Local);
+    let dir = archive_dir().join(local.format("%Y-%m-%d").to_string());
+    fs::create_dir_all(&dir).context("create archive dir")?;
+    let mut file = unused_file(&dir, path, local);
+    fs::write(&file, content).with_context(|| format!("write {}", file.display()))?;
+    let gzipped = Command::new("gzip")
+        .args(["-f", "-q"])
+        .arg(&file)
+        .status_within(COMMAND_TIMEOUT)
+        .is_ok_and(|status| status.success());
+    if gzipped {
+        file.set_extension("log.gz");
+    }
+    let entry = Entry {
+        at: now,
+        target: target.to_string(),
+        path: path.to_string(),
+        lines: content.lines().count(),
+        file,
+    };
+    let mut index = OpenOptions::new()
+        .create(true)
+        .append(true)
+        .open(index_path())
+        .context("open archive index")?;
+    writeln!(index, "{}", serde_json::to_string(&entry)?).context("write archive index")?;
+    prune(now);
+    Ok(entry)
+}
+
+/// The first archive file name in `dir` not taken by an earlier kill in the
+/// same second, plain or gzipped.
+fn unused_file(dir: &Path, path: &str, at: DateTime<Local>) -> PathBuf {
+    (1..)
+        .map(|n| dir.join(file_name(path, at, n)))
+        .find(|file| !file.exists() && !file.with_extension("log.gz").exists())
+        .expect("some archive file name is free")
+}
+
+fn file_name(path: &str, at: DateTime<Local>, n: usize) -> String {
+    let time = at.format("%H%M%S");
+    if n == 1 {
+        format!("{}-{time}.log", workspace_slug(path))
+    } else {
+        format!("{}-{time}-{n}.log", workspace_slug(path))
+    }
+}
+
+/// A file-name friendly form of a workspace path, e.g. `src-api`.
+pub fn workspace_slug(path: &str) -> String {
+    let workspace = project_key(path);
+    let workspace = workspace.trim_start_matches('-');
+    if workspace.is_empty() {
+        "pane".to_string()
+    } else {
+        workspace.to_string()
+    }
+}
+
+fn prune(now: DateTime<Utc>) {
+    prune_days(&archive_dir(), now);
+}
+
+/// Deletes the day directories of `dir` older than `archive.keepDays` (0
+/// keeps everything). Archived index lines pointing into them are skipped by
+/// `list`.
+pub fn prune_days(dir: &Path, now: DateTime<Utc>) {
+    let keep_days = config().archive.keep_days;
+    if keep_days == 0 {
+        return;
+    }
+    let cutoff = (now - chrono::Duration::days(keep_days as i64))
+        .with_timezone(&Local)
+        .format("%Y-%m-%d")
+        .to_string();
+    let Ok(dirs) = fs::read_dir(dir) else {
+        return;
+    };
+    for dir in dirs.flatten().filter(|dir| dir.path().is_dir()) {
+        if dir.file_name().to_string_lossy().as_ref() < cutoff.as_str()
+            && let Err(err) = fs::remove_dir_all(dir.path())
+        {
+            log::warn("prune archive failed", &[("err", &err)]);
+        }
+    }
+}
+
+/// Archived outputs that still exist on disk, newest first.
+pub fn list() -> Vec<Entry> {
+    let data = fs::read_to_string(index_path()).unwrap_or_default();
+    let mut entries: Vec<Entry> = data
+        .lines()
+        .filter_map(|line| serde_json::from_str::<Entry>(line).ok())
+        .filter(|entry| entry.file.exists())
+        .collect();
+    entries.reverse();
+    entries
+}
+
+/// A shell command that pages through an archived output.
+pub fn view_command(file: &Path) -> String {
+    format!(
+        "gzip -dcf {} | less -R",
+        shell_quote(&file.to_string_lossy())
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use chrono::TimeZone;
+
+    #[test]
+    fn names_archives_by_workspace_and_time() {
+        let at = Local.with_ymd_and_hms(2026, 3, 2, 14, 5, 9).unwrap();
+
+        assert_eq!(file_name("/src/api", at, 1), "src-api-140509.log");
+        assert_eq!(file_name("", at, 1), "pane-140509.log");
+        assert_eq!(
+            view_command(Path::new("/a b/x.log.gz")),
+            "gzip -dcf '/a b/x.log.gz' | less -R"
+        );
+    }
+
+    #[test]
+    fn kills_in_the_same_second_get_their_own_files() {
+        let at = Local.with_ymd_and_hms(2026, 3, 2, 14, 5, 9).unwrap();
+        let dir = std::env::temp_dir().join(format!("agent-mux-archive-{}", std::process::id()));
+        fs::create_dir_all(&dir).unwrap();
+        fs::write(dir.join("src-api-140509.log.gz"), "").unwrap();
+
+        let file = unused_file(&dir, "/src/api", at);
+        fs::remove_dir_all(&dir).unwrap();
+        assert_eq!(file, dir.join("src-api-140509-2.log"));
+    }
+}
@@ -0,0 +1,78 @@
+use crate::agent::provider::ProcessTable;
+use crate::agent::remote::split_remote_target;
+use crate::agent::{Pane, config::config, kitty, wezterm};
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Backend<'a> {
+    Tmux,
+    Wezterm(&'a str),
+    Kitty(&'a str),
+    Remote { name: &'a str, target: &'a str },
+}
+
+pub fn backend_of(target: &str) -> Backend<'_> {
+    if let Some(id) = target.strip_prefix("wezterm:") {
+        Backend::Wezterm(id)
+    } else if let Some(id) = target.strip_prefix("kitty:") {
+        Backend::Kitty(id)
+    } else if let Some((name, target)) = split_remote_target(target) {
+        Backend::Remote { name, target }
+    } else {
+        Backend::Tmux
+    }
+}
+
+pub fn list_native_panes(pt: &ProcessTable) -> Vec<Pane> {
+    let mut panes = Vec::new();
+    if config().backend_enabled("wezterm") {
+        panes.extend(wezterm::list_panes(pt));
+    }
+    if config().backend_enabled("kitty") {
+        panes.extend(kitty::list_panes(pt));
+    }
+    panes
+}
+
+pub fn last_lines(content: &str, lines: usize) -> String {
+    let all: Vec<&str> = content.trim_end_matches('\n').lines().collect();
+    all[all.len().saturating_sub(lines)..].join("\n")
+}
+
+pub fn percent_decode(s: &str) -> String {
+    let bytes = s.as_bytes();
+    let mut out = Vec::with_capacity(bytes.len());
+    let mut i = 0;
+    while i < bytes.len() {
+        if bytes[i] == b'%'
+            && i + 2 < bytes.len()
+            && let Ok(hex) = std::str::from_utf8(&bytes[i + 1..i + 3])
+            && let Ok(byte) = u8::from_str_radix(hex, 16)
+        {
+            out.push(byte);
+            i += 3;
+            continue;
+        }
+        out.push(bytes[i]);
+        i += 1;
+    }
+    String::from_utf8_lossy(&out).into_owned()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn routes_targets_by_prefix() {
+        assert_eq!(backend_of("main:1.2"), Backend::Tmux);
+        assert_eq!(backend_of("wezterm:7"), Backend::Wezterm("7"));
+        assert_eq!(backend_of("kitty:3"), Backend::Kitty("3"));
+        assert_eq!(
+            backend_of("ssh:devbox/main:1.2"),
+            Backend::Remote {
+                name: "devbox",
+                target: "main:1.2"
+            }
+        );
+    }
+}
@@ -0,0 +1,67 @@
+use chrono::{DateTime, Duration, Utc};
+
+use crate::agent::config::Cleanup;
+use crate::agent::{Pane, PaneStatus};
+
+/// Panes the `cleanup` policy offers to kill: finished or idle for at least
+/// `idleHours`, with a clean git tree and nothing queued for them. Nothing
+/// is killed here; callers present the list for review.
+pub fn candidates(panes: &[Pane], policy: Cleanup, now: DateTime<Utc>) -> Vec<&Pane> {
+    if policy.idle_hours == 0 {
+        return Vec::new();
+    }
+    // More hours than a duration can hold: nothing is ever that old.
+    let Some(idle_for) = i64::try_from(policy.idle_hours)
+        .ok()
+        .and_then(Duration::try_hours)
+    else {
+        return Vec::new();
+    };
+    panes
+        .iter()
+        .filter(|pane| {
+            !pane.terminated
+                && matches!(pane.status, PaneStatus::Idle | PaneStatus::Unread)
+                && pane.last_active.is_some_and(|at| now - at >= idle_for)
+                && !pane.git_dirty
+                && !pane.project_dirty
+                && pane.queued_prompts.is_empty()
+                && pane.on_finish.is_empty()
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn offers_only_old_clean_finished_panes() {
+        let now = Utc::now();
+        let pane = |id: &str, status: PaneStatus, hours: i64, dirty: bool| Pane {
+            pane_id: id.to_string(),
+            status,
+            last_active: Some(now - Duration::hours(hours)),
+            git_dirty: dirty,
+            ..Pane::default()
+        };
+        let panes = [
+            pane("%1", PaneStatus::Unread, 30, false),
+            pane("%2", PaneStatus::Idle, 30, true),
+            pane("%3", PaneStatus::Busy, 30, false),
+            pane("%4", PaneStatus::Idle, 2, false),
+        ];
+
+        let ids: Vec<&str> = candidates(&panes, Cleanup { idle_hours: 24 }, now)
+            .iter()
+            .map(|pane| pane.pane_id.as_str())
+            .collect();
+
+        assert_eq!(ids, ["%1"]);
+        assert!(candidates(&panes, Cleanup::default(), now).is_empty());
+        let never = Cleanup {
+            idle_hours: u64::MAX,
+        };
+        assert!(candidates(&panes, never, now).is_empty());
+    }
+}
@@ -0,0 +1,691 @@
+use std::collections::{BTreeMap, HashMap};
+use std::path::PathBuf;
+use std::sync::OnceLock;
+
+use anyhow::{Context, Result};
+use serde::Deserialize;
+
+use crate::agent::PaneStatus;
+use crate::agent::log;
+
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct Config {
+    pub backends: Vec<String>,
+    pub kitty_listen_on: String,
+    pub remotes: Vec<Remote>,
+    pub web: WebConfig,
+    pub editor_uri: String,
+    pub truncation: Truncation,
+    pub theme: Theme,
+    pub status_style: StatusStyle,
+    pub header_marks: HeaderMarks,
+    pub pane_columns: Vec<PaneColumn>,
+    pub notifications: NotificationConfig,
+    pub digest: Digest,
+    pub unread_expiry: UnreadExpiry,
+    pub transitions: Transitions,
+    pub snooze_minutes: u32,
+    pub confirm_kill: bool,
+    /// Shared mode: every sidebar and RPC client is read-only and the
+    /// watcher refuses pane updates.
+    pub read_only: bool,
+    pub quick_switch: bool,
+    /// A tmux key bound for one use after `enter` switches to a pane, which
+    /// opens the sidebar again where it was left. Empty binds nothing.
+    pub return_key: String,
+    /// Label a pane by its window's name alone when that name says more
+    /// than the shell or agent tmux would name the window after.
+    pub window_name_labels: bool,
+    /// Status words instead of icons, a `>` on the selected row, and the
+    /// terminal cursor left on it for screen readers.
+    pub accessible: bool,
+    pub kill_undo_secs: u64,
+    pub stash_placement: StashPlacement,
+    pub auto_stash: AutoStash,
+    pub cleanup: Cleanup,
+    pub archive: Archive,
+    pub output_log: OutputLog,
+    pub containers: Containers,
+    pub team_status: TeamStatus,
+    pub tasks: Tasks,
+    pub concurrency: Concurrency,
+    pub preview: Preview,
+    pub power_save: PowerSave,
+    pub slow_paths: SlowPaths,
+    pub auto_approve: Vec<ApproveRule>,
+    pub alerts: Vec<AlertRule>,
+    pub templates: BTreeMap<String, Template>,
+    pub hooks: Hooks,
+}
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Truncation {
+    #[default]
+    End,
+    Middle,
+}
+
+/// The sidebar's palette. `auto` picks `light` when `COLORFGBG`, which
+/// many terminals set, names a light background.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Theme {
+    #[default]
+    Auto,
+    Dark,
+    Light,
+}
+
+impl Theme {
+    pub fn is_light(self) -> bool {
+        match self {
+            Self::Auto => std::env::var("COLORFGBG").is_ok_and(|v| light_background(&v)),
+            Self::Dark => false,
+            Self::Light => true,
+        }
+    }
+}
+
+/// Whether a `COLORFGBG` value (`fg;bg`, or `fg;default;bg`) has a light
+/// background: white or one of the bright colors other than grey.
+fn light_background(colorfgbg: &str) -> bool {
+    colorfgbg
+        .rsplit(';')
+        .next()
+        .and_then(|bg| bg.parse::<u8>().ok())
+        .is_some_and(|bg| bg == 7 || (9..=15).contains(&bg))
+}
+
+/// Icon colors by status (`#rrggbb`, a color name, or a 256-color index),
+/// and how panes that have needed attention for `escalateAfterMins`
+/// (0 disables) are emphasized. Idle panes get dimmer as their idle time
+/// passes each of `decayMins`.
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct StatusStyle {
+    pub colors: HashMap<PaneStatus, String>,
+    pub escalate_after_mins: u64,
+    pub escalate: Emphasis,
+    pub decay_mins: Vec<u64>,
+}
+
+/// The marks on workspace headers: `dirty` after the branch when the
+/// workspace has uncommitted changes, in `dirtyColor`, `stashed` with
+/// the number of its panes that are stashed, and `conflict` when several
+/// agents share the workspace while one is busy. An empty mark is not shown.
+/// `conflictAcrossWorktrees` counts worktrees of one repository as one
+/// workspace for the conflict mark.
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct HeaderMarks {
+    pub dirty: String,
+    pub dirty_color: String,
+    pub stashed: String,
+    pub conflict: String,
+    pub conflict_across_worktrees: bool,
+}
+
+impl Default for HeaderMarks {
+    fn default() -> Self {
+        Self {
+            dirty: "*".to_string(),
+            dirty_color: "yellow".to_string(),
+            stashed: "≡".to_string(),
+            conflict: "⚠".to_string(),
+            conflict_across_worktrees: false,
+        }
+    }
+}
+
+/// What a pane row shows, in order. `label`, `target`, `path` and `tags`
+/// shrink to fit, in that order of priority, and the columns after the last
+/// of them are right-aligned.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum PaneColumn {
+    Icon,
+    Provider,
+    Label,
+    Target,
+    /// The pane's directory, when it is a worktree of its project.
+    Path,
+    /// Time since the pane was last active, or its queued prompt count.
+    Elapsed,
+    /// How long the pane has been busy.
+    Busy,
+    /// The local time the pane was last active.
+    Clock,
+    /// Time since the pane's status last changed.
+    Since,
+    /// The dirty mark from `headerMarks` when the pane's checkout has
+    /// uncommitted changes.
+    Dirty,
+    /// The pane's tags, each as `#tag`.
+    Tags,
+}
+
+impl PaneColumn {
+    /// Shrinks to fit the sidebar.
+    pub fn is_flexible(self) -> bool {
+        matches!(self, Self::Label | Self::Target | Self::Path | Self::Tags)
+    }
+
+    /// A fixed-width slot that pads itself.
+    pub fn is_slot(self) -> bool {
+        matches!(self, Self::Elapsed | Self::Busy | Self::Clock | Self::Since)
+    }
+}
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Emphasis {
+    Bold,
+    #[default]
+    Reverse,
+    Blink,
+}
+
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(default)]
+pub struct WebConfig {
+    pub listen: String,
+    pub token: String,
+}
+
+/// When a pane that finished unattended stops being reported as unread.
+/// `afterHours` of 0 disables the timeout; `newDay` clears anything that
+/// finished before local midnight.
+#[derive(Debug, Clone, Copy, Default, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct UnreadExpiry {
+    pub after_hours: u64,
+    pub new_day: bool,
+}
+
+/// How the watcher moves panes between statuses. A busy pane settles after
+/// `settlePolls` refreshes without new output; if it was busy for less than
+/// `minBusySecs` it settles to idle rather than unread. An attention prompt
+/// must be seen on `attentionPolls` refreshes in a row before it counts.
+/// `attentionPreemptsBusy` ends Busy as soon as an attention prompt shows,
+/// and manual read/unread marks lapse after `overrideMinutes` (0 keeps them
+/// until the output changes).
+#[derive(Debug, Clone, Copy, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct Transitions {
+    pub settle_polls: usize,
+    pub attention_polls: usize,
+    pub min_busy_secs: u64,
+    pub attention_preempts_busy: bool,
+    pub override_minutes: u64,
+}
+
+impl Default for Transitions {
+    fn default() -> Self {
+        Self {
+            settle_polls: 2,
+            attention_polls: 1,
+            min_busy_secs: 0,
+            attention_preempts_busy: false,
+            override_minutes: 0,
+        }
+    }
+}
+
+/// Where stashed panes are listed: together in a stashed section below the
+/// active list, or dimmed at the end of their own workspace.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum StashPlacement {
+    #[default]
+    Section,
+    Workspace,
+}
+
+/// Moves panes idle for `idleHours` (0 disables) into the stashed section.
+#[derive(Debug, Clone, Copy, Default, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct AutoStash {
+    pub idle_hours: u64,
+    pub unstash_on_activity: bool,
+}
+
+/// Offers to kill panes idle or unread for `idleHours` (0 disables) whose
+/// git tree is clean.
+#[derive(Debug, Clone, Copy, Default, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct Cleanup {
+    pub idle_hours: u64,
+}
+
+/// Saves the scrollback of panes before they are killed, keeping
+/// `keepDays` of archives (0 keeps them forever).
+#[derive(Debug, Clone, Copy, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct Archive {
+    pub enabled: bool,
+    pub keep_days: u64,
+}
+
+impl Default for Archive {
+    fn default() -> Self {
+        Self {
+            enabled: true,
+            keep_days: 30,
+        }
+    }
+}
+
+/// Has the watcher pipe every local tmux agent pane's output to a log file,
+/// rotated once it passes `maxSizeMb` with `keep` older files kept.
+#[derive(Debug, Clone, Copy, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct OutputLog {
+    pub enabled: bool,
+    pub max_size_mb: u64,
+    pub keep: usize,
+}
+
+impl Default for OutputLog {
+    fn default() -> Self {
+        Self {
+            enabled: false,
+            max_size_mb: 10,
+            keep: 3,
+        }
+    }
+}
+
+/// A named recipe for `agent-mux spawn --template`. `{arg}` in `directory`,
+/// `prompt`, and `windowName` is replaced with the spawn argument.
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct Template {
+    pub provider: String,
+    pub command: String,
+    pub directory: String,
+    pub prompt: String,
+    pub window_name: String,
+}
+
+impl Default for Template {
+    fn default() -> Self {
+        Self {
+            provider: "claude".to_string(),
+            command: String::new(),
+            directory: String::new(),
+            prompt: String::new(),
+            window_name: String::new(),
+        }
+    }
+}
+
+/// Raises an alert when `pattern` shows up in the output of a pane that
+/// `provider` and `workspace` select (empty matches any): the pane gets
+/// `tag`, and a notification goes out when `notify` is set.
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct AlertRule {
+    pub name: String,
+    pub pattern: String,
+    pub provider: String,
+    pub workspace: String,
+    pub tag: String,
+    pub notify: bool,
+}
+
+impl Default for AlertRule {
+    fn default() -> Self {
+        Self {
+            name: String::new(),
+            pattern: String::new(),
+            provider: String::new(),
+            workspace: String::new(),
+            tag: "alert".to_string(),
+            notify: true,
+        }
+    }
+}
+
+/// Answers a permission prompt by sending `keys` when its tool header is
+/// exactly `tool` and the prompt matches `prompt` and not `unless`. Empty
+/// `provider` and `workspace` match any pane; an empty `tool` matches none.
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct ApproveRule {
+    pub name: String,
+    pub provider: String,
+    pub workspace: String,
+    pub tool: String,
+    pub prompt: String,
+    pub unless: String,
+    pub keys: Vec<String>,
+}
+
+impl Default for ApproveRule {
+    fn default() -> Self {
+        Self {
+            name: String::new(),
+            provider: String::new(),
+            workspace: String::new(),
+            tool: String::new(),
+            prompt: String::new(),
+            unless: String::new(),
+            keys: vec!["Enter".to_string()],
+        }
+    }
+}
+
+/// Shell commands the watcher runs when a pane needs attention or finishes
+/// unread, and when refreshes start failing.
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct Hooks {
+    pub on_attention: String,
+    pub on_unread: String,
+    pub on_error: String,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct NotificationConfig {
+    pub enabled: bool,
+    pub desktop: bool,
+    pub tmux: bool,
+    pub statuses: Vec<PaneStatus>,
+    pub cooldown_secs: u64,
+    pub command: String,
+}
+
+impl Default for NotificationConfig {
+    fn default() -> Self {
+        Self {
+            enabled: false,
+            desktop: true,
+            tmux: false,
+            statuses: vec![
+                PaneStatus::NeedsAttention,
+                PaneStatus::Unread,
+                PaneStatus::Error,
+            ],
+            cooldown_secs: 60,
+            command: String::new(),
+        }
+    }
+}
+
+/// Pipes a daily summary of finished, attention and error events to
+/// `command` (`mail -s "$AGENT_MUX_SUBJECT" me@example.com`) at `at`
+/// (`HH:MM`, local time).
+#[derive(Debug, Clone, Deserialize)]
+#[serde(default)]
+pub struct Digest {
+    pub enabled: bool,
+    pub at: String,
+    pub command: String,
+}
+
+impl Default for Digest {
+    fn default() -> Self {
+        Self {
+            enabled: false,
+            at: "18:00".to_string(),
+            command: String::new(),
+        }
+    }
+}
+
+/// Container path prefixes (`/workspaces/foo`) mapped to the host
+/// directories mounted there, for panes whose path does not exist on the
+/// host. With `detect`, the mounts of running docker containers are used too.
+#[derive(Debug, Clone, Deserialize)]
+#[serde(default)]
+pub struct Containers {
+    pub paths: BTreeMap<String, String>,
+    pub detect: bool,
+}
+
+impl Default for Containers {
+    fn default() -> Self {
+        Self {
+            paths: BTreeMap::new(),
+            detect: true,
+        }
+    }
+}
+
+/// Has the watcher publish an anonymized summary of its panes every
+/// `intervalSecs`, appended to `file` and/or POSTed to `endpoint`.
+/// `machine` names this machine in reports (a hash of the host name by
+/// default).
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct TeamStatus {
+    pub enabled: bool,
+    pub interval_secs: u64,
+    pub file: String,
+    pub endpoint: String,
+    pub machine: String,
+}
+
+impl Default for TeamStatus {
+    fn default() -> Self {
+        Self {
+            enabled: false,
+            interval_secs: 300,
+            file: String::new(),
+            endpoint: String::new(),
+            machine: String::new(),
+        }
+    }
+}
+
+/// `spawn` is the agent command started for a queued task whose workspace
+/// has no agent yet; empty leaves such tasks waiting. `branchPrefix` starts
+/// the branch name of a task given its own worktree.
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct Tasks {
+    pub spawn: String,
+    pub branch_prefix: String,
+}
+
+impl Default for Tasks {
+    fn default() -> Self {
+        Self {
+            spawn: "claude".to_string(),
+            branch_prefix: "task/".to_string(),
+        }
+    }
+}
+
+/// Caps on agents busy at once: `maxBusy` across all of them and
+/// `providers` per provider name. 0 or a missing entry means no cap.
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct Concurrency {
+    pub max_busy: usize,
+    pub providers: BTreeMap<String, usize>,
+}
+
+/// How often the sidebar recaptures the previewed pane: every `refreshMs`,
+/// or every `fastRefreshMs` for a pane switched to fast with `p`.
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct Preview {
+    pub refresh_ms: u64,
+    pub fast_refresh_ms: u64,
+}
+
+impl Default for Preview {
+    fn default() -> Self {
+        Self {
+            refresh_ms: 100,
+            fast_refresh_ms: 33,
+        }
+    }
+}
+
+/// Power-save mode: the watcher polls every `pollMs` instead of 250 ms,
+/// git status checks pause, and the sidebar stops refreshing the preview on
+/// its own. `auto` turns it on while running on battery.
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct PowerSave {
+    pub mode: PowerMode,
+    pub poll_ms: u64,
+}
+
+impl Default for PowerSave {
+    fn default() -> Self {
+        Self {
+            mode: PowerMode::Auto,
+            poll_ms: 1000,
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum PowerMode {
+    #[default]
+    Auto,
+    On,
+    Off,
+}
+
+/// Directories on slow filesystems, besides the network and WSL drive
+/// mounts found on their own. Their branch and project are read every
+/// `cacheSecs`, and `git status` only runs in them when `dirty` is set.
+#[derive(Debug, Clone, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct SlowPaths {
+    pub paths: Vec<String>,
+    pub dirty: bool,
+    pub cache_secs: u64,
+}
+
+impl Default for SlowPaths {
+    fn default() -> Self {
+        Self {
+            paths: Vec::new(),
+            dirty: false,
+            cache_secs: 60,
+        }
+    }
+}
+
+#[derive(Debug, Clone, Deserialize)]
+pub struct Remote {
+    pub name: String,
+    pub host: String,
+}
+
+impl Default for Config {
+    fn default() -> Self {
+        Self {
+            backends: vec!["tmux".to_string()],
+            kitty_listen_on: String::new(),
+            remotes: Vec::new(),
+            web: WebConfig::default(),
+            editor_uri: String::new(),
+            truncation: Truncation::End,
+            theme: Theme::Auto,
+            status_style: StatusStyle::default(),
+            header_marks: HeaderMarks::default(),
+            pane_columns: vec![
+                PaneColumn::Icon,
+                PaneColumn::Label,
+                PaneColumn::Path,
+                PaneColumn::Tags,
+                PaneColumn::Elapsed,
+            ],
+            notifications: NotificationConfig::default(),
+            digest: Digest::default(),
+            unread_expiry: UnreadExpiry::default(),
+            transitions: Transitions::default(),
+            snooze_minutes: 30,
+            confirm_kill: false,
+            read_only: false,
+            quick_switch: false,
+            return_key: String::new(),
+            window_name_labels: false,
+            accessible: false,
+            kill_undo_secs: 5,
+            stash_placement: StashPlacement::Section,
+            auto_stash: AutoStash::default(),
+            cleanup: Cleanup::default(),
+            archive: Archive::default(),
+            output_log: OutputLog::default(),
+            containers: Containers::default(),
+            team_status: TeamStatus::default(),
+            tasks: Tasks::default(),
+            concurrency: Concurrency::default(),
+            preview: Preview::default(),
+            power_save: PowerSave::default(),
+            slow_paths: SlowPaths::default(),
+            auto_approve: Vec::new(),
+            alerts: Vec::new(),
+            templates: BTreeMap::new(),
+            hooks: Hooks::default(),
+        }
+    }
+}
+
+impl Config {
+    pub fn backend_enabled(&self, name: &str) -> bool {
+        self.backends.iter().any(|backend| backend == name)
+    }
+}
+
+/// The config file, loaded once. The binary checks it with `load_config`
+/// at startup, so the defaults are only used when it broke since.
+pub fn config() -> &'static Config {
+    static CONFIG: OnceLock<Config> = OnceLock::new();
+    CONFIG.get_or_init(|| {
+        load_config().unwrap_or_else(|err| {
+            log::error("config ignored", &[("err", &format!("{err:#}"))]);
+            Config::default()
+        })
+    })
+}
+
+/// Reads the config file; a missing file gives the defaults. A file that
+/// doesn't parse is an error naming the line and column, rather than
+/// silently turning settings such as `readOnly` back off.
+pub fn load_config() -> Result<Config> {
+    let path = config_path();
+    let data = match std::fs::read(&path) {
+        Ok(data) => data,
+        Err(err) if err.kind() == std::io::ErrorKind::NotFound => return Ok(Config::default()),
+        Err(err) => return Err(err).with_context(|| format!("read {}", path.display())),
+    };
+    serde_json::from_slice(&data).with_context(|| format!("invalid {}", path.display()))
+}
+
+pub fn config_path() -> PathBuf {
+    let base = std::env::var_os("XDG_CONFIG_HOME")
+        .map(PathBuf::from)
+        .unwrap_or_else(|| {
+            std::env::var_os("HOME")
+                .map(PathBuf::from)
+                .unwrap_or_else(|| PathBuf::from("."))
+                .join(".config")
+        });
+    base.join("agent-mux/config.json")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn reads_the_background_from_colorfgbg() {
+        assert!(light_background("0;15"));
+        assert!(light_background("0;default;7"));
+        assert!(!light_background("15;0"));
+        assert!(!light_background("7;8"));
+        assert!(!light_background("default;default"));
+    }
+}
@@ -0,0 +1,145 @@
+use std::path::Path;
+use std::process::Command;
+use std::sync::{Mutex, OnceLock};
+use std::time::{Duration, Instant};
+
+use crate::agent::config::config;
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt};
+use crate::agent::{Pane, expand_home};
+
+/// How long detected container mounts are trusted before `docker` is asked
+/// again.
+const MOUNTS_TTL: Duration = Duration::from_secs(60);
+
+/// `(container path, host path)` pairs.
+type Mounts = Vec<(String, String)>;
+
+const MOUNT_FORMAT: &str = r#"{{range .Mounts}}{{.Destination}}{{"\t"}}{{.Source}}{{"\n"}}{{end}}"#;
+
+/// Rewrites the paths of local panes that run inside a container (a
+/// devcontainer's `/workspaces/foo`, say) to the host directory mounted
+/// there, so git info and grouping work as for any other pane.
+pub fn map_pane_paths(panes: &mut [Pane]) {
+    let containers = &config().containers;
+    let mut detected: Option<Mounts> = None;
+    for p in panes.iter_mut() {
+        if !p.host.is_empty() || p.path.is_empty() || Path::new(&p.path).exists() {
+            continue;
+        }
+        let mapped = map_path(
+            containers
+                .paths
+                .iter()
+                .map(|(from, to)| (from.as_str(), expand_home(to))),
+            &p.path,
+        )
+        .or_else(|| {
+            if !containers.detect {
+                return None;
+            }
+            let mounts = detected.get_or_insert_with(docker_mounts);
+            map_path(
+                mounts.iter().map(|(from, to)| (from.as_str(), to.clone())),
+                &p.path,
+            )
+        });
+        if let Some(mapped) = mapped {
+            p.path = mapped;
+        }
+    }
+}
+
+/// Maps `path` through the longest `(container, host)` prefix it falls
+/// under.
+fn map_path<'a>(maps: impl Iterator<Item = (&'a str, String)>, path: &str) -> Option<String> {
+    maps.filter_map(|(from, to)| {
+        let from = from.trim_end_matches('/');
+        let rest = path.strip_prefix(from)?;
+        (rest.is_empty() || rest.starts_with('/')).then(|| (from.len(), format!("{to}{rest}")))
+    })
+    .max_by_key(|(len, _)| *len)
+    .map(|(_, mapped)| mapped)
+}
+
+fn docker_mounts() -> Mounts {
+    static CACHE: OnceLock<Mutex<Option<(Instant, Mounts)>>> = OnceLock::new();
+    let cache = CACHE.get_or_init(|| Mutex::new(None));
+    let Ok(mut cache) = cache.lock() else {
+        return Vec::new();
+    };
+    if let Some((at, mounts)) = cache.as_ref()
+        && at.elapsed() < MOUNTS_TTL
+    {
+        return mounts.clone();
+    }
+    let mounts = inspect_mounts();
+    *cache = Some((Instant::now(), mounts.clone()));
+    mounts
+}
+
+fn inspect_mounts() -> Mounts {
+    let Ok(out) = Command::new("docker")
+        .args(["ps", "-q"])
+        .output_within(COMMAND_TIMEOUT)
+    else {
+        return Vec::new();
+    };
+    let ids: Vec<String> = String::from_utf8_lossy(&out.stdout)
+        .split_whitespace()
+        .map(str::to_string)
+        .collect();
+    if !out.status.success() || ids.is_empty() {
+        return Vec::new();
+    }
+    let Ok(out) = Command::new("docker")
+        .args(["inspect", "--format", MOUNT_FORMAT])
+        .args(&ids)
+        .output_within(COMMAND_TIMEOUT)
+    else {
+        return Vec::new();
+    };
+    parse_mounts(&String::from_utf8_lossy(&out.stdout))
+}
+
+fn parse_mounts(out: &str) -> Mounts {
+    out.lines()
+        .filter_map(|line| {
+            let (destination, source) = line.split_once('\t')?;
+            (destination.starts_with('/') && source.starts_with('/'))
+                .then(|| (destination.to_string(), source.to_string()))
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{map_path, parse_mounts};
+
+    #[test]
+    fn maps_through_the_longest_matching_prefix() {
+        let maps = [
+            ("/workspaces", "/home/me/src".to_string()),
+            ("/workspaces/foo/", "/home/me/foo".to_string()),
+        ];
+        let map = |path| map_path(maps.iter().map(|(f, t)| (*f, t.clone())), path);
+        assert_eq!(
+            map("/workspaces/foo/lib").as_deref(),
+            Some("/home/me/foo/lib")
+        );
+        assert_eq!(map("/workspaces/foo").as_deref(), Some("/home/me/foo"));
+        assert_eq!(
+            map("/workspaces/foobar").as_deref(),
+            Some("/home/me/src/foobar")
+        );
+        assert_eq!(map("/srv/app"), None);
+    }
+
+    #[test]
+    fn parses_docker_mounts() {
+        let out = "/workspaces/foo\t/home/me/foo\n/data\tnamed-volume\n\n";
+        assert_eq!(
+            parse_mounts(out),
+            vec![("/workspaces/foo".to_string(), "/home/me/foo".to_string())]
+        );
+    }
+}
@@ -0,0 +1,143 @@
+use std::backtrace::Backtrace;
+use std::collections::VecDeque;
+use std::fs::{self, OpenOptions};
+use std::io::Write;
+use std::panic::{self, PanicHookInfo};
+use std::path::PathBuf;
+use std::sync::Mutex;
+use std::sync::atomic::{AtomicBool, Ordering};
+
+use crossterm::event::DisableMouseCapture;
+use crossterm::terminal::{LeaveAlternateScreen, disable_raw_mode};
+use crossterm::{cursor, execute};
+
+use crate::agent::persist::state_dir;
+
+const RECENT_EVENTS: usize = 64;
+
+static RECENT: Mutex<VecDeque<String>> = Mutex::new(VecDeque::new());
+static TERMINAL_ACTIVE: AtomicBool = AtomicBool::new(false);
+
+pub fn crash_log_path() -> PathBuf {
+    state_dir().join("crash.log")
+}
+
+pub fn record(event: impl Into<String>) {
+    let Ok(mut recent) = RECENT.lock() else {
+        return;
+    };
+    if recent.len() == RECENT_EVENTS {
+        recent.pop_front();
+    }
+    recent.push_back(format!(
+        "{} {}",
+        chrono::Utc::now().format("%H:%M:%S%.3f"),
+        event.into()
+    ));
+}
+
+pub fn set_terminal_active(active: bool) {
+    TERMINAL_ACTIVE.store(active, Ordering::SeqCst);
+}
+
+pub fn install() {
+    let default_hook = panic::take_hook();
+    panic::set_hook(Box::new(move |info| {
+        if TERMINAL_ACTIVE.swap(false, Ordering::SeqCst) {
+            restore_terminal();
+        }
+        let report = crash_report(info, &Backtrace::force_capture());
+        match write_crash_log(&report) {
+            Ok(path) => eprintln!(
+                "agent-mux crashed: {}\ndetails written to {}",
+                panic_message(info),
+                path.display()
+            ),
+            Err(_) => default_hook(info),
+        }
+    }));
+}
+
+fn restore_terminal() {
+    let mut stdout = std::io::stdout();
+    let _ = execute!(
+        stdout,
+        DisableMouseCapture,
+        LeaveAlternateScreen,
+        cursor::Show
+    );
+    let _ = disable_raw_mode();
+}
+
+fn crash_report(info: &PanicHookInfo<'_>, backtrace: &Backtrace) -> String {
+    let location = info
+        .location()
+        .map(|loc| format!("{}:{}:{}", loc.file(), loc.line(), loc.column()))
+        .unwrap_or_default();
+    let thread = std::thread::current();
+    let recent = RECENT
+        .lock()
+        .map(|recent| recent.iter().cloned().collect::<Vec<_>>())
+        .unwrap_or_default();
+    format_report(
+        &panic_message(info),
+        &location,
+        thread.name().unwrap_or("<unnamed>"),
+        &backtrace.to_string(),
+        &recent,
+    )
+}
+
+fn format_report(
+    message: &str,
+    location: &str,
+    thread: &str,
+    backtrace: &str,
+    recent: &[String],
+) -> String {
+    let mut report = format!(
+        "=== {} agent-mux {} crashed\nthread '{thread}' panicked at {location}:\n{message}\n\nbacktrace:\n{backtrace}\n",
+        chrono::Utc::now().to_rfc3339(),
+        env!("CARGO_PKG_VERSION"),
+    );
+    report.push_str("\nrecent events:\n");
+    for event in recent {
+        report.push_str(event);
+        report.push('\n');
+    }
+    report
+}
+
+fn panic_message(info: &PanicHookInfo<'_>) -> String {
+    if let Some(message) = info.payload().downcast_ref::<&str>() {
+        message.to_string()
+    } else if let Some(message) = info.payload().downcast_ref::<String>() {
+        message.clone()
+    } else {
+        "unknown panic".to_string()
+    }
+}
+
+fn write_crash_log(report: &str) -> std::io::Result<PathBuf> {
+    fs::create_dir_all(state_dir())?;
+    let path = crash_log_path();
+    let mut file = OpenOptions::new().create(true).append(true).open(&path)?;
+    writeln!(file, "{report}")?;
+    Ok(path)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn report_includes_location_and_recent_events() {
+        let recent = vec!["12:00:00.000 key Char('s')".to_string()];
+
+        let report = format_report("boom", "src/tui.rs:10:5", "main", "<frames>", &recent);
+
+        assert!(report.contains("thread 'main' panicked at src/tui.rs:10:5:\nboom"));
+        assert!(report.contains("backtrace:\n<frames>"));
+        assert!(report.ends_with("recent events:\n12:00:00.000 key Char('s')\n"));
+    }
+}
@@ -0,0 +1,230 @@
+use std::collections::BTreeMap;
+use std::fmt::Write as _;
+use std::fs::{self, File};
+use std::path::PathBuf;
+use std::process::{Command, Stdio};
+use std::time::{Duration, Instant};
+
+use anyhow::{Context, Result, bail};
+use chrono::{DateTime, Local, NaiveTime, Utc};
+
+use crate::agent::config::config;
+use crate::agent::events::StatusChange;
+use crate::agent::exec::RunExt;
+use crate::agent::persist::state_dir;
+use crate::agent::{PaneStatus, journal, log};
+
+const CHECK_INTERVAL: Duration = Duration::from_secs(60);
+const SEND_TIMEOUT: Duration = Duration::from_secs(30);
+
+/// The last digest sent; its mtime marks where the next one starts.
+fn digest_path() -> PathBuf {
+    state_dir().join("digest.txt")
+}
+
+/// Sends one summary of the day's finished, attention and error events at
+/// `digest.at` instead of a notification for each.
+#[derive(Debug, Default)]
+pub struct DigestSender {
+    checked: Option<Instant>,
+}
+
+impl DigestSender {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn run(&mut self) {
+        let settings = &config().digest;
+        if !settings.enabled || self.checked.is_some_and(|at| at.elapsed() < CHECK_INTERVAL) {
+            return;
+        }
+        self.checked = Some(Instant::now());
+        let Ok(at) = NaiveTime::parse_from_str(&settings.at, "%H:%M") else {
+            log::warn("bad digest time", &[("at", &settings.at)]);
+            return;
+        };
+        let now = Local::now();
+        let Some(due) = now.with_time(at).single() else {
+            return;
+        };
+        let last = last_sent();
+        if now < due || last.is_some_and(|last| last >= due) {
+            return;
+        }
+        let since = last.unwrap_or_else(|| now - chrono::Duration::days(1));
+        std::thread::spawn(move || {
+            if let Err(err) = send(since.with_timezone(&Utc)) {
+                log::warn("digest failed", &[("err", &format!("{err:#}"))]);
+            }
+        });
+    }
+}
+
+fn last_sent() -> Option<DateTime<Local>> {
+    let modified = fs::metadata(digest_path()).ok()?.modified().ok()?;
+    Some(modified.into())
+}
+
+/// Builds the digest of everything since `since` and pipes it to
+/// `digest.command`, even when nothing happened, so the next one starts
+/// from now.
+pub fn send(since: DateTime<Utc>) -> Result<()> {
+    let command = &config().digest.command;
+    if command.is_empty() {
+        bail!("digest.command is not set");
+    }
+    let body = digest(&journal::since(since));
+    fs::create_dir_all(state_dir()).context("create state dir")?;
+    fs::write(digest_path(), &body).context("write digest")?;
+    let status = Command::new("sh")
+        .arg("-c")
+        .arg(command)
+        .env("AGENT_MUX_SUBJECT", subject())
+        .stdin(File::open(digest_path()).context("open digest")?)
+        .stdout(Stdio::null())
+        .stderr(Stdio::null())
+        .status_within(SEND_TIMEOUT)
+        .context("run digest command")?;
+    if !status.success() {
+        bail!("digest command exited with {status}");
+    }
+    Ok(())
+}
+
+pub fn subject() -> String {
+    format!("agent-mux digest for {}", Local::now().format("%a %-d %b"))
+}
+
+/// One line of totals, then each workspace with what each of its agents
+/// did.
+pub fn digest(changes: &[StatusChange]) -> String {
+    let mut totals = Counts::default();
+    let mut workspaces: BTreeMap<&str, BTreeMap<(&str, &str), Counts>> = BTreeMap::new();
+    for change in changes {
+        let pane = workspaces
+            .entry(change.path.as_str())
+            .or_default()
+            .entry((change.provider.as_str(), change.target.as_str()))
+            .or_default();
+        if pane.add(change) {
+            totals.add(change);
+        }
+    }
+    if totals.is_empty() {
+        return "No agent finished, needed attention or failed.\n".to_string();
+    }
+    let mut out = format!("{}\n", totals.summary());
+    for (path, panes) in workspaces {
+        let panes: Vec<_> = panes.iter().filter(|(_, c)| !c.is_empty()).collect();
+        if panes.is_empty() {
+            continue;
+        }
+        let _ = writeln!(out, "\n{}", shorten_home(path));
+        for ((provider, target), counts) in panes {
+            let last = counts
+                .last
+                .map(|at| at.with_timezone(&Local).format("%H:%M").to_string())
+                .unwrap_or_default();
+            let _ = writeln!(
+                out,
+                "  {provider} {target}: {}, last {last}",
+                counts.summary()
+            );
+        }
+    }
+    out
+}
+
+#[derive(Debug, Default)]
+struct Counts {
+    finished: usize,
+    attention: usize,
+    errors: usize,
+    last: Option<DateTime<Utc>>,
+}
+
+impl Counts {
+    fn add(&mut self, change: &StatusChange) -> bool {
+        match change.to {
+            PaneStatus::Unread => self.finished += 1,
+            PaneStatus::NeedsAttention => self.attention += 1,
+            PaneStatus::Error => self.errors += 1,
+            _ => return false,
+        }
+        self.last = Some(change.at);
+        true
+    }
+
+    fn is_empty(&self) -> bool {
+        self.finished + self.attention + self.errors == 0
+    }
+
+    fn summary(&self) -> String {
+        [
+            (self.finished, "finished"),
+            (self.attention, "needed attention"),
+            (self.errors, "failed"),
+        ]
+        .iter()
+        .filter(|(count, _)| *count > 0)
+        .map(|(count, label)| format!("{count} {label}"))
+        .collect::<Vec<_>>()
+        .join(", ")
+    }
+}
+
+fn shorten_home(path: &str) -> String {
+    match std::env::var("HOME") {
+        Ok(home) if !home.is_empty() && path.starts_with(&home) => {
+            format!("~{}", &path[home.len()..])
+        }
+        _ => path.to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use chrono::{TimeZone, Utc};
+
+    use super::digest;
+    use crate::agent::PaneStatus;
+    use crate::agent::events::StatusChange;
+
+    fn change(target: &str, path: &str, to: PaneStatus, minute: u32) -> StatusChange {
+        StatusChange {
+            pane_id: target.to_string(),
+            target: target.to_string(),
+            provider: "claude".to_string(),
+            path: path.to_string(),
+            from: Some(PaneStatus::Busy),
+            to,
+            at: Utc.with_ymd_and_hms(2026, 3, 2, 14, minute, 0).unwrap(),
+        }
+    }
+
+    #[test]
+    fn sums_events_per_workspace_and_agent() {
+        let changes = [
+            change("s:1.1", "/src/api", PaneStatus::Busy, 0),
+            change("s:1.1", "/src/api", PaneStatus::Unread, 5),
+            change("s:1.1", "/src/api", PaneStatus::NeedsAttention, 9),
+            change("s:2.1", "/src/web", PaneStatus::Error, 12),
+            change("s:3.1", "/src/docs", PaneStatus::Idle, 20),
+        ];
+        let text = digest(&changes);
+        let lines: Vec<&str> = text.lines().collect();
+
+        assert_eq!(lines[0], "1 finished, 1 needed attention, 1 failed");
+        assert_eq!(lines[2], "/src/api");
+        assert!(lines[3].starts_with("  claude s:1.1: 1 finished, 1 needed attention, last "));
+        assert_eq!(lines[5], "/src/web");
+        assert!(!text.contains("/src/docs"));
+    }
+
+    #[test]
+    fn says_so_when_nothing_happened() {
+        let changes = [change("s:1.1", "/src/api", PaneStatus::Busy, 0)];
+        assert!(digest(&changes).starts_with("No agent"));
+    }
+}
@@ -0,0 +1,103 @@
+use std::path::Path;
+use std::process::Command;
+
+use anyhow::{Context, Result, anyhow, bail};
+
+use crate::agent::config::config;
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt};
+use crate::agent::git::modified_files;
+use crate::agent::remote::shell_join;
+use crate::agent::{Pane, tmux};
+
+pub fn open_workspace(pane: &Pane, with_files: bool, new_window: bool) -> Result<()> {
+    if !pane.host.is_empty() {
+        bail!("cannot open remote workspace {}", pane.path);
+    }
+    let files = if with_files {
+        modified_files(&pane.path)
+    } else {
+        Vec::new()
+    };
+    if !config().editor_uri.is_empty() {
+        return open_uris(&pane.path, &files);
+    }
+
+    let editor = std::env::var("VISUAL")
+        .or_else(|_| std::env::var("EDITOR"))
+        .unwrap_or_else(|_| "vi".to_string());
+    let mut args: Vec<&str> = files.iter().map(String::as_str).collect();
+    if args.is_empty() {
+        args.push(".");
+    }
+    let command = format!("{editor} {}", shell_join(&args));
+    let status = if new_window {
+        tmux::tmux()
+            .args(["new-window", "-c", &pane.path, &command])
+            .status_within(COMMAND_TIMEOUT)
+            .context("tmux new-window")?
+    } else {
+        Command::new("sh")
+            .arg("-c")
+            .arg(&command)
+            .current_dir(&pane.path)
+            .status()
+            .with_context(|| format!("run {editor}"))?
+    };
+    if status.success() {
+        Ok(())
+    } else {
+        Err(anyhow!("editor exited with {status}"))
+    }
+}
+
+fn open_uris(root: &str, files: &[String]) -> Result<()> {
+    let paths: Vec<String> = if files.is_empty() {
+        vec![root.to_string()]
+    } else {
+        files
+            .iter()
+            .map(|file| Path::new(root).join(file).to_string_lossy().into_owned())
+            .collect()
+    };
+    let opener = if cfg!(target_os = "macos") {
+        "open"
+    } else {
+        "xdg-open"
+    };
+    for path in paths {
+        let uri = config().editor_uri.replace("{path}", &uri_path(&path));
+        let status = Command::new(opener)
+            .arg(&uri)
+            .status_within(COMMAND_TIMEOUT)
+            .with_context(|| format!("{opener} {uri}"))?;
+        if !status.success() {
+            bail!("{opener} {uri} exited with {status}");
+        }
+    }
+    Ok(())
+}
+
+/// `path` percent-encoded for a URI, keeping its slashes.
+fn uri_path(path: &str) -> String {
+    let mut out = String::with_capacity(path.len());
+    for byte in path.bytes() {
+        if byte.is_ascii_alphanumeric() || b"/-._~".contains(&byte) {
+            out.push(byte as char);
+        } else {
+            out.push_str(&format!("%{byte:02X}"));
+        }
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn encodes_paths_for_editor_uris() {
+        assert_eq!(uri_path("/src/api/main.rs"), "/src/api/main.rs");
+        assert_eq!(uri_path("/src/my app/#1?.rs"), "/src/my%20app/%231%3F.rs");
+        assert_eq!(uri_path("/src/café"), "/src/caf%C3%A9");
+    }
+}
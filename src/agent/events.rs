@@ -0,0 +1,181 @@
+use std::collections::HashMap;
+
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+
+use crate::agent::{Pane, PaneStatus};
+
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct StatusChange {
+    pub pane_id: String,
+    pub target: String,
+    pub provider: String,
+    pub path: String,
+    pub from: Option<PaneStatus>,
+    pub to: PaneStatus,
+    pub at: DateTime<Utc>,
+}
+
+impl StatusChange {
+    pub fn from_pane(pane: &Pane, from: Option<PaneStatus>, at: DateTime<Utc>) -> Self {
+        Self {
+            pane_id: pane.pane_id.clone(),
+            target: pane.target.clone(),
+            provider: pane.provider.clone(),
+            path: pane.path.clone(),
+            from,
+            to: pane.status,
+            at,
+        }
+    }
+}
+
+/// Something the watcher noticed. It works events out once per poll and
+/// hands the same list to the journal, notifications, hooks, finish
+/// triggers and socket subscribers, so none of them diff pane state
+/// themselves.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(tag = "type", rename_all = "snake_case")]
+pub enum Event {
+    PaneAdded {
+        #[serde(rename = "paneId")]
+        pane_id: String,
+        target: String,
+        provider: String,
+    },
+    PaneRemoved {
+        #[serde(rename = "paneId")]
+        pane_id: String,
+        target: String,
+    },
+    /// Also sent for a new pane, with no `from`.
+    StatusChanged(StatusChange),
+    /// Refreshes started failing; sent once until one succeeds again.
+    Error { message: String, at: DateTime<Utc> },
+}
+
+impl Event {
+    pub fn status_change(&self) -> Option<&StatusChange> {
+        match self {
+            Self::StatusChanged(change) => Some(change),
+            _ => None,
+        }
+    }
+}
+
+pub fn status_changes(events: &[Event]) -> impl Iterator<Item = &StatusChange> {
+    events.iter().filter_map(Event::status_change)
+}
+
+#[derive(Debug, Default)]
+pub struct EventBus {
+    seeded: bool,
+    prev: HashMap<String, (PaneStatus, String)>,
+    failing: bool,
+}
+
+impl EventBus {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// The events between the last poll's panes and these. The first call
+    /// only remembers them.
+    pub fn update(&mut self, panes: &[Pane]) -> Vec<Event> {
+        let now = Utc::now();
+        let mut events = Vec::new();
+        let mut next = HashMap::with_capacity(panes.len());
+        for pane in panes {
+            let from = self.prev.remove(&pane.pane_id).map(|(status, _)| status);
+            if self.seeded && from.is_none() {
+                events.push(Event::PaneAdded {
+                    pane_id: pane.pane_id.clone(),
+                    target: pane.target.clone(),
+                    provider: pane.provider.clone(),
+                });
+            }
+            if self.seeded && from != Some(pane.status) {
+                events.push(Event::StatusChanged(StatusChange::from_pane(
+                    pane, from, now,
+                )));
+            }
+            next.insert(pane.pane_id.clone(), (pane.status, pane.target.clone()));
+        }
+        if self.seeded {
+            let mut removed: Vec<_> = self.prev.drain().collect();
+            removed.sort_by(|a, b| a.0.cmp(&b.0));
+            events.extend(
+                removed
+                    .into_iter()
+                    .map(|(pane_id, (_, target))| Event::PaneRemoved { pane_id, target }),
+            );
+        }
+        self.prev = next;
+        self.seeded = true;
+        events
+    }
+
+    /// An `Error` event when refreshes start failing.
+    pub fn refreshed(&mut self, error: Option<&str>) -> Option<Event> {
+        let started = error.is_some() && !self.failing;
+        self.failing = error.is_some();
+        started.then(|| Event::Error {
+            message: error.unwrap_or_default().to_string(),
+            at: Utc::now(),
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn pane(id: &str, status: PaneStatus) -> Pane {
+        Pane {
+            pane_id: id.to_string(),
+            target: format!("s:1.{id}"),
+            status,
+            ..Pane::default()
+        }
+    }
+
+    #[test]
+    fn first_update_only_seeds() {
+        let mut bus = EventBus::new();
+
+        assert!(bus.update(&[pane("%1", PaneStatus::Busy)]).is_empty());
+    }
+
+    #[test]
+    fn reports_transitions_and_new_panes() {
+        let mut bus = EventBus::new();
+        bus.update(&[pane("%1", PaneStatus::Busy)]);
+
+        let events = bus.update(&[pane("%1", PaneStatus::Unread), pane("%2", PaneStatus::Idle)]);
+        let changes: Vec<_> = status_changes(&events).collect();
+
+        assert_eq!(changes.len(), 2);
+        assert_eq!(changes[0].from, Some(PaneStatus::Busy));
+        assert_eq!(changes[0].to, PaneStatus::Unread);
+        assert_eq!(changes[1].from, None);
+        assert!(matches!(&events[1], Event::PaneAdded { pane_id, .. } if pane_id == "%2"));
+        assert_eq!(
+            bus.update(&[pane("%1", PaneStatus::Unread)]),
+            vec![Event::PaneRemoved {
+                pane_id: "%2".to_string(),
+                target: "s:1.%2".to_string(),
+            }]
+        );
+    }
+
+    #[test]
+    fn errors_once_until_refreshes_recover() {
+        let mut bus = EventBus::new();
+
+        assert!(bus.refreshed(Some("tmux")).is_some());
+        assert!(bus.refreshed(Some("tmux")).is_none());
+        assert!(bus.refreshed(None).is_none());
+        assert!(bus.refreshed(Some("tmux")).is_some());
+    }
+}
@@ -0,0 +1,122 @@
+use std::io::{self, Read};
+use std::process::{Child, Command, ExitStatus, Output, Stdio};
+use std::sync::mpsc;
+use std::thread;
+use std::time::{Duration, Instant};
+
+use crate::agent::log;
+
+pub const COMMAND_TIMEOUT: Duration = Duration::from_secs(3);
+pub const GIT_TIMEOUT: Duration = Duration::from_secs(5);
+pub const SSH_TIMEOUT: Duration = Duration::from_secs(10);
+
+pub trait RunExt {
+    fn output_within(&mut self, timeout: Duration) -> io::Result<Output>;
+    fn status_within(&mut self, timeout: Duration) -> io::Result<ExitStatus>;
+    /// Starts a user command that may run for a while. A background thread
+    /// waits for it and logs a warning labelled `label` if it fails.
+    fn spawn_reaped(&mut self, label: &str) -> io::Result<()>;
+}
+
+impl RunExt for Command {
+    fn output_within(&mut self, timeout: Duration) -> io::Result<Output> {
+        let deadline = Instant::now() + timeout;
+        let mut child = self
+            .stdin(Stdio::null())
+            .stdout(Stdio::piped())
+            .stderr(Stdio::piped())
+            .spawn()?;
+        let stdout = child.stdout.take().map(read_in_background);
+        let stderr = child.stderr.take().map(read_in_background);
+        let status = wait_until(&mut child, deadline, timeout)?;
+        Ok(Output {
+            status,
+            stdout: stdout.map(|rx| collect(rx, deadline)).unwrap_or_default(),
+            stderr: stderr.map(|rx| collect(rx, deadline)).unwrap_or_default(),
+        })
+    }
+
+    fn status_within(&mut self, timeout: Duration) -> io::Result<ExitStatus> {
+        let deadline = Instant::now() + timeout;
+        let mut child = self.spawn()?;
+        wait_until(&mut child, deadline, timeout)
+    }
+
+    fn spawn_reaped(&mut self, label: &str) -> io::Result<()> {
+        let mut child = self.stdin(Stdio::null()).spawn()?;
+        let label = label.to_string();
+        thread::spawn(move || match child.wait() {
+            Ok(status) if !status.success() => {
+                log::warn("command failed", &[("cmd", &label), ("status", &status)])
+            }
+            Ok(_) => {}
+            Err(err) => log::warn("command failed", &[("cmd", &label), ("err", &err)]),
+        });
+        Ok(())
+    }
+}
+
+fn read_in_background(mut pipe: impl Read + Send + 'static) -> mpsc::Receiver<Vec<u8>> {
+    let (tx, rx) = mpsc::channel();
+    thread::spawn(move || {
+        let mut data = Vec::new();
+        let _ = pipe.read_to_end(&mut data);
+        let _ = tx.send(data);
+    });
+    rx
+}
+
+fn collect(rx: mpsc::Receiver<Vec<u8>>, deadline: Instant) -> Vec<u8> {
+    let remaining = deadline
+        .saturating_duration_since(Instant::now())
+        .max(Duration::from_millis(10));
+    rx.recv_timeout(remaining).unwrap_or_default()
+}
+
+fn wait_until(child: &mut Child, deadline: Instant, timeout: Duration) -> io::Result<ExitStatus> {
+    let mut delay = Duration::from_millis(1);
+    loop {
+        if let Some(status) = child.try_wait()? {
+            return Ok(status);
+        }
+        if Instant::now() >= deadline {
+            let _ = child.kill();
+            let _ = child.wait();
+            return Err(io::Error::new(
+                io::ErrorKind::TimedOut,
+                format!("timed out after {}ms", timeout.as_millis()),
+            ));
+        }
+        thread::sleep(delay);
+        delay = (delay * 2).min(Duration::from_millis(20));
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn collects_output_of_fast_commands() {
+        let out = Command::new("sh")
+            .args(["-c", "echo hi; echo err >&2"])
+            .output_within(COMMAND_TIMEOUT)
+            .unwrap();
+
+        assert!(out.status.success());
+        assert_eq!(out.stdout, b"hi\n");
+        assert_eq!(out.stderr, b"err\n");
+    }
+
+    #[test]
+    fn kills_commands_that_exceed_the_timeout() {
+        let start = Instant::now();
+        let err = Command::new("sleep")
+            .arg("5")
+            .output_within(Duration::from_millis(50))
+            .unwrap_err();
+
+        assert_eq!(err.kind(), io::ErrorKind::TimedOut);
+        assert!(start.elapsed() < Duration::from_secs(2));
+    }
+}
@@ -3,9 +3,15 @@ use std::fs;
 use std::path::{Path, PathBuf};
 use std::process::Command;
 use std::sync::{Mutex, OnceLock};
-use std::time::SystemTime;
+use std::time::{Duration, Instant, SystemTime};
 
-use crate::agent::Pane;
+use anyhow::{Context, Result, bail};
+use chrono::{DateTime, Utc};
+use serde::Serialize;
+
+use crate::agent::config::config;
+use crate::agent::exec::{GIT_TIMEOUT, RunExt};
+use crate::agent::{Pane, container, log, mounts, remote};
 
 #[derive(Clone, Debug)]
 struct DirtyEntry {
@@ -13,7 +19,22 @@ struct DirtyEntry {
     dirty: bool,
 }
 
+/// Checking out a new worktree or committing through hooks can take a while.
+const WRITE_TIMEOUT: Duration = Duration::from_secs(60);
+
+/// A `git status` this slow marks its directory as on a slow filesystem.
+const SLOW_STATUS: Duration = Duration::from_secs(2);
+
 static DIRTY_CACHE: OnceLock<Mutex<HashMap<String, DirtyEntry>>> = OnceLock::new();
+type SlowEntry = (Instant, String, String);
+static SLOW_CACHE: OnceLock<Mutex<HashMap<String, SlowEntry>>> = OnceLock::new();
+
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Commit {
+    pub hash: String,
+    pub at: DateTime<Utc>,
+    pub subject: String,
+}
 
 pub fn enrich_panes_fast(panes: &mut [Pane]) {
     let _g = smelt_perf::perf::begin("git.enrich_panes_fast");
@@ -26,41 +47,71 @@ pub fn enrich_panes(panes: &mut [Pane]) {
 }
 
 fn enrich_panes_with(panes: &mut [Pane], include_dirty: bool) {
-    let mut unique: HashMap<String, WsInfo> = HashMap::new();
+    container::map_pane_paths(panes);
+    let mut unique: HashMap<(String, String), WsInfo> = HashMap::new();
     for p in panes.iter() {
-        unique.entry(p.path.clone()).or_insert_with(|| WsInfo {
-            short_path: shorten(&p.path),
-            project_root: String::new(),
-            project_short: String::new(),
-            git_branch: String::new(),
-            git_dirty: None,
-        });
+        unique
+            .entry((p.host.clone(), p.path.clone()))
+            .or_insert_with(|| WsInfo {
+                short_path: if p.host.is_empty() {
+                    shorten(&p.path)
+                } else {
+                    format!("{}:{}", p.host, shorten(&p.path))
+                },
+                project_root: String::new(),
+                project_short: String::new(),
+                git_branch: String::new(),
+                git_dirty: None,
+            });
     }
 
     smelt_perf::perf::record_value("git.unique_paths", unique.len() as u64);
-    for (path, info) in unique.iter_mut() {
-        info.git_branch = git_branch(path);
-        if include_dirty {
+    for ((host, path), info) in unique.iter_mut() {
+        if !host.is_empty() {
+            let host = remote::remote_host(host);
+            info.git_branch = remote::git_branch(host, path);
+            if include_dirty {
+                info.git_dirty = Some(remote::git_dirty(host, path));
+            }
+            info.project_root = path.clone();
+            info.project_short = info.short_path.clone();
+            continue;
+        }
+        if mounts::is_slow(path) {
+            (info.project_root, info.git_branch) = slow_metadata(path);
+        } else {
+            info.project_root = project_root(path);
+            info.git_branch = git_branch(path);
+        }
+        if include_dirty && checks_dirty(path) {
             info.git_dirty = Some(git_dirty(path));
         }
-        info.project_root = project_root(path);
         info.project_short = shorten(&info.project_root);
     }
 
-    let mut projects: HashMap<String, (String, Option<bool>)> = HashMap::new();
-    for info in unique.values() {
+    let mut projects: HashMap<(String, String), (String, Option<bool>)> = HashMap::new();
+    for ((host, _), info) in &unique {
         projects
-            .entry(info.project_root.clone())
+            .entry((host.clone(), info.project_root.clone()))
             .or_insert_with(|| {
+                if !host.is_empty() {
+                    return (info.git_branch.clone(), info.git_dirty);
+                }
+                let root = &info.project_root;
+                let branch = if mounts::is_slow(root) {
+                    slow_metadata(root).1
+                } else {
+                    git_branch(root)
+                };
                 (
-                    git_branch(&info.project_root),
-                    include_dirty.then(|| git_dirty(&info.project_root)),
+                    branch,
+                    (include_dirty && checks_dirty(root)).then(|| git_dirty(root)),
                 )
             });
     }
 
     for p in panes.iter_mut() {
-        if let Some(info) = unique.get(&p.path) {
+        if let Some(info) = unique.get(&(p.host.clone(), p.path.clone())) {
             p.short_path = info.short_path.clone();
             p.project_root = info.project_root.clone();
             p.project_short = info.project_short.clone();
@@ -68,7 +119,9 @@ fn enrich_panes_with(panes: &mut [Pane], include_dirty: bool) {
             if let Some(dirty) = info.git_dirty {
                 p.git_dirty = dirty;
             }
-            if let Some((branch, dirty)) = projects.get(&info.project_root) {
+            if let Some((branch, dirty)) =
+                projects.get(&(p.host.clone(), info.project_root.clone()))
+            {
                 p.project_branch = branch.clone();
                 if let Some(dirty) = dirty {
                     p.project_dirty = *dirty;
@@ -78,6 +131,34 @@ fn enrich_panes_with(panes: &mut [Pane], include_dirty: bool) {
     }
 }
 
+/// Whether to run `git status` in `dir`, which a slow filesystem makes
+/// too costly unless `slowPaths.dirty` asks for it.
+fn checks_dirty(dir: &str) -> bool {
+    config().slow_paths.dirty || !mounts::is_slow(dir)
+}
+
+/// The project root and branch of a directory on a slow filesystem, read
+/// at most every `slowPaths.cacheSecs`.
+fn slow_metadata(dir: &str) -> (String, String) {
+    let ttl = Duration::from_secs(config().slow_paths.cache_secs);
+    let cache = SLOW_CACHE.get_or_init(|| Mutex::new(HashMap::new()));
+    if let Ok(cache) = cache.lock()
+        && let Some((at, root, branch)) = cache.get(dir)
+        && at.elapsed() < ttl
+    {
+        return (root.clone(), branch.clone());
+    }
+    let root = project_root(dir);
+    let branch = git_branch(dir);
+    if let Ok(mut cache) = cache.lock() {
+        cache.insert(
+            dir.to_string(),
+            (Instant::now(), root.clone(), branch.clone()),
+        );
+    }
+    (root, branch)
+}
+
 #[derive(Debug)]
 struct WsInfo {
     short_path: String,
@@ -193,16 +274,23 @@ fn git_dirty(dir: &str) -> bool {
         return entry.dirty;
     }
 
+    let started = Instant::now();
     let dirty = {
         let _g = smelt_perf::perf::begin("git.status");
         Command::new("git")
             .arg("status")
             .arg("--porcelain")
             .current_dir(dir)
-            .output()
+            .output_within(GIT_TIMEOUT)
             .map(|out| !String::from_utf8_lossy(&out.stdout).trim().is_empty())
-            .unwrap_or(false)
+            .unwrap_or_else(|err| {
+                log::warn("git status failed", &[("dir", &dir), ("err", &err)]);
+                false
+            })
     };
+    if started.elapsed() >= SLOW_STATUS {
+        mounts::mark_slow(dir);
+    }
 
     if let Ok(mut cache) = cache.lock() {
         cache.insert(
@@ -216,6 +304,151 @@ fn git_dirty(dir: &str) -> bool {
     dirty
 }
 
+pub fn modified_files(dir: &str) -> Vec<String> {
+    let Ok(out) = Command::new("git")
+        .args(["status", "--porcelain", "--untracked-files=all"])
+        .current_dir(dir)
+        .output_within(GIT_TIMEOUT)
+        .inspect_err(|err| log::warn("git status failed", &[("dir", &dir), ("err", err)]))
+    else {
+        return Vec::new();
+    };
+    parse_porcelain_paths(&String::from_utf8_lossy(&out.stdout))
+}
+
+/// Commits reachable from `dir`'s HEAD that were committed after `since`,
+/// newest first.
+pub fn commits_since(dir: &str, since: DateTime<Utc>) -> Vec<Commit> {
+    let Ok(out) = Command::new("git")
+        .arg("log")
+        .arg(format!("--since={}", since.to_rfc3339()))
+        .arg("--format=%h%x09%cI%x09%s")
+        .current_dir(dir)
+        .output_within(GIT_TIMEOUT)
+        .inspect_err(|err| log::warn("git log failed", &[("dir", &dir), ("err", err)]))
+    else {
+        return Vec::new();
+    };
+    parse_log(&String::from_utf8_lossy(&out.stdout))
+}
+
+/// The top directory of the repository `dir` is in.
+pub fn toplevel(dir: &str) -> Result<String> {
+    let out = Command::new("git")
+        .args(["rev-parse", "--show-toplevel"])
+        .current_dir(dir)
+        .output_within(GIT_TIMEOUT)
+        .context("git rev-parse")?;
+    if !out.status.success() {
+        bail!("{dir} is not in a git repository");
+    }
+    Ok(String::from_utf8_lossy(&out.stdout).trim().to_string())
+}
+
+/// Checks out a new `branch` from `root`'s HEAD into `path`.
+pub fn add_worktree(root: &str, branch: &str, path: &str) -> Result<()> {
+    let out = Command::new("git")
+        .args(["worktree", "add", "-b", branch, path])
+        .current_dir(root)
+        .output_within(WRITE_TIMEOUT)
+        .context("git worktree add")?;
+    if !out.status.success() {
+        bail!(
+            "git worktree add failed: {}",
+            String::from_utf8_lossy(&out.stderr).trim()
+        );
+    }
+    Ok(())
+}
+
+/// Undoes `add_worktree`: removes the worktree at `path` and deletes
+/// `branch`.
+pub fn remove_worktree(root: &str, branch: &str, path: &str) -> Result<()> {
+    for args in [
+        &["worktree", "remove", "--force", path][..],
+        &["branch", "-D", branch][..],
+    ] {
+        let out = Command::new("git")
+            .args(args)
+            .current_dir(root)
+            .output_within(WRITE_TIMEOUT)
+            .with_context(|| format!("git {}", args[..2].join(" ")))?;
+        if !out.status.success() {
+            bail!(
+                "git {} failed: {}",
+                args[..2].join(" "),
+                String::from_utf8_lossy(&out.stderr).trim()
+            );
+        }
+    }
+    Ok(())
+}
+
+/// Uncommitted changes to tracked files in `dir`, as a patch.
+pub fn diff(dir: &str) -> String {
+    let Ok(out) = Command::new("git")
+        .args(["diff", "HEAD", "--no-color", "--no-ext-diff"])
+        .current_dir(dir)
+        .output_within(GIT_TIMEOUT)
+        .inspect_err(|err| log::warn("git diff failed", &[("dir", &dir), ("err", err)]))
+    else {
+        return String::new();
+    };
+    String::from_utf8_lossy(&out.stdout).into_owned()
+}
+
+/// Commits everything in `dir`, untracked files included, and returns the
+/// new commit's short hash.
+pub fn commit_all(dir: &str, message: &str) -> Result<String> {
+    let run = |args: &[&str]| -> Result<String> {
+        let out = Command::new("git")
+            .args(args)
+            .current_dir(dir)
+            .output_within(WRITE_TIMEOUT)
+            .with_context(|| format!("git {}", args[0]))?;
+        if !out.status.success() {
+            bail!(
+                "git {} failed: {}",
+                args[0],
+                String::from_utf8_lossy(&out.stderr).trim()
+            );
+        }
+        Ok(String::from_utf8_lossy(&out.stdout).trim().to_string())
+    };
+    run(&["add", "-A"])?;
+    run(&["commit", "-q", "-m", message])?;
+    run(&["rev-parse", "--short", "HEAD"])
+}
+
+fn parse_log(out: &str) -> Vec<Commit> {
+    out.lines()
+        .filter_map(|line| {
+            let mut fields = line.splitn(3, '\t');
+            let hash = fields.next()?.to_string();
+            let at = DateTime::parse_from_rfc3339(fields.next()?).ok()?;
+            Some(Commit {
+                hash,
+                at: at.with_timezone(&Utc),
+                subject: fields.next().unwrap_or_default().to_string(),
+            })
+        })
+        .collect()
+}
+
+fn parse_porcelain_paths(out: &str) -> Vec<String> {
+    out.lines()
+        .filter(|line| line.len() > 3 && !line.starts_with(" D") && !line.starts_with("D "))
+        .map(|line| {
+            let path = &line[3..];
+            path.rsplit_once(" -> ")
+                .map(|(_, to)| to)
+                .unwrap_or(path)
+                .trim_matches('"')
+                .to_string()
+        })
+        .collect()
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -229,6 +462,30 @@ mod tests {
         std::env::temp_dir().join(format!("agent-mux-{name}-{}-{nanos}", std::process::id()))
     }
 
+    #[test]
+    fn parses_commits_from_log() {
+        let out = "4f2a9c1\t2026-03-02T15:04:05+01:00\tFix login race\tfor real\nbogus\n";
+
+        assert_eq!(
+            parse_log(out),
+            vec![Commit {
+                hash: "4f2a9c1".to_string(),
+                at: "2026-03-02T14:04:05Z".parse().unwrap(),
+                subject: "Fix login race\tfor real".to_string(),
+            }]
+        );
+    }
+
+    #[test]
+    fn parses_modified_paths_from_porcelain() {
+        let out = " M src/main.rs\nR  old.rs -> new.rs\n D gone.rs\n?? notes.md\n";
+
+        assert_eq!(
+            parse_porcelain_paths(out),
+            vec!["src/main.rs", "new.rs", "notes.md"]
+        );
+    }
+
     #[test]
     fn fast_enriches_worktree_structure() -> std::io::Result<()> {
         let root = temp_dir("worktree");
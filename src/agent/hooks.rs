@@ -0,0 +1,98 @@
+use std::process::Command;
+
+use crate::agent::config::{Hooks, config};
+use crate::agent::events::{Event, StatusChange};
+use crate::agent::exec::RunExt;
+use crate::agent::{Pane, PaneStatus, log};
+
+/// Runs the configured `hooks` commands for a poll's events. Pane hooks
+/// fire once per status transition; `onError` fires when an agent turns to
+/// Error and when refreshes start failing, not on every failed poll.
+pub fn run_hooks(panes: &[Pane], events: &[Event]) {
+    let hooks = &config().hooks;
+    for event in events {
+        match event {
+            Event::StatusChanged(change) => {
+                let Some((name, command)) = pane_hook(hooks, change.to) else {
+                    continue;
+                };
+                let Some(pane) = panes.iter().find(|pane| pane.pane_id == change.pane_id) else {
+                    continue;
+                };
+                if pane.terminated {
+                    continue;
+                }
+                let mut cmd = hook_command(name, command);
+                set_pane_env(&mut cmd, pane, change);
+                run(name, cmd);
+            }
+            Event::Error { message, .. } if !hooks.on_error.is_empty() => {
+                let mut cmd = hook_command("error", &hooks.on_error);
+                cmd.env("AGENT_MUX_ERROR", message);
+                run("error", cmd);
+            }
+            _ => {}
+        }
+    }
+}
+
+fn pane_hook(hooks: &Hooks, status: PaneStatus) -> Option<(&'static str, &str)> {
+    let (event, command) = match status {
+        PaneStatus::NeedsAttention => ("attention", &hooks.on_attention),
+        PaneStatus::Unread => ("unread", &hooks.on_unread),
+        PaneStatus::Error => ("error", &hooks.on_error),
+        PaneStatus::Busy | PaneStatus::Idle | PaneStatus::Disconnected => return None,
+    };
+    (!command.is_empty()).then_some((event, command.as_str()))
+}
+
+fn hook_command(event: &str, command: &str) -> Command {
+    let mut cmd = Command::new("sh");
+    cmd.arg("-c")
+        .arg(command)
+        .env("AGENT_MUX_EVENT", event)
+        .current_dir(std::env::temp_dir());
+    cmd
+}
+
+fn set_pane_env(cmd: &mut Command, pane: &Pane, change: &StatusChange) {
+    cmd.env("AGENT_MUX_PANE", &pane.pane_id)
+        .env("AGENT_MUX_TARGET", &pane.target)
+        .env("AGENT_MUX_SESSION", &pane.session)
+        .env("AGENT_MUX_PROVIDER", &pane.provider)
+        .env("AGENT_MUX_PATH", &pane.path)
+        .env("AGENT_MUX_FROM", change.from.map_or("", PaneStatus::as_str))
+        .env("AGENT_MUX_TO", change.to.as_str());
+}
+
+fn run(event: &str, mut cmd: Command) {
+    let label = format!("{event} hook");
+    if let Err(err) = cmd.spawn_reaped(&label) {
+        log::warn("hook failed", &[("event", &event), ("err", &err)]);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn maps_statuses_to_configured_hooks() {
+        let hooks = Hooks {
+            on_attention: "say attention".to_string(),
+            on_error: "say crashed".to_string(),
+            ..Hooks::default()
+        };
+
+        assert_eq!(
+            pane_hook(&hooks, PaneStatus::NeedsAttention),
+            Some(("attention", "say attention"))
+        );
+        assert_eq!(
+            pane_hook(&hooks, PaneStatus::Error),
+            Some(("error", "say crashed"))
+        );
+        assert_eq!(pane_hook(&hooks, PaneStatus::Unread), None);
+        assert_eq!(pane_hook(&hooks, PaneStatus::Busy), None);
+    }
+}
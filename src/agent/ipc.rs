@@ -1,18 +1,54 @@
 use std::io::{BufRead, BufReader, Write};
 use std::os::unix::net::UnixStream;
 use std::path::PathBuf;
+use std::thread;
 use std::time::Duration;
 
 use anyhow::{Context, Result, anyhow};
 use serde::{Deserialize, Serialize};
 
-use crate::agent::persist::{Snapshot, UiState, state_dir};
+use crate::agent::events::Event;
+use crate::agent::persist::{
+    self, Snapshot, UiState, apply_ui_state, load_snapshot, load_ui_state, panes_from_snapshot,
+    state_dir,
+};
+use crate::agent::trigger::FinishAction;
+use crate::agent::{Pane, PaneStatus};
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
 #[serde(tag = "type")]
 pub enum Request {
     GetState,
     Subscribe,
+    UpdatePane(PaneUpdate),
+    KillPane { target: String },
+    RespawnPane { pane_id: String },
+}
+
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct PaneUpdate {
+    pub pane_id: String,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub stashed: Option<bool>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub manual_status: Option<PaneStatus>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub do_not_disturb: Option<bool>,
+    #[serde(default)]
+    pub dismissed: bool,
+    /// Snoozes for this many minutes; 0 ends a snooze.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub snooze_minutes: Option<u32>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub queue_prompt: Option<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub on_finish: Option<FinishAction>,
+    #[serde(default)]
+    pub clear_on_finish: bool,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub alert: Option<String>,
+    #[serde(default)]
+    pub clear_alerts: bool,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -22,34 +58,294 @@ pub enum Response {
         snapshot: Option<Snapshot>,
         ui_state: UiState,
     },
+    /// A poll's events, sent to subscribers after the state they follow.
+    Events {
+        events: Vec<Event>,
+    },
+    Ok,
     Error {
         message: String,
     },
 }
 
+/// Long enough for a kill that archives a remote pane over ssh.
+const WATCHER_COMMAND_TIMEOUT: Duration = Duration::from_secs(30);
+
 pub fn socket_path() -> PathBuf {
     state_dir().join("daemon.sock")
 }
 
 pub fn get_state() -> Result<(Option<Snapshot>, UiState)> {
-    let mut stream = UnixStream::connect(socket_path()).context("connect daemon socket")?;
-    stream
-        .set_read_timeout(Some(Duration::from_millis(150)))
-        .ok();
+    match request(&Request::GetState)? {
+        Response::State { snapshot, ui_state } => Ok((snapshot, ui_state)),
+        Response::Ok | Response::Events { .. } => Err(anyhow!("unexpected daemon response")),
+        Response::Error { message } => Err(anyhow!(message)),
+    }
+}
+
+fn request(request: &Request) -> Result<Response> {
+    let stream = UnixStream::connect(socket_path()).context("connect daemon socket")?;
+    exchange(stream, request, Duration::from_millis(150))
+}
+
+fn exchange(mut stream: UnixStream, request: &Request, timeout: Duration) -> Result<Response> {
+    stream.set_read_timeout(Some(timeout)).ok();
     stream
         .set_write_timeout(Some(Duration::from_millis(150)))
         .ok();
 
-    let request = serde_json::to_string(&Request::GetState).context("encode daemon request")?;
+    let request = serde_json::to_string(request).context("encode daemon request")?;
     writeln!(stream, "{request}").context("write daemon request")?;
 
     let mut line = String::new();
     BufReader::new(stream)
         .read_line(&mut line)
         .context("read daemon response")?;
-    let response: Response = serde_json::from_str(&line).context("decode daemon response")?;
-    match response {
-        Response::State { snapshot, ui_state } => Ok((snapshot, ui_state)),
+    serde_json::from_str(&line).context("decode daemon response")
+}
+
+/// Kills a pane through the watcher, so every sidebar sees it go on the
+/// next push. Without a watcher the pane is killed here.
+pub fn kill_pane(target: &str) -> Result<()> {
+    command(
+        &Request::KillPane {
+            target: target.to_string(),
+        },
+        || crate::agent::kill_pane(target),
+    )
+}
+
+pub fn respawn_pane(pane: &Pane) -> Result<()> {
+    command(
+        &Request::RespawnPane {
+            pane_id: pane.pane_id.clone(),
+        },
+        || crate::agent::respawn_agent(pane),
+    )
+}
+
+/// Sends a command the watcher carries out itself. Only a missing watcher
+/// falls back to `local`; once sent, a slow or failed command must not run
+/// twice.
+fn command(request: &Request, local: impl FnOnce() -> Result<()>) -> Result<()> {
+    let Ok(stream) = UnixStream::connect(socket_path()) else {
+        return local();
+    };
+    match exchange(stream, request, WATCHER_COMMAND_TIMEOUT)? {
+        Response::Ok => Ok(()),
         Response::Error { message } => Err(anyhow!(message)),
+        Response::State { .. } | Response::Events { .. } => {
+            Err(anyhow!("unexpected daemon response"))
+        }
     }
 }
+
+pub fn set_pane_stashed(pane: &Pane, stashed: bool) -> Result<()> {
+    update_pane(
+        pane,
+        PaneUpdate {
+            stashed: Some(stashed),
+            ..PaneUpdate::default()
+        },
+    )
+}
+
+pub fn set_pane_manual_status(pane: &Pane, status: PaneStatus) -> Result<()> {
+    update_pane(
+        pane,
+        PaneUpdate {
+            manual_status: Some(status),
+            ..PaneUpdate::default()
+        },
+    )
+}
+
+pub fn set_pane_do_not_disturb(pane: &Pane, on: bool) -> Result<()> {
+    update_pane(
+        pane,
+        PaneUpdate {
+            do_not_disturb: Some(on),
+            ..PaneUpdate::default()
+        },
+    )
+}
+
+pub fn snooze_pane(pane: &Pane, minutes: u32) -> Result<()> {
+    update_pane(
+        pane,
+        PaneUpdate {
+            snooze_minutes: Some(minutes),
+            ..PaneUpdate::default()
+        },
+    )
+}
+
+pub fn queue_prompt(pane: &Pane, prompt: &str) -> Result<()> {
+    update_pane(
+        pane,
+        PaneUpdate {
+            queue_prompt: Some(prompt.to_string()),
+            ..PaneUpdate::default()
+        },
+    )
+}
+
+/// Watches the pane's output for a regex; `None` clears its watches.
+pub fn set_pane_alert(pane: &Pane, pattern: Option<&str>) -> Result<()> {
+    update_pane(
+        pane,
+        PaneUpdate {
+            clear_alerts: pattern.is_none(),
+            alert: pattern.map(str::to_string),
+            ..PaneUpdate::default()
+        },
+    )
+}
+
+/// Adds a one-shot action for when the pane finishes; `None` clears them.
+pub fn set_finish_action(pane: &Pane, action: Option<FinishAction>) -> Result<()> {
+    let clear_on_finish = action.is_none();
+    update_pane(
+        pane,
+        PaneUpdate {
+            on_finish: action,
+            clear_on_finish,
+            ..PaneUpdate::default()
+        },
+    )
+}
+
+pub fn dismiss_pane(pane: &Pane) -> Result<()> {
+    update_pane(
+        pane,
+        PaneUpdate {
+            dismissed: true,
+            ..PaneUpdate::default()
+        },
+    )
+}
+
+// Marks and acks go through the watcher so it sees them before its next
+// notification pass; without a watcher they are written directly.
+fn update_pane(pane: &Pane, update: PaneUpdate) -> Result<()> {
+    let update = PaneUpdate {
+        pane_id: pane.pane_id.clone(),
+        ..update
+    };
+    match request(&Request::UpdatePane(update.clone())) {
+        Ok(Response::Ok) => Ok(()),
+        Ok(Response::Error { message }) => Err(anyhow!(message)),
+        Ok(Response::State { .. } | Response::Events { .. }) => {
+            Err(anyhow!("unexpected daemon response"))
+        }
+        Err(_) => apply_pane_update(pane, &update),
+    }
+}
+
+pub fn apply_pane_update(pane: &Pane, update: &PaneUpdate) -> Result<()> {
+    if let Some(stashed) = update.stashed {
+        persist::set_pane_stashed(pane, stashed)?;
+    }
+    if let Some(status) = update.manual_status {
+        persist::set_pane_manual_status(pane, status)?;
+    }
+    if let Some(on) = update.do_not_disturb {
+        persist::set_pane_do_not_disturb(pane, on)?;
+    }
+    if update.dismissed {
+        persist::dismiss_pane(pane)?;
+    }
+    if let Some(minutes) = update.snooze_minutes {
+        let until = (minutes > 0)
+            .then(|| chrono::Utc::now() + chrono::Duration::minutes(i64::from(minutes)));
+        persist::snooze_pane(pane, until)?;
+    }
+    if let Some(prompt) = &update.queue_prompt {
+        persist::queue_prompt(pane, prompt)?;
+    }
+    if update.clear_on_finish {
+        persist::add_finish_action(pane, None)?;
+    }
+    if let Some(action) = &update.on_finish {
+        persist::add_finish_action(pane, Some(action.clone()))?;
+    }
+    if update.clear_alerts {
+        persist::add_pane_alert(pane, None)?;
+    }
+    if let Some(pattern) = &update.alert {
+        persist::add_pane_alert(pane, Some(pattern))?;
+    }
+    Ok(())
+}
+
+pub fn subscribe(mut on_response: impl FnMut(Response) -> bool) -> Result<()> {
+    let mut stream = UnixStream::connect(socket_path()).context("connect daemon socket")?;
+    let request = serde_json::to_string(&Request::Subscribe).context("encode daemon request")?;
+    writeln!(stream, "{request}").context("write daemon request")?;
+    let mut reader = BufReader::new(stream);
+    loop {
+        let mut line = String::new();
+        if reader
+            .read_line(&mut line)
+            .context("read daemon response")?
+            == 0
+        {
+            return Ok(());
+        }
+        let response: Response = serde_json::from_str(&line).context("decode daemon response")?;
+        if !on_response(response) {
+            return Ok(());
+        }
+    }
+}
+
+pub fn follow(on_state: impl FnMut(Snapshot, UiState)) -> ! {
+    follow_with(on_state, |_| {})
+}
+
+/// Like `follow`, also passing on the watcher's events. Events that happen
+/// while reconnecting are missed.
+pub fn follow_with(
+    mut on_state: impl FnMut(Snapshot, UiState),
+    mut on_events: impl FnMut(Vec<Event>),
+) -> ! {
+    loop {
+        let _ = subscribe(|response| {
+            match response {
+                Response::State {
+                    snapshot: Some(snapshot),
+                    ui_state,
+                } => on_state(snapshot, ui_state),
+                Response::Events { events } => on_events(events),
+                _ => {}
+            }
+            true
+        });
+        if let (Some(snapshot), ui_state) = load_state() {
+            on_state(snapshot, ui_state);
+        }
+        thread::sleep(Duration::from_secs(1));
+    }
+}
+
+pub fn load_state() -> (Option<Snapshot>, UiState) {
+    match get_state() {
+        Ok((Some(snapshot), ui_state)) => (Some(snapshot), ui_state),
+        Ok((None, ui_state)) => (load_snapshot(), ui_state),
+        Err(_) => (load_snapshot(), load_ui_state()),
+    }
+}
+
+pub fn load_panes() -> Vec<Pane> {
+    let (snapshot, ui_state) = load_state();
+    snapshot
+        .map(|snapshot| display_panes(&snapshot, &ui_state))
+        .unwrap_or_default()
+}
+
+pub fn display_panes(snapshot: &Snapshot, ui_state: &UiState) -> Vec<Pane> {
+    let mut panes = panes_from_snapshot(snapshot);
+    apply_ui_state(&mut panes, ui_state);
+    panes.sort_by(|a, b| a.order.cmp(&b.order).then(a.target.cmp(&b.target)));
+    panes
+}
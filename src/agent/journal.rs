@@ -0,0 +1,143 @@
+use std::fs::{self, OpenOptions};
+use std::io::Write;
+use std::path::PathBuf;
+
+use anyhow::{Context, Result};
+use chrono::{DateTime, Local, Utc};
+
+use crate::agent::events::{Event, StatusChange, status_changes};
+use crate::agent::persist::state_dir;
+use crate::agent::{PaneStatus, log};
+
+const MAX_JOURNAL_BYTES: u64 = 1024 * 1024;
+
+pub fn journal_path() -> PathBuf {
+    state_dir().join("journal.jsonl")
+}
+
+fn backup_path() -> PathBuf {
+    state_dir().join("journal.jsonl.1")
+}
+
+/// Appends every status transition the watcher sees to the journal, so a
+/// pane's history survives restarts and can be shown later.
+pub fn record(events: &[Event]) {
+    let changes: Vec<&StatusChange> = status_changes(events).collect();
+    if changes.is_empty() {
+        return;
+    }
+    if let Err(err) = append(&changes) {
+        log::warn("write journal failed", &[("err", &format!("{err:#}"))]);
+    }
+}
+
+fn append(changes: &[&StatusChange]) -> Result<()> {
+    fs::create_dir_all(state_dir()).context("create state dir")?;
+    let path = journal_path();
+    if fs::metadata(&path).is_ok_and(|meta| meta.len() >= MAX_JOURNAL_BYTES) {
+        fs::rename(&path, backup_path()).context("rotate journal")?;
+    }
+    let mut file = OpenOptions::new()
+        .create(true)
+        .append(true)
+        .open(&path)
+        .context("open journal")?;
+    for change in changes {
+        writeln!(file, "{}", serde_json::to_string(change)?).context("write journal")?;
+    }
+    Ok(())
+}
+
+/// The last `limit` recorded transitions of one pane, oldest first.
+pub fn history(pane_id: &str, limit: usize) -> Vec<StatusChange> {
+    let mut changes = recorded(|change| change.pane_id == pane_id);
+    let skip = changes.len().saturating_sub(limit);
+    changes.drain(..skip);
+    changes
+}
+
+/// Every recorded transition at or after `at`, oldest first.
+pub fn since(at: DateTime<Utc>) -> Vec<StatusChange> {
+    recorded(|change| change.at >= at)
+}
+
+fn recorded(keep: impl Fn(&StatusChange) -> bool) -> Vec<StatusChange> {
+    [backup_path(), journal_path()]
+        .iter()
+        .filter_map(|path| fs::read_to_string(path).ok())
+        .flat_map(|data| {
+            data.lines()
+                .filter_map(|line| serde_json::from_str::<StatusChange>(line).ok())
+                .filter(|change| keep(change))
+                .collect::<Vec<_>>()
+        })
+        .collect()
+}
+
+/// Formats transitions as `busy 14:02–14:19 → attention 14:19 → read 14:31`.
+/// Busy stretches show when they ended; other statuses when they began.
+pub fn timeline(changes: &[StatusChange]) -> String {
+    let time = |change: &StatusChange| change.at.with_timezone(&Local).format("%H:%M");
+    changes
+        .iter()
+        .enumerate()
+        .map(|(i, change)| {
+            let label = match change.to {
+                PaneStatus::Idle if change.from.is_some_and(PaneStatus::wants_attention) => "read",
+                PaneStatus::NeedsAttention => "attention",
+                status => status.as_str(),
+            };
+            match changes.get(i + 1) {
+                Some(next) if change.to == PaneStatus::Busy => {
+                    format!("{label} {}–{}", time(change), time(next))
+                }
+                _ => format!("{label} {}", time(change)),
+            }
+        })
+        .collect::<Vec<_>>()
+        .join(" → ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use chrono::{TimeZone, Utc};
+
+    #[test]
+    fn formats_a_compact_timeline() {
+        let at = |h, m| {
+            Local
+                .with_ymd_and_hms(2026, 3, 2, h, m, 0)
+                .unwrap()
+                .with_timezone(&Utc)
+        };
+        let change = |from, to, at| StatusChange {
+            pane_id: "%1".to_string(),
+            target: "s:1.1".to_string(),
+            provider: "claude".to_string(),
+            path: "/src/api".to_string(),
+            from,
+            to,
+            at,
+        };
+        let changes = [
+            change(Some(PaneStatus::Idle), PaneStatus::Busy, at(14, 2)),
+            change(
+                Some(PaneStatus::Busy),
+                PaneStatus::NeedsAttention,
+                at(14, 19),
+            ),
+            change(
+                Some(PaneStatus::NeedsAttention),
+                PaneStatus::Idle,
+                at(14, 31),
+            ),
+        ];
+
+        assert_eq!(
+            timeline(&changes),
+            "busy 14:02–14:19 → attention 14:19 → read 14:31"
+        );
+        assert_eq!(timeline(&[]), "");
+    }
+}
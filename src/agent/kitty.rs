@@ -0,0 +1,134 @@
+use std::process::Command;
+
+use anyhow::{Context, Result, anyhow};
+use serde::Deserialize;
+
+use crate::agent::Pane;
+use crate::agent::backend::last_lines;
+use crate::agent::config::config;
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt};
+use crate::agent::provider::{ProcessTable, resolve};
+
+#[derive(Debug, Deserialize)]
+struct KittyOsWindow {
+    #[serde(default)]
+    tabs: Vec<KittyTab>,
+}
+
+#[derive(Debug, Deserialize)]
+struct KittyTab {
+    id: u64,
+    #[serde(default)]
+    title: String,
+    #[serde(default)]
+    windows: Vec<KittyWindow>,
+}
+
+#[derive(Debug, Deserialize)]
+struct KittyWindow {
+    id: u64,
+    #[serde(default)]
+    pid: i32,
+    #[serde(default)]
+    cwd: String,
+    #[serde(default)]
+    is_focused: bool,
+    #[serde(default)]
+    foreground_processes: Vec<KittyProcess>,
+}
+
+#[derive(Debug, Deserialize)]
+struct KittyProcess {
+    #[serde(default)]
+    cmdline: Vec<String>,
+}
+
+pub fn list_panes(pt: &ProcessTable) -> Vec<Pane> {
+    let _g = smelt_perf::perf::begin("kitty.list_panes");
+    let Ok(out) = kitty_command().arg("ls").output_within(COMMAND_TIMEOUT) else {
+        return Vec::new();
+    };
+    if !out.status.success() {
+        return Vec::new();
+    }
+    let Ok(os_windows) = serde_json::from_slice::<Vec<KittyOsWindow>>(&out.stdout) else {
+        return Vec::new();
+    };
+    let mut panes = Vec::new();
+    for tab in os_windows.into_iter().flat_map(|os_window| os_window.tabs) {
+        for window in tab.windows {
+            let cmd = window
+                .foreground_processes
+                .first()
+                .and_then(|process| process.cmdline.first())
+                .cloned()
+                .unwrap_or_default();
+            let Some(matched) = resolve(&cmd, window.pid, pt) else {
+                continue;
+            };
+            let target = format!("kitty:{}", window.id);
+            panes.push(Pane {
+                pane_id: target.clone(),
+                target,
+                session: "kitty".to_string(),
+                window: tab.id.to_string(),
+                window_name: tab.title.clone(),
+                pane: window.id.to_string(),
+                path: window.cwd,
+                pid: window.pid,
+                provider_pid: matched.pid,
+                provider: matched.name,
+                window_active: window.is_focused,
+                ..Pane::default()
+            });
+        }
+    }
+    panes
+}
+
+pub fn capture_pane(id: &str, lines: usize, escapes: bool) -> Result<String> {
+    let mut cmd = kitty_command();
+    cmd.args(["get-text", "--extent", "all", "--match"])
+        .arg(format!("id:{id}"));
+    if escapes {
+        cmd.arg("--ansi");
+    }
+    let out = cmd
+        .output_within(COMMAND_TIMEOUT)
+        .with_context(|| format!("kitty get-text {id}"))?;
+    if !out.status.success() {
+        return Err(anyhow!("kitty get-text {id} exited with {}", out.status));
+    }
+    Ok(last_lines(&String::from_utf8_lossy(&out.stdout), lines))
+}
+
+pub fn switch_to_pane(id: &str) -> Result<()> {
+    run_kitty("focus-window", id)
+}
+
+pub fn kill_pane(id: &str) -> Result<()> {
+    run_kitty("close-window", id)
+}
+
+fn run_kitty(action: &str, id: &str) -> Result<()> {
+    let status = kitty_command()
+        .arg(action)
+        .arg("--match")
+        .arg(format!("id:{id}"))
+        .status_within(COMMAND_TIMEOUT)
+        .context("kitty")?;
+    if status.success() {
+        Ok(())
+    } else {
+        Err(anyhow!("kitty exited with {status}"))
+    }
+}
+
+fn kitty_command() -> Command {
+    let mut cmd = Command::new("kitty");
+    cmd.arg("@");
+    if !config().kitty_listen_on.is_empty() {
+        cmd.arg("--to").arg(&config().kitty_listen_on);
+    }
+    cmd
+}
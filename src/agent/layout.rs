@@ -0,0 +1,161 @@
+use std::fs;
+use std::path::PathBuf;
+
+use anyhow::{Context, Result, bail};
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+
+use crate::agent::backend::{Backend, backend_of};
+use crate::agent::persist::state_dir;
+use crate::agent::spawn::Spawn;
+use crate::agent::throttle::spawn_or_queue;
+use crate::agent::{Pane, ipc};
+
+/// The agents that were running, saved by `agent-mux snapshot save` so
+/// `restore` can start them again in the same sessions and directories.
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct Layout {
+    pub version: u32,
+    pub saved_at: Option<DateTime<Utc>>,
+    pub agents: Vec<LayoutAgent>,
+}
+
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct LayoutAgent {
+    pub session: String,
+    pub window_name: String,
+    pub path: String,
+    pub provider: String,
+    pub command: String,
+}
+
+#[derive(Debug, PartialEq)]
+pub enum Restored {
+    Started { target: String, pane_id: String },
+    AlreadyRunning { target: String },
+    Queued { target: String },
+}
+
+pub fn layouts_dir() -> PathBuf {
+    state_dir().join("layouts")
+}
+
+fn layout_path(name: &str) -> Result<PathBuf> {
+    if name.is_empty() || name.starts_with('.') || name.contains('/') {
+        bail!("invalid layout name {name:?}");
+    }
+    Ok(layouts_dir().join(format!("{name}.json")))
+}
+
+fn capture(panes: &[Pane]) -> Layout {
+    let agents = panes
+        .iter()
+        .filter(|p| !p.terminated && backend_of(&p.target) == Backend::Tmux)
+        .map(|p| LayoutAgent {
+            session: p.session.clone(),
+            window_name: p.window_name.clone(),
+            path: p.path.clone(),
+            provider: p.provider.clone(),
+            command: p.command.clone(),
+        })
+        .collect();
+    Layout {
+        version: 1,
+        saved_at: Some(Utc::now()),
+        agents,
+    }
+}
+
+pub fn save(name: &str) -> Result<usize> {
+    let path = layout_path(name)?;
+    let layout = capture(&ipc::load_panes());
+    if layout.agents.is_empty() {
+        bail!("no local tmux agents to save");
+    }
+    fs::create_dir_all(layouts_dir()).context("create layouts dir")?;
+    let data = serde_json::to_vec_pretty(&layout).context("encode layout")?;
+    fs::write(&path, data).with_context(|| format!("write {}", path.display()))?;
+    Ok(layout.agents.len())
+}
+
+pub fn restore(name: &str) -> Result<Vec<Restored>> {
+    let path = layout_path(name)?;
+    let data = fs::read(&path).with_context(|| format!("no saved layout {name}"))?;
+    let layout: Layout = serde_json::from_slice(&data).context("decode layout")?;
+    let live = ipc::load_panes();
+    let mut restored = Vec::new();
+    for agent in layout.agents {
+        let target = format!("{}:{}", agent.session, agent.window_name);
+        if live
+            .iter()
+            .any(|p| !p.terminated && p.path == agent.path && p.provider == agent.provider)
+        {
+            restored.push(Restored::AlreadyRunning { target });
+            continue;
+        }
+        let request = Spawn {
+            session: agent.session,
+            command: if agent.command.is_empty() {
+                agent.provider
+            } else {
+                agent.command
+            },
+            directory: agent.path,
+            window_name: agent.window_name,
+            ..Spawn::default()
+        };
+        restored.push(match spawn_or_queue(&request, &live)? {
+            Some(pane_id) => Restored::Started { target, pane_id },
+            None => Restored::Queued { target },
+        });
+    }
+    Ok(restored)
+}
+
+pub fn list() -> Vec<String> {
+    let mut names: Vec<String> = fs::read_dir(layouts_dir())
+        .into_iter()
+        .flatten()
+        .flatten()
+        .filter_map(|entry| {
+            entry
+                .file_name()
+                .to_str()?
+                .strip_suffix(".json")
+                .map(str::to_string)
+        })
+        .collect();
+    names.sort();
+    names
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn captures_live_local_tmux_agents() {
+        let pane = |target: &str, terminated: bool| Pane {
+            target: target.to_string(),
+            session: "work".to_string(),
+            window_name: "api".to_string(),
+            path: "/src/api".to_string(),
+            provider: "claude".to_string(),
+            command: "claude --continue".to_string(),
+            terminated,
+            ..Pane::default()
+        };
+
+        let layout = capture(&[
+            pane("work:1.1", false),
+            pane("work:2.1", true),
+            pane("ssh:devbox/main:1.1", false),
+        ]);
+
+        assert_eq!(layout.agents.len(), 1);
+        assert_eq!(layout.agents[0].command, "claude --continue");
+        assert!(layout_path("../etc").is_err());
+    }
+}
@@ -0,0 +1,279 @@
+use std::collections::VecDeque;
+use std::fmt::{Display, Write as _};
+use std::fs::{self, OpenOptions};
+use std::io::Write;
+use std::path::PathBuf;
+use std::sync::Mutex;
+use std::sync::atomic::{AtomicBool, AtomicU8, Ordering};
+
+use anyhow::{Result, anyhow};
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+
+use crate::agent::crash;
+use crate::agent::persist::state_dir;
+
+const MAX_LOG_BYTES: u64 = 1024 * 1024;
+const LOG_BACKUPS: usize = 3;
+const RECENT_PROBLEMS: usize = 50;
+
+static LEVEL: AtomicU8 = AtomicU8::new(Level::Info as u8);
+static STDERR: AtomicBool = AtomicBool::new(false);
+static PROBLEMS: Mutex<VecDeque<Problem>> = Mutex::new(VecDeque::new());
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+pub enum Level {
+    Error = 0,
+    Warn = 1,
+    Info = 2,
+    Debug = 3,
+}
+
+impl Level {
+    pub fn parse(s: &str) -> Option<Self> {
+        match s.to_ascii_lowercase().as_str() {
+            "error" => Some(Self::Error),
+            "warn" | "warning" => Some(Self::Warn),
+            "info" => Some(Self::Info),
+            "debug" => Some(Self::Debug),
+            _ => None,
+        }
+    }
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Error => "error",
+            Self::Warn => "warn",
+            Self::Info => "info",
+            Self::Debug => "debug",
+        }
+    }
+}
+
+pub type Fields<'a> = &'a [(&'a str, &'a dyn Display)];
+
+pub fn log_path() -> PathBuf {
+    state_dir().join("watch.log")
+}
+
+pub fn set_level(level: Level) {
+    LEVEL.store(level as u8, Ordering::Relaxed);
+}
+
+/// Mirrors every record to stderr, for running the watcher in a terminal.
+pub fn set_stderr(enabled: bool) {
+    STDERR.store(enabled, Ordering::Relaxed);
+}
+
+pub fn level() -> Level {
+    match LEVEL.load(Ordering::Relaxed) {
+        0 => Level::Error,
+        1 => Level::Warn,
+        2 => Level::Info,
+        _ => Level::Debug,
+    }
+}
+
+pub fn enabled(level: Level) -> bool {
+    level as u8 <= LEVEL.load(Ordering::Relaxed)
+}
+
+/// Applies and strips `--log-level <level>` (or `--log-level=<level>`).
+pub fn init_from_args(args: Vec<String>) -> Result<Vec<String>> {
+    let (level, rest) = parse_level_flag(args)?;
+    if let Some(level) = level {
+        set_level(level);
+    }
+    Ok(rest)
+}
+
+/// Strips `--log-level` from the arguments and returns the last level given.
+fn parse_level_flag(args: Vec<String>) -> Result<(Option<Level>, Vec<String>)> {
+    let mut level = None;
+    let mut rest = Vec::with_capacity(args.len());
+    let mut iter = args.into_iter();
+    while let Some(arg) = iter.next() {
+        let value = if arg == "--log-level" {
+            iter.next().unwrap_or_default()
+        } else if let Some(value) = arg.strip_prefix("--log-level=") {
+            value.to_string()
+        } else {
+            rest.push(arg);
+            continue;
+        };
+        level = Some(Level::parse(&value).ok_or_else(|| anyhow!("unknown log level {value:?}"))?);
+    }
+    Ok((level, rest))
+}
+
+pub fn error(msg: &str, fields: Fields<'_>) {
+    log(Level::Error, msg, fields);
+}
+
+pub fn warn(msg: &str, fields: Fields<'_>) {
+    log(Level::Warn, msg, fields);
+}
+
+pub fn info(msg: &str, fields: Fields<'_>) {
+    log(Level::Info, msg, fields);
+}
+
+pub fn debug(msg: &str, fields: Fields<'_>) {
+    log(Level::Debug, msg, fields);
+}
+
+/// A warning or error, kept for the diagnostics overlay whatever the log
+/// level. Repeats of the last one only bump its count.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Problem {
+    pub at: DateTime<Utc>,
+    pub level: String,
+    pub message: String,
+    #[serde(default, skip_serializing_if = "is_one")]
+    pub count: u32,
+}
+
+fn is_one(count: &u32) -> bool {
+    *count == 1
+}
+
+/// This process's recent warnings and errors, oldest first.
+pub fn recent_problems() -> Vec<Problem> {
+    PROBLEMS
+        .lock()
+        .map(|problems| problems.iter().cloned().collect())
+        .unwrap_or_default()
+}
+
+fn remember(level: Level, msg: &str, fields: Fields<'_>) {
+    let Ok(mut problems) = PROBLEMS.lock() else {
+        return;
+    };
+    let mut message = msg.to_string();
+    for (key, value) in fields {
+        let _ = write!(message, " {key}={}", quote(&value.to_string()));
+    }
+    let at = Utc::now();
+    if let Some(last) = problems.back_mut()
+        && last.message == message
+    {
+        last.at = at;
+        last.count += 1;
+        return;
+    }
+    if problems.len() == RECENT_PROBLEMS {
+        problems.pop_front();
+    }
+    problems.push_back(Problem {
+        at,
+        level: level.as_str().to_string(),
+        message,
+        count: 1,
+    });
+}
+
+fn log(level: Level, msg: &str, fields: Fields<'_>) {
+    if level <= Level::Warn {
+        remember(level, msg, fields);
+    }
+    if !enabled(level) {
+        return;
+    }
+    let record = format_record(level, msg, fields);
+    crash::record(record.clone());
+    let line = format!("time={} {record}\n", Utc::now().to_rfc3339());
+    if STDERR.load(Ordering::Relaxed) {
+        eprint!("{line}");
+    }
+    let _ = append(&line);
+}
+
+fn format_record(level: Level, msg: &str, fields: Fields<'_>) -> String {
+    let mut out = format!(
+        "level={} msg={} pid={}",
+        level.as_str(),
+        quote(msg),
+        std::process::id()
+    );
+    for (key, value) in fields {
+        let _ = write!(out, " {key}={}", quote(&value.to_string()));
+    }
+    out
+}
+
+fn quote(value: &str) -> String {
+    if !value.is_empty()
+        && !value
+            .chars()
+            .any(|ch| ch.is_whitespace() || ch == '"' || ch == '=' || ch.is_control())
+    {
+        return value.to_string();
+    }
+    format!("{value:?}")
+}
+
+fn append(line: &str) -> std::io::Result<()> {
+    fs::create_dir_all(state_dir())?;
+    let path = log_path();
+    if fs::metadata(&path).is_ok_and(|meta| meta.len() >= MAX_LOG_BYTES) {
+        rotate(&path);
+    }
+    OpenOptions::new()
+        .create(true)
+        .append(true)
+        .open(&path)?
+        .write_all(line.as_bytes())
+}
+
+fn rotate(path: &std::path::Path) {
+    let backup = |n: usize| PathBuf::from(format!("{}.{n}", path.display()));
+    for n in (1..LOG_BACKUPS).rev() {
+        let _ = fs::rename(backup(n), backup(n + 1));
+    }
+    let _ = fs::rename(path, backup(1));
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn formats_records_as_logfmt() {
+        let record = format_record(
+            Level::Debug,
+            "status changed",
+            &[("pane", &"%3"), ("reason", &"quiet after busy")],
+        );
+
+        assert!(record.starts_with("level=debug msg=\"status changed\" pid="));
+        assert!(record.ends_with(" pane=%3 reason=\"quiet after busy\""));
+    }
+
+    #[test]
+    fn keeps_recent_problems_and_folds_repeats() {
+        remember(Level::Warn, "capture failed", &[("pane", &"%9")]);
+        remember(Level::Warn, "capture failed", &[("pane", &"%9")]);
+
+        let problems = recent_problems();
+        let last = problems
+            .iter()
+            .rfind(|p| p.message == "capture failed pane=%9")
+            .unwrap();
+        assert_eq!((last.level.as_str(), last.count), ("warn", 2));
+    }
+
+    #[test]
+    fn strips_log_level_flag() {
+        let args = vec!["watch".to_string(), "--log-level=debug".to_string()];
+
+        assert_eq!(
+            parse_level_flag(args).unwrap(),
+            (Some(Level::Debug), vec!["watch".to_string()])
+        );
+        assert_eq!(
+            parse_level_flag(vec!["watch".into()]).unwrap(),
+            (None, vec!["watch".to_string()])
+        );
+        assert!(parse_level_flag(vec!["--log-level".into(), "loud".into()]).is_err());
+    }
+}
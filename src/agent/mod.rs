@@ -1,27 +1,71 @@
+pub mod alert;
+pub mod approve;
+pub mod archive;
+pub mod backend;
+pub mod cleanup;
+pub mod config;
+pub mod container;
+pub mod crash;
+pub mod digest;
+pub mod editor;
+pub mod events;
+pub mod exec;
 pub mod git;
+pub mod hooks;
 pub mod ipc;
+pub mod journal;
+pub mod kitty;
+pub mod layout;
+pub mod log;
+pub mod mounts;
+pub mod notify;
+pub mod output;
 pub mod persist;
+pub mod power;
 pub mod provider;
+pub mod ps;
+pub mod queue;
 pub mod reconcile;
+pub mod record;
+pub mod remote;
+pub mod review;
+pub mod service;
+pub mod simulate;
+pub mod spawn;
 pub mod status;
+pub mod tasks;
+pub mod team;
+pub mod throttle;
 pub mod tmux;
+pub mod transcript;
+pub mod trigger;
 pub mod watch;
+pub mod web;
+pub mod wezterm;
 
 pub use reconcile::Reconciler;
 pub use tmux::{
-    capture_pane, kill_pane, list_panes, list_panes_fast, restart_watch, start_watch,
+    capture_pane, copy_text, kill_pane, list_panes, list_panes_fast, live_tmux_pane_ids,
+    load_buffer, origin_pane, respawn_agent, restart_watch, start_watch, stop_watch_process,
     switch_to_pane,
 };
 
 use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
 
-#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+/// What an agent is doing, as far as its screen and process tell.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default, Hash, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
 pub enum PaneStatus {
     #[default]
     Idle = 0,
     Busy = 1,
     NeedsAttention = 2,
     Unread = 3,
+    /// The agent crashed or printed a fatal error.
+    Error = 4,
+    /// The pane is still open but its agent process is gone.
+    Disconnected = 5,
 }
 
 impl PaneStatus {
@@ -30,6 +74,8 @@ impl PaneStatus {
             1 => Self::Busy,
             2 => Self::NeedsAttention,
             3 => Self::Unread,
+            4 => Self::Error,
+            5 => Self::Disconnected,
             _ => Self::Idle,
         }
     }
@@ -37,35 +83,184 @@ impl PaneStatus {
     pub fn as_i32(self) -> i32 {
         self as i32
     }
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Idle => "idle",
+            Self::Busy => "busy",
+            Self::NeedsAttention => "needs_attention",
+            Self::Unread => "unread",
+            Self::Error => "error",
+            Self::Disconnected => "disconnected",
+        }
+    }
+
+    /// Rank in the status sort order, most urgent first.
+    pub fn priority(self) -> u8 {
+        match self {
+            Self::NeedsAttention => 0,
+            Self::Error => 1,
+            Self::Unread => 2,
+            Self::Busy => 3,
+            Self::Idle => 4,
+            Self::Disconnected => 5,
+        }
+    }
+
+    /// Whether the pane is waiting on the user: a prompt, a finished turn
+    /// nobody has looked at, or an error.
+    pub fn wants_attention(self) -> bool {
+        matches!(self, Self::NeedsAttention | Self::Unread | Self::Error)
+    }
 }
 
-#[derive(Debug, Clone, Default)]
+/// A terminal pane running an agent. `target` is `session:window.pane`, and
+/// `provider` one of `providers()`. New fields may be added, so build one
+/// from `Pane::default()`.
+#[derive(Debug, Clone, Default, Serialize)]
+#[serde(rename_all = "camelCase")]
+#[non_exhaustive]
 pub struct Pane {
+    /// The terminal's id for the pane, e.g. tmux's `%12`.
     pub pane_id: String,
+    /// Where to send commands for the pane, e.g. `main:3.1`.
     pub target: String,
+    /// The SSH remote the pane was found on; empty for this machine.
+    #[serde(skip_serializing_if = "String::is_empty")]
+    pub host: String,
+    /// The tmux session, or the terminal's tab or OS window elsewhere.
     pub session: String,
+    /// The window index within `session`.
     pub window: String,
+    /// The window's name as the terminal shows it.
     pub window_name: String,
+    /// The window was named by hand (or by a spawn template) rather than
+    /// renamed by tmux after the running command.
+    pub window_named: bool,
+    /// The title of the agent's current conversation, if it keeps one.
+    #[serde(skip_serializing_if = "String::is_empty")]
+    pub title: String,
+    /// The pane index within `window`.
     pub pane: String,
+    /// The working directory.
     pub path: String,
+    /// `path` with the home directory shortened to `~`.
     pub short_path: String,
+    /// The enclosing git repository's root, if any.
     pub project_root: String,
+    /// `project_root` shortened like `short_path`.
     pub project_short: String,
+    /// The branch checked out at `project_root`.
     pub project_branch: String,
+    /// `project_root` has uncommitted changes.
     pub project_dirty: bool,
+    /// The branch checked out at `path`.
     pub git_branch: String,
+    /// `path` has uncommitted changes.
     pub git_dirty: bool,
+    /// The pane's shell process.
     #[allow(dead_code)]
+    #[serde(skip)]
     pub pid: i32,
+    /// The agent process under the shell.
+    #[serde(skip)]
     pub provider_pid: i32,
+    /// What the agent is doing, after reconciling.
     pub status: PaneStatus,
+    /// The status the last poll saw before reconciling.
+    #[serde(skip)]
     pub observed_status: Option<PaneStatus>,
+    /// A hash of the visible screen, to tell when output changes.
+    #[serde(skip)]
     pub content_hash: String,
+    /// The screen changed since the previous poll.
+    #[serde(skip)]
     pub content_moving: bool,
+    /// The screen shows a question or permission prompt.
+    #[serde(skip)]
     pub heuristic_attention: bool,
+    /// The screen shows a crash or fatal error.
+    #[serde(skip)]
+    pub heuristic_error: bool,
+    /// The on-screen line that made the pane need attention.
+    #[serde(skip_serializing_if = "String::is_empty")]
+    pub attention_reason: String,
+    /// The pane's window is the active one in its session.
     pub window_active: bool,
+    /// When tmux last saw output in the pane's window, in epoch seconds; 0
+    /// where unknown.
+    #[serde(skip)]
+    pub window_activity: u64,
+    /// When the agent last produced output.
     pub last_active: Option<DateTime<Utc>>,
+    /// When the current busy stretch began.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub busy_since: Option<DateTime<Utc>>,
+    /// When the pane last changed status.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub status_since: Option<DateTime<Utc>>,
+    /// Hidden from the sidebar by the user.
     pub stashed: bool,
+    /// The user's manual position in the sidebar.
     pub order: usize,
+    /// The agent's name, one of `providers()`.
     pub provider: String,
+    /// The agent's command line.
+    #[serde(skip_serializing_if = "String::is_empty")]
+    pub command: String,
+    /// The pane is gone and only kept to show how it ended.
+    pub terminated: bool,
+    /// Held at Busy by the user until they clear it.
+    pub do_not_disturb: bool,
+    /// Attention is muted until then.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub snoozed_until: Option<DateTime<Utc>>,
+    /// Prompts waiting to be sent when the agent is next idle.
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub queued_prompts: Vec<String>,
+    /// What to do when the agent next finishes.
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub on_finish: Vec<trigger::FinishAction>,
+    /// Patterns watched for in this pane's output, besides the `alerts` in
+    /// the config.
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub alerts: Vec<String>,
+    /// Labels the user gave the pane.
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub tags: Vec<String>,
+}
+
+impl Pane {
+    /// The status to show for the pane: while it is snoozed, a pane waiting
+    /// on the user reads as idle. `status` itself stays the real one.
+    pub fn shown_status(&self) -> PaneStatus {
+        if self.snoozed_until.is_some() && self.status.wants_attention() {
+            PaneStatus::Idle
+        } else {
+            self.status
+        }
+    }
+}
+
+/// Expands a leading `~` to `$HOME`.
+pub fn expand_home(path: &str) -> String {
+    match (path.strip_prefix("~"), std::env::var("HOME")) {
+        (Some(rest), Ok(home)) if rest.is_empty() || rest.starts_with('/') => {
+            format!("{home}{rest}")
+        }
+        _ => path.to_string(),
+    }
+}
+
+pub fn format_age(secs: i64) -> String {
+    let secs = secs.max(0);
+    if secs < 60 {
+        format!("{}s", secs)
+    } else if secs < 3600 {
+        format!("{}m", secs / 60)
+    } else if secs < 86_400 {
+        format!("{}h", secs / 3600)
+    } else {
+        format!("{}d", secs / 86_400)
+    }
 }
@@ -0,0 +1,138 @@
+use std::collections::HashSet;
+use std::fs;
+use std::sync::{Mutex, OnceLock};
+
+use crate::agent::approve::in_workspace;
+use crate::agent::config::config;
+use crate::agent::{expand_home, log};
+
+/// Filesystems where every stat crosses a VM boundary or the network:
+/// WSL's Windows drives (`9p`, `drvfs`), NFS, SMB, and FUSE remotes.
+const SLOW_TYPES: [&str; 10] = [
+    "9p",
+    "drvfs",
+    "nfs",
+    "nfs4",
+    "cifs",
+    "smb3",
+    "smbfs",
+    "fuse.sshfs",
+    "fuse.rclone",
+    "davfs",
+];
+
+#[derive(Debug, Clone, PartialEq)]
+struct Mount {
+    point: String,
+    fstype: String,
+}
+
+/// Whether `path` lives on a slow filesystem: one of `slowPaths.paths`, a
+/// mount of a slow type, or a directory git was seen to crawl through.
+pub fn is_slow(path: &str) -> bool {
+    if path.is_empty() {
+        return false;
+    }
+    config()
+        .slow_paths
+        .paths
+        .iter()
+        .any(|slow| in_workspace(path, &expand_home(slow)))
+        || marked().lock().is_ok_and(|marked| marked.contains(path))
+        || slow_mount(mount_table(), path)
+}
+
+/// Treats `path` as slow from now on, after git took too long in it.
+pub fn mark_slow(path: &str) {
+    let Ok(mut marked) = marked().lock() else {
+        return;
+    };
+    if marked.insert(path.to_string()) {
+        log::info("slow filesystem", &[("dir", &path)]);
+    }
+}
+
+fn marked() -> &'static Mutex<HashSet<String>> {
+    static MARKED: OnceLock<Mutex<HashSet<String>>> = OnceLock::new();
+    MARKED.get_or_init(|| Mutex::new(HashSet::new()))
+}
+
+fn mount_table() -> &'static [Mount] {
+    static MOUNTS: OnceLock<Vec<Mount>> = OnceLock::new();
+    MOUNTS.get_or_init(|| {
+        fs::read_to_string("/proc/mounts")
+            .map(|text| parse_mounts(&text))
+            .unwrap_or_default()
+    })
+}
+
+fn parse_mounts(text: &str) -> Vec<Mount> {
+    text.lines()
+        .filter_map(|line| {
+            let mut fields = line.split_whitespace();
+            let point = fields.nth(1)?.replace("\\040", " ");
+            let fstype = fields.next()?.to_string();
+            Some(Mount { point, fstype })
+        })
+        .collect()
+}
+
+/// Whether the innermost mount holding `path` is of a slow type.
+fn slow_mount(mounts: &[Mount], path: &str) -> bool {
+    mounts
+        .iter()
+        .filter(|mount| in_workspace(path, &mount.point) || mount.point == "/")
+        .max_by_key(|mount| mount.point.len())
+        .is_some_and(|mount| SLOW_TYPES.contains(&mount.fstype.as_str()))
+}
+
+/// Maps a Windows path, as `C:\src\api` or the `/C:/src/api` of a `file:`
+/// URL, onto WSL's drive mounts as `/mnt/c/src/api`. Other paths pass
+/// through.
+pub fn posix_path(path: &str) -> String {
+    let windows = path.strip_prefix('/').unwrap_or(path);
+    let mut chars = windows.chars();
+    let (Some(drive), Some(':')) = (chars.next(), chars.next()) else {
+        return path.to_string();
+    };
+    let rest = chars.as_str();
+    if !drive.is_ascii_alphabetic() || !(rest.is_empty() || rest.starts_with(['\\', '/'])) {
+        return path.to_string();
+    }
+    let rest = rest.replace('\\', "/");
+    format!(
+        "/mnt/{}{}",
+        drive.to_ascii_lowercase(),
+        rest.trim_end_matches('/')
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn finds_slow_filesystems_by_innermost_mount() {
+        let mounts = parse_mounts(
+            "/dev/sdc / ext4 rw,relatime 0 0\n\
+             C:\\134 /mnt/c 9p rw,noatime 0 0\n\
+             /dev/sdd /mnt/c/cache ext4 rw 0 0\n\
+             server:/export /home/me/nfs\\040share nfs4 rw 0 0\n",
+        );
+
+        assert!(!slow_mount(&mounts, "/home/me/src"));
+        assert!(slow_mount(&mounts, "/mnt/c/Users/me/src"));
+        assert!(!slow_mount(&mounts, "/mnt/c/cache/build"));
+        assert!(!slow_mount(&mounts, "/mnt/cdrom"));
+        assert!(slow_mount(&mounts, "/home/me/nfs share/api"));
+    }
+
+    #[test]
+    fn maps_windows_paths_onto_drive_mounts() {
+        assert_eq!(posix_path(r"C:\Users\me\src"), "/mnt/c/Users/me/src");
+        assert_eq!(posix_path("/D:/work/api/"), "/mnt/d/work/api");
+        assert_eq!(posix_path("C:"), "/mnt/c");
+        assert_eq!(posix_path("/home/me/src"), "/home/me/src");
+        assert_eq!(posix_path("/a:b"), "/a:b");
+    }
+}
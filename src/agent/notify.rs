@@ -0,0 +1,225 @@
+use std::collections::HashMap;
+use std::process::Command;
+
+use chrono::{DateTime, Duration, Utc};
+
+use crate::agent::config::{NotificationConfig, config};
+use crate::agent::events::{Event, StatusChange, status_changes};
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt};
+use crate::agent::{Pane, PaneStatus, log, tmux};
+
+/// Dispatches desktop notifications for status transitions. Only the watcher
+/// owns one, so every transition is announced at most once per cooldown no
+/// matter how many clients are attached.
+#[derive(Debug, Default)]
+pub struct Notifier {
+    sent: HashMap<(String, PaneStatus), DateTime<Utc>>,
+}
+
+impl Notifier {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn notify(&mut self, panes: &[Pane], events: &[Event]) {
+        let settings = &config().notifications;
+        for change in self.due(panes, events, settings, Utc::now()) {
+            let Some(pane) = panes.iter().find(|pane| pane.pane_id == change.pane_id) else {
+                continue;
+            };
+            let title = format!("agent-mux: {}", label(change.to));
+            let body = body(pane);
+            let settings = settings.clone();
+            std::thread::spawn(move || {
+                if settings.desktop
+                    && let Err(err) = send(&settings.command, &title, &body, &change)
+                {
+                    log::warn(
+                        "notification failed",
+                        &[("pane", &change.pane_id), ("err", &err)],
+                    );
+                }
+                if settings.tmux
+                    && let Err(err) =
+                        tmux::display_message(&format!("agent-mux: {body} {}", label(change.to)))
+                {
+                    log::warn(
+                        "tmux message failed",
+                        &[("pane", &change.pane_id), ("err", &format!("{err:#}"))],
+                    );
+                }
+            });
+        }
+    }
+
+    fn due(
+        &mut self,
+        panes: &[Pane],
+        events: &[Event],
+        settings: &NotificationConfig,
+        now: DateTime<Utc>,
+    ) -> Vec<StatusChange> {
+        let cooldown = Duration::seconds(settings.cooldown_secs as i64);
+        self.sent.retain(|_, at| now - *at < cooldown);
+
+        let mut due = Vec::new();
+        for change in status_changes(events) {
+            if !settings.statuses.contains(&change.to) {
+                continue;
+            }
+            let quiet = panes
+                .iter()
+                .find(|pane| pane.pane_id == change.pane_id)
+                .is_none_or(|pane| pane.stashed || pane.terminated || pane.snoozed_until.is_some());
+            if quiet {
+                continue;
+            }
+            let key = (change.pane_id.clone(), change.to);
+            if self.sent.contains_key(&key) {
+                continue;
+            }
+            self.sent.insert(key, now);
+            due.push(change.clone());
+        }
+        due
+    }
+}
+
+/// Sends `message` about a pane through the configured notification
+/// channels, whether or not status notifications are enabled. An empty
+/// message says the pane finished.
+pub fn announce(pane: &Pane, message: &str) -> anyhow::Result<()> {
+    let settings = &config().notifications;
+    let change = StatusChange::from_pane(pane, Some(PaneStatus::Busy), Utc::now());
+    let body = match message {
+        "" => format!("{} finished", body(pane)),
+        message => format!("{message} ({})", body(pane)),
+    };
+    if settings.desktop {
+        send(&settings.command, "agent-mux", &body, &change)?;
+    }
+    if settings.tmux {
+        tmux::display_message(&format!("agent-mux: {body}"))?;
+    }
+    Ok(())
+}
+
+fn label(status: PaneStatus) -> &'static str {
+    match status {
+        PaneStatus::NeedsAttention => "needs attention",
+        PaneStatus::Unread => "finished",
+        PaneStatus::Busy => "working",
+        PaneStatus::Idle => "idle",
+        PaneStatus::Error => "errored",
+        PaneStatus::Disconnected => "disconnected",
+    }
+}
+
+fn body(pane: &Pane) -> String {
+    let location = if pane.short_path.is_empty() {
+        &pane.target
+    } else {
+        &pane.short_path
+    };
+    format!("{} in {location}", pane.provider)
+}
+
+fn send(command: &str, title: &str, body: &str, change: &StatusChange) -> std::io::Result<()> {
+    let mut cmd = if !command.is_empty() {
+        let mut cmd = Command::new("sh");
+        cmd.arg("-c").arg(command);
+        cmd
+    } else if cfg!(target_os = "macos") {
+        let mut cmd = Command::new("osascript");
+        cmd.arg("-e").arg(format!(
+            "display notification {} with title {}",
+            applescript_string(body),
+            applescript_string(title)
+        ));
+        cmd
+    } else {
+        let mut cmd = Command::new("notify-send");
+        cmd.arg("--app-name=agent-mux").arg(title).arg(body);
+        cmd
+    };
+    cmd.env("AGENT_MUX_TITLE", title)
+        .env("AGENT_MUX_BODY", body)
+        .env("AGENT_MUX_PANE", &change.pane_id)
+        .env("AGENT_MUX_TARGET", &change.target)
+        .env("AGENT_MUX_STATUS", change.to.as_str());
+    let status = cmd.status_within(COMMAND_TIMEOUT)?;
+    if status.success() {
+        Ok(())
+    } else {
+        Err(std::io::Error::other(format!("exited with {status}")))
+    }
+}
+
+fn applescript_string(s: &str) -> String {
+    format!("\"{}\"", s.replace('\\', "\\\\").replace('"', "\\\""))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::agent::events::EventBus;
+
+    fn pane(id: &str, status: PaneStatus) -> Pane {
+        Pane {
+            pane_id: id.to_string(),
+            target: format!("s:1.{id}"),
+            status,
+            ..Pane::default()
+        }
+    }
+
+    #[derive(Default)]
+    struct Watcher {
+        bus: EventBus,
+        notifier: Notifier,
+    }
+
+    impl Watcher {
+        fn due(&mut self, panes: &[Pane], now: DateTime<Utc>) -> Vec<StatusChange> {
+            let events = self.bus.update(panes);
+            self.notifier
+                .due(panes, &events, &NotificationConfig::default(), now)
+        }
+    }
+
+    #[test]
+    fn notifies_each_transition_once_per_cooldown() {
+        let settings = NotificationConfig::default();
+        let mut watcher = Watcher::default();
+        let now = Utc::now();
+        watcher.due(&[pane("%1", PaneStatus::Busy)], now);
+
+        let due = watcher.due(&[pane("%1", PaneStatus::Unread)], now);
+        assert_eq!(due.len(), 1);
+
+        watcher.due(&[pane("%1", PaneStatus::Busy)], now);
+        let again = watcher.due(&[pane("%1", PaneStatus::Unread)], now);
+        assert!(again.is_empty());
+
+        watcher.due(&[pane("%1", PaneStatus::Busy)], now);
+        let later = now + Duration::seconds(settings.cooldown_secs as i64);
+        let after = watcher.due(&[pane("%1", PaneStatus::Unread)], later);
+        assert_eq!(after.len(), 1);
+    }
+
+    #[test]
+    fn skips_unconfigured_statuses_and_stashed_panes() {
+        let mut watcher = Watcher::default();
+        let now = Utc::now();
+        watcher.due(
+            &[pane("%1", PaneStatus::Idle), pane("%2", PaneStatus::Busy)],
+            now,
+        );
+
+        let mut stashed = pane("%2", PaneStatus::NeedsAttention);
+        stashed.stashed = true;
+        let due = watcher.due(&[pane("%1", PaneStatus::Busy), stashed], now);
+
+        assert!(due.is_empty());
+    }
+}
@@ -0,0 +1,181 @@
+use std::collections::HashSet;
+use std::fs::{self, File, OpenOptions};
+use std::io::{self, BufRead, Write};
+use std::path::{Path, PathBuf};
+
+use anyhow::{Context, Result};
+use chrono::{DateTime, Local, Utc};
+
+use crate::agent::archive::{prune_days, workspace_slug};
+use crate::agent::config::config;
+use crate::agent::persist::state_dir;
+use crate::agent::web::strip_ansi;
+use crate::agent::{Pane, log, tmux};
+
+pub fn output_dir() -> PathBuf {
+    state_dir().join("output")
+}
+
+/// Pipes each local tmux agent pane's output to
+/// `output/<date>/<workspace>-<time>-<pane>.log` once, when the watcher
+/// first sees it.
+#[derive(Debug, Default)]
+pub struct OutputLogger {
+    piped: HashSet<String>,
+}
+
+impl OutputLogger {
+    pub fn new() -> Self {
+        if config().output_log.enabled {
+            prune_days(&output_dir(), Utc::now());
+        }
+        Self::default()
+    }
+
+    pub fn run(&mut self, panes: &[Pane]) {
+        if !config().output_log.enabled || !tmux::supports(tmux::Feature::PaneOptions) {
+            return;
+        }
+        let now = Utc::now();
+        for p in panes {
+            if !p.host.is_empty()
+                || !p.pane_id.starts_with('%')
+                || p.terminated
+                || !self.piped.insert(p.pane_id.clone())
+            {
+                continue;
+            }
+            let file = output_dir().join(log_name(p, now.with_timezone(&Local)));
+            if let Err(err) = start(&p.pane_id, &file) {
+                log::warn(
+                    "pipe pane output failed",
+                    &[("pane", &p.pane_id), ("err", &format!("{err:#}"))],
+                );
+            }
+        }
+        self.piped
+            .retain(|id| panes.iter().any(|p| &p.pane_id == id));
+    }
+}
+
+fn log_name(p: &Pane, at: DateTime<Local>) -> PathBuf {
+    Path::new(&at.format("%Y-%m-%d").to_string()).join(format!(
+        "{}-{}-{}.log",
+        workspace_slug(&p.path),
+        at.format("%H%M%S"),
+        p.pane_id.trim_start_matches('%')
+    ))
+}
+
+fn start(pane_id: &str, file: &Path) -> Result<()> {
+    if let Some(dir) = file.parent() {
+        fs::create_dir_all(dir).context("create output dir")?;
+    }
+    tmux::pipe_pane(pane_id, file)?;
+    Ok(())
+}
+
+/// Copies a pane's output from stdin into `file` as plain text until the
+/// pane closes. tmux runs this through `agent-mux pipe-log`.
+pub fn sink(file: &Path) -> Result<()> {
+    let settings = config().output_log;
+    let max_bytes = settings.max_size_mb.max(1) * 1024 * 1024;
+    let mut out = open(file)?;
+    let mut size = out.metadata().map(|meta| meta.len()).unwrap_or(0);
+    let mut input = io::stdin().lock();
+    let mut line = Vec::new();
+    loop {
+        line.clear();
+        if input.read_until(b'\n', &mut line)? == 0 {
+            return Ok(());
+        }
+        let text = strip_ansi(&String::from_utf8_lossy(&line)).replace('\r', "");
+        if text.trim().is_empty() {
+            continue;
+        }
+        out.write_all(text.as_bytes())
+            .with_context(|| format!("write {}", file.display()))?;
+        size += text.len() as u64;
+        if size >= max_bytes {
+            drop(out);
+            rotate(file, settings.keep)?;
+            out = open(file)?;
+            size = 0;
+        }
+    }
+}
+
+fn open(file: &Path) -> Result<File> {
+    OpenOptions::new()
+        .create(true)
+        .append(true)
+        .open(file)
+        .with_context(|| format!("open {}", file.display()))
+}
+
+fn rotated(file: &Path, n: usize) -> PathBuf {
+    PathBuf::from(format!("{}.{n}", file.display()))
+}
+
+/// Shifts `file.1` to `file.2` and so on, dropping the oldest beyond `keep`,
+/// and moves `file` to `file.1`.
+fn rotate(file: &Path, keep: usize) -> Result<()> {
+    if keep == 0 {
+        return fs::remove_file(file).with_context(|| format!("remove {}", file.display()));
+    }
+    for n in (1..keep).rev() {
+        let from = rotated(file, n);
+        if from.exists() {
+            fs::rename(&from, rotated(file, n + 1)).context("rotate output log")?;
+        }
+    }
+    fs::rename(file, rotated(file, 1)).context("rotate output log")
+}
+
+/// Everything still on disk for a log, oldest rotation first.
+pub fn read(file: &Path) -> String {
+    (1..=config().output_log.keep)
+        .rev()
+        .map(|n| rotated(file, n))
+        .chain([file.to_path_buf()])
+        .filter_map(|file| fs::read_to_string(file).ok())
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use chrono::TimeZone;
+
+    #[test]
+    fn rotates_logs_keeping_the_newest() -> Result<()> {
+        let dir = std::env::temp_dir().join(format!("agent-mux-output-{}", std::process::id()));
+        fs::create_dir_all(&dir)?;
+        let file = dir.join("pane.log");
+        for text in ["one\n", "two\n", "three\n"] {
+            fs::write(&file, text)?;
+            rotate(&file, 2)?;
+        }
+        fs::write(&file, "four\n")?;
+
+        assert_eq!(read(&file), "two\nthree\nfour\n");
+        assert!(!rotated(&file, 3).exists());
+        fs::remove_dir_all(&dir)?;
+        Ok(())
+    }
+
+    #[test]
+    fn names_logs_by_workspace_time_and_pane() {
+        let at = Local.with_ymd_and_hms(2026, 3, 2, 14, 5, 9).unwrap();
+        let p = Pane {
+            pane_id: "%12".to_string(),
+            path: "/src/api".to_string(),
+            ..Pane::default()
+        };
+
+        assert_eq!(
+            log_name(&p, at),
+            Path::new("2026-03-02/src-api-140509-12.log")
+        );
+    }
+}
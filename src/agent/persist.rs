@@ -1,25 +1,38 @@
+use std::collections::{BTreeMap, BTreeSet, HashSet};
 use std::fs::{self, File, OpenOptions};
 use std::io::Write;
 use std::path::PathBuf;
 
 use anyhow::{Context, Result};
-use chrono::{DateTime, Utc};
+use chrono::{DateTime, Duration, Utc};
 use fs2::FileExt;
 use serde::{Deserialize, Serialize, de::DeserializeOwned};
 
-use crate::agent::{Pane, PaneStatus, tmux::parse_target};
+use crate::agent::config::{AutoStash, config};
+use crate::agent::remote::split_remote_target;
+use crate::agent::review::Review;
+use crate::agent::spawn::Spawn;
+use crate::agent::tasks::Task;
+use crate::agent::trigger::FinishAction;
+use crate::agent::{Pane, PaneStatus, log, tmux::parse_target};
 
 #[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
 pub struct CachedPane {
     #[serde(rename = "paneID", default, skip_serializing_if = "String::is_empty")]
     pub pane_id: String,
     pub target: String,
+    #[serde(default, skip_serializing_if = "String::is_empty")]
+    pub host: String,
     #[serde(
         rename = "windowName",
         default,
         skip_serializing_if = "String::is_empty"
     )]
     pub window_name: String,
+    #[serde(rename = "windowNamed", default, skip_serializing_if = "is_false")]
+    pub window_named: bool,
+    #[serde(default, skip_serializing_if = "String::is_empty")]
+    pub title: String,
     #[serde(default)]
     pub path: String,
     #[serde(rename = "shortPath", default)]
@@ -60,6 +73,12 @@ pub struct CachedPane {
     pub provider: String,
     #[serde(rename = "windowActive", default, skip_serializing_if = "is_false")]
     pub window_active: bool,
+    #[serde(
+        rename = "windowActivity",
+        default,
+        skip_serializing_if = "is_zero_u64"
+    )]
+    pub window_activity: u64,
     #[serde(
         rename = "statusOverride",
         default,
@@ -78,12 +97,30 @@ pub struct CachedPane {
         skip_serializing_if = "Option::is_none"
     )]
     pub last_status: Option<i32>,
+    #[serde(
+        rename = "attentionReason",
+        default,
+        skip_serializing_if = "String::is_empty"
+    )]
+    pub attention_reason: String,
     #[serde(
         rename = "lastActive",
         default,
         skip_serializing_if = "Option::is_none"
     )]
     pub last_active: Option<DateTime<Utc>>,
+    #[serde(rename = "busySince", default, skip_serializing_if = "Option::is_none")]
+    pub busy_since: Option<DateTime<Utc>>,
+    #[serde(
+        rename = "statusSince",
+        default,
+        skip_serializing_if = "Option::is_none"
+    )]
+    pub status_since: Option<DateTime<Utc>>,
+    #[serde(default, skip_serializing_if = "String::is_empty")]
+    pub command: String,
+    #[serde(default, skip_serializing_if = "is_false")]
+    pub terminated: bool,
 }
 
 #[derive(Debug, Clone, Default, Serialize, Deserialize)]
@@ -118,6 +155,32 @@ pub struct Heartbeat {
     pub version: i32,
     #[serde(rename = "updatedAt", default, skip_serializing_if = "Option::is_none")]
     pub updated_at: Option<DateTime<Utc>>,
+    #[serde(default, skip_serializing_if = "is_zero_u32")]
+    pub pid: u32,
+    #[serde(rename = "startedAt", default, skip_serializing_if = "Option::is_none")]
+    pub started_at: Option<DateTime<Utc>>,
+    #[serde(
+        rename = "lastRefreshAt",
+        default,
+        skip_serializing_if = "Option::is_none"
+    )]
+    pub last_refresh_at: Option<DateTime<Utc>>,
+    #[serde(
+        rename = "lastError",
+        default,
+        skip_serializing_if = "String::is_empty"
+    )]
+    pub last_error: String,
+    #[serde(
+        rename = "lastErrorAt",
+        default,
+        skip_serializing_if = "Option::is_none"
+    )]
+    pub last_error_at: Option<DateTime<Utc>>,
+    /// The watcher's recent warnings and errors, for the diagnostics
+    /// overlay.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub problems: Vec<log::Problem>,
 }
 
 #[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
@@ -130,6 +193,44 @@ pub struct UiState {
     pub last_position: LastPosition,
     #[serde(rename = "sidebarWidth", default, skip_serializing_if = "is_zero_u16")]
     pub sidebar_width: u16,
+    /// Where each sidebar was left, by `tmux::view_key`, until its window or
+    /// session closes. Replaces `lastPosition` and `sidebarWidth`, which are
+    /// only read as a fallback.
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub views: BTreeMap<String, ViewState>,
+    /// Bookmark letter to pane id.
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub marks: BTreeMap<String, String>,
+    #[serde(default, skip_serializing_if = "PaneFilter::is_all")]
+    pub filter: PaneFilter,
+    #[serde(default, skip_serializing_if = "PaneSort::is_manual")]
+    pub sort: PaneSort,
+    #[serde(default, skip_serializing_if = "PaneTree::is_paths")]
+    pub tree: PaneTree,
+    /// Headers folded away with `zc`, by the sidebar's collapse key.
+    #[serde(default, skip_serializing_if = "BTreeSet::is_empty")]
+    pub collapsed: BTreeSet<String>,
+    /// Tags by `tag_key` rather than pane id, so an agent restarted in the
+    /// same place keeps them.
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub tags: BTreeMap<String, Vec<String>>,
+    /// When set, only panes with this tag are listed.
+    #[serde(
+        rename = "tagFilter",
+        default,
+        skip_serializing_if = "String::is_empty"
+    )]
+    pub tag_filter: String,
+    /// Review verdicts by workspace path.
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub reviews: BTreeMap<String, Review>,
+    /// Preview refresh speeds other than normal, by pane id.
+    #[serde(
+        rename = "previewRates",
+        default,
+        skip_serializing_if = "BTreeMap::is_empty"
+    )]
+    pub preview_rates: BTreeMap<String, PreviewRate>,
     #[serde(rename = "updatedAt", default, skip_serializing_if = "Option::is_none")]
     pub updated_at: Option<DateTime<Utc>>,
 }
@@ -152,6 +253,59 @@ pub struct UiPaneState {
         skip_serializing_if = "String::is_empty"
     )]
     pub manual_status_base_hash: String,
+    #[serde(
+        rename = "manualStatusAt",
+        default,
+        skip_serializing_if = "Option::is_none"
+    )]
+    pub manual_status_at: Option<DateTime<Utc>>,
+    #[serde(rename = "doNotDisturb", default, skip_serializing_if = "is_false")]
+    pub do_not_disturb: bool,
+    #[serde(default, skip_serializing_if = "is_false")]
+    pub dismissed: bool,
+    #[serde(
+        rename = "snoozedUntil",
+        default,
+        skip_serializing_if = "Option::is_none"
+    )]
+    pub snoozed_until: Option<DateTime<Utc>>,
+    /// The pane's last activity when it was auto-stashed, so it is stashed
+    /// once per idle stretch and only new activity unstashes it.
+    #[serde(
+        rename = "autoStashedActivity",
+        default,
+        skip_serializing_if = "Option::is_none"
+    )]
+    pub auto_stashed_activity: Option<DateTime<Utc>>,
+    #[serde(
+        rename = "queuedPrompts",
+        default,
+        skip_serializing_if = "Vec::is_empty"
+    )]
+    pub queued_prompts: Vec<String>,
+    #[serde(rename = "onFinish", default, skip_serializing_if = "Vec::is_empty")]
+    pub on_finish: Vec<FinishAction>,
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub alerts: Vec<String>,
+}
+
+/// A sidebar's own cursor and width. Sidebars open side by side keep
+/// theirs apart, so none resets another when it quits.
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct ViewState {
+    #[serde(rename = "lastPosition", default)]
+    pub last_position: LastPosition,
+    #[serde(rename = "sidebarWidth", default, skip_serializing_if = "is_zero_u16")]
+    pub sidebar_width: u16,
+}
+
+impl UiState {
+    pub fn view(&self, key: &str) -> ViewState {
+        self.views.get(key).cloned().unwrap_or_else(|| ViewState {
+            last_position: self.last_position.clone(),
+            sidebar_width: self.sidebar_width,
+        })
+    }
 }
 
 #[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
@@ -170,6 +324,135 @@ pub struct LastPosition {
     pub scroll_start: usize,
 }
 
+/// Which panes the sidebar lists. Each step hides more than the last.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum PaneFilter {
+    #[default]
+    All,
+    HideStashed,
+    HideIdle,
+    AttentionOnly,
+}
+
+impl PaneFilter {
+    pub fn next(self) -> Self {
+        match self {
+            Self::All => Self::HideStashed,
+            Self::HideStashed => Self::HideIdle,
+            Self::HideIdle => Self::AttentionOnly,
+            Self::AttentionOnly => Self::All,
+        }
+    }
+
+    pub fn label(self) -> &'static str {
+        match self {
+            Self::All => "all",
+            Self::HideStashed => "hide stashed",
+            Self::HideIdle => "hide idle and stashed",
+            Self::AttentionOnly => "attention only",
+        }
+    }
+
+    pub fn shows(self, pane: &Pane) -> bool {
+        match self {
+            Self::All => true,
+            Self::HideStashed => !pane.stashed,
+            Self::HideIdle => {
+                !pane.stashed
+                    && !matches!(
+                        pane.shown_status(),
+                        PaneStatus::Idle | PaneStatus::Disconnected
+                    )
+            }
+            Self::AttentionOnly => !pane.stashed && pane.shown_status().wants_attention(),
+        }
+    }
+
+    fn is_all(&self) -> bool {
+        *self == Self::All
+    }
+}
+
+/// How the sidebar orders workspaces and the panes within them.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum PaneSort {
+    /// tmux order.
+    #[default]
+    Manual,
+    /// Most urgent status first, then most recently active.
+    Status,
+}
+
+impl PaneSort {
+    pub fn next(self) -> Self {
+        match self {
+            Self::Manual => Self::Status,
+            Self::Status => Self::Manual,
+        }
+    }
+
+    fn is_manual(&self) -> bool {
+        *self == Self::Manual
+    }
+}
+
+/// How often the sidebar recaptures a pane's preview on its own.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum PreviewRate {
+    Fast,
+    #[default]
+    Normal,
+    Paused,
+}
+
+impl PreviewRate {
+    pub fn next(self) -> Self {
+        match self {
+            Self::Normal => Self::Fast,
+            Self::Fast => Self::Paused,
+            Self::Paused => Self::Normal,
+        }
+    }
+
+    pub fn label(self) -> &'static str {
+        match self {
+            Self::Fast => "fast",
+            Self::Normal => "normal",
+            Self::Paused => "paused",
+        }
+    }
+}
+
+/// How the sidebar nests panes.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum PaneTree {
+    /// Under their workspace or project directory.
+    #[default]
+    Paths,
+    /// Under their tmux window, under its session.
+    Tmux,
+    /// Under their first tag.
+    Tags,
+}
+
+impl PaneTree {
+    pub fn next(self) -> Self {
+        match self {
+            Self::Paths => Self::Tmux,
+            Self::Tmux => Self::Tags,
+            Self::Tags => Self::Paths,
+        }
+    }
+
+    fn is_paths(&self) -> bool {
+        *self == Self::Paths
+    }
+}
+
 fn is_false(v: &bool) -> bool {
     !*v
 }
@@ -180,6 +463,14 @@ fn is_zero_u16(v: &u16) -> bool {
     *v == 0
 }
 
+fn is_zero_u32(v: &u32) -> bool {
+    *v == 0
+}
+
+fn is_zero_u64(v: &u64) -> bool {
+    *v == 0
+}
+
 impl CachedPane {
     pub fn pane_key(&self) -> &str {
         if self.pane_id.is_empty() {
@@ -218,6 +509,11 @@ pub fn load_ui_state() -> UiState {
 
 pub fn apply_ui_state(panes: &mut [Pane], ui_state: &UiState) {
     for pane in panes {
+        pane.tags = ui_state
+            .tags
+            .get(&tag_key(pane))
+            .cloned()
+            .unwrap_or_default();
         if let Some(ui) = ui_state
             .panes
             .get(&pane.pane_id)
@@ -230,7 +526,9 @@ pub fn apply_ui_state(panes: &mut [Pane], ui_state: &UiState) {
 
 pub fn apply_pane_ui_state(pane: &mut Pane, ui: &UiPaneState) {
     pane.stashed = ui.stashed;
-    if let Some(status) = ui.manual_status {
+    if let Some(status) = ui.manual_status
+        && !manual_status_lapsed(ui, config().transitions.override_minutes, Utc::now())
+    {
         pane.status = display_status(
             pane.status,
             &pane.content_hash,
@@ -238,6 +536,21 @@ pub fn apply_pane_ui_state(pane: &mut Pane, ui: &UiPaneState) {
             &ui.manual_status_base_hash,
         );
     }
+    pane.do_not_disturb = ui.do_not_disturb;
+    if ui.do_not_disturb {
+        pane.status = PaneStatus::Busy;
+    }
+    pane.queued_prompts = ui.queued_prompts.clone();
+    pane.on_finish = ui.on_finish.clone();
+    pane.alerts = ui.alerts.clone();
+    pane.snoozed_until = ui.snoozed_until.filter(|until| *until > Utc::now());
+}
+
+fn manual_status_lapsed(ui: &UiPaneState, override_minutes: u64, now: DateTime<Utc>) -> bool {
+    override_minutes > 0
+        && ui
+            .manual_status_at
+            .is_some_and(|at| now - at >= Duration::minutes(override_minutes as i64))
 }
 
 pub fn display_status(
@@ -266,8 +579,100 @@ pub fn has_manual_status(ui_state: &UiState, pane_id: &str, pane_target: &str) -
         .is_some()
 }
 
+impl UiState {
+    /// Whether the sidebar lists `pane` under the filter and tag filter.
+    pub fn shows(&self, pane: &Pane) -> bool {
+        self.filter.shows(pane)
+            && (self.tag_filter.is_empty() || pane.tags.contains(&self.tag_filter))
+    }
+}
+
+/// Where a pane's tags are kept: its host, directory and window name,
+/// which outlive the pane itself.
+pub fn tag_key(pane: &Pane) -> String {
+    format!("{}:{}:{}", pane.host, pane.path, pane.window_name)
+}
+
+/// Splits `text` on spaces and commas into tags, without a leading `#` and
+/// without repeats.
+pub fn parse_tags(text: &str) -> Vec<String> {
+    let mut tags: Vec<String> = Vec::new();
+    for tag in text.split([' ', ',']) {
+        let tag = tag.trim_start_matches('#');
+        if !tag.is_empty() && !tags.iter().any(|t| t == tag) {
+            tags.push(tag.to_string());
+        }
+    }
+    tags
+}
+
+pub fn set_pane_tags(pane: &Pane, tags: Vec<String>) -> Result<()> {
+    update_ui_state(|state| {
+        if tags.is_empty() {
+            state.tags.remove(&tag_key(pane));
+        } else {
+            state.tags.insert(tag_key(pane), tags.clone());
+        }
+    })
+}
+
 pub fn ui_pane_state_is_empty(ui: &UiPaneState) -> bool {
-    !ui.stashed && ui.manual_status.is_none()
+    !ui.stashed
+        && ui.manual_status.is_none()
+        && !ui.do_not_disturb
+        && !ui.dismissed
+        && ui.snoozed_until.is_none_or(|until| until <= Utc::now())
+        && ui.auto_stashed_activity.is_none()
+        && ui.queued_prompts.is_empty()
+        && ui.on_finish.is_empty()
+        && ui.alerts.is_empty()
+}
+
+pub fn auto_stash(state: &mut UiState, panes: &[Pane], policy: AutoStash, now: DateTime<Utc>) {
+    if policy.idle_hours == 0 {
+        return;
+    }
+    // An `idleHours` beyond what a duration holds means never.
+    let Some(idle_for) = i64::try_from(policy.idle_hours)
+        .ok()
+        .and_then(Duration::try_hours)
+    else {
+        return;
+    };
+    for pane in panes {
+        let Some(last_active) = pane.last_active else {
+            continue;
+        };
+        if pane.terminated {
+            continue;
+        }
+        let ui = state.panes.entry(pane.pane_id.clone()).or_default();
+        match ui.auto_stashed_activity {
+            Some(stashed_at) if stashed_at == last_active => {}
+            Some(_) => {
+                if policy.unstash_on_activity && ui.stashed {
+                    ui.stashed = false;
+                }
+                ui.auto_stashed_activity = None;
+            }
+            None => {
+                if !ui.stashed && pane.status == PaneStatus::Idle && now - last_active >= idle_for {
+                    ui.stashed = true;
+                    ui.auto_stashed_activity = Some(last_active);
+                }
+            }
+        }
+    }
+    state.panes.retain(|_, ui| !ui_pane_state_is_empty(ui));
+}
+
+pub fn dismissed_panes(ui_state: &UiState) -> HashSet<String> {
+    ui_state
+        .panes
+        .iter()
+        .filter(|(_, ui)| ui.dismissed)
+        .map(|(id, _)| id.clone())
+        .collect()
 }
 
 fn ui_state_from_legacy_state(state: State) -> UiState {
@@ -280,6 +685,14 @@ fn ui_state_from_legacy_state(state: State) -> UiState {
                 stashed: cp.stashed,
                 manual_status: cp.status_override,
                 manual_status_base_hash: cp.content_hash,
+                manual_status_at: None,
+                do_not_disturb: false,
+                dismissed: false,
+                snoozed_until: None,
+                auto_stashed_activity: None,
+                queued_prompts: Vec::new(),
+                on_finish: Vec::new(),
+                alerts: Vec::new(),
             };
             (ui.stashed || ui.manual_status.is_some()).then_some((key, ui))
         })
@@ -289,6 +702,16 @@ fn ui_state_from_legacy_state(state: State) -> UiState {
         panes,
         last_position: state.last_position,
         sidebar_width: state.sidebar_width,
+        views: BTreeMap::new(),
+        marks: BTreeMap::new(),
+        filter: PaneFilter::All,
+        sort: PaneSort::Manual,
+        tree: PaneTree::Paths,
+        collapsed: BTreeSet::new(),
+        tags: BTreeMap::new(),
+        tag_filter: String::new(),
+        reviews: BTreeMap::new(),
+        preview_rates: BTreeMap::new(),
         updated_at: state.updated_at,
     }
 }
@@ -334,6 +757,7 @@ fn comparable_panes(panes: &[CachedPane]) -> Vec<CachedPane> {
             pane.stashed = false;
             pane.status_override = None;
             pane.window_active = false;
+            pane.window_activity = 0;
             pane.content_hash.clear();
             pane.last_active = None;
             pane
@@ -342,18 +766,50 @@ fn comparable_panes(panes: &[CachedPane]) -> Vec<CachedPane> {
 }
 
 pub fn write_heartbeat() -> Result<()> {
+    update_heartbeat(|_| {})
+}
+
+pub fn update_heartbeat(f: impl FnOnce(&mut Heartbeat)) -> Result<()> {
     let lock_file = lock_file(heartbeat_write_lock_path())?;
-    write_json_file(
-        heartbeat_path(),
-        &Heartbeat {
-            version: 1,
-            updated_at: Some(Utc::now()),
-        },
-    )?;
+    let mut heartbeat = load_heartbeat().unwrap_or_default();
+    f(&mut heartbeat);
+    heartbeat.version = 1;
+    heartbeat.updated_at = Some(Utc::now());
+    write_json_file(heartbeat_path(), &heartbeat)?;
     drop(lock_file);
     Ok(())
 }
 
+pub fn load_heartbeat() -> Option<Heartbeat> {
+    load_json_file(heartbeat_path())
+}
+
+pub fn load_tasks() -> Vec<Task> {
+    load_json_file(tasks_path()).unwrap_or_default()
+}
+
+pub fn update_tasks<T>(f: impl FnOnce(&mut Vec<Task>) -> T) -> Result<T> {
+    let lock_file = lock_file(tasks_write_lock_path())?;
+    let mut tasks = load_tasks();
+    let result = f(&mut tasks);
+    write_json_file(tasks_path(), &tasks)?;
+    drop(lock_file);
+    Ok(result)
+}
+
+pub fn load_spawns() -> Vec<Spawn> {
+    load_json_file(spawns_path()).unwrap_or_default()
+}
+
+pub fn update_spawns<T>(f: impl FnOnce(&mut Vec<Spawn>) -> T) -> Result<T> {
+    let lock_file = lock_file(spawns_write_lock_path())?;
+    let mut spawns = load_spawns();
+    let result = f(&mut spawns);
+    write_json_file(spawns_path(), &spawns)?;
+    drop(lock_file);
+    Ok(result)
+}
+
 pub fn update_ui_state_if_changed(mut f: impl FnMut(&mut UiState)) -> Result<bool> {
     let lock_file = lock_file(ui_state_write_lock_path())?;
     let mut state = load_ui_state();
@@ -384,6 +840,128 @@ pub fn update_ui_state(mut f: impl FnMut(&mut UiState)) -> Result<()> {
     Ok(())
 }
 
+pub fn set_pane_stashed(pane: &Pane, stashed: bool) -> Result<()> {
+    update_ui_state(|state| {
+        let entry = state.panes.entry(pane.pane_id.clone()).or_default();
+        entry.stashed = stashed;
+        if stashed {
+            entry.auto_stashed_activity = None;
+        }
+        state.panes.retain(|_, ui| !ui_pane_state_is_empty(ui));
+    })
+}
+
+/// Points bookmark `letter` at the pane, moving it off any pane it was on
+/// and replacing the pane's previous letter.
+pub fn set_mark(letter: char, pane_id: &str) -> Result<()> {
+    update_ui_state(|state| {
+        state.marks.retain(|_, id| id != pane_id);
+        state.marks.insert(letter.to_string(), pane_id.to_string());
+    })
+}
+
+pub fn dismiss_pane(pane: &Pane) -> Result<()> {
+    update_ui_state(|state| {
+        state
+            .panes
+            .entry(pane.pane_id.clone())
+            .or_default()
+            .dismissed = true;
+    })
+}
+
+pub fn set_pane_do_not_disturb(pane: &Pane, on: bool) -> Result<()> {
+    update_ui_state(|state| {
+        state
+            .panes
+            .entry(pane.pane_id.clone())
+            .or_default()
+            .do_not_disturb = on;
+        state.panes.retain(|_, ui| !ui_pane_state_is_empty(ui));
+    })
+}
+
+pub fn snooze_pane(pane: &Pane, until: Option<DateTime<Utc>>) -> Result<()> {
+    update_ui_state(|state| {
+        state
+            .panes
+            .entry(pane.pane_id.clone())
+            .or_default()
+            .snoozed_until = until;
+        state.panes.retain(|_, ui| !ui_pane_state_is_empty(ui));
+    })
+}
+
+pub fn queue_prompt(pane: &Pane, prompt: &str) -> Result<()> {
+    update_ui_state(|state| {
+        state
+            .panes
+            .entry(pane.pane_id.clone())
+            .or_default()
+            .queued_prompts
+            .push(prompt.to_string());
+    })
+}
+
+pub fn pop_queued_prompt(pane_id: &str) -> Result<Option<String>> {
+    let mut prompt = None;
+    update_ui_state_if_changed(|state| {
+        if let Some(ui) = state.panes.get_mut(pane_id)
+            && !ui.queued_prompts.is_empty()
+        {
+            prompt = Some(ui.queued_prompts.remove(0));
+        }
+        state.panes.retain(|_, ui| !ui_pane_state_is_empty(ui));
+    })?;
+    Ok(prompt)
+}
+
+pub fn add_finish_action(pane: &Pane, action: Option<FinishAction>) -> Result<()> {
+    update_ui_state(|state| {
+        let entry = state.panes.entry(pane.pane_id.clone()).or_default();
+        match &action {
+            Some(action) => entry.on_finish.push(action.clone()),
+            None => entry.on_finish.clear(),
+        }
+        state.panes.retain(|_, ui| !ui_pane_state_is_empty(ui));
+    })
+}
+
+/// Watches the pane's output for `pattern`; `None` stops watching.
+pub fn add_pane_alert(pane: &Pane, pattern: Option<&str>) -> Result<()> {
+    update_ui_state(|state| {
+        let entry = state.panes.entry(pane.pane_id.clone()).or_default();
+        match pattern {
+            Some(pattern) if !entry.alerts.iter().any(|p| p == pattern) => {
+                entry.alerts.push(pattern.to_string())
+            }
+            Some(_) => {}
+            None => entry.alerts.clear(),
+        }
+        state.panes.retain(|_, ui| !ui_pane_state_is_empty(ui));
+    })
+}
+
+pub fn take_finish_actions(pane_id: &str) -> Result<Vec<FinishAction>> {
+    let mut actions = Vec::new();
+    update_ui_state_if_changed(|state| {
+        if let Some(ui) = state.panes.get_mut(pane_id) {
+            actions = std::mem::take(&mut ui.on_finish);
+        }
+        state.panes.retain(|_, ui| !ui_pane_state_is_empty(ui));
+    })?;
+    Ok(actions)
+}
+
+pub fn set_pane_manual_status(pane: &Pane, status: PaneStatus) -> Result<()> {
+    update_ui_state(|state| {
+        let entry = state.panes.entry(pane.pane_id.clone()).or_default();
+        entry.manual_status = Some(status.as_i32());
+        entry.manual_status_base_hash = pane.content_hash.clone();
+        entry.manual_status_at = Some(Utc::now());
+    })
+}
+
 fn load_state_file(path: PathBuf) -> Option<State> {
     let state: State = load_json_file(path)?;
     (state.version == 1).then_some(state)
@@ -430,7 +1008,10 @@ pub fn cache_panes(panes: &[Pane]) -> Vec<CachedPane> {
         .map(|p| CachedPane {
             pane_id: p.pane_id.clone(),
             target: p.target.clone(),
+            host: p.host.clone(),
             window_name: p.window_name.clone(),
+            window_named: p.window_named,
+            title: p.title.clone(),
             path: p.path.clone(),
             short_path: p.short_path.clone(),
             project_root: p.project_root.clone(),
@@ -442,7 +1023,13 @@ pub fn cache_panes(panes: &[Pane]) -> Vec<CachedPane> {
             order: p.order,
             provider: p.provider.clone(),
             window_active: p.window_active,
+            window_activity: p.window_activity,
             last_active: p.last_active,
+            busy_since: p.busy_since,
+            status_since: p.status_since,
+            attention_reason: p.attention_reason.clone(),
+            command: p.command.clone(),
+            terminated: p.terminated,
             ..CachedPane::default()
         })
         .collect()
@@ -461,13 +1048,19 @@ fn panes_from_cached(panes: &[CachedPane]) -> Vec<Pane> {
             } else {
                 cp.pane_id.clone()
             };
-            let (session, window, pane) = parse_target(&cp.target);
+            let (session, window, pane) = match split_remote_target(&cp.target) {
+                Some((_, target)) => parse_target(target),
+                None => parse_target(&cp.target),
+            };
             Pane {
                 pane_id: id,
                 target: cp.target.clone(),
+                host: cp.host.clone(),
                 session,
                 window,
                 window_name: cp.window_name.clone(),
+                window_named: cp.window_named,
+                title: cp.title.clone(),
                 pane,
                 path: cp.path.clone(),
                 short_path: cp.short_path.clone(),
@@ -481,9 +1074,15 @@ fn panes_from_cached(panes: &[CachedPane]) -> Vec<Pane> {
                 order: cp.order,
                 provider: cp.provider.clone(),
                 window_active: cp.window_active,
+                window_activity: cp.window_activity,
                 content_hash: cp.content_hash.clone(),
                 status: cp.last_status.map(PaneStatus::from_i32).unwrap_or_default(),
                 last_active: cp.last_active,
+                busy_since: cp.busy_since,
+                status_since: cp.status_since,
+                attention_reason: cp.attention_reason.clone(),
+                command: cp.command.clone(),
+                terminated: cp.terminated,
                 ..Pane::default()
             }
         })
@@ -513,6 +1112,14 @@ pub fn heartbeat_path() -> PathBuf {
     state_dir().join("heartbeat.json")
 }
 
+pub fn tasks_path() -> PathBuf {
+    state_dir().join("tasks.json")
+}
+
+pub fn spawns_path() -> PathBuf {
+    state_dir().join("spawns.json")
+}
+
 pub fn snapshot_write_lock_path() -> PathBuf {
     state_dir().join("snapshot.lock")
 }
@@ -525,9 +1132,24 @@ pub fn heartbeat_write_lock_path() -> PathBuf {
     state_dir().join("heartbeat.lock")
 }
 
+pub fn tasks_write_lock_path() -> PathBuf {
+    state_dir().join("tasks.lock")
+}
+
+pub fn spawns_write_lock_path() -> PathBuf {
+    state_dir().join("spawns.lock")
+}
+
 #[cfg(test)]
 mod tests {
-    use super::{UiPaneState, UiState, apply_ui_state, display_status, has_manual_status};
+    use chrono::{Duration, Utc};
+
+    use super::{
+        LastPosition, PaneFilter, UiPaneState, UiState, ViewState, apply_ui_state, auto_stash,
+        display_status, has_manual_status, manual_status_lapsed, parse_tags, tag_key,
+        ui_pane_state_is_empty,
+    };
+    use crate::agent::config::AutoStash;
     use crate::agent::{Pane, PaneStatus};
 
     fn pane(status: PaneStatus, content_hash: &str) -> Pane {
@@ -568,6 +1190,19 @@ mod tests {
         );
     }
 
+    #[test]
+    fn manual_status_lapses_after_override_minutes() {
+        let now = Utc::now();
+        let marked = UiPaneState {
+            manual_status_at: Some(now - Duration::minutes(10)),
+            ..ui(PaneStatus::Idle, "same")
+        };
+
+        assert!(!manual_status_lapsed(&marked, 0, now));
+        assert!(!manual_status_lapsed(&marked, 15, now));
+        assert!(manual_status_lapsed(&marked, 5, now));
+    }
+
     #[test]
     fn applies_user_state_as_display_layer() {
         let mut panes = vec![pane(PaneStatus::Unread, "same")];
@@ -581,4 +1216,154 @@ mod tests {
         assert_eq!(panes[0].status, PaneStatus::Idle);
         assert!(has_manual_status(&state, "%1", "s:1.1"));
     }
+
+    #[test]
+    fn do_not_disturb_holds_busy_over_heuristics() {
+        let mut panes = vec![pane(PaneStatus::NeedsAttention, "same")];
+        let mut state = UiState::default();
+        let dnd = UiPaneState {
+            do_not_disturb: true,
+            ..UiPaneState::default()
+        };
+        state.panes.insert("%1".to_string(), dnd);
+
+        apply_ui_state(&mut panes, &state);
+
+        assert_eq!(panes[0].status, PaneStatus::Busy);
+        assert!(panes[0].do_not_disturb);
+        assert!(!ui_pane_state_is_empty(&state.panes["%1"]));
+    }
+
+    #[test]
+    fn filters_narrow_step_by_step() {
+        let mut stashed = pane(PaneStatus::Unread, "same");
+        stashed.stashed = true;
+        let panes = [
+            pane(PaneStatus::Idle, "same"),
+            pane(PaneStatus::Busy, "same"),
+            pane(PaneStatus::NeedsAttention, "same"),
+            stashed,
+        ];
+        let shown = |filter: PaneFilter| panes.iter().filter(|p| filter.shows(p)).count();
+
+        assert_eq!(shown(PaneFilter::All), 4);
+        assert_eq!(shown(PaneFilter::HideStashed), 3);
+        assert_eq!(shown(PaneFilter::HideIdle), 2);
+        assert_eq!(shown(PaneFilter::AttentionOnly), 1);
+        assert_eq!(PaneFilter::AttentionOnly.next(), PaneFilter::All);
+    }
+
+    #[test]
+    fn snooze_hides_attention_until_it_expires() {
+        let mut panes = vec![pane(PaneStatus::NeedsAttention, "same")];
+        let mut state = UiState::default();
+        let snooze = |minutes| UiPaneState {
+            snoozed_until: Some(Utc::now() + Duration::minutes(minutes)),
+            ..UiPaneState::default()
+        };
+        state.panes.insert("%1".to_string(), snooze(5));
+
+        apply_ui_state(&mut panes, &state);
+        assert_eq!(panes[0].status, PaneStatus::NeedsAttention);
+        assert_eq!(panes[0].shown_status(), PaneStatus::Idle);
+        assert!(!PaneFilter::AttentionOnly.shows(&panes[0]));
+        assert!(!ui_pane_state_is_empty(&state.panes["%1"]));
+
+        let mut panes = vec![pane(PaneStatus::NeedsAttention, "same")];
+        state.panes.insert("%1".to_string(), snooze(-5));
+        apply_ui_state(&mut panes, &state);
+        assert_eq!(panes[0].shown_status(), PaneStatus::NeedsAttention);
+        assert!(panes[0].snoozed_until.is_none());
+        assert!(ui_pane_state_is_empty(&state.panes["%1"]));
+    }
+
+    #[test]
+    fn auto_stashes_idle_panes_once_and_unstashes_on_activity() {
+        let policy = AutoStash {
+            idle_hours: 4,
+            unstash_on_activity: true,
+        };
+        let now = Utc::now();
+        let mut idle = pane(PaneStatus::Idle, "same");
+        idle.last_active = Some(now - Duration::hours(5));
+        let mut state = UiState::default();
+
+        auto_stash(&mut state, std::slice::from_ref(&idle), policy, now);
+        assert!(state.panes["%1"].stashed);
+
+        state.panes.get_mut("%1").unwrap().stashed = false;
+        auto_stash(&mut state, std::slice::from_ref(&idle), policy, now);
+        assert!(!state.panes["%1"].stashed);
+
+        state.panes.get_mut("%1").unwrap().stashed = true;
+        idle.last_active = Some(now);
+        auto_stash(&mut state, std::slice::from_ref(&idle), policy, now);
+        assert!(!state.panes.contains_key("%1"));
+
+        let never = AutoStash {
+            idle_hours: u64::MAX,
+            ..policy
+        };
+        idle.last_active = Some(now - Duration::days(365));
+        auto_stash(&mut state, &[idle], never, now);
+        assert!(!state.panes.contains_key("%1"));
+    }
+
+    #[test]
+    fn views_keep_their_own_position_and_fall_back_to_legacy() {
+        let mut state = UiState {
+            sidebar_width: 40,
+            ..UiState::default()
+        };
+        assert_eq!(state.view("pane:main:1").sidebar_width, 40);
+
+        let view = |pane_id: &str, sidebar_width| ViewState {
+            last_position: LastPosition {
+                pane_id: pane_id.to_string(),
+                ..LastPosition::default()
+            },
+            sidebar_width,
+        };
+        state.views.insert("pane:main:1".to_string(), view("%1", 0));
+        state
+            .views
+            .insert("pane:main:2".to_string(), view("%2", 32));
+
+        let json = serde_json::to_string(&state).unwrap();
+        let state: UiState = serde_json::from_str(&json).unwrap();
+        assert_eq!(state.view("pane:main:1"), view("%1", 0));
+        assert_eq!(state.view("pane:main:2"), view("%2", 32));
+    }
+
+    #[test]
+    fn tags_follow_the_place_not_the_pane() {
+        assert_eq!(parse_tags("#urgent, exp urgent"), ["urgent", "exp"]);
+
+        let old = Pane {
+            path: "/src/app".to_string(),
+            window_name: "claude".to_string(),
+            ..pane(PaneStatus::Idle, "")
+        };
+        let mut state = UiState {
+            tag_filter: "exp".to_string(),
+            ..UiState::default()
+        };
+        state.tags.insert(tag_key(&old), parse_tags("urgent exp"));
+
+        let mut panes = vec![
+            Pane {
+                pane_id: "%9".to_string(),
+                ..old.clone()
+            },
+            Pane {
+                pane_id: "%10".to_string(),
+                path: "/src/other".to_string(),
+                ..old
+            },
+        ];
+        apply_ui_state(&mut panes, &state);
+        assert_eq!(panes[0].tags, ["urgent", "exp"]);
+        assert!(state.shows(&panes[0]));
+        assert!(!state.shows(&panes[1]));
+    }
 }
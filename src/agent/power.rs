@@ -0,0 +1,124 @@
+use std::fs;
+use std::path::Path;
+use std::process::Command;
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
+
+use crate::agent::config::{PowerMode, config};
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt};
+
+/// How long a battery reading is trusted before it is taken again.
+const CHECK_INTERVAL: Duration = Duration::from_secs(30);
+
+/// Whether power-save mode is on: forced by `powerSave.mode`, or on battery
+/// under `auto`.
+pub fn power_save() -> bool {
+    match config().power_save.mode {
+        PowerMode::On => true,
+        PowerMode::Off => false,
+        PowerMode::Auto => on_battery_cached(),
+    }
+}
+
+/// The watcher's poll interval, lengthened in power-save mode.
+pub fn poll_interval(normal: Duration) -> Duration {
+    if power_save() {
+        normal.max(Duration::from_millis(config().power_save.poll_ms))
+    } else {
+        normal
+    }
+}
+
+fn on_battery_cached() -> bool {
+    static CACHE: Mutex<Option<(Instant, bool)>> = Mutex::new(None);
+    let mut cache = CACHE.lock().unwrap_or_else(|err| err.into_inner());
+    if let Some((at, on_battery)) = *cache
+        && at.elapsed() < CHECK_INTERVAL
+    {
+        return on_battery;
+    }
+    let on_battery = on_battery();
+    *cache = Some((Instant::now(), on_battery));
+    on_battery
+}
+
+/// Whether the machine runs on battery: `pmset` on macOS, the kernel's
+/// power supplies elsewhere. Desktops without a battery never are.
+pub fn on_battery() -> bool {
+    if cfg!(target_os = "macos") {
+        Command::new("pmset")
+            .args(["-g", "batt"])
+            .output_within(COMMAND_TIMEOUT)
+            .is_ok_and(|out| {
+                out.status.success() && pmset_on_battery(&String::from_utf8_lossy(&out.stdout))
+            })
+    } else {
+        sysfs_on_battery(Path::new("/sys/class/power_supply"))
+    }
+}
+
+/// `pmset -g batt` starts with "Now drawing from 'Battery Power'".
+fn pmset_on_battery(out: &str) -> bool {
+    out.lines()
+        .next()
+        .is_some_and(|line| line.contains("'Battery Power'"))
+}
+
+/// On battery when a battery is discharging and no charger is online.
+fn sysfs_on_battery(root: &Path) -> bool {
+    let Ok(entries) = fs::read_dir(root) else {
+        return false;
+    };
+    let read = |dir: &Path, name: &str| {
+        fs::read_to_string(dir.join(name))
+            .unwrap_or_default()
+            .trim()
+            .to_string()
+    };
+    let mut discharging = false;
+    for entry in entries.flatten() {
+        let dir = entry.path();
+        match read(&dir, "type").as_str() {
+            "Battery" => discharging |= read(&dir, "status") == "Discharging",
+            "Mains" | "USB" if read(&dir, "online") == "1" => return false,
+            _ => {}
+        }
+    }
+    discharging
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn reads_battery_power_from_pmset() {
+        assert!(pmset_on_battery(
+            "Now drawing from 'Battery Power'\n -InternalBattery-0\t81%; discharging\n"
+        ));
+        assert!(!pmset_on_battery(
+            "Now drawing from 'AC Power'\n -InternalBattery-0\t100%; charged\n"
+        ));
+    }
+
+    #[test]
+    fn reads_battery_power_from_sysfs() -> std::io::Result<()> {
+        let root = std::env::temp_dir().join(format!("agent-mux-power-{}", std::process::id()));
+        let supply = |name: &str, files: &[(&str, &str)]| -> std::io::Result<()> {
+            let dir = root.join(name);
+            fs::create_dir_all(&dir)?;
+            for (file, text) in files {
+                fs::write(dir.join(file), format!("{text}\n"))?;
+            }
+            Ok(())
+        };
+        supply("BAT0", &[("type", "Battery"), ("status", "Discharging")])?;
+        supply("AC", &[("type", "Mains"), ("online", "0")])?;
+        assert!(sysfs_on_battery(&root));
+
+        supply("AC", &[("type", "Mains"), ("online", "1")])?;
+        assert!(!sysfs_on_battery(&root));
+        assert!(!sysfs_on_battery(&root.join("missing")));
+        fs::remove_dir_all(&root)
+    }
+}
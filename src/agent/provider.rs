@@ -7,6 +7,14 @@ pub struct ProcessTable {
     pub args: HashMap<i32, String>,
 }
 
+impl ProcessTable {
+    /// No processes at all, as when `ps` failed. Every agent would look
+    /// gone, so the table says nothing about them.
+    pub fn is_empty(&self) -> bool {
+        self.comm.is_empty()
+    }
+}
+
 #[derive(Debug, Clone, PartialEq, Eq)]
 pub struct ProviderMatch {
     pub name: String,
@@ -43,8 +51,18 @@ const PROVIDERS: &[ProviderPattern] = &[
         label: "kimi",
         needles: &["kimi", "kimi-code", "@moonshot-ai/kimi-code"],
     },
+    ProviderPattern {
+        label: "aider",
+        needles: &["aider"],
+    },
 ];
 
+/// The names of the agents panes are matched against, as they appear in
+/// `Pane::provider`.
+pub fn providers() -> impl Iterator<Item = &'static str> {
+    PROVIDERS.iter().map(|provider| provider.label)
+}
+
 pub fn resolve(cmd: &str, shell_pid: i32, pt: &ProcessTable) -> Option<ProviderMatch> {
     let current = resolve_registered(cmd);
     if let Some(matched) = resolve_descendant(shell_pid, pt) {
@@ -127,30 +145,41 @@ fn resolve_registered(cmd: &str) -> Option<&'static str> {
 
 pub fn parse_process_table(out: &str) -> ProcessTable {
     let mut pt = ProcessTable::default();
-    for line in out.trim().lines() {
-        let line = line.trim();
-        if line.is_empty() {
-            continue;
-        }
-        let fields: Vec<&str> = line.split_whitespace().collect();
-        if fields.len() < 3 {
+    for line in out.lines() {
+        let Some((pid, rest)) = next_field(line) else {
             continue;
-        }
-        let Ok(pid) = fields[0].parse::<i32>() else {
+        };
+        let Some((ppid, cmdline)) = next_field(rest) else {
             continue;
         };
-        let Ok(ppid) = fields[1].parse::<i32>() else {
+        let (Ok(pid), Ok(ppid)) = (pid.parse::<i32>(), ppid.parse::<i32>()) else {
             continue;
         };
-        let mut cmdline = line.trim_start_matches(fields[0]).trim_start();
-        cmdline = cmdline.trim_start_matches(fields[1]).trim_start();
+        let cmdline = cmdline.trim();
+        if cmdline.is_empty() {
+            continue;
+        }
         pt.children.entry(ppid).or_default().push(pid);
-        pt.comm.insert(pid, fields[2].to_string());
+        pt.comm.insert(pid, command_name(cmdline).to_string());
         pt.args.insert(pid, cmdline.to_string());
     }
     pt
 }
 
+fn next_field(s: &str) -> Option<(&str, &str)> {
+    let s = s.trim_start();
+    let end = s.find(char::is_whitespace)?;
+    Some((&s[..end], &s[end..]))
+}
+
+fn command_name(cmdline: &str) -> &str {
+    let program = cmdline.split_whitespace().next().unwrap_or(cmdline);
+    if program.starts_with('[') {
+        return program;
+    }
+    program.rsplit('/').next().unwrap_or(program)
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -0,0 +1,116 @@
+use std::process::Command;
+
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt, SSH_TIMEOUT};
+use crate::agent::provider::{ProcessTable, parse_process_table};
+use crate::agent::remote::ssh_command;
+
+#[cfg(any(
+    target_os = "macos",
+    target_os = "freebsd",
+    target_os = "openbsd",
+    target_os = "netbsd",
+    target_os = "dragonfly"
+))]
+const PS_ARGS: &[&str] = &["-axww", "-o", "pid=", "-o", "ppid=", "-o", "command="];
+
+#[cfg(not(any(
+    target_os = "macos",
+    target_os = "freebsd",
+    target_os = "openbsd",
+    target_os = "netbsd",
+    target_os = "dragonfly"
+)))]
+const PS_ARGS: &[&str] = &["-A", "-o", "pid=", "-o", "ppid=", "-o", "args="];
+
+// BusyBox ps rejects -A and always prints a header; it lists every process.
+const BUSYBOX_PS_ARGS: &[&str] = &["-o", "pid,ppid,args"];
+
+// Remote hosts may run any OS, so try the POSIX form and fall back to BusyBox.
+const REMOTE_PS: &str = "ps -A -o pid= -o ppid= -o args= 2>/dev/null || ps -o pid,ppid,args";
+
+pub fn local_process_table() -> ProcessTable {
+    for args in [PS_ARGS, BUSYBOX_PS_ARGS] {
+        if let Ok(out) = Command::new("ps").args(args).output_within(COMMAND_TIMEOUT)
+            && out.status.success()
+        {
+            return parse_process_table(&String::from_utf8_lossy(&out.stdout));
+        }
+    }
+    ProcessTable::default()
+}
+
+pub fn remote_process_table(host: &str) -> ProcessTable {
+    ssh_command(host, &["sh", "-c", REMOTE_PS])
+        .output_within(SSH_TIMEOUT)
+        .map(|out| parse_process_table(&String::from_utf8_lossy(&out.stdout)))
+        .unwrap_or_default()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::agent::provider::resolve;
+
+    fn resolve_fixture(fixture: &str, cmd: &str, shell_pid: i32) -> (String, i32) {
+        let pt = parse_process_table(fixture);
+        let matched = resolve(cmd, shell_pid, &pt).unwrap();
+        (matched.name, matched.pid)
+    }
+
+    #[test]
+    fn parses_linux_procps_output() {
+        let fixture = include_str!("fixtures/ps-linux.txt");
+        let pt = parse_process_table(fixture);
+
+        assert_eq!(pt.comm[&2], "[kthreadd]");
+        assert_eq!(pt.args[&812], "/usr/bin/tmux new-session -d -s main");
+        assert_eq!(
+            resolve_fixture(fixture, "zsh", 813),
+            ("claude".to_string(), 901)
+        );
+    }
+
+    #[test]
+    fn parses_macos_output() {
+        let fixture = include_str!("fixtures/ps-macos.txt");
+        let pt = parse_process_table(fixture);
+
+        assert_eq!(pt.comm[&641], "-zsh");
+        assert_eq!(pt.comm[&702], "node");
+        assert_eq!(
+            resolve_fixture(fixture, "zsh", 641),
+            ("codex".to_string(), 702)
+        );
+    }
+
+    #[test]
+    fn parses_freebsd_output_with_spaces_in_process_titles() {
+        let fixture = include_str!("fixtures/ps-freebsd.txt");
+        let pt = parse_process_table(fixture);
+
+        assert_eq!(pt.comm[&620], "tmux:");
+        assert_eq!(pt.children[&620], vec![621]);
+        assert_eq!(
+            resolve_fixture(fixture, "sh", 621),
+            ("gemini".to_string(), 655)
+        );
+    }
+
+    #[test]
+    fn skips_busybox_header() {
+        let fixture = include_str!("fixtures/ps-busybox.txt");
+        let pt = parse_process_table(fixture);
+
+        assert_eq!(pt.args.len(), 4);
+        assert_eq!(
+            resolve_fixture(fixture, "ash", 38),
+            ("opencode".to_string(), 52)
+        );
+    }
+
+    #[test]
+    fn failed_ps_gives_an_empty_table() {
+        assert!(parse_process_table("").is_empty());
+        assert!(!parse_process_table(include_str!("fixtures/ps-linux.txt")).is_empty());
+    }
+}
@@ -0,0 +1,103 @@
+use std::collections::HashMap;
+use std::time::{Duration, Instant};
+
+use crate::agent::backend::{Backend, backend_of};
+use crate::agent::persist::pop_queued_prompt;
+use crate::agent::throttle::Throttle;
+use crate::agent::{Pane, PaneStatus, log, tmux};
+
+/// How long to wait for a pane to start working after a prompt was sent
+/// before the next queued prompt may go out anyway.
+const SEND_GRACE: Duration = Duration::from_secs(30);
+
+/// Sends prompts queued for busy panes once they go idle, one per turn,
+/// holding them while the concurrency limit is reached.
+#[derive(Debug, Default)]
+pub struct PromptQueue {
+    awaiting: HashMap<String, Instant>,
+}
+
+impl PromptQueue {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn run(&mut self, panes: &[Pane], throttle: &mut Throttle) {
+        let now = Instant::now();
+        self.awaiting.retain(|id, sent| {
+            now.duration_since(*sent) < SEND_GRACE
+                && panes
+                    .iter()
+                    .any(|pane| pane.pane_id == *id && pane.status != PaneStatus::Busy)
+        });
+        for pane in panes {
+            if self.awaiting.contains_key(&pane.pane_id) {
+                throttle.count(&pane.provider);
+            }
+        }
+        let ready: Vec<&Pane> = panes.iter().filter(|pane| self.ready(pane)).collect();
+        for pane in ready {
+            if !throttle.admits(&pane.provider) {
+                continue;
+            }
+            let prompt = match pop_queued_prompt(&pane.pane_id) {
+                Ok(Some(prompt)) => prompt,
+                Ok(None) => continue,
+                Err(err) => {
+                    log::warn(
+                        "take queued prompt failed",
+                        &[("pane", &pane.pane_id), ("err", &format!("{err:#}"))],
+                    );
+                    continue;
+                }
+            };
+            self.awaiting.insert(pane.pane_id.clone(), now);
+            throttle.count(&pane.provider);
+            match tmux::send_text(&pane.pane_id, &prompt) {
+                Ok(()) => log::info("sent queued prompt", &[("pane", &pane.pane_id)]),
+                Err(err) => log::warn(
+                    "send queued prompt failed",
+                    &[("pane", &pane.pane_id), ("err", &format!("{err:#}"))],
+                ),
+            }
+        }
+    }
+
+    fn ready(&self, pane: &Pane) -> bool {
+        !pane.queued_prompts.is_empty()
+            && matches!(pane.status, PaneStatus::Idle | PaneStatus::Unread)
+            && !pane.terminated
+            && backend_of(&pane.target) == Backend::Tmux
+            && !self.awaiting.contains_key(&pane.pane_id)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn pane(status: PaneStatus) -> Pane {
+        Pane {
+            pane_id: "%1".to_string(),
+            target: "s:1.1".to_string(),
+            status,
+            queued_prompts: vec!["next".to_string()],
+            ..Pane::default()
+        }
+    }
+
+    #[test]
+    fn waits_for_idle_and_for_the_previous_prompt_to_start() {
+        let mut queue = PromptQueue::new();
+
+        assert!(!queue.ready(&pane(PaneStatus::Busy)));
+        assert!(!queue.ready(&pane(PaneStatus::NeedsAttention)));
+        assert!(queue.ready(&pane(PaneStatus::Unread)));
+
+        queue.awaiting.insert("%1".to_string(), Instant::now());
+        assert!(!queue.ready(&pane(PaneStatus::Idle)));
+
+        queue.run(&[pane(PaneStatus::Busy)], &mut Throttle::default());
+        assert!(queue.awaiting.is_empty());
+    }
+}
@@ -1,25 +1,51 @@
-use std::collections::HashMap;
+use std::collections::{HashMap, HashSet};
 
-use chrono::{DateTime, Utc};
+use chrono::{DateTime, Duration, Local, Utc};
 
-use crate::agent::persist::{CachedPane, Snapshot};
-use crate::agent::{Pane, PaneStatus};
+use crate::agent::backend::{Backend, backend_of};
+use crate::agent::config::{Transitions, UnreadExpiry, config};
+use crate::agent::persist::{CachedPane, Snapshot, panes_from_snapshot};
+use crate::agent::{Pane, PaneStatus, log, transcript};
 
+/// The single status engine. Only the watcher runs it; the sidebar, CLI,
+/// RPC, and web clients read its snapshot and layer the user's marks on top
+/// with `apply_ui_state`, so they cannot disagree about a pane's status.
 #[derive(Debug, Default)]
 pub struct Reconciler {
     prev_content: HashMap<String, String>,
     unchanged_count: HashMap<String, usize>,
+    attention_count: HashMap<String, usize>,
+    attention_reasons: HashMap<String, String>,
     prev_statuses: HashMap<String, PaneStatus>,
     prev_window_active: HashMap<String, bool>,
     last_active: HashMap<String, DateTime<Utc>>,
+    history_checked: HashSet<String>,
+    busy_since: HashMap<String, DateTime<Utc>>,
+    status_since: HashMap<String, DateTime<Utc>>,
+    terminated: HashMap<String, Pane>,
+    transitions: Transitions,
+    verbose: bool,
 }
 
 impl Reconciler {
     pub fn new() -> Self {
-        Self::default()
+        Self {
+            transitions: config().transitions,
+            ..Self::default()
+        }
+    }
+
+    /// Logs every decision at debug level, not just status changes.
+    pub fn set_verbose(&mut self, verbose: bool) {
+        self.verbose = verbose;
     }
 
-    pub fn seed_from_snapshot(&mut self, snapshot: &Snapshot) {
+    pub(crate) fn seed_from_snapshot(&mut self, snapshot: &Snapshot) {
+        for pane in panes_from_snapshot(snapshot) {
+            if pane.terminated {
+                self.terminated.insert(pane.pane_id.clone(), pane);
+            }
+        }
         for cp in &snapshot.panes {
             let id = cp.pane_key().to_string();
             if !cp.content_hash.is_empty() {
@@ -31,18 +57,45 @@ impl Reconciler {
                     .insert(id.clone(), PaneStatus::from_i32(s));
             }
             self.prev_window_active.insert(id.clone(), cp.window_active);
+            if !cp.attention_reason.is_empty() {
+                self.attention_reasons
+                    .insert(id.clone(), cp.attention_reason.clone());
+            }
+            if let Some(t) = cp.busy_since {
+                self.busy_since.insert(id.clone(), t);
+            }
+            if let Some(t) = cp.status_since {
+                self.status_since.insert(id.clone(), t);
+            }
             if let Some(t) = cp.last_active {
                 self.last_active.insert(id, t);
             }
         }
     }
 
+    /// A pane first seen idle has no activity of its own yet; its agent's
+    /// newest transcript in the same directory says when it last worked.
+    /// Looked up once per pane, for every agent with a transcript reader.
+    fn seed_last_active(&mut self, p: &Pane) {
+        if self.last_active.contains_key(&p.pane_id)
+            || !self.history_checked.insert(p.pane_id.clone())
+        {
+            return;
+        }
+        if let Some(at) =
+            transcript::latest(&p.provider, &p.path).and_then(|session| session.updated_at)
+        {
+            self.last_active.insert(p.pane_id.clone(), at);
+        }
+    }
+
     pub fn reconcile(&mut self, panes: &mut [Pane]) {
         let now = Utc::now();
         let mut alive = HashMap::new();
         for p in panes.iter_mut() {
             let id = p.pane_id.clone();
             alive.insert(id.clone(), true);
+            self.seed_last_active(p);
             let prev_status = self
                 .prev_statuses
                 .get(&id)
@@ -65,6 +118,16 @@ impl Reconciler {
                 }
                 p.last_active = self.last_active.get(&id).copied();
                 p.status = observed_status;
+                if observed_status != PaneStatus::NeedsAttention {
+                    p.attention_reason.clear();
+                }
+                self.log_decision(
+                    p,
+                    prev_status,
+                    "reported by provider",
+                    raw_content_changed,
+                    now,
+                );
                 self.track_pane(p);
                 continue;
             }
@@ -80,48 +143,212 @@ impl Reconciler {
             }
             p.last_active = self.last_active.get(&id).copied();
 
-            p.status = if active_now {
+            let attention_seen = if p.heuristic_attention {
+                let seen = self.attention_count.entry(id.clone()).or_default();
+                *seen += 1;
+                *seen
+            } else {
+                self.attention_count.remove(&id);
+                0
+            };
+            let attention = attention_seen >= self.transitions.attention_polls.max(1);
+
+            let (status, reason) = if active_now {
                 if p.window_active && prev_status == PaneStatus::Idle {
-                    PaneStatus::Idle
+                    (PaneStatus::Idle, "output in focused idle pane")
+                } else if content_changed {
+                    (PaneStatus::Busy, "content changed")
                 } else {
-                    PaneStatus::Busy
+                    (PaneStatus::Busy, "content moving")
                 }
             } else if prev_status == PaneStatus::Busy {
-                if self.unchanged_count.get(&id).copied().unwrap_or_default() >= 2 {
-                    if p.heuristic_attention {
-                        PaneStatus::NeedsAttention
+                let unchanged = self.unchanged_count.get(&id).copied().unwrap_or_default();
+                if unchanged >= self.transitions.settle_polls {
+                    let busy_for = self.busy_since.get(&id).map(|since| now - *since);
+                    if attention {
+                        (PaneStatus::NeedsAttention, "settled on attention prompt")
+                    } else if p.heuristic_error {
+                        (PaneStatus::Error, "settled on error")
+                    } else if p.heuristic_attention {
+                        (PaneStatus::Busy, "confirming attention prompt")
                     } else if p.window_active {
-                        PaneStatus::Idle
+                        (PaneStatus::Idle, "settled while focused")
+                    } else if busy_for.is_some_and(|busy_for| {
+                        busy_for < Duration::seconds(self.transitions.min_busy_secs as i64)
+                    }) {
+                        (PaneStatus::Idle, "settled after a short burst")
                     } else {
-                        PaneStatus::Unread
+                        (PaneStatus::Unread, "settled while unfocused")
                     }
+                } else if self.transitions.attention_preempts_busy && attention {
+                    (PaneStatus::NeedsAttention, "attention prompt preempts busy")
                 } else {
-                    PaneStatus::Busy
+                    (PaneStatus::Busy, "settling")
                 }
-            } else if p.heuristic_attention || prev_status == PaneStatus::NeedsAttention {
-                PaneStatus::NeedsAttention
+            } else if attention {
+                (PaneStatus::NeedsAttention, "attention prompt visible")
+            } else if p.heuristic_error {
+                (PaneStatus::Error, "error visible")
+            } else if matches!(prev_status, PaneStatus::NeedsAttention | PaneStatus::Error) {
+                (prev_status, "attention not yet cleared")
             } else if prev_status == PaneStatus::Unread {
                 if p.window_active {
-                    PaneStatus::Idle
+                    (PaneStatus::Idle, "viewed")
+                } else if p
+                    .last_active
+                    .is_some_and(|since| unread_expired(config().unread_expiry, since, now))
+                {
+                    (PaneStatus::Idle, "unread expired")
                 } else {
-                    PaneStatus::Unread
+                    (PaneStatus::Unread, "not yet viewed")
                 }
             } else {
-                PaneStatus::Idle
+                (PaneStatus::Idle, "no activity")
             };
+            p.status = status;
+            if status != PaneStatus::NeedsAttention {
+                self.attention_reasons.remove(&id);
+                p.attention_reason.clear();
+            } else if p.attention_reason.is_empty() {
+                p.attention_reason = self.attention_reasons.get(&id).cloned().unwrap_or_default();
+            } else {
+                self.attention_reasons
+                    .insert(id.clone(), p.attention_reason.clone());
+            }
+            self.log_decision(p, prev_status, reason, content_changed, now);
 
             self.track_pane(p);
         }
 
         self.prev_content.retain(|k, _| alive.contains_key(k));
         self.unchanged_count.retain(|k, _| alive.contains_key(k));
+        self.attention_count.retain(|k, _| alive.contains_key(k));
+        self.attention_reasons.retain(|k, _| alive.contains_key(k));
         self.prev_statuses.retain(|k, _| alive.contains_key(k));
         self.prev_window_active.retain(|k, _| alive.contains_key(k));
         self.last_active.retain(|k, _| alive.contains_key(k));
+        self.history_checked.retain(|k| alive.contains_key(k));
+        self.busy_since.retain(|k, _| alive.contains_key(k));
+        self.status_since.retain(|k, _| alive.contains_key(k));
+    }
+
+    /// Keeps local tmux panes whose agent exited listed as terminated while
+    /// the pane itself is still open, until they are dismissed or the agent
+    /// comes back. `live_pane_ids` is only called when there is something to
+    /// check; `None` keeps every tracked pane. A refresh whose process table
+    /// came back empty fails before this, so a `ps` hiccup does not end every
+    /// agent at once.
+    pub(crate) fn track_terminated(
+        &mut self,
+        previous: Option<&Snapshot>,
+        panes: &mut Vec<Pane>,
+        dismissed: &HashSet<String>,
+        live_pane_ids: impl FnOnce() -> Option<HashSet<String>>,
+    ) {
+        let current: HashSet<String> = panes.iter().map(|p| p.pane_id.clone()).collect();
+        for p in previous.map(panes_from_snapshot).unwrap_or_default() {
+            if p.terminated
+                || current.contains(&p.pane_id)
+                || backend_of(&p.target) != Backend::Tmux
+            {
+                continue;
+            }
+            log::info(
+                "agent exited",
+                &[("pane", &p.pane_id), ("provider", &p.provider)],
+            );
+            self.terminated.insert(
+                p.pane_id.clone(),
+                Pane {
+                    status: PaneStatus::Disconnected,
+                    terminated: true,
+                    ..p
+                },
+            );
+        }
+        self.terminated
+            .retain(|id, _| !current.contains(id) && !dismissed.contains(id));
+        if self.terminated.is_empty() {
+            return;
+        }
+        if let Some(live) = live_pane_ids() {
+            self.terminated.retain(|id, _| live.contains(id));
+        }
+        let mut terminated: Vec<Pane> = self.terminated.values().cloned().collect();
+        terminated.sort_by(|a, b| a.order.cmp(&b.order).then(a.target.cmp(&b.target)));
+        panes.extend(terminated);
+    }
+
+    fn log_decision(
+        &self,
+        p: &Pane,
+        from: PaneStatus,
+        reason: &str,
+        content_changed: bool,
+        now: DateTime<Utc>,
+    ) {
+        if !log::enabled(log::Level::Debug) {
+            return;
+        }
+        if !self.verbose {
+            if p.status != from {
+                log::debug(
+                    "status changed",
+                    &[
+                        ("pane", &p.pane_id),
+                        ("target", &p.target),
+                        ("from", &from.as_str()),
+                        ("to", &p.status.as_str()),
+                        ("reason", &reason),
+                        ("focused", &p.window_active),
+                    ],
+                );
+            }
+            return;
+        }
+        let unchanged = self
+            .unchanged_count
+            .get(&p.pane_id)
+            .copied()
+            .unwrap_or_default();
+        let idle_secs = p
+            .last_active
+            .map(|at| (now - at).num_seconds().to_string())
+            .unwrap_or_else(|| "-".to_string());
+        log::debug(
+            "reconcile",
+            &[
+                ("pane", &p.pane_id),
+                ("target", &p.target),
+                ("from", &from.as_str()),
+                ("to", &p.status.as_str()),
+                ("reason", &reason),
+                ("content_changed", &content_changed),
+                ("content_moving", &p.content_moving),
+                ("unchanged_polls", &unchanged),
+                ("idle_secs", &idle_secs),
+                ("attention", &p.heuristic_attention),
+                (
+                    "observed",
+                    &p.observed_status.map_or("-", PaneStatus::as_str),
+                ),
+                ("focused", &p.window_active),
+            ],
+        );
     }
 
-    fn track_pane(&mut self, p: &Pane) {
+    fn track_pane(&mut self, p: &mut Pane) {
         let id = p.pane_id.clone();
+        if p.status != PaneStatus::Busy {
+            self.busy_since.remove(&id);
+        } else if !self.busy_since.contains_key(&id) {
+            self.busy_since.insert(id.clone(), Utc::now());
+        }
+        p.busy_since = self.busy_since.get(&id).copied();
+        if self.prev_statuses.get(&id) != Some(&p.status) || !self.status_since.contains_key(&id) {
+            self.status_since.insert(id.clone(), Utc::now());
+        }
+        p.status_since = self.status_since.get(&id).copied();
         if !p.content_hash.is_empty() {
             self.prev_content.insert(id.clone(), p.content_hash.clone());
         }
@@ -129,7 +356,7 @@ impl Reconciler {
         self.prev_window_active.insert(id, p.window_active);
     }
 
-    pub fn apply_to_cache(&self, panes: &mut [CachedPane]) {
+    pub(crate) fn apply_to_cache(&self, panes: &mut [CachedPane]) {
         for cp in panes {
             let id = cp.pane_key().to_string();
             if let Some(h) = self.prev_content.get(&id) {
@@ -144,10 +371,24 @@ impl Reconciler {
             if let Some(t) = self.last_active.get(&id) {
                 cp.last_active = Some(*t);
             }
+            cp.busy_since = self.busy_since.get(&id).copied();
+            cp.status_since = self.status_since.get(&id).copied();
         }
     }
 }
 
+fn unread_expired(policy: UnreadExpiry, since: DateTime<Utc>, now: DateTime<Utc>) -> bool {
+    // Too many hours to fit a duration never come round.
+    let after = i64::try_from(policy.after_hours)
+        .ok()
+        .and_then(Duration::try_hours);
+    if policy.after_hours > 0 && after.is_some_and(|after| now - since >= after) {
+        return true;
+    }
+    policy.new_day
+        && since.with_timezone(&Local).date_naive() < now.with_timezone(&Local).date_naive()
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -199,4 +440,172 @@ mod tests {
 
         assert_eq!(panes[0].status, PaneStatus::NeedsAttention);
     }
+
+    #[test]
+    fn attention_prompt_wins_over_a_visible_error() {
+        let mut reconciler = Reconciler::new();
+        reconciler.seed_from_snapshot(&snapshot(PaneStatus::Idle, "old", false));
+        let mut panes = vec![Pane {
+            heuristic_error: true,
+            ..pane("old", false, true)
+        }];
+
+        reconciler.reconcile(&mut panes);
+
+        assert_eq!(panes[0].status, PaneStatus::NeedsAttention);
+    }
+
+    #[test]
+    fn visible_error_sticks_until_output_resumes() {
+        let mut reconciler = Reconciler::new();
+        reconciler.seed_from_snapshot(&snapshot(PaneStatus::Idle, "old", false));
+        let mut panes = vec![Pane {
+            heuristic_error: true,
+            ..pane("old", false, false)
+        }];
+
+        reconciler.reconcile(&mut panes);
+        assert_eq!(panes[0].status, PaneStatus::Error);
+
+        panes[0].heuristic_error = false;
+        panes[0].heuristic_attention = false;
+        reconciler.reconcile(&mut panes);
+        assert_eq!(panes[0].status, PaneStatus::Error);
+
+        panes[0].content_hash = "new".to_string();
+        reconciler.reconcile(&mut panes);
+        assert_eq!(panes[0].status, PaneStatus::Busy);
+    }
+
+    #[test]
+    fn transition_rules_shape_how_busy_settles() {
+        let mut reconciler = Reconciler::new();
+        reconciler.transitions = Transitions {
+            settle_polls: 1,
+            attention_polls: 1,
+            min_busy_secs: 60,
+            attention_preempts_busy: false,
+            override_minutes: 0,
+        };
+        reconciler.seed_from_snapshot(&snapshot(PaneStatus::Idle, "old", false));
+        let mut panes = vec![pane("new", false, false)];
+
+        reconciler.reconcile(&mut panes);
+        assert_eq!(panes[0].status, PaneStatus::Busy);
+        reconciler.reconcile(&mut panes);
+        assert_eq!(panes[0].status, PaneStatus::Idle);
+
+        reconciler.transitions.settle_polls = 5;
+        reconciler.transitions.attention_preempts_busy = true;
+        panes[0].content_hash = "newer".to_string();
+        reconciler.reconcile(&mut panes);
+        panes[0].heuristic_attention = true;
+        reconciler.reconcile(&mut panes);
+        assert_eq!(panes[0].status, PaneStatus::NeedsAttention);
+    }
+
+    #[test]
+    fn attention_prompt_must_persist_before_it_counts() {
+        let mut reconciler = Reconciler::new();
+        reconciler.transitions.attention_polls = 3;
+        reconciler.seed_from_snapshot(&snapshot(PaneStatus::Idle, "old", false));
+        let mut panes = vec![pane("old", false, true)];
+
+        for _ in 0..2 {
+            reconciler.reconcile(&mut panes);
+            assert_eq!(panes[0].status, PaneStatus::Idle);
+        }
+        reconciler.reconcile(&mut panes);
+        assert_eq!(panes[0].status, PaneStatus::NeedsAttention);
+    }
+
+    #[test]
+    fn keeps_the_attention_reason_until_attention_clears() {
+        let mut reconciler = Reconciler::new();
+        reconciler.seed_from_snapshot(&snapshot(PaneStatus::Idle, "old", false));
+        let mut panes = vec![Pane {
+            attention_reason: "Do you want to proceed?".to_string(),
+            ..pane("old", false, true)
+        }];
+
+        reconciler.reconcile(&mut panes);
+        assert_eq!(panes[0].attention_reason, "Do you want to proceed?");
+
+        panes[0].heuristic_attention = false;
+        panes[0].attention_reason.clear();
+        reconciler.reconcile(&mut panes);
+        assert_eq!(panes[0].status, PaneStatus::NeedsAttention);
+        assert_eq!(panes[0].attention_reason, "Do you want to proceed?");
+
+        panes[0].content_hash = "new".to_string();
+        reconciler.reconcile(&mut panes);
+        assert!(panes[0].attention_reason.is_empty());
+    }
+
+    #[test]
+    fn unread_expires_after_timeout_or_new_day() {
+        let now = Local::now()
+            .date_naive()
+            .and_hms_opt(12, 0, 0)
+            .and_then(|t| t.and_local_timezone(Local).single())
+            .unwrap()
+            .with_timezone(&Utc);
+        let hours = UnreadExpiry {
+            after_hours: 8,
+            new_day: false,
+        };
+        let daily = UnreadExpiry {
+            after_hours: 0,
+            new_day: true,
+        };
+
+        assert!(!unread_expired(
+            UnreadExpiry::default(),
+            now - Duration::days(3),
+            now
+        ));
+        assert!(!unread_expired(hours, now - Duration::hours(7), now));
+        assert!(unread_expired(hours, now - Duration::hours(8), now));
+        let forever = UnreadExpiry {
+            after_hours: u64::MAX / 2,
+            new_day: false,
+        };
+        assert!(!unread_expired(forever, now - Duration::days(3), now));
+        assert!(!unread_expired(daily, now - Duration::hours(1), now));
+        assert!(unread_expired(daily, now - Duration::days(1), now));
+    }
+
+    #[test]
+    fn keeps_exited_agent_panes_while_the_tmux_pane_is_open() {
+        let mut reconciler = Reconciler::new();
+        let previous = snapshot(PaneStatus::Busy, "old", false);
+        let mut panes = Vec::new();
+
+        reconciler.track_terminated(Some(&previous), &mut panes, &HashSet::new(), || {
+            Some(HashSet::from(["%1".to_string()]))
+        });
+
+        assert_eq!(panes.len(), 1);
+        assert!(panes[0].terminated);
+        assert_eq!(panes[0].status, PaneStatus::Disconnected);
+
+        let mut panes = Vec::new();
+        let dismissed = HashSet::from(["%1".to_string()]);
+        reconciler.track_terminated(None, &mut panes, &dismissed, || None);
+
+        assert!(panes.is_empty());
+    }
+
+    #[test]
+    fn drops_terminated_panes_once_the_tmux_pane_closes() {
+        let mut reconciler = Reconciler::new();
+        let previous = snapshot(PaneStatus::Idle, "old", false);
+        let mut panes = Vec::new();
+
+        reconciler.track_terminated(Some(&previous), &mut panes, &HashSet::new(), || {
+            Some(HashSet::new())
+        });
+
+        assert!(panes.is_empty());
+    }
 }
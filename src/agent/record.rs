@@ -0,0 +1,133 @@
+use std::fs::{self, OpenOptions};
+use std::io::{self, Read, Write};
+use std::path::{Path, PathBuf};
+use std::time::Instant;
+
+use anyhow::{Context, Result, bail};
+use chrono::{DateTime, Local, Utc};
+use serde_json::json;
+
+use crate::agent::archive::workspace_slug;
+use crate::agent::persist::state_dir;
+use crate::agent::{Pane, tmux};
+
+pub fn recordings_dir() -> PathBuf {
+    state_dir().join("recordings")
+}
+
+/// Starts recording a local tmux pane to an asciicast v2 file, or stops the
+/// recording in progress. Returns the file and whether it is now recording.
+pub fn toggle(pane: &Pane) -> Result<(PathBuf, bool)> {
+    if !pane.host.is_empty() || !pane.pane_id.starts_with('%') {
+        bail!("only local tmux panes can be recorded");
+    }
+    if let Some(file) = tmux::stop_recording(&pane.pane_id)? {
+        return Ok((file, false));
+    }
+    Ok((start(pane, Utc::now())?, true))
+}
+
+fn start(pane: &Pane, now: DateTime<Utc>) -> Result<PathBuf> {
+    let dir = recordings_dir();
+    fs::create_dir_all(&dir).context("create recordings dir")?;
+    let local = now.with_timezone(&Local);
+    let file = dir.join(format!(
+        "{}-{}.cast",
+        workspace_slug(&pane.path),
+        local.format("%Y%m%d-%H%M%S")
+    ));
+    // pipe-pane only sees new output, so the recording opens on a copy of
+    // the current screen.
+    let (width, height, screen) = tmux::pane_screen(&pane.pane_id)?;
+    let title = format!("{} in {}", pane.provider, pane.path);
+    let first_frame = format!("\x1b[2J\x1b[H{}", screen.trim_end().replace('\n', "\r\n"));
+    let cast = format!(
+        "{}\n{}\n",
+        header(width, height, now, &title),
+        event(0.0, &first_frame)
+    );
+    fs::write(&file, cast).with_context(|| format!("write {}", file.display()))?;
+    tmux::record_pane(&pane.pane_id, &file)?;
+    Ok(file)
+}
+
+fn header(width: usize, height: usize, at: DateTime<Utc>, title: &str) -> String {
+    json!({
+        "version": 2,
+        "width": width,
+        "height": height,
+        "timestamp": at.timestamp(),
+        "title": title,
+    })
+    .to_string()
+}
+
+fn event(elapsed: f64, data: &str) -> String {
+    let elapsed = (elapsed * 1_000_000.0).round() / 1_000_000.0;
+    json!([elapsed, "o", data]).to_string()
+}
+
+/// Appends a pane's output from stdin to `file` as timed asciicast events
+/// until the pipe closes. tmux runs this through `agent-mux pipe-cast`.
+pub fn sink(file: &Path) -> Result<()> {
+    let mut out = OpenOptions::new()
+        .append(true)
+        .open(file)
+        .with_context(|| format!("open {}", file.display()))?;
+    let started = Instant::now();
+    let mut input = io::stdin().lock();
+    let mut buf = [0u8; 8192];
+    let mut pending = Vec::new();
+    loop {
+        let n = input.read(&mut buf)?;
+        if n == 0 {
+            return Ok(());
+        }
+        pending.extend_from_slice(&buf[..n]);
+        let text = take_utf8(&mut pending);
+        if !text.is_empty() {
+            writeln!(out, "{}", event(started.elapsed().as_secs_f64(), &text))
+                .with_context(|| format!("write {}", file.display()))?;
+        }
+    }
+}
+
+/// Drains the decodable prefix of `bytes`, keeping a character split across
+/// reads for the next one.
+fn take_utf8(bytes: &mut Vec<u8>) -> String {
+    let valid = match std::str::from_utf8(bytes) {
+        Ok(_) => bytes.len(),
+        Err(err) if err.error_len().is_none() => err.valid_up_to(),
+        Err(_) => bytes.len(),
+    };
+    let text = String::from_utf8_lossy(&bytes[..valid]).into_owned();
+    bytes.drain(..valid);
+    text
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn writes_asciicast_lines() {
+        let at = "2026-03-02T14:05:09Z".parse().unwrap();
+
+        assert_eq!(
+            header(80, 24, at, "claude in /src/api"),
+            r#"{"height":24,"timestamp":1772460309,"title":"claude in /src/api","version":2,"width":80}"#
+        );
+        assert_eq!(event(1.23456789, "hi\r\n"), r#"[1.234568,"o","hi\r\n"]"#);
+    }
+
+    #[test]
+    fn keeps_split_characters_for_the_next_read() {
+        let mut bytes = "né".as_bytes().to_vec();
+        let tail = bytes.pop().unwrap();
+
+        assert_eq!(take_utf8(&mut bytes), "n");
+        bytes.push(tail);
+        assert_eq!(take_utf8(&mut bytes), "é");
+        assert!(bytes.is_empty());
+    }
+}
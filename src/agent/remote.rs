@@ -0,0 +1,111 @@
+use std::process::Command;
+
+use crate::agent::config::{Remote, config};
+use crate::agent::exec::{RunExt, SSH_TIMEOUT};
+use crate::agent::persist::state_dir;
+
+pub fn remote(name: &str) -> Option<&'static Remote> {
+    config().remotes.iter().find(|remote| remote.name == name)
+}
+
+pub fn remote_host(name: &str) -> &str {
+    remote(name)
+        .map(|remote| remote.host.as_str())
+        .unwrap_or(name)
+}
+
+pub fn ssh_options() -> Vec<String> {
+    [
+        "-o",
+        "BatchMode=yes",
+        "-o",
+        "ConnectTimeout=5",
+        "-o",
+        "ControlMaster=auto",
+        "-o",
+        "ControlPersist=10m",
+        "-o",
+    ]
+    .into_iter()
+    .map(String::from)
+    .chain([format!(
+        "ControlPath={}",
+        state_dir().join("ssh-%C").to_string_lossy()
+    )])
+    .collect()
+}
+
+pub fn ssh_command(host: &str, remote_args: &[&str]) -> Command {
+    let mut cmd = Command::new("ssh");
+    cmd.args(ssh_options())
+        .arg(host)
+        .arg("--")
+        .arg(shell_join(remote_args));
+    cmd
+}
+
+pub fn shell_join(args: &[&str]) -> String {
+    args.iter()
+        .map(|arg| shell_quote(arg))
+        .collect::<Vec<_>>()
+        .join(" ")
+}
+
+pub fn remote_target(name: &str, target: &str) -> String {
+    format!("ssh:{name}/{target}")
+}
+
+pub fn split_remote_target(target: &str) -> Option<(&str, &str)> {
+    target.strip_prefix("ssh:")?.split_once('/')
+}
+
+pub fn git_branch(host: &str, path: &str) -> String {
+    ssh_command(
+        host,
+        &["git", "-C", path, "rev-parse", "--abbrev-ref", "HEAD"],
+    )
+    .output_within(SSH_TIMEOUT)
+    .ok()
+    .filter(|out| out.status.success())
+    .map(|out| String::from_utf8_lossy(&out.stdout).trim().to_string())
+    .unwrap_or_default()
+}
+
+pub fn git_dirty(host: &str, path: &str) -> bool {
+    ssh_command(host, &["git", "-C", path, "status", "--porcelain"])
+        .output_within(SSH_TIMEOUT)
+        .map(|out| !String::from_utf8_lossy(&out.stdout).trim().is_empty())
+        .unwrap_or(false)
+}
+
+pub fn shell_quote(arg: &str) -> String {
+    if !arg.is_empty()
+        && arg
+            .chars()
+            .all(|ch| ch.is_ascii_alphanumeric() || "-_./=:%@,".contains(ch))
+    {
+        return arg.to_string();
+    }
+    format!("'{}'", arg.replace('\'', r"'\''"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn quotes_remote_arguments() {
+        assert_eq!(shell_quote("list-panes"), "list-panes");
+        assert_eq!(shell_quote("#{pane_id}\t"), "'#{pane_id}\t'");
+        assert_eq!(shell_quote("it's"), r"'it'\''s'");
+    }
+
+    #[test]
+    fn splits_remote_targets() {
+        assert_eq!(
+            split_remote_target(&remote_target("devbox", "main:1.2")),
+            Some(("devbox", "main:1.2"))
+        );
+        assert_eq!(split_remote_target("main:1.2"), None);
+    }
+}
@@ -0,0 +1,201 @@
+use std::collections::BTreeMap;
+
+use anyhow::{Result, bail};
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
+
+use crate::agent::persist::{UiState, update_ui_state};
+use crate::agent::{Pane, git};
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum Verdict {
+    Approved,
+    FollowUp,
+}
+
+impl Verdict {
+    pub fn label(self) -> &'static str {
+        match self {
+            Self::Approved => "approved",
+            Self::FollowUp => "follow-up",
+        }
+    }
+}
+
+/// A verdict on a workspace's changes. It only holds while the changes are
+/// the ones that were reviewed, by `changes` hash.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct Review {
+    pub verdict: Verdict,
+    pub changes: String,
+    pub at: DateTime<Utc>,
+}
+
+/// A checkout with uncommitted changes and agents working in it.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Workspace {
+    /// The repository root, so agents in its subdirectories share one entry.
+    pub path: String,
+    pub short_path: String,
+    pub branch: String,
+    /// The first agent pane in the workspace.
+    pub pane_id: String,
+    /// Every agent pane in the workspace.
+    pub pane_ids: Vec<String>,
+    /// Changed paths, untracked files included.
+    pub files: Vec<String>,
+    pub diff: String,
+    pub changes: String,
+}
+
+/// The local workspaces whose agents left uncommitted changes, by
+/// repository root. Reads each checkout's diff, so call it off the UI
+/// thread.
+pub fn dirty_workspaces(panes: &[Pane]) -> Vec<Workspace> {
+    let mut by_root: BTreeMap<&str, Vec<&Pane>> = BTreeMap::new();
+    for pane in panes {
+        if pane.host.is_empty() && !pane.terminated && !pane.path.is_empty() && pane.git_dirty {
+            let root = if pane.project_root.is_empty() {
+                &pane.path
+            } else {
+                &pane.project_root
+            };
+            by_root.entry(root).or_default().push(pane);
+        }
+    }
+    by_root
+        .into_iter()
+        .filter_map(|(root, agents)| {
+            let (files, diff, changes) = read_changes(root);
+            if files.is_empty() {
+                return None;
+            }
+            Some(Workspace {
+                path: root.to_string(),
+                short_path: if agents[0].project_short.is_empty() {
+                    agents[0].short_path.clone()
+                } else {
+                    agents[0].project_short.clone()
+                },
+                branch: agents[0].git_branch.clone(),
+                pane_id: agents[0].pane_id.clone(),
+                pane_ids: agents.iter().map(|p| p.pane_id.clone()).collect(),
+                changes,
+                files,
+                diff,
+            })
+        })
+        .collect()
+}
+
+/// The changed files, the patch and their hash, as they are on disk now.
+fn read_changes(dir: &str) -> (Vec<String>, String, String) {
+    let files = git::modified_files(dir);
+    let diff = git::diff(dir);
+    let changes = changes_hash(&files, &diff);
+    (files, diff, changes)
+}
+
+fn changes_hash(files: &[String], diff: &str) -> String {
+    let mut hasher = Sha256::new();
+    for file in files {
+        hasher.update(file.as_bytes());
+        hasher.update(b"\n");
+    }
+    hasher.update(diff.as_bytes());
+    hasher.finalize()[..8]
+        .iter()
+        .map(|b| format!("{b:02x}"))
+        .collect()
+}
+
+/// The verdict given to the workspace's current changes, if any.
+pub fn verdict(state: &UiState, workspace: &Workspace) -> Option<Verdict> {
+    state
+        .reviews
+        .get(&workspace.path)
+        .filter(|review| review.changes == workspace.changes)
+        .map(|review| review.verdict)
+}
+
+/// Records a verdict on the workspace's current changes; `None` clears it.
+pub fn set_verdict(workspace: &Workspace, verdict: Option<Verdict>) -> Result<()> {
+    update_ui_state(|state| match verdict {
+        Some(verdict) => {
+            state.reviews.insert(
+                workspace.path.clone(),
+                Review {
+                    verdict,
+                    changes: workspace.changes.clone(),
+                    at: Utc::now(),
+                },
+            );
+        }
+        None => {
+            state.reviews.remove(&workspace.path);
+        }
+    })
+}
+
+/// Commits the workspace's changes as a checkpoint and returns the commit's
+/// short hash. Refuses when the files on disk are no longer the ones that
+/// were reviewed. Runs git hooks, so call it off the UI thread.
+pub fn checkpoint(workspace: &Workspace) -> Result<String> {
+    let (_, _, changes) = read_changes(&workspace.path);
+    if changes != workspace.changes {
+        bail!(
+            "{} changed since it was reviewed; reload with r",
+            workspace.short_path
+        );
+    }
+    let noun = if workspace.files.len() == 1 {
+        "file"
+    } else {
+        "files"
+    };
+    let message = format!("checkpoint: {} {noun} from review", workspace.files.len());
+    let hash = git::commit_all(&workspace.path, &message)?;
+    update_ui_state(|state| {
+        state.reviews.remove(&workspace.path);
+    })?;
+    Ok(hash)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn workspace(diff: &str) -> Workspace {
+        let files = vec!["src/lib.rs".to_string()];
+        Workspace {
+            path: "/src/api".to_string(),
+            short_path: "~/src/api".to_string(),
+            branch: "main".to_string(),
+            pane_id: "%1".to_string(),
+            pane_ids: vec!["%1".to_string()],
+            changes: changes_hash(&files, diff),
+            files,
+            diff: diff.to_string(),
+        }
+    }
+
+    #[test]
+    fn verdicts_lapse_when_the_changes_move_on() {
+        let reviewed = workspace("+fn a() {}\n");
+        let mut state = UiState::default();
+        state.reviews.insert(
+            reviewed.path.clone(),
+            Review {
+                verdict: Verdict::Approved,
+                changes: reviewed.changes.clone(),
+                at: Utc::now(),
+            },
+        );
+
+        assert_eq!(verdict(&state, &reviewed), Some(Verdict::Approved));
+        assert_eq!(verdict(&state, &workspace("+fn b() {}\n")), None);
+    }
+}
@@ -0,0 +1,179 @@
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+
+use anyhow::{Context, Result, anyhow};
+
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt};
+use crate::agent::log::log_path;
+
+const LABEL: &str = "dev.agent-mux.watch";
+const UNIT: &str = "agent-mux.service";
+
+pub fn install_service() -> Result<PathBuf> {
+    let exe = std::env::current_exe().context("current executable")?;
+    let path_env = std::env::var("PATH").unwrap_or_default();
+    let file = service_file()?;
+    if let Some(dir) = file.parent() {
+        fs::create_dir_all(dir).with_context(|| format!("create {}", dir.display()))?;
+    }
+    let contents = if cfg!(target_os = "macos") {
+        launchd_plist(&exe, &path_env, &log_path())
+    } else {
+        systemd_unit(&exe, &path_env)
+    };
+    fs::write(&file, contents).with_context(|| format!("write {}", file.display()))?;
+
+    if cfg!(target_os = "macos") {
+        let domain = launchd_domain()?;
+        let _ = run(&["launchctl", "bootout", &format!("{domain}/{LABEL}")]);
+        run(&["launchctl", "bootstrap", &domain, &file.to_string_lossy()])?;
+    } else {
+        run(&["systemctl", "--user", "daemon-reload"])?;
+        run(&["systemctl", "--user", "enable", "--now", UNIT])?;
+    }
+    Ok(file)
+}
+
+pub fn uninstall_service() -> Result<PathBuf> {
+    let file = service_file()?;
+    if cfg!(target_os = "macos") {
+        let domain = launchd_domain()?;
+        let _ = run(&["launchctl", "bootout", &format!("{domain}/{LABEL}")]);
+    } else {
+        let _ = run(&["systemctl", "--user", "disable", "--now", UNIT]);
+    }
+    if file.exists() {
+        fs::remove_file(&file).with_context(|| format!("remove {}", file.display()))?;
+    }
+    if !cfg!(target_os = "macos") {
+        let _ = run(&["systemctl", "--user", "daemon-reload"]);
+    }
+    Ok(file)
+}
+
+fn service_file() -> Result<PathBuf> {
+    let home = std::env::var_os("HOME")
+        .map(PathBuf::from)
+        .ok_or_else(|| anyhow!("HOME is not set"))?;
+    if cfg!(target_os = "macos") {
+        return Ok(home.join(format!("Library/LaunchAgents/{LABEL}.plist")));
+    }
+    let config = std::env::var_os("XDG_CONFIG_HOME")
+        .map(PathBuf::from)
+        .unwrap_or_else(|| home.join(".config"));
+    Ok(config.join("systemd/user").join(UNIT))
+}
+
+fn launchd_domain() -> Result<String> {
+    let out = Command::new("id")
+        .arg("-u")
+        .output_within(COMMAND_TIMEOUT)
+        .context("id -u")?;
+    Ok(format!(
+        "gui/{}",
+        String::from_utf8_lossy(&out.stdout).trim()
+    ))
+}
+
+fn run(args: &[&str]) -> Result<()> {
+    let status = Command::new(args[0])
+        .args(&args[1..])
+        .status_within(COMMAND_TIMEOUT)
+        .with_context(|| args[0].to_string())?;
+    if status.success() {
+        Ok(())
+    } else {
+        Err(anyhow!("{} exited with {status}", args.join(" ")))
+    }
+}
+
+// Restart only on failure: a watcher that finds another one already holding
+// the lock exits cleanly and should not be respawned in a loop.
+fn systemd_unit(exe: &Path, path_env: &str) -> String {
+    format!(
+        "[Unit]\n\
+         Description=agent-mux watcher\n\
+         \n\
+         [Service]\n\
+         ExecStart=\"{}\" watch\n\
+         Environment=\"PATH={path_env}\"\n\
+         Restart=on-failure\n\
+         RestartSec=2\n\
+         \n\
+         [Install]\n\
+         WantedBy=default.target\n",
+        exe.display()
+    )
+}
+
+fn launchd_plist(exe: &Path, path_env: &str, log: &Path) -> String {
+    format!(
+        r#"<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>{LABEL}</string>
+  <key>ProgramArguments</key>
+  <array>
+    <string>{}</string>
+    <string>watch</string>
+  </array>
+  <key>EnvironmentVariables</key>
+  <dict>
+    <key>PATH</key>
+    <string>{}</string>
+  </dict>
+  <key>RunAtLoad</key>
+  <true/>
+  <key>KeepAlive</key>
+  <dict>
+    <key>SuccessfulExit</key>
+    <false/>
+  </dict>
+  <key>StandardOutPath</key>
+  <string>{}</string>
+  <key>StandardErrorPath</key>
+  <string>{}</string>
+</dict>
+</plist>
+"#,
+        xml_escape(&exe.to_string_lossy()),
+        xml_escape(path_env),
+        xml_escape(&log.to_string_lossy()),
+        xml_escape(&log.to_string_lossy()),
+    )
+}
+
+fn xml_escape(s: &str) -> String {
+    s.replace('&', "&amp;")
+        .replace('<', "&lt;")
+        .replace('>', "&gt;")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn systemd_unit_restarts_on_failure() {
+        let unit = systemd_unit(Path::new("/opt/agent mux/agent-mux"), "/usr/bin:/bin");
+
+        assert!(unit.contains("ExecStart=\"/opt/agent mux/agent-mux\" watch\n"));
+        assert!(unit.contains("Environment=\"PATH=/usr/bin:/bin\"\n"));
+        assert!(unit.contains("Restart=on-failure\n"));
+    }
+
+    #[test]
+    fn launchd_plist_escapes_paths() {
+        let plist = launchd_plist(
+            Path::new("/Users/me/R&D/agent-mux"),
+            "/usr/bin",
+            Path::new("/tmp/watch.log"),
+        );
+
+        assert!(plist.contains("<string>/Users/me/R&amp;D/agent-mux</string>"));
+        assert!(plist.contains("<key>SuccessfulExit</key>\n    <false/>"));
+    }
+}
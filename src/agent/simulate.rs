@@ -0,0 +1,167 @@
+use std::io::{self, BufRead, Write};
+use std::sync::mpsc;
+use std::thread;
+use std::time::{Duration, Instant};
+
+use anyhow::{Context, Result, bail};
+
+/// Works for a while, asks for permission, works again, then finishes.
+pub const DEFAULT_SCRIPT: &str = "busy:6,ask,busy:4,done";
+
+const ACTIONS: &[&str] = &[
+    "Reading src/main.rs",
+    "Searching for \"fn reconcile\"",
+    "Editing src/agent/reconcile.rs",
+    "Running cargo test",
+    "Thinking",
+];
+const SPINNER: &[char] = &['⠋', '⠙', '⠹', '⠸', '⠼', '⠴', '⠦', '⠧', '⠇', '⠏'];
+
+/// One step of a simulated agent's script. Steps that wait end on Enter, or
+/// after their duration when one is given.
+#[derive(Debug, Clone, Copy, PartialEq)]
+enum Step {
+    Busy(Duration),
+    Ask(Option<Duration>),
+    Done(Option<Duration>),
+    Error(Option<Duration>),
+}
+
+/// `busy:6,ask,busy:4,done`: each step with an optional duration in
+/// seconds.
+fn parse_script(script: &str) -> Result<Vec<Step>> {
+    script
+        .split(',')
+        .map(|step| {
+            let (name, secs) = step.trim().split_once(':').unwrap_or((step.trim(), ""));
+            let secs = match secs {
+                "" => None,
+                secs => Some(Duration::from_secs_f64(
+                    secs.parse()
+                        .with_context(|| format!("bad duration in {step}"))?,
+                )),
+            };
+            Ok(match name {
+                "busy" => Step::Busy(secs.unwrap_or(Duration::from_secs(5))),
+                "ask" => Step::Ask(secs),
+                "done" => Step::Done(secs),
+                "error" => Step::Error(secs),
+                _ => bail!("unknown step {name}; use busy, ask, done or error"),
+            })
+        })
+        .collect()
+}
+
+/// Plays `script` in the current terminal, over and over unless `once`.
+/// The output is shaped so the attention and error heuristics see what they
+/// would from a real agent.
+pub fn run(script: &str, once: bool) -> Result<()> {
+    let steps = parse_script(script)?;
+    let input = stdin_lines();
+    let mut out = io::stdout().lock();
+    loop {
+        for step in &steps {
+            match *step {
+                Step::Busy(duration) => busy(&mut out, duration)?,
+                Step::Ask(timeout) => {
+                    writeln!(out, "\nDo you want to proceed?")?;
+                    writeln!(out, "❯ 1. Yes\n  2. No")?;
+                    wait(&mut out, &input, timeout)?;
+                }
+                Step::Done(timeout) => {
+                    writeln!(out, "\n● Done. Updated 3 files; all tests pass.\n")?;
+                    write!(out, "> ")?;
+                    wait(&mut out, &input, timeout)?;
+                }
+                Step::Error(timeout) => {
+                    writeln!(out, "\nAPI Error: 529 {{\"type\":\"overloaded_error\"}}")?;
+                    wait(&mut out, &input, timeout)?;
+                }
+            }
+        }
+        if once {
+            return Ok(());
+        }
+    }
+}
+
+fn busy(out: &mut impl Write, duration: Duration) -> Result<()> {
+    let start = Instant::now();
+    let mut tick = 0;
+    while start.elapsed() < duration {
+        let action = ACTIONS[tick / 10 % ACTIONS.len()];
+        let spinner = SPINNER[tick % SPINNER.len()];
+        write!(
+            out,
+            "\r\x1b[K{spinner} {action}… ({}s)",
+            start.elapsed().as_secs()
+        )?;
+        out.flush()?;
+        if tick % 10 == 9 {
+            writeln!(out, "\r\x1b[K✓ {action}")?;
+        }
+        tick += 1;
+        thread::sleep(Duration::from_millis(150));
+    }
+    writeln!(out, "\r\x1b[K")?;
+    Ok(())
+}
+
+fn wait(
+    out: &mut impl Write,
+    input: &mpsc::Receiver<String>,
+    timeout: Option<Duration>,
+) -> Result<()> {
+    out.flush()?;
+    while input.try_recv().is_ok() {}
+    match timeout {
+        Some(timeout) => {
+            let _ = input.recv_timeout(timeout);
+        }
+        None => {
+            if input.recv().is_err() {
+                // stdin closed: nothing will ever answer.
+                loop {
+                    thread::park();
+                }
+            }
+        }
+    }
+    Ok(())
+}
+
+fn stdin_lines() -> mpsc::Receiver<String> {
+    let (tx, rx) = mpsc::channel();
+    thread::spawn(move || {
+        for line in io::stdin().lock().lines() {
+            let Ok(line) = line else { break };
+            if tx.send(line).is_err() {
+                break;
+            }
+        }
+    });
+    rx
+}
+
+#[cfg(test)]
+mod tests {
+    use std::time::Duration;
+
+    use super::{DEFAULT_SCRIPT, Step, parse_script};
+
+    #[test]
+    fn parses_scripts() {
+        assert_eq!(
+            parse_script("busy:1.5, ask:3,done,error").unwrap(),
+            vec![
+                Step::Busy(Duration::from_millis(1500)),
+                Step::Ask(Some(Duration::from_secs(3))),
+                Step::Done(None),
+                Step::Error(None),
+            ]
+        );
+        assert!(parse_script(DEFAULT_SCRIPT).is_ok());
+        assert!(parse_script("sleep:3").is_err());
+        assert!(parse_script("busy:soon").is_err());
+    }
+}
@@ -0,0 +1,167 @@
+use std::path::Path;
+
+use anyhow::{Context, Result, anyhow, bail};
+use serde::{Deserialize, Serialize};
+
+use crate::agent::config::{Template, config};
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt};
+use crate::agent::remote::shell_quote;
+use crate::agent::transcript::Session;
+use crate::agent::{expand_home, tmux};
+
+/// A new agent window: `command` started in `directory` with `prompt` as
+/// its first message. An empty `session` means tmux's current session; a
+/// named one is created if it does not exist. `focus` selects the new window
+/// rather than opening it in the background.
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+pub struct Spawn {
+    pub session: String,
+    pub command: String,
+    pub directory: String,
+    pub prompt: String,
+    pub window_name: String,
+    pub focus: bool,
+}
+
+impl Spawn {
+    pub fn from_template(name: &str, arg: &str) -> Result<Self> {
+        let template = config().templates.get(name).ok_or_else(|| {
+            let known: Vec<&str> = config().templates.keys().map(String::as_str).collect();
+            if known.is_empty() {
+                anyhow!("unknown template {name}; none are configured")
+            } else {
+                anyhow!("unknown template {name} (have: {})", known.join(", "))
+            }
+        })?;
+        Ok(Self::expand(template, arg))
+    }
+
+    /// Reopens a past session in the directory it ran in.
+    pub fn resume(session: &Session) -> Result<Self> {
+        let command = match session.provider.as_str() {
+            "claude" => format!("claude --resume {}", shell_quote(&session.id)),
+            "codex" => format!("codex resume {}", shell_quote(&session.id)),
+            other => bail!("cannot resume {other} sessions"),
+        };
+        Ok(Self {
+            command,
+            directory: session.path.clone(),
+            ..Self::default()
+        })
+    }
+
+    fn expand(template: &Template, arg: &str) -> Self {
+        let fill = |s: &str| s.replace("{arg}", arg);
+        Self {
+            session: String::new(),
+            command: if template.command.is_empty() {
+                template.provider.clone()
+            } else {
+                template.command.clone()
+            },
+            directory: expand_home(&fill(&template.directory)),
+            prompt: fill(&template.prompt),
+            window_name: fill(&template.window_name),
+            focus: false,
+        }
+    }
+
+    fn command_line(&self) -> String {
+        if self.prompt.is_empty() {
+            self.command.clone()
+        } else {
+            format!("{} {}", self.command, shell_quote(&self.prompt))
+        }
+    }
+}
+
+/// Opens a tmux window running the agent and returns its pane id.
+pub fn spawn(spawn: &Spawn) -> Result<String> {
+    if spawn.command.is_empty() {
+        bail!("nothing to run: set a provider or command");
+    }
+    if !spawn.directory.is_empty() && !Path::new(&spawn.directory).is_dir() {
+        bail!("directory {} does not exist", spawn.directory);
+    }
+    let mut cmd = tmux::tmux();
+    let detach: &[&str] = if spawn.focus { &[] } else { &["-d"] };
+    if spawn.session.is_empty() {
+        cmd.arg("new-window").args(detach);
+    } else if session_exists(&spawn.session) {
+        cmd.arg("new-window")
+            .args(detach)
+            .args(["-t", &format!("{}:", spawn.session)]);
+    } else {
+        cmd.args(["new-session", "-d", "-s", &spawn.session]);
+    }
+    cmd.args(["-P", "-F", "#{pane_id}"]);
+    if !spawn.directory.is_empty() {
+        cmd.args(["-c", &spawn.directory]);
+    }
+    if !spawn.window_name.is_empty() {
+        cmd.args(["-n", &spawn.window_name]);
+    }
+    let out = cmd
+        .arg(spawn.command_line())
+        .output_within(COMMAND_TIMEOUT)
+        .context("tmux new-window")?;
+    if !out.status.success() {
+        bail!(
+            "tmux new-window failed: {}",
+            String::from_utf8_lossy(&out.stderr).trim()
+        );
+    }
+    Ok(String::from_utf8_lossy(&out.stdout).trim().to_string())
+}
+
+fn session_exists(session: &str) -> bool {
+    tmux::tmux()
+        .args(["has-session", "-t", &format!("={session}")])
+        .status_within(COMMAND_TIMEOUT)
+        .is_ok_and(|status| status.success())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn expands_template_placeholders() {
+        let template = Template {
+            directory: "/src/{arg}".to_string(),
+            prompt: "Fix {arg}; read the ticket first".to_string(),
+            window_name: "bug-{arg}".to_string(),
+            ..Template::default()
+        };
+
+        let spawn = Spawn::expand(&template, "JIRA-123");
+
+        assert_eq!(spawn.directory, "/src/JIRA-123");
+        assert_eq!(spawn.window_name, "bug-JIRA-123");
+        assert_eq!(
+            spawn.command_line(),
+            "claude 'Fix JIRA-123; read the ticket first'"
+        );
+    }
+
+    #[test]
+    fn resumes_sessions_in_their_directory() {
+        let session = Session {
+            id: "8c1f".to_string(),
+            provider: "claude".to_string(),
+            path: "/src/api".to_string(),
+            ..Session::default()
+        };
+
+        let spawn = Spawn::resume(&session).unwrap();
+
+        assert_eq!(spawn.directory, "/src/api");
+        assert_eq!(spawn.command_line(), "claude --resume 8c1f");
+        let gemini = Session {
+            provider: "gemini".to_string(),
+            ..session
+        };
+        assert!(Spawn::resume(&gemini).is_err());
+    }
+}
@@ -3,6 +3,7 @@ use std::process::Command;
 
 use serde::Deserialize;
 
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt};
 use crate::agent::{Pane, PaneStatus};
 
 #[derive(Debug, Clone, Deserialize)]
@@ -44,12 +45,13 @@ enum SmeltFocus {
 }
 
 pub fn apply_provider_statuses(panes: &mut [Pane]) {
-    if !panes.iter().any(|pane| pane.provider == "smelt") {
+    let is_local_smelt = |pane: &Pane| pane.provider == "smelt" && pane.host.is_empty();
+    if !panes.iter().any(is_local_smelt) {
         return;
     }
 
     let statuses = smelt_statuses();
-    for pane in panes.iter_mut().filter(|pane| pane.provider == "smelt") {
+    for pane in panes.iter_mut().filter(|pane| is_local_smelt(pane)) {
         if pane.provider_pid <= 0 {
             continue;
         }
@@ -65,7 +67,7 @@ fn smelt_statuses() -> HashMap<u32, SmeltStatus> {
         .arg("status")
         .arg("--all")
         .arg("--json")
-        .output()
+        .output_within(COMMAND_TIMEOUT)
     else {
         return HashMap::new();
     };
@@ -90,6 +92,7 @@ fn map_smelt_status(status: &SmeltStatus) -> PaneStatus {
                 PaneStatus::Idle
             }
             Some(SmeltReason::TurnComplete) => PaneStatus::Unread,
+            Some(SmeltReason::Error) => PaneStatus::Error,
             _ => PaneStatus::NeedsAttention,
         },
     }
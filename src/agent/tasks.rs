@@ -0,0 +1,586 @@
+use std::path::Path;
+
+use anyhow::{Result, bail};
+use chrono::{DateTime, Duration, Utc};
+use serde::{Deserialize, Serialize};
+
+use crate::agent::backend::{Backend, backend_of};
+use crate::agent::config::config;
+use crate::agent::persist::{
+    add_finish_action, load_tasks, queue_prompt, set_pane_tags, update_tasks,
+};
+use crate::agent::spawn::{self, Spawn};
+use crate::agent::throttle::{Throttle, provider_of, spawn_or_queue};
+use crate::agent::trigger::FinishAction;
+use crate::agent::{Pane, PaneStatus, git, ipc, log};
+
+/// How long a spawned agent has to show up before its task fails.
+const SPAWN_GRACE: Duration = Duration::seconds(60);
+
+/// A prompt to hand to an agent working in `workspace`.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct Task {
+    pub id: u32,
+    pub prompt: String,
+    pub workspace: String,
+    #[serde(default)]
+    pub state: TaskState,
+    /// The agent the task was given to.
+    #[serde(default, skip_serializing_if = "String::is_empty")]
+    pub pane_id: String,
+    /// The branch of the task's own worktree, for `task new`.
+    #[serde(default, skip_serializing_if = "String::is_empty")]
+    pub branch: String,
+    pub created_at: DateTime<Utc>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub assigned_at: Option<DateTime<Utc>>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub finished_at: Option<DateTime<Utc>>,
+}
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum TaskState {
+    /// Waiting for an idle agent in its workspace.
+    #[default]
+    Pending,
+    /// Has its own worktree, and waits for the concurrency limit to start
+    /// its agent.
+    Ready,
+    /// Given to an agent that has not started on it yet.
+    Assigned,
+    Running,
+    Done,
+    Failed,
+}
+
+impl TaskState {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Pending => "pending",
+            Self::Ready => "ready",
+            Self::Assigned => "assigned",
+            Self::Running => "running",
+            Self::Done => "done",
+            Self::Failed => "failed",
+        }
+    }
+
+    pub fn is_open(self) -> bool {
+        matches!(
+            self,
+            Self::Pending | Self::Ready | Self::Assigned | Self::Running
+        )
+    }
+}
+
+/// What the dispatcher decided to do for a task.
+#[derive(Debug, Clone)]
+enum Dispatch {
+    Send { task: u32, pane_id: String },
+    Spawn { task: u32, workspace: String },
+}
+
+pub fn add(prompt: &str, workspace: &str) -> Result<Task> {
+    if prompt.trim().is_empty() {
+        bail!("missing prompt");
+    }
+    update_tasks(|tasks| {
+        let task = Task {
+            id: next_id(tasks),
+            prompt: prompt.trim().to_string(),
+            workspace: workspace.to_string(),
+            state: TaskState::Pending,
+            pane_id: String::new(),
+            branch: String::new(),
+            created_at: Utc::now(),
+            assigned_at: None,
+            finished_at: None,
+        };
+        tasks.push(task.clone());
+        task
+    })
+}
+
+/// Starts `prompt` on a new branch in its own worktree, next to the
+/// repository `directory` is in. The agent comes from `template` when
+/// given, else `tasks.spawn`. Its pane is tagged `task` and notifies once
+/// it finishes, and the task is recorded as assigned so the queue follows
+/// it. While the `concurrency` limit holds the agent back, the task stays
+/// ready until the agent starts. When the agent can be neither started nor
+/// queued, the worktree and branch are removed again.
+pub fn start_in_worktree(prompt: &str, directory: &str, template: Option<&str>) -> Result<Task> {
+    let prompt = prompt.trim();
+    if prompt.is_empty() {
+        bail!("missing prompt");
+    }
+    let root = git::toplevel(directory)?;
+    let name = slug(prompt);
+    let path = (1..)
+        .map(|n| match n {
+            1 => format!("{root}-{name}"),
+            n => format!("{root}-{name}-{n}"),
+        })
+        .find(|path| !Path::new(path).exists())
+        .unwrap_or_default();
+    let branch = format!("{}{name}", config().tasks.branch_prefix);
+
+    let mut request = match template {
+        Some(template) => Spawn::from_template(template, prompt)?,
+        None => Spawn {
+            command: config().tasks.spawn.clone(),
+            ..Spawn::default()
+        },
+    };
+    if request.prompt.is_empty() {
+        request.prompt = prompt.to_string();
+    }
+    request.directory = path.clone();
+    request.window_name = name.clone();
+    git::add_worktree(&root, &branch, &path)?;
+    let pane_id = match spawn_or_queue(&request, &ipc::load_panes()) {
+        Ok(pane_id) => pane_id,
+        Err(err) => {
+            if let Err(cleanup) = git::remove_worktree(&root, &branch, &path) {
+                log::warn(
+                    "remove task worktree failed",
+                    &[("path", &path), ("err", &format!("{cleanup:#}"))],
+                );
+            }
+            return Err(err);
+        }
+    };
+
+    // Record the task before anything else can fail, now that its agent is
+    // running or queued in the worktree.
+    let now = Utc::now();
+    let task = update_tasks(|tasks| {
+        let task = Task {
+            id: next_id(tasks),
+            prompt: request.prompt.clone(),
+            workspace: path.clone(),
+            state: if pane_id.is_some() {
+                TaskState::Assigned
+            } else {
+                TaskState::Ready
+            },
+            pane_id: pane_id.clone().unwrap_or_default(),
+            branch: branch.clone(),
+            created_at: now,
+            assigned_at: pane_id.is_some().then_some(now),
+            finished_at: None,
+        };
+        tasks.push(task.clone());
+        task
+    })?;
+    let pane = Pane {
+        pane_id: pane_id.clone().unwrap_or_default(),
+        path,
+        window_name: name,
+        ..Pane::default()
+    };
+    set_pane_tags(&pane, vec!["task".to_string()])?;
+    if pane_id.is_some() {
+        ipc::set_finish_action(&pane, Some(finish_notice(&branch)))?;
+    }
+    Ok(task)
+}
+
+/// The notification sent once a worktree task's agent finishes.
+fn finish_notice(branch: &str) -> FinishAction {
+    FinishAction::Notify {
+        message: format!("{branch} is ready"),
+    }
+}
+
+fn next_id(tasks: &[Task]) -> u32 {
+    tasks.iter().map(|task| task.id).max().unwrap_or(0) + 1
+}
+
+/// A branch and directory name from the first few words of a prompt.
+fn slug(prompt: &str) -> String {
+    let words: Vec<String> = prompt
+        .split(|ch: char| !ch.is_ascii_alphanumeric())
+        .filter(|word| !word.is_empty())
+        .take(5)
+        .map(str::to_ascii_lowercase)
+        .collect();
+    match words.join("-") {
+        slug if slug.is_empty() => "task".to_string(),
+        slug => slug
+            .chars()
+            .take(40)
+            .collect::<String>()
+            .trim_end_matches('-')
+            .to_string(),
+    }
+}
+
+/// Drops a task that has not been given to an agent yet.
+pub fn cancel(id: u32) -> Result<()> {
+    let found = update_tasks(|tasks| {
+        let before = tasks.len();
+        tasks.retain(|task| task.id != id || task.state != TaskState::Pending);
+        tasks.len() < before
+    })?;
+    if !found {
+        bail!("no pending task {id}");
+    }
+    Ok(())
+}
+
+/// Forgets finished and failed tasks.
+pub fn clear_finished() -> Result<()> {
+    update_tasks(|tasks| tasks.retain(|task| task.state.is_open()))
+}
+
+/// Hands pending tasks to idle agents, or spawns one for a workspace
+/// without any, and follows assigned tasks through their agent's status.
+/// Run by the watcher after each refresh.
+pub fn run_dispatch(panes: &[Pane], throttle: &mut Throttle) {
+    if !load_tasks().iter().any(|task| task.state.is_open()) {
+        return;
+    }
+    let now = Utc::now();
+    let dispatched = update_tasks(|tasks| {
+        let started = advance(tasks, panes, now);
+        let spawn = (!config().tasks.spawn.is_empty()).then(|| provider_of(&config().tasks.spawn));
+        (started, assign(tasks, panes, spawn, throttle, now))
+    });
+    let (started, dispatched) = match dispatched {
+        Ok(dispatched) => dispatched,
+        Err(err) => {
+            log::warn("update tasks failed", &[("err", &format!("{err:#}"))]);
+            return;
+        }
+    };
+    for task in started {
+        let pane = Pane {
+            pane_id: task.pane_id.clone(),
+            ..Pane::default()
+        };
+        if let Err(err) = add_finish_action(&pane, Some(finish_notice(&task.branch))) {
+            log::warn(
+                "add finish action failed",
+                &[("task", &task.id), ("err", &format!("{err:#}"))],
+            );
+        }
+    }
+    for dispatch in dispatched {
+        let (task, result) = match &dispatch {
+            Dispatch::Send { task, pane_id } => (*task, send(*task, panes, pane_id)),
+            Dispatch::Spawn { task, workspace } => (*task, spawn_for(*task, workspace)),
+        };
+        let (state, pane_id) = match result {
+            Ok(pane_id) => {
+                log::info("assigned task", &[("task", &task), ("pane", &pane_id)]);
+                (TaskState::Assigned, pane_id)
+            }
+            Err(err) => {
+                log::warn(
+                    "assign task failed",
+                    &[("task", &task), ("err", &format!("{err:#}"))],
+                );
+                (TaskState::Failed, String::new())
+            }
+        };
+        let saved = update_tasks(|tasks| {
+            if let Some(entry) = tasks.iter_mut().find(|entry| entry.id == task) {
+                entry.state = state;
+                entry.pane_id = pane_id;
+                if state == TaskState::Failed {
+                    entry.finished_at = Some(now);
+                }
+            }
+        });
+        if let Err(err) = saved {
+            log::warn("update tasks failed", &[("err", &format!("{err:#}"))]);
+        }
+    }
+}
+
+fn send(task: u32, panes: &[Pane], pane_id: &str) -> Result<String> {
+    let Some(pane) = panes.iter().find(|pane| pane.pane_id == pane_id) else {
+        bail!("pane {pane_id} is gone");
+    };
+    let Some(prompt) = load_tasks()
+        .into_iter()
+        .find(|entry| entry.id == task)
+        .map(|entry| entry.prompt)
+    else {
+        bail!("task {task} is gone");
+    };
+    queue_prompt(pane, &prompt)?;
+    Ok(pane.pane_id.clone())
+}
+
+fn spawn_for(task: u32, workspace: &str) -> Result<String> {
+    let Some(prompt) = load_tasks()
+        .into_iter()
+        .find(|entry| entry.id == task)
+        .map(|entry| entry.prompt)
+    else {
+        bail!("task {task} is gone");
+    };
+    spawn::spawn(&Spawn {
+        command: config().tasks.spawn.clone(),
+        directory: workspace.to_string(),
+        prompt,
+        window_name: format!("task-{task}"),
+        ..Spawn::default()
+    })
+}
+
+/// Moves assigned tasks on by their agent's status: Busy means it started,
+/// going idle afterwards means it finished, and an error or a vanished
+/// pane fails it. A ready task is assigned once an agent shows up in its
+/// worktree; those are returned.
+fn advance(tasks: &mut [Task], panes: &[Pane], now: DateTime<Utc>) -> Vec<Task> {
+    let mut started = Vec::new();
+    for task in tasks.iter_mut() {
+        if task.state == TaskState::Ready {
+            if let Some(pane) = panes.iter().find(|pane| {
+                pane.host.is_empty() && !pane.terminated && pane.path == task.workspace
+            }) {
+                task.state = TaskState::Assigned;
+                task.pane_id = pane.pane_id.clone();
+                task.assigned_at = Some(now);
+                started.push(task.clone());
+            }
+            continue;
+        }
+        if !matches!(task.state, TaskState::Assigned | TaskState::Running) {
+            continue;
+        }
+        let pane = panes
+            .iter()
+            .find(|pane| pane.pane_id == task.pane_id && !pane.terminated);
+        let next = match (task.state, pane.map(|pane| pane.status)) {
+            (TaskState::Assigned, None)
+                if task.assigned_at.is_some_and(|at| now - at < SPAWN_GRACE) =>
+            {
+                continue;
+            }
+            (_, None) | (_, Some(PaneStatus::Error | PaneStatus::Disconnected)) => {
+                TaskState::Failed
+            }
+            (TaskState::Assigned, Some(PaneStatus::Busy)) => TaskState::Running,
+            (TaskState::Running, Some(PaneStatus::Idle | PaneStatus::Unread)) => TaskState::Done,
+            _ => continue,
+        };
+        task.state = next;
+        if !next.is_open() {
+            task.finished_at = Some(now);
+        }
+    }
+    started
+}
+
+/// Claims an idle agent for each pending task, oldest first. A workspace
+/// with no agents at all gets a new one of the `spawn` provider, if the
+/// concurrency limit allows; one whose agents are all busy waits.
+fn assign(
+    tasks: &mut [Task],
+    panes: &[Pane],
+    spawn: Option<&str>,
+    throttle: &mut Throttle,
+    now: DateTime<Utc>,
+) -> Vec<Dispatch> {
+    let mut claimed: Vec<String> = tasks
+        .iter()
+        .filter(|task| matches!(task.state, TaskState::Assigned | TaskState::Running))
+        .map(|task| task.pane_id.clone())
+        .collect();
+    let mut spawning: Vec<String> = Vec::new();
+    let mut dispatched = Vec::new();
+    for task in tasks.iter_mut() {
+        if task.state != TaskState::Pending {
+            continue;
+        }
+        let in_workspace = |pane: &&Pane| {
+            pane.host.is_empty()
+                && !pane.terminated
+                && (pane.path == task.workspace || pane.project_root == task.workspace)
+        };
+        let idle = panes.iter().filter(in_workspace).find(|pane| {
+            matches!(pane.status, PaneStatus::Idle | PaneStatus::Unread)
+                && !pane.stashed
+                && !pane.do_not_disturb
+                && pane.snoozed_until.is_none()
+                && pane.queued_prompts.is_empty()
+                && backend_of(&pane.target) == Backend::Tmux
+                && !claimed.contains(&pane.pane_id)
+        });
+        if let Some(pane) = idle {
+            claimed.push(pane.pane_id.clone());
+            task.pane_id = pane.pane_id.clone();
+            dispatched.push(Dispatch::Send {
+                task: task.id,
+                pane_id: pane.pane_id.clone(),
+            });
+        } else if let Some(provider) = spawn
+            && !panes.iter().any(|pane| in_workspace(&pane))
+            && !spawning.contains(&task.workspace)
+            && throttle.admit(provider)
+        {
+            spawning.push(task.workspace.clone());
+            dispatched.push(Dispatch::Spawn {
+                task: task.id,
+                workspace: task.workspace.clone(),
+            });
+        } else {
+            continue;
+        }
+        task.state = TaskState::Assigned;
+        task.assigned_at = Some(now);
+    }
+    dispatched
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn task(id: u32, workspace: &str) -> Task {
+        Task {
+            id,
+            prompt: format!("task {id}"),
+            workspace: workspace.to_string(),
+            state: TaskState::Pending,
+            pane_id: String::new(),
+            branch: String::new(),
+            created_at: Utc::now(),
+            assigned_at: None,
+            finished_at: None,
+        }
+    }
+
+    fn pane(id: &str, path: &str, status: PaneStatus) -> Pane {
+        Pane {
+            pane_id: id.to_string(),
+            target: format!("s:1.{id}"),
+            path: path.to_string(),
+            status,
+            ..Pane::default()
+        }
+    }
+
+    #[test]
+    fn gives_each_idle_agent_one_task_and_spawns_for_empty_workspaces() {
+        let now = Utc::now();
+        let mut tasks = vec![
+            task(1, "/src/api"),
+            task(2, "/src/api"),
+            task(3, "/src/web"),
+            task(4, "/src/web"),
+        ];
+        let panes = [
+            pane("%1", "/src/api", PaneStatus::Idle),
+            pane("%2", "/src/api", PaneStatus::Busy),
+        ];
+
+        let dispatched = assign(
+            &mut tasks,
+            &panes,
+            Some("claude"),
+            &mut Throttle::default(),
+            now,
+        );
+
+        assert_eq!(dispatched.len(), 2);
+        assert!(matches!(&dispatched[0], Dispatch::Send { task: 1, pane_id } if pane_id == "%1"));
+        assert!(matches!(&dispatched[1], Dispatch::Spawn { task: 3, .. }));
+        let states: Vec<TaskState> = tasks.iter().map(|task| task.state).collect();
+        assert_eq!(
+            states,
+            [
+                TaskState::Assigned,
+                TaskState::Pending,
+                TaskState::Assigned,
+                TaskState::Pending
+            ]
+        );
+        assert!(assign(&mut tasks, &panes, None, &mut Throttle::default(), now).is_empty());
+    }
+
+    #[test]
+    fn follows_the_agent_from_busy_to_idle() {
+        let now = Utc::now();
+        let mut tasks = vec![Task {
+            state: TaskState::Assigned,
+            pane_id: "%1".to_string(),
+            assigned_at: Some(now),
+            ..task(1, "/src/api")
+        }];
+
+        advance(&mut tasks, &[], now);
+        assert_eq!(tasks[0].state, TaskState::Assigned);
+
+        advance(&mut tasks, &[pane("%1", "/src/api", PaneStatus::Idle)], now);
+        assert_eq!(tasks[0].state, TaskState::Assigned);
+
+        advance(&mut tasks, &[pane("%1", "/src/api", PaneStatus::Busy)], now);
+        assert_eq!(tasks[0].state, TaskState::Running);
+
+        let attention = pane("%1", "/src/api", PaneStatus::NeedsAttention);
+        advance(&mut tasks, &[attention], now);
+        assert_eq!(tasks[0].state, TaskState::Running);
+
+        advance(
+            &mut tasks,
+            &[pane("%1", "/src/api", PaneStatus::Unread)],
+            now,
+        );
+        assert_eq!(tasks[0].state, TaskState::Done);
+        assert_eq!(tasks[0].finished_at, Some(now));
+    }
+
+    #[test]
+    fn ready_tasks_wait_for_an_agent_in_their_worktree() {
+        let now = Utc::now();
+        let mut tasks = vec![Task {
+            state: TaskState::Ready,
+            branch: "task/fix-auth".to_string(),
+            ..task(1, "/src/api-fix-auth")
+        }];
+
+        assert!(advance(&mut tasks, &[pane("%1", "/src/api", PaneStatus::Idle)], now).is_empty());
+        assert_eq!(tasks[0].state, TaskState::Ready);
+
+        let started = advance(
+            &mut tasks,
+            &[pane("%2", "/src/api-fix-auth", PaneStatus::Idle)],
+            now,
+        );
+        assert_eq!(started.len(), 1);
+        assert_eq!(tasks[0].state, TaskState::Assigned);
+        assert_eq!(tasks[0].pane_id, "%2");
+        assert_eq!(tasks[0].assigned_at, Some(now));
+    }
+
+    #[test]
+    fn names_worktrees_after_the_prompt() {
+        assert_eq!(
+            slug("Fix the flaky auth test, again!"),
+            "fix-the-flaky-auth-test"
+        );
+        assert_eq!(slug("  ¿?  "), "task");
+        assert_eq!(slug(&"a".repeat(60)), "a".repeat(40));
+    }
+
+    #[test]
+    fn fails_when_the_agent_disappears() {
+        let now = Utc::now();
+        let mut tasks = vec![Task {
+            state: TaskState::Assigned,
+            pane_id: "%9".to_string(),
+            assigned_at: Some(now - Duration::minutes(5)),
+            ..task(1, "/src/api")
+        }];
+
+        advance(&mut tasks, &[], now);
+
+        assert_eq!(tasks[0].state, TaskState::Failed);
+    }
+}
@@ -0,0 +1,234 @@
+use std::collections::BTreeMap;
+use std::fs::{self, OpenOptions};
+use std::io::Write;
+use std::path::Path;
+use std::process::Command;
+use std::time::{Duration, Instant};
+
+use anyhow::{Context, Result, bail};
+use chrono::{DateTime, Utc};
+use serde::Serialize;
+use sha2::{Digest, Sha256};
+
+use crate::agent::config::{TeamStatus, config};
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt, SSH_TIMEOUT};
+use crate::agent::{Pane, PaneStatus, expand_home, log};
+
+/// What one machine reports. Only counts, workspace names and durations:
+/// no pane content, paths, titles or prompts.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+#[serde(rename_all = "camelCase")]
+pub struct Report {
+    pub machine: String,
+    pub at: DateTime<Utc>,
+    pub interval_secs: u64,
+    pub panes: usize,
+    pub statuses: BTreeMap<&'static str, usize>,
+    pub workspaces: Vec<WorkspaceReport>,
+}
+
+#[derive(Debug, Clone, PartialEq, Serialize)]
+#[serde(rename_all = "camelCase")]
+pub struct WorkspaceReport {
+    pub name: String,
+    pub panes: usize,
+    pub busy: usize,
+    /// Seconds agents in this workspace spent busy since the last report.
+    pub busy_secs: u64,
+}
+
+/// Publishes a `Report` every `intervalSecs` when `teamStatus` is enabled.
+#[derive(Debug, Default)]
+pub struct TeamReporter {
+    last_tick: Option<Instant>,
+    last_sent: Option<Instant>,
+    busy: BTreeMap<String, Duration>,
+}
+
+impl TeamReporter {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn run(&mut self, panes: &[Pane]) {
+        let settings = &config().team_status;
+        if !settings.enabled {
+            return;
+        }
+        let now = Instant::now();
+        if let Some(last) = self.last_tick {
+            self.accumulate(panes, now - last);
+        }
+        self.last_tick = Some(now);
+        let interval = Duration::from_secs(settings.interval_secs.max(1));
+        let Some(last_sent) = self.last_sent else {
+            self.last_sent = Some(now);
+            return;
+        };
+        if now - last_sent < interval {
+            return;
+        }
+        self.last_sent = Some(now);
+        let report = self.report(panes, machine_id(settings), Utc::now(), interval);
+        let settings = settings.clone();
+        std::thread::spawn(move || {
+            if let Err(err) = publish(&settings, &report) {
+                log::warn("team status failed", &[("err", &format!("{err:#}"))]);
+            }
+        });
+    }
+
+    fn accumulate(&mut self, panes: &[Pane], elapsed: Duration) {
+        for pane in panes.iter().filter(|p| is_busy(p)) {
+            *self.busy.entry(workspace(pane)).or_default() += elapsed;
+        }
+    }
+
+    fn report(
+        &mut self,
+        panes: &[Pane],
+        machine: String,
+        at: DateTime<Utc>,
+        interval: Duration,
+    ) -> Report {
+        let panes: Vec<&Pane> = panes.iter().filter(|p| !p.terminated).collect();
+        let mut statuses = BTreeMap::new();
+        let mut workspaces: BTreeMap<String, WorkspaceReport> = BTreeMap::new();
+        for pane in &panes {
+            *statuses.entry(pane.status.as_str()).or_default() += 1;
+            let name = workspace(pane);
+            let entry = workspaces
+                .entry(name.clone())
+                .or_insert_with(|| WorkspaceReport {
+                    name,
+                    panes: 0,
+                    busy: 0,
+                    busy_secs: 0,
+                });
+            entry.panes += 1;
+            entry.busy += usize::from(is_busy(pane));
+        }
+        for (name, busy) in std::mem::take(&mut self.busy) {
+            if let Some(entry) = workspaces.get_mut(&name) {
+                entry.busy_secs = busy.as_secs();
+            }
+        }
+        Report {
+            machine,
+            at,
+            interval_secs: interval.as_secs(),
+            panes: panes.len(),
+            statuses,
+            workspaces: workspaces.into_values().collect(),
+        }
+    }
+}
+
+fn is_busy(pane: &Pane) -> bool {
+    pane.status == PaneStatus::Busy && !pane.terminated
+}
+
+/// The project's directory name, never its full path.
+fn workspace(pane: &Pane) -> String {
+    let root = if pane.project_root.is_empty() {
+        &pane.path
+    } else {
+        &pane.project_root
+    };
+    Path::new(root)
+        .file_name()
+        .and_then(|name| name.to_str())
+        .unwrap_or("unknown")
+        .to_string()
+}
+
+/// `machine` from the config, or a hash of the host name that stays the
+/// same between reports without naming the machine.
+fn machine_id(settings: &TeamStatus) -> String {
+    if !settings.machine.is_empty() {
+        return settings.machine.clone();
+    }
+    let hostname = Command::new("hostname")
+        .output_within(COMMAND_TIMEOUT)
+        .map(|out| String::from_utf8_lossy(&out.stdout).trim().to_string())
+        .unwrap_or_default();
+    Sha256::digest(hostname.as_bytes())[..6]
+        .iter()
+        .map(|b| format!("{b:02x}"))
+        .collect()
+}
+
+fn publish(settings: &TeamStatus, report: &Report) -> Result<()> {
+    let line = serde_json::to_string(report)?;
+    if !settings.file.is_empty() {
+        let path = expand_home(&settings.file);
+        if let Some(dir) = Path::new(&path).parent() {
+            fs::create_dir_all(dir).context("create team status dir")?;
+        }
+        let mut file = OpenOptions::new()
+            .create(true)
+            .append(true)
+            .open(&path)
+            .with_context(|| format!("open {path}"))?;
+        writeln!(file, "{line}").context("write team status")?;
+    }
+    if !settings.endpoint.is_empty() {
+        let out = Command::new("curl")
+            .args(["-fsS", "-X", "POST", "-H", "Content-Type: application/json"])
+            .args(["--data-binary", &line, &settings.endpoint])
+            .output_within(SSH_TIMEOUT)
+            .context("run curl")?;
+        if !out.status.success() {
+            bail!("{}", String::from_utf8_lossy(&out.stderr).trim());
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use std::time::Duration;
+
+    use chrono::Utc;
+
+    use super::TeamReporter;
+    use crate::agent::{Pane, PaneStatus};
+
+    fn pane(id: &str, root: &str, status: PaneStatus) -> Pane {
+        Pane {
+            pane_id: id.to_string(),
+            path: format!("{root}/src"),
+            project_root: root.to_string(),
+            status,
+            ..Pane::default()
+        }
+    }
+
+    #[test]
+    fn reports_counts_and_busy_time_per_workspace() {
+        let panes = vec![
+            pane("%1", "/home/me/api", PaneStatus::Busy),
+            pane("%2", "/home/me/api", PaneStatus::Idle),
+            pane("%3", "/home/me/web", PaneStatus::NeedsAttention),
+        ];
+        let mut reporter = TeamReporter::new();
+        reporter.accumulate(&panes, Duration::from_secs(30));
+        reporter.accumulate(&panes, Duration::from_secs(30));
+        let report = reporter.report(&panes, "m".to_string(), Utc::now(), Duration::from_secs(60));
+
+        assert_eq!(report.panes, 3);
+        assert_eq!(report.statuses.get("busy"), Some(&1));
+        let api = &report.workspaces[0];
+        assert_eq!(
+            (api.name.as_str(), api.panes, api.busy, api.busy_secs),
+            ("api", 2, 1, 60)
+        );
+        assert_eq!(report.workspaces[1].busy_secs, 0);
+
+        let json = serde_json::to_string(&report).unwrap();
+        assert!(!json.contains("/home/me"));
+
+        let report = reporter.report(&panes, "m".to_string(), Utc::now(), Duration::from_secs(60));
+        assert_eq!(report.workspaces[0].busy_secs, 0);
+    }
+}
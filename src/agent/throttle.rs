@@ -0,0 +1,186 @@
+use std::collections::HashMap;
+use std::path::Path;
+use std::time::{Duration, Instant};
+
+use anyhow::Result;
+
+use crate::agent::config::{Concurrency, config};
+use crate::agent::persist::{load_spawns, update_spawns};
+use crate::agent::spawn::{self, Spawn};
+use crate::agent::{Pane, PaneStatus, log};
+
+/// How long a started agent counts as busy before it shows up as such.
+const START_GRACE: Duration = Duration::from_secs(30);
+
+/// Counts busy agents against the `concurrency` limits. Whatever is let
+/// through in a refresh is counted too, so a batch cannot overshoot before
+/// its agents show up busy.
+#[derive(Debug, Clone, Default)]
+pub struct Throttle {
+    limits: Concurrency,
+    total: usize,
+    busy: HashMap<String, usize>,
+}
+
+impl Throttle {
+    pub fn new<'a>(panes: impl IntoIterator<Item = &'a Pane>) -> Self {
+        Self::with_limits(config().concurrency.clone(), panes)
+    }
+
+    fn with_limits<'a>(limits: Concurrency, panes: impl IntoIterator<Item = &'a Pane>) -> Self {
+        let mut throttle = Self {
+            limits,
+            ..Self::default()
+        };
+        for pane in panes {
+            if pane.status == PaneStatus::Busy && !pane.terminated {
+                throttle.count(&pane.provider);
+            }
+        }
+        throttle
+    }
+
+    pub fn count(&mut self, provider: &str) {
+        self.total += 1;
+        *self.busy.entry(provider.to_string()).or_default() += 1;
+    }
+
+    /// Whether one more `provider` agent may start working.
+    pub fn admits(&self, provider: &str) -> bool {
+        let under = |limit: usize, busy: usize| limit == 0 || busy < limit;
+        under(self.limits.max_busy, self.total)
+            && under(
+                self.limits.providers.get(provider).copied().unwrap_or(0),
+                self.busy.get(provider).copied().unwrap_or(0),
+            )
+    }
+
+    /// `admits`, counting the agent when it does.
+    pub fn admit(&mut self, provider: &str) -> bool {
+        let admitted = self.admits(provider);
+        if admitted {
+            self.count(provider);
+        }
+        admitted
+    }
+}
+
+/// The provider an agent command runs, by its program's name.
+pub fn provider_of(command: &str) -> &str {
+    let program = command.split_whitespace().next().unwrap_or_default();
+    Path::new(program)
+        .file_name()
+        .and_then(|name| name.to_str())
+        .unwrap_or(program)
+}
+
+/// Spawns the agent now, or queues it behind earlier ones while the limit
+/// holds. Returns the new pane id, or `None` when queued. An agent without
+/// a prompt does not start working, so it is never held.
+pub fn spawn_or_queue(request: &Spawn, panes: &[Pane]) -> Result<Option<String>> {
+    if request.prompt.is_empty()
+        || load_spawns().is_empty() && Throttle::new(panes).admits(provider_of(&request.command))
+    {
+        return spawn::spawn(request).map(Some);
+    }
+    update_spawns(|spawns| spawns.push(request.clone()))?;
+    Ok(None)
+}
+
+/// Starts queued spawns, oldest first, as the limit lets them through.
+#[derive(Debug, Default)]
+pub struct SpawnQueue {
+    /// Agents started but not yet seen busy, by pane id.
+    started: HashMap<String, (String, Instant)>,
+}
+
+impl SpawnQueue {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn run(&mut self, panes: &[Pane], throttle: &mut Throttle) {
+        let now = Instant::now();
+        self.started.retain(|id, (_, at)| {
+            now.duration_since(*at) < START_GRACE
+                && !panes
+                    .iter()
+                    .any(|pane| pane.pane_id == *id && pane.status == PaneStatus::Busy)
+        });
+        for (provider, _) in self.started.values() {
+            throttle.count(provider);
+        }
+        if load_spawns().is_empty() {
+            return;
+        }
+        let admitted = update_spawns(|spawns| {
+            let mut admitted = Vec::new();
+            spawns.retain(|request| {
+                if throttle.admit(provider_of(&request.command)) {
+                    admitted.push(request.clone());
+                    false
+                } else {
+                    true
+                }
+            });
+            admitted
+        });
+        let admitted = match admitted {
+            Ok(admitted) => admitted,
+            Err(err) => {
+                log::warn("update spawn queue failed", &[("err", &format!("{err:#}"))]);
+                return;
+            }
+        };
+        for request in admitted {
+            match spawn::spawn(&request) {
+                Ok(pane_id) => {
+                    log::info("started queued spawn", &[("pane", &pane_id)]);
+                    let provider = provider_of(&request.command).to_string();
+                    self.started.insert(pane_id, (provider, now));
+                }
+                Err(err) => log::warn(
+                    "start queued spawn failed",
+                    &[("command", &request.command), ("err", &format!("{err:#}"))],
+                ),
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn busy(provider: &str) -> Pane {
+        Pane {
+            provider: provider.to_string(),
+            status: PaneStatus::Busy,
+            ..Pane::default()
+        }
+    }
+
+    #[test]
+    fn holds_agents_past_the_total_and_provider_limits() {
+        let limits = Concurrency {
+            max_busy: 3,
+            providers: [("claude".to_string(), 2)].into_iter().collect(),
+        };
+        let panes = [busy("claude"), busy("codex")];
+        let mut throttle = Throttle::with_limits(limits, &panes);
+
+        assert!(throttle.admit("claude"));
+        assert!(!throttle.admits("claude"));
+        assert!(!throttle.admits("codex"));
+
+        let mut unlimited = Throttle::with_limits(Concurrency::default(), &panes);
+        assert!((0..10).all(|_| unlimited.admit("claude")));
+    }
+
+    #[test]
+    fn names_the_provider_by_program() {
+        assert_eq!(provider_of("/usr/local/bin/claude --model opus"), "claude");
+        assert_eq!(provider_of("codex"), "codex");
+        assert_eq!(provider_of(""), "");
+    }
+}
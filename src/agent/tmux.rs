@@ -1,5 +1,7 @@
+use std::collections::{HashMap, HashSet};
 use std::fs::OpenOptions;
 use std::os::unix::process::CommandExt;
+use std::path::{Path, PathBuf};
 use std::process::{Command, Stdio};
 use std::sync::{Mutex, OnceLock};
 use std::thread;
@@ -9,10 +11,14 @@ use anyhow::{Context, Result, anyhow};
 use regex::Regex;
 use sha2::{Digest, Sha256};
 
-use crate::agent::Pane;
+use crate::agent::backend::{Backend, backend_of, list_native_panes};
+use crate::agent::config::config;
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt, SSH_TIMEOUT};
 use crate::agent::git::enrich_panes;
-use crate::agent::provider::{ProcessTable, parse_process_table, resolve};
+use crate::agent::provider::{ProcessTable, resolve};
+use crate::agent::remote::{remote_host, remote_target, shell_join, ssh_command, ssh_options};
 use crate::agent::status::apply_provider_statuses;
+use crate::agent::{Pane, archive, kitty, log, mounts, output, ps, wezterm};
 
 const PROCESS_TABLE_TTL: Duration = Duration::from_secs(1);
 
@@ -29,14 +35,18 @@ struct RawPane {
     session: String,
     window: String,
     window_name: String,
+    window_named: bool,
     pane: String,
     path: String,
     cmd: String,
     pid: i32,
     provider_pid: i32,
     window_focused: bool,
+    window_activity: u64,
 }
 
+/// Every agent pane across the configured backends and remotes, with git
+/// info. `list_panes_fast` skips the git lookups.
 pub fn list_panes() -> Result<Vec<Pane>> {
     let _g = smelt_perf::perf::begin("agent.list_panes");
     let mut panes = list_panes_fast()?;
@@ -54,11 +64,53 @@ pub fn list_panes_fast() -> Result<Vec<Pane>> {
 
 fn fetch_panes() -> Result<Vec<Pane>> {
     let _g = smelt_perf::perf::begin("tmux.fetch_panes");
-    let tmux_out = list_tmux_panes()?;
     let pt = load_process_table();
+    let mut panes = if config().backend_enabled("tmux") {
+        if pt.is_empty() {
+            return Err(anyhow!("process table is empty; skipping this refresh"));
+        }
+        fetch_tmux_panes(None, &pt)?
+    } else {
+        Vec::new()
+    };
+    for remote in &config().remotes {
+        let remote_pt = load_remote_process_table(&remote.host);
+        match fetch_tmux_panes(Some(&remote.host), &remote_pt) {
+            Ok(remote_panes) => {
+                let offset = panes.len();
+                panes.extend(remote_panes.into_iter().map(|pane| Pane {
+                    pane_id: remote_target(&remote.name, &pane.pane_id),
+                    target: remote_target(&remote.name, &pane.target),
+                    host: remote.name.clone(),
+                    order: offset + pane.order,
+                    ..pane
+                }));
+            }
+            Err(err) => log::warn(
+                "remote unavailable",
+                &[("remote", &remote.name), ("err", &format!("{err:#}"))],
+            ),
+        }
+    }
+    let offset = panes.len();
+    panes.extend(
+        list_native_panes(&pt)
+            .into_iter()
+            .enumerate()
+            .map(|(order, pane)| Pane {
+                order: offset + order,
+                path: mounts::posix_path(&pane.path),
+                ..pane
+            }),
+    );
+    Ok(panes)
+}
+
+fn fetch_tmux_panes(host: Option<&str>, pt: &ProcessTable) -> Result<Vec<Pane>> {
+    let tmux_out = list_tmux_panes(host)?;
     let raw = {
         let _g = smelt_perf::perf::begin("provider.resolve_panes");
-        resolve_agent_panes(parse_tmux_panes(&tmux_out), &pt)
+        resolve_agent_panes(parse_tmux_panes(&tmux_out), pt)
     };
     smelt_perf::perf::record_value("tmux.agent_panes", raw.len() as u64);
     Ok(raw
@@ -70,11 +122,14 @@ fn fetch_panes() -> Result<Vec<Pane>> {
             session: r.session,
             window: r.window,
             window_name: r.window_name,
+            window_named: r.window_named,
             pane: r.pane,
             path: r.path,
             pid: r.pid,
             window_active: r.window_focused,
+            window_activity: r.window_activity,
             order,
+            command: pt.args.get(&r.provider_pid).cloned().unwrap_or_default(),
             provider: r.cmd,
             provider_pid: r.provider_pid,
             ..Pane::default()
@@ -82,21 +137,158 @@ fn fetch_panes() -> Result<Vec<Pane>> {
         .collect())
 }
 
-fn list_tmux_panes() -> Result<String> {
+fn command_timeout(host: Option<&str>) -> Duration {
+    if host.is_some() {
+        SSH_TIMEOUT
+    } else {
+        COMMAND_TIMEOUT
+    }
+}
+
+/// `tmux`, or `tmux -L $AGENT_MUX_TMUX_SOCKET` when that is set, so tests
+/// and demos can run against a private server.
+pub fn tmux() -> Command {
+    let mut cmd = Command::new("tmux");
+    if let Some(socket) = std::env::var_os("AGENT_MUX_TMUX_SOCKET") {
+        cmd.arg("-L").arg(socket);
+    }
+    cmd
+}
+
+/// What agent-mux uses that older tmux servers lack.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Feature {
+    /// `#{?…}` conditionals and `#{pane_current_path}` in the pane list.
+    Formats,
+    /// Per-pane `@` options, which mark output logs and recordings.
+    PaneOptions,
+    /// `display-popup`, for a sidebar in a popup.
+    Popup,
+}
+
+impl Feature {
+    const ALL: [Feature; 3] = [Feature::Formats, Feature::PaneOptions, Feature::Popup];
+
+    fn since(self) -> (u32, u32) {
+        match self {
+            Feature::Formats => (1, 8),
+            Feature::PaneOptions => (3, 0),
+            Feature::Popup => (3, 2),
+        }
+    }
+
+    fn describe(self) -> &'static str {
+        match self {
+            Feature::Formats => "listing panes",
+            Feature::PaneOptions => "output logs and recordings",
+            Feature::Popup => "the sidebar in a popup",
+        }
+    }
+}
+
+/// The local tmux's `(major, minor)` version, asked once. `None` when it
+/// can't be told, as for development builds, which are assumed current.
+pub fn version() -> Option<(u32, u32)> {
+    static VERSION: OnceLock<Option<(u32, u32)>> = OnceLock::new();
+    *VERSION.get_or_init(|| {
+        let out = tmux().arg("-V").output_within(COMMAND_TIMEOUT).ok()?;
+        parse_version(&String::from_utf8_lossy(&out.stdout))
+    })
+}
+
+/// `tmux 3.3a`, `tmux next-3.4` or `tmux 3.2-rc2`.
+fn parse_version(out: &str) -> Option<(u32, u32)> {
+    let version = out.trim().strip_prefix("tmux ")?;
+    let version = version.strip_prefix("next-").unwrap_or(version);
+    let (major, minor) = version.split_once('.')?;
+    let digits = minor
+        .find(|c: char| !c.is_ascii_digit())
+        .unwrap_or(minor.len());
+    Some((major.parse().ok()?, minor[..digits].parse().ok()?))
+}
+
+pub fn supports(feature: Feature) -> bool {
+    version().is_none_or(|version| version >= feature.since())
+}
+
+fn require(feature: Feature) -> Result<()> {
+    match version() {
+        Some((major, minor)) if !supports(feature) => {
+            let (need_major, need_minor) = feature.since();
+            Err(anyhow!(
+                "{} needs tmux {need_major}.{need_minor} or newer; this is tmux {major}.{minor}",
+                feature.describe()
+            ))
+        }
+        _ => Ok(()),
+    }
+}
+
+/// What the local tmux is too old for, to warn about once at startup
+/// rather than misread its output later.
+pub fn compatibility_warning() -> Option<String> {
+    let (major, minor) = version()?;
+    let missing: Vec<String> = Feature::ALL
+        .into_iter()
+        .filter(|feature| !supports(*feature))
+        .map(|feature| {
+            let (need_major, need_minor) = feature.since();
+            format!("{} needs {need_major}.{need_minor}", feature.describe())
+        })
+        .collect();
+    (!missing.is_empty()).then(|| format!("tmux {major}.{minor} is old: {}", missing.join(", ")))
+}
+
+fn tmux_command(host: Option<&str>, args: &[&str]) -> Command {
+    match host {
+        Some(host) => {
+            let mut remote_args = vec!["tmux"];
+            remote_args.extend_from_slice(args);
+            ssh_command(host, &remote_args)
+        }
+        None => {
+            let mut cmd = tmux();
+            cmd.args(args);
+            cmd
+        }
+    }
+}
+
+fn list_tmux_panes(host: Option<&str>) -> Result<String> {
     let _g = smelt_perf::perf::begin("tmux.list_panes");
-    let out = Command::new("tmux")
-        .arg("list-panes")
-        .arg("-a")
-        .arg("-F")
-        .arg("#{session_name}:#{window_index}.#{pane_index}\t#{pane_current_command}\t#{pane_current_path}\t#{pane_pid}\t#{window_name}\t#{window_active}#{?session_attached,1,0}#{pane_active}\t#{pane_id}")
-        .output()
-        .context("tmux list-panes")?;
+    if host.is_none() {
+        require(Feature::Formats)?;
+    }
+    let out = tmux_command(
+        host,
+        &[
+            "list-panes",
+            "-a",
+            "-F",
+            "#{session_name}:#{window_index}.#{pane_index}\t#{pane_current_command}\t#{pane_current_path}\t#{pane_pid}\t#{window_name}\t#{window_active}#{?session_attached,1,0}#{pane_active}\t#{pane_id}\t#{automatic-rename}\t#{window_activity}",
+        ],
+    )
+    .output_within(command_timeout(host))
+    .context("tmux list-panes")?;
     if !out.status.success() {
         return Err(anyhow!("tmux list-panes exited with {}", out.status));
     }
     Ok(String::from_utf8_lossy(&out.stdout).into_owned())
 }
 
+pub fn live_tmux_pane_ids() -> Result<HashSet<String>> {
+    let out = tmux_command(None, &["list-panes", "-a", "-F", "#{pane_id}"])
+        .output_within(COMMAND_TIMEOUT)
+        .context("tmux list-panes")?;
+    if !out.status.success() {
+        return Err(anyhow!("tmux list-panes exited with {}", out.status));
+    }
+    Ok(String::from_utf8_lossy(&out.stdout)
+        .lines()
+        .map(str::to_string)
+        .collect())
+}
+
 fn parse_tmux_panes(out: &str) -> Vec<RawPane> {
     let panes: Vec<RawPane> = out
         .trim()
@@ -105,7 +297,7 @@ fn parse_tmux_panes(out: &str) -> Vec<RawPane> {
             if line.is_empty() {
                 return None;
             }
-            let fields: Vec<&str> = line.splitn(7, '\t').collect();
+            let fields: Vec<&str> = line.splitn(9, '\t').collect();
             if fields.len() < 7 {
                 return None;
             }
@@ -117,7 +309,9 @@ fn parse_tmux_panes(out: &str) -> Vec<RawPane> {
                 pid: fields[3].parse().unwrap_or(0),
                 provider_pid: 0,
                 window_name: fields[4].to_string(),
+                window_named: fields.get(7) == Some(&"off"),
                 window_focused: fields[5] == "111",
+                window_activity: fields.get(8).and_then(|f| f.parse().ok()).unwrap_or(0),
                 pane_id: fields[6].to_string(),
                 session,
                 window,
@@ -140,11 +334,19 @@ fn resolve_agent_panes(raw: Vec<RawPane>, pt: &ProcessTable) -> Vec<RawPane> {
 }
 
 fn load_process_table() -> ProcessTable {
-    static CACHE: OnceLock<Mutex<Option<ProcessTableCache>>> = OnceLock::new();
-    let cache = CACHE.get_or_init(|| Mutex::new(None));
+    cached_process_table("", ps::local_process_table)
+}
+
+fn load_remote_process_table(host: &str) -> ProcessTable {
+    cached_process_table(host, || ps::remote_process_table(host))
+}
+
+fn cached_process_table(key: &str, load: impl FnOnce() -> ProcessTable) -> ProcessTable {
+    static CACHE: OnceLock<Mutex<HashMap<String, ProcessTableCache>>> = OnceLock::new();
+    let cache = CACHE.get_or_init(|| Mutex::new(HashMap::new()));
 
     if let Ok(cache) = cache.lock()
-        && let Some(entry) = cache.as_ref()
+        && let Some(entry) = cache.get(key)
         && entry.loaded_at.elapsed() < PROCESS_TABLE_TTL
     {
         smelt_perf::perf::record_value("process.ps_cache_hit", 1);
@@ -152,18 +354,19 @@ fn load_process_table() -> ProcessTable {
     }
 
     let _g = smelt_perf::perf::begin("process.ps");
-    let table = Command::new("ps")
-        .arg("-eo")
-        .arg("pid=,ppid=,command=")
-        .output()
-        .map(|out| parse_process_table(&String::from_utf8_lossy(&out.stdout)))
-        .unwrap_or_default();
+    let table = load();
+    if table.is_empty() {
+        return table;
+    }
 
     if let Ok(mut cache) = cache.lock() {
-        *cache = Some(ProcessTableCache {
-            loaded_at: Instant::now(),
-            table: table.clone(),
-        });
+        cache.insert(
+            key.to_string(),
+            ProcessTableCache {
+                loaded_at: Instant::now(),
+                table: table.clone(),
+            },
+        );
     }
     table
 }
@@ -173,33 +376,72 @@ fn capture_content(panes: &mut [Pane]) {
     thread::scope(|scope| {
         for pane in panes {
             scope.spawn(move || {
-                let (hash, moving, attention) = capture_pane_content(&pane.target);
+                let (hash, moving, attention, error) = capture_pane_content(&pane.target);
                 pane.content_hash = hash;
                 pane.content_moving = moving;
-                pane.heuristic_attention = attention;
+                pane.heuristic_attention = attention.is_some();
+                pane.attention_reason = attention.unwrap_or_default();
+                pane.heuristic_error = error;
             });
         }
     });
 }
 
-fn capture_pane_content(target: &str) -> (String, bool, bool) {
+/// Returns the content hash, whether it is moving, the line matching an
+/// attention prompt, and whether the agent crashed. A visible prompt wins
+/// over an error.
+fn capture_pane_content(target: &str) -> (String, bool, Option<String>, bool) {
     let _g = smelt_perf::perf::begin("tmux.capture_pane_content");
-    let Ok(out) = Command::new("tmux")
-        .arg("capture-pane")
-        .arg("-t")
-        .arg(target)
-        .arg("-p")
-        .arg("-S")
-        .arg("-10")
-        .output()
-    else {
-        return (String::new(), false, false);
+    let captured = match backend_of(target) {
+        Backend::Wezterm(id) => wezterm::capture_pane(id, 10, false).map(String::into_bytes),
+        Backend::Kitty(id) => kitty::capture_pane(id, 10, false).map(String::into_bytes),
+        Backend::Remote { name, target } => capture_tmux_content(Some(remote_host(name)), target),
+        Backend::Tmux => capture_tmux_content(None, target),
+    };
+    let stdout = match captured {
+        Ok(stdout) => stdout,
+        Err(err) => {
+            log::warn(
+                "capture pane failed",
+                &[("target", &target), ("err", &format!("{err:#}"))],
+            );
+            return (String::new(), false, None, false);
+        }
     };
-    let content = trim_trailing_newlines(out.stdout);
+    let content = trim_trailing_newlines(stdout);
     smelt_perf::perf::record_value("tmux.capture_bytes", content.len() as u64);
     let hash = short_hash(&content);
-    let attention = attention_re().is_match(&String::from_utf8_lossy(&content));
-    (hash, false, attention)
+    let text = String::from_utf8_lossy(&content);
+    let attention = matching_line(attention_re(), &text).map(str::to_string);
+    let crashed = attention.is_none() && crashed(&text);
+    (hash, false, attention, crashed)
+}
+
+/// How many non-blank lines at the bottom of a pane a crash is looked for
+/// in. A live agent keeps its own input box there, so output it merely
+/// shows, such as failing tests, stays above them.
+const CRASH_TAIL_LINES: usize = 3;
+
+/// Whether the agent's own error banner is on screen, or its process died
+/// with a crash as its last output.
+fn crashed(text: &str) -> bool {
+    if agent_error_re().is_match(text) {
+        return true;
+    }
+    let tail: Vec<&str> = text
+        .lines()
+        .rev()
+        .filter(|line| !line.trim().is_empty())
+        .take(CRASH_TAIL_LINES)
+        .collect();
+    tail.iter().any(|line| crash_re().is_match(line))
+}
+
+fn capture_tmux_content(host: Option<&str>, target: &str) -> Result<Vec<u8>> {
+    let out = tmux_command(host, &["capture-pane", "-t", target, "-p", "-S", "-10"])
+        .output_within(command_timeout(host))
+        .with_context(|| format!("capture-pane {target}"))?;
+    Ok(out.stdout)
 }
 
 fn trim_trailing_newlines(mut data: Vec<u8>) -> Vec<u8> {
@@ -209,28 +451,59 @@ fn trim_trailing_newlines(mut data: Vec<u8>) -> Vec<u8> {
     data
 }
 
-fn short_hash(data: &[u8]) -> String {
+pub fn short_hash(data: &[u8]) -> String {
     let digest = Sha256::digest(data);
     digest[..8].iter().map(|b| format!("{b:02x}")).collect()
 }
 
+/// The whole line around the first match of `re`, trimmed.
+pub fn matching_line<'a>(re: &Regex, text: &'a str) -> Option<&'a str> {
+    let found = re.find(text)?;
+    let start = text[..found.start()].rfind('\n').map_or(0, |i| i + 1);
+    let end = text[found.end()..]
+        .find('\n')
+        .map_or(text.len(), |i| found.end() + i);
+    Some(text[start..end].trim())
+}
+
 fn attention_re() -> &'static Regex {
     static RE: OnceLock<Regex> = OnceLock::new();
     RE.get_or_init(|| Regex::new(r"Do you want to proceed\?|Do you want to allow|Allow once|press Enter to approve|Enter to select|Type something|Esc to cancel|I'll wait for your|waiting for your response|Let me know when|Please let me know|What would you like|How would you like|Should I proceed|Would you like me to|please provide|please specify|I need more information|Could you clarify|awaiting your|ready when you are|let me know if you'd like|Feel free to ask|Is there anything else|What else can I help|Want me to|Shall I|Do you want me to|Ready to proceed").expect("valid attention regex"))
 }
 
+/// Errors agents report in their own UI while they keep running.
+fn agent_error_re() -> &'static Regex {
+    static RE: OnceLock<Regex> = OnceLock::new();
+    RE.get_or_init(|| Regex::new(r"API Error: \d{3}").expect("valid agent error regex"))
+}
+
+/// The last lines a crashing process prints.
+fn crash_re() -> &'static Regex {
+    static RE: OnceLock<Regex> = OnceLock::new();
+    RE.get_or_init(|| Regex::new(r"thread '[^']*' panicked at|^\s*([\w.]+(Error|Exception)|KeyboardInterrupt)(: |$)|(?i:fatal error)|Unhandled(Promise)?Rejection").expect("valid crash regex"))
+}
+
 pub fn capture_pane(target: &str, lines: usize) -> Result<String> {
     let _g = smelt_perf::perf::begin("tmux.capture_preview");
-    let out = Command::new("tmux")
-        .arg("capture-pane")
-        .arg("-t")
-        .arg(target)
-        .arg("-e")
-        .arg("-p")
-        .arg("-S")
-        .arg(format!("-{lines}"))
-        .output()
-        .with_context(|| format!("capture-pane {target}"))?;
+    let host = match backend_of(target) {
+        Backend::Wezterm(id) => return wezterm::capture_pane(id, lines, true),
+        Backend::Kitty(id) => return kitty::capture_pane(id, lines, true),
+        Backend::Remote { name, target } => {
+            return capture_tmux_pane(Some(remote_host(name)), target, lines);
+        }
+        Backend::Tmux => None,
+    };
+    capture_tmux_pane(host, target, lines)
+}
+
+fn capture_tmux_pane(host: Option<&str>, target: &str, lines: usize) -> Result<String> {
+    let start = format!("-{lines}");
+    let out = tmux_command(
+        host,
+        &["capture-pane", "-t", target, "-e", "-p", "-S", &start],
+    )
+    .output_within(command_timeout(host))
+    .with_context(|| format!("capture-pane {target}"))?;
     if !out.status.success() {
         return Err(anyhow!("capture-pane {target} exited with {}", out.status));
     }
@@ -238,31 +511,365 @@ pub fn capture_pane(target: &str, lines: usize) -> Result<String> {
 }
 
 pub fn switch_to_pane(target: &str) -> Result<()> {
+    match backend_of(target) {
+        Backend::Wezterm(id) => return wezterm::switch_to_pane(id),
+        Backend::Kitty(id) => return kitty::switch_to_pane(id),
+        Backend::Remote { name, target } => return attach_remote_pane(name, target),
+        Backend::Tmux => {}
+    }
     let (session, window, _) = parse_target(target);
     let session_window = format!("{session}:{window}");
     run_tmux(["switch-client", "-t", &session_window])?;
     run_tmux(["select-pane", "-t", target])
 }
 
+/// Binds `key` in the root table to run the tmux `command` once: the
+/// binding removes itself when pressed.
+pub fn bind_once(key: &str, command: &str) -> Result<()> {
+    run_tmux([
+        "bind-key",
+        "-n",
+        key,
+        &format!("unbind-key -n {key} ; {command}"),
+    ])
+}
+
+fn attach_remote_pane(name: &str, target: &str) -> Result<()> {
+    let (session, window, _) = parse_target(target);
+    let session_window = format!("{session}:{window}");
+    let attach = shell_join(&[
+        "tmux",
+        "attach-session",
+        "-t",
+        &session,
+        ";",
+        "select-window",
+        "-t",
+        &session_window,
+        ";",
+        "select-pane",
+        "-t",
+        target,
+    ]);
+    let mut command = vec!["ssh".to_string(), "-t".to_string()];
+    command.extend(ssh_options());
+    command.extend([remote_host(name).to_string(), "--".to_string(), attach]);
+    let command: Vec<&str> = command.iter().map(String::as_str).collect();
+    let window_name = format!("{name}:{session_window}");
+    run_tmux(["new-window", "-n", &window_name, &shell_join(&command)])
+}
+
+pub fn respawn_agent(pane: &Pane) -> Result<()> {
+    if !pane.terminated || backend_of(&pane.target) != Backend::Tmux {
+        return Err(anyhow!("{} is not a terminated tmux pane", pane.target));
+    }
+    let command = if pane.command.is_empty() {
+        &pane.provider
+    } else {
+        &pane.command
+    };
+    send_text(&pane.pane_id, command)
+}
+
+/// Types `text` into a local tmux pane and presses Enter.
+pub fn send_text(target: &str, text: &str) -> Result<()> {
+    run_tmux(["send-keys", "-t", target, "-l", text])?;
+    run_tmux(["send-keys", "-t", target, "Enter"])
+}
+
 pub fn kill_pane(target: &str) -> Result<()> {
+    let (host, target) = match backend_of(target) {
+        Backend::Wezterm(id) => return wezterm::kill_pane(id),
+        Backend::Kitty(id) => return kitty::kill_pane(id),
+        Backend::Remote { name, target } => (Some(remote_host(name)), target),
+        Backend::Tmux => (None, target),
+    };
+    if config().archive.enabled
+        && let Err(err) = archive_pane(host, target)
+    {
+        log::warn(
+            "archive pane failed",
+            &[("target", &target), ("err", &format!("{err:#}"))],
+        );
+    }
     let (session, window, _) = parse_target(target);
     let session_window = format!("{session}:{window}");
-    let out = Command::new("tmux")
-        .arg("list-panes")
-        .arg("-t")
-        .arg(&session_window)
-        .output()
+    let out = tmux_command(host, &["list-panes", "-t", &session_window])
+        .output_within(command_timeout(host))
         .context("list-panes")?;
     let pane_count = String::from_utf8_lossy(&out.stdout).trim().lines().count();
-    if pane_count <= 1 {
-        run_tmux(["kill-window", "-t", &session_window])
+    let args = if pane_count <= 1 {
+        ["kill-window", "-t", &session_window]
+    } else {
+        ["kill-pane", "-t", target]
+    };
+    let status = tmux_command(host, &args)
+        .status_within(command_timeout(host))
+        .context("tmux")?;
+    if status.success() {
+        Ok(())
+    } else {
+        Err(anyhow!("tmux exited with {status}"))
+    }
+}
+
+/// Saves a pane's whole output to the archive before it is killed: its
+/// output log when one is being written, else its scrollback.
+fn archive_pane(host: Option<&str>, target: &str) -> Result<()> {
+    let info = tmux_command(
+        host,
+        &[
+            "display-message",
+            "-p",
+            "-t",
+            target,
+            "#{pane_current_path}\t#{@agent-mux-log}",
+        ],
+    )
+    .output_within(command_timeout(host))
+    .map(|out| String::from_utf8_lossy(&out.stdout).trim_end().to_string())
+    .unwrap_or_default();
+    let (path, log_file) = info.split_once('\t').unwrap_or((&info, ""));
+    let logged = match (host, log_file) {
+        (None, file) if !file.is_empty() => output::read(Path::new(file)),
+        _ => String::new(),
+    };
+    let content = if logged.trim().is_empty() {
+        let out = tmux_command(host, &["capture-pane", "-p", "-J", "-S", "-", "-t", target])
+            .output_within(command_timeout(host))
+            .context("capture-pane")?;
+        if !out.status.success() {
+            return Err(anyhow!("capture-pane {target} exited with {}", out.status));
+        }
+        String::from_utf8_lossy(&out.stdout).into_owned()
+    } else {
+        logged
+    };
+    archive::store(target, path, content.trim_end(), chrono::Utc::now())?;
+    Ok(())
+}
+
+/// Returns the last `lines` lines of a local tmux pane as plain text.
+pub fn capture_text(target: &str, lines: usize) -> Result<String> {
+    let start = format!("-{lines}");
+    let out = tmux()
+        .args(["capture-pane", "-t", target, "-p", "-J", "-S", &start])
+        .output_within(COMMAND_TIMEOUT)
+        .with_context(|| format!("capture-pane {target}"))?;
+    if !out.status.success() {
+        return Err(anyhow!("capture-pane {target} exited with {}", out.status));
+    }
+    Ok(String::from_utf8_lossy(&out.stdout).into_owned())
+}
+
+pub fn send_keys(target: &str, keys: &[String]) -> Result<()> {
+    let status = tmux()
+        .args(["send-keys", "-t", target])
+        .args(keys)
+        .status_within(COMMAND_TIMEOUT)
+        .context("tmux send-keys")?;
+    if status.success() {
+        Ok(())
+    } else {
+        Err(anyhow!("tmux exited with {status}"))
+    }
+}
+
+/// Loads a file into the tmux paste buffer and, where tmux supports it
+/// (3.2+), the system clipboard.
+pub fn load_buffer(file: &Path) -> Result<()> {
+    let file = file.to_string_lossy();
+    run_tmux(["load-buffer", "-w", &file]).or_else(|_| run_tmux(["load-buffer", &file]))
+}
+
+/// Puts `text` in the tmux paste buffer and, where tmux supports it, the
+/// system clipboard.
+pub fn copy_text(text: &str) -> Result<()> {
+    run_tmux(["set-buffer", "-w", "--", text]).or_else(|_| run_tmux(["set-buffer", "--", text]))
+}
+
+/// Pipes a local pane's output into `agent-mux pipe-log <file>` and records
+/// the file in the pane's `@agent-mux-log` option. Panes that are already
+/// piped somewhere are left alone.
+pub fn pipe_pane(pane_id: &str, file: &Path) -> Result<()> {
+    require(Feature::PaneOptions)?;
+    if pane_format(pane_id, "#{pane_pipe}")? == "1" {
+        return Ok(());
+    }
+    let command = sink_command("pipe-log", file)?;
+    run_tmux(["pipe-pane", "-o", "-t", pane_id, &command])?;
+    let file = file.to_string_lossy();
+    run_tmux(["set-option", "-p", "-t", pane_id, "@agent-mux-log", &file])
+}
+
+/// Pipes a local pane's output into `agent-mux pipe-cast <file>`, taking
+/// over from its output log until `stop_recording`. tmux allows one pipe
+/// per pane.
+pub fn record_pane(pane_id: &str, file: &Path) -> Result<()> {
+    require(Feature::PaneOptions)?;
+    let command = sink_command("pipe-cast", file)?;
+    run_tmux(["pipe-pane", "-t", pane_id, &command])?;
+    let file = file.to_string_lossy();
+    run_tmux(["set-option", "-p", "-t", pane_id, "@agent-mux-cast", &file])
+}
+
+/// Ends a recording and hands the pane back to its output log, if it had
+/// one. Returns the recording's file.
+pub fn stop_recording(pane_id: &str) -> Result<Option<PathBuf>> {
+    let file = pane_format(pane_id, "#{@agent-mux-cast}")?;
+    if file.is_empty() {
+        return Ok(None);
+    }
+    run_tmux(["pipe-pane", "-t", pane_id])?;
+    run_tmux(["set-option", "-p", "-u", "-t", pane_id, "@agent-mux-cast"])?;
+    let log_file = pane_format(pane_id, "#{@agent-mux-log}")?;
+    if !log_file.is_empty() {
+        let command = sink_command("pipe-log", Path::new(&log_file))?;
+        run_tmux(["pipe-pane", "-o", "-t", pane_id, &command])?;
+    }
+    Ok(Some(PathBuf::from(file)))
+}
+
+/// The file a local pane is being recorded to, if any.
+pub fn recording_file(pane_id: &str) -> Option<PathBuf> {
+    let file = pane_format(pane_id, "#{@agent-mux-cast}").ok()?;
+    (!file.is_empty()).then(|| PathBuf::from(file))
+}
+
+/// A local pane's width, height, and visible screen with its colors.
+pub fn pane_screen(pane_id: &str) -> Result<(usize, usize, String)> {
+    let size = pane_format(pane_id, "#{pane_width}x#{pane_height}")?;
+    let (width, height) = size
+        .split_once('x')
+        .and_then(|(w, h)| Some((w.parse().ok()?, h.parse().ok()?)))
+        .ok_or_else(|| anyhow!("no size for pane {pane_id}"))?;
+    let out = tmux()
+        .args(["capture-pane", "-e", "-p", "-t", pane_id])
+        .output_within(COMMAND_TIMEOUT)
+        .context("capture-pane")?;
+    Ok((
+        width,
+        height,
+        String::from_utf8_lossy(&out.stdout).into_owned(),
+    ))
+}
+
+fn pane_format(pane_id: &str, format: &str) -> Result<String> {
+    let out = tmux()
+        .args(["display-message", "-p", "-t", pane_id, format])
+        .output_within(COMMAND_TIMEOUT)
+        .context("display-message")?;
+    if !out.status.success() {
+        return Err(anyhow!("no tmux pane {pane_id}"));
+    }
+    Ok(String::from_utf8_lossy(&out.stdout).trim_end().to_string())
+}
+
+/// The shell command tmux runs to feed a pane's output to one of our sinks.
+fn sink_command(subcommand: &str, file: &Path) -> Result<String> {
+    let exe = std::env::current_exe().context("current executable")?;
+    Ok(shell_join(&[
+        &exe.to_string_lossy(),
+        subcommand,
+        &file.to_string_lossy(),
+    ]))
+}
+
+/// Flashes `message` in the status line of every attached tmux client.
+pub fn display_message(message: &str) -> Result<()> {
+    let out = tmux()
+        .args(["list-clients", "-F", "#{client_name}"])
+        .output_within(COMMAND_TIMEOUT)
+        .context("list-clients")?;
+    let message = message.replace('#', "##");
+    for client in String::from_utf8_lossy(&out.stdout).lines() {
+        run_tmux(["display-message", "-c", client, &message])?;
+    }
+    Ok(())
+}
+
+/// The pane the client was on before agent-mux opened: the previously active
+/// pane of this window, else the active pane of the session's last window.
+/// `None` outside a tmux pane, e.g. in a popup, where quitting already
+/// returns there.
+pub fn origin_pane() -> Option<String> {
+    std::env::var_os("TMUX_PANE")?;
+    ["{last}", ":!"].into_iter().find_map(|target| {
+        let out = tmux()
+            .args([
+                "display-message",
+                "-p",
+                "-t",
+                target,
+                "#{session_name}:#{window_index}.#{pane_index}",
+            ])
+            .output_within(COMMAND_TIMEOUT)
+            .ok()?;
+        let target = String::from_utf8_lossy(&out.stdout).trim().to_string();
+        (out.status.success() && !target.is_empty()).then_some(target)
+    })
+}
+
+/// Which sidebar this is, for keeping its cursor and width apart from
+/// other open ones: `pane:<session>:<window>` for a sidebar pane and
+/// `popup:<session>` for a popup, which has no `$TMUX_PANE`. Falls back to
+/// `pane` or `popup` when tmux can't tell.
+pub fn view_key() -> String {
+    let pane = std::env::var("TMUX_PANE").ok();
+    let (kind, format) = match pane {
+        Some(_) => ("pane", "#{session_name}:#{window_index}"),
+        None => ("popup", "#{session_name}"),
+    };
+    let mut cmd = tmux();
+    cmd.args(["display-message", "-p"]);
+    if let Some(pane) = &pane {
+        cmd.args(["-t", pane]);
+    }
+    let id = cmd
+        .arg(format)
+        .output_within(COMMAND_TIMEOUT)
+        .ok()
+        .filter(|out| out.status.success())
+        .map(|out| String::from_utf8_lossy(&out.stdout).trim().to_string())
+        .unwrap_or_default();
+    if id.is_empty() {
+        kind.to_string()
     } else {
-        run_tmux(["kill-pane", "-t", target])
+        format!("{kind}:{id}")
+    }
+}
+
+/// The `view_key` of every tmux window and session that still exists.
+pub fn live_view_keys() -> Result<HashSet<String>> {
+    let out = tmux_command(
+        None,
+        &[
+            "list-windows",
+            "-a",
+            "-F",
+            "#{session_name}:#{window_index}",
+        ],
+    )
+    .output_within(COMMAND_TIMEOUT)
+    .context("tmux list-windows")?;
+    if !out.status.success() {
+        return Err(anyhow!("tmux list-windows exited with {}", out.status));
     }
+    let mut keys = HashSet::new();
+    for window in String::from_utf8_lossy(&out.stdout).lines() {
+        if let Some((session, _)) = window.rsplit_once(':') {
+            keys.insert(format!("popup:{session}"));
+        }
+        keys.insert(format!("pane:{window}"));
+    }
+    Ok(keys)
 }
 
 fn run_tmux<const N: usize>(args: [&str; N]) -> Result<()> {
-    let status = Command::new("tmux").args(args).status().context("tmux")?;
+    let status = tmux()
+        .args(args)
+        .status_within(COMMAND_TIMEOUT)
+        .context("tmux")?;
     if status.success() {
         Ok(())
     } else {
@@ -273,29 +880,33 @@ fn run_tmux<const N: usize>(args: [&str; N]) -> Result<()> {
 pub fn start_watch() -> Result<()> {
     if crate::agent::watch::is_running() {
         for _ in 0..5 {
-            if crate::agent::ipc::get_state().is_ok_and(|(snapshot, _)| snapshot.is_some()) {
+            if crate::agent::ipc::get_state().is_ok_and(|(snapshot, _)| snapshot.is_some())
+                || heartbeat_is_fresh()
+            {
                 return Ok(());
             }
             thread::sleep(Duration::from_millis(50));
         }
+        log::warn("restarting unresponsive watcher", &[]);
         stop_watch_process();
         thread::sleep(Duration::from_millis(200));
     }
 
     std::fs::create_dir_all(crate::agent::persist::state_dir()).context("create state dir")?;
-    let log = OpenOptions::new()
+    let log_file = OpenOptions::new()
         .create(true)
         .append(true)
-        .open(crate::agent::watch::log_path())
+        .open(log::log_path())
         .context("open watch log")?;
-    let stderr = log.try_clone().context("clone watch log")?;
+    let stderr = log_file.try_clone().context("clone watch log")?;
 
     let exe = std::env::current_exe().context("current executable")?;
     Command::new(exe)
         .arg("watch")
+        .args(["--log-level", log::level().as_str()])
         .process_group(0)
         .stdin(Stdio::null())
-        .stdout(Stdio::from(log))
+        .stdout(Stdio::from(log_file))
         .stderr(Stdio::from(stderr))
         .spawn()
         .context("start watch")?;
@@ -310,13 +921,21 @@ pub fn start_watch() -> Result<()> {
     Ok(())
 }
 
+// A watcher still working through a slow first refresh (e.g. unreachable
+// remotes) keeps its heartbeat fresh and should not be restarted.
+fn heartbeat_is_fresh() -> bool {
+    crate::agent::persist::load_heartbeat()
+        .and_then(|heartbeat| heartbeat.updated_at)
+        .is_some_and(|at| chrono::Utc::now() - at < chrono::Duration::seconds(5))
+}
+
 pub fn restart_watch() -> Result<()> {
     stop_watch_process();
     thread::sleep(Duration::from_millis(200));
     start_watch()
 }
 
-fn stop_watch_process() {
+pub fn stop_watch_process() {
     if let Ok(data) = std::fs::read_to_string(crate::agent::watch::lock_path())
         && let Ok(pid) = data.trim().parse::<i32>()
         && pid > 0
@@ -324,7 +943,7 @@ fn stop_watch_process() {
         let _ = Command::new("kill")
             .arg("-TERM")
             .arg(pid.to_string())
-            .status();
+            .status_within(COMMAND_TIMEOUT);
     }
 }
 
@@ -343,3 +962,42 @@ pub fn parse_target(s: &str) -> (String, String, String) {
         rest[dot_idx + 1..].to_string(),
     )
 }
+
+#[cfg(test)]
+mod tests {
+    use super::{crashed, parse_tmux_panes, parse_version};
+
+    #[test]
+    fn parses_versions() {
+        assert_eq!(parse_version("tmux 3.3a\n"), Some((3, 3)));
+        assert_eq!(parse_version("tmux next-3.4"), Some((3, 4)));
+        assert_eq!(parse_version("tmux 3.2-rc2"), Some((3, 2)));
+        assert_eq!(parse_version("tmux 2.9"), Some((2, 9)));
+        assert_eq!(parse_version("tmux master"), None);
+        assert_eq!(parse_version("tmux openbsd-7.4"), None);
+    }
+
+    #[test]
+    fn only_crashes_at_the_bottom_count_as_errors() {
+        let tests = "Traceback (most recent call last):\n  File \"t.py\"\nValueError: bad\n\
+                     FAILED tests/test_auth.py\n\n╭──\n│ >\n╰──\n  ? for shortcuts";
+        let died = "  File \"aider/main.py\", line 9\nValueError: bad\n$ ";
+
+        assert!(!crashed(tests));
+        assert!(crashed(died));
+        assert!(crashed("⎿  API Error: 529 Overloaded\n╭──\n│ >\n╰──"));
+    }
+
+    #[test]
+    fn parses_window_activity() {
+        let panes = parse_tmux_panes(
+            "s:1.1\tclaude\t/src/api\t42\tapi\t111\t%1\ton\t1760601600\n\
+             s:2.1\tcodex\t/src/web\t43\tweb\t011\t%2\n",
+        );
+
+        assert_eq!(panes[0].window_activity, 1760601600);
+        assert!(panes[0].window_focused);
+        assert_eq!(panes[1].window_activity, 0);
+        assert_eq!(panes[1].pane_id, "%2");
+    }
+}
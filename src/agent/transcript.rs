@@ -0,0 +1,1025 @@
+use std::collections::HashMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::sync::{Mutex, OnceLock};
+use std::time::SystemTime;
+
+use anyhow::{Context, Result, bail};
+use chrono::{DateTime, Local, NaiveDateTime, Utc};
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use sha2::{Digest, Sha256};
+
+use crate::agent::git::{Commit, commits_since};
+use crate::agent::persist::state_dir;
+
+/// A past agent session, read from its transcript on disk.
+#[derive(Debug, Clone, Default, PartialEq, Serialize)]
+#[serde(rename_all = "camelCase")]
+pub struct Session {
+    pub id: String,
+    pub provider: String,
+    pub path: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub started_at: Option<DateTime<Utc>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub updated_at: Option<DateTime<Utc>>,
+    #[serde(skip_serializing_if = "String::is_empty")]
+    pub title: String,
+    pub first_prompt: String,
+    pub messages: usize,
+    /// Commits made in the workspace while the session ran; filled in by
+    /// `attach_commits`.
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub commits: Vec<Commit>,
+    #[serde(skip)]
+    pub file: PathBuf,
+}
+
+/// A session whose prompts or replies contain a search query.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+#[serde(rename_all = "camelCase")]
+pub struct SearchHit {
+    #[serde(flatten)]
+    pub session: Session,
+    pub snippet: String,
+    pub matches: usize,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Role {
+    User,
+    Assistant,
+    /// A tool call, summarised as its name and main argument.
+    Tool,
+}
+
+/// One prompt, reply, or tool call.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Turn {
+    pub role: Role,
+    pub text: String,
+}
+
+#[derive(Debug, Default)]
+struct Transcript {
+    id: String,
+    file: PathBuf,
+    path: String,
+    started_at: Option<DateTime<Utc>>,
+    updated_at: Option<DateTime<Utc>>,
+    title: String,
+    turns: Vec<Turn>,
+}
+
+impl Transcript {
+    fn seen(&mut self, at: Option<DateTime<Utc>>) {
+        if let Some(at) = at {
+            self.started_at.get_or_insert(at);
+            self.updated_at = Some(at);
+        }
+    }
+
+    /// Sessions without a single prompt or reply (e.g. ones that were opened
+    /// and closed right away) yield `None`.
+    fn into_session(self, provider: &str) -> Option<Session> {
+        let first_prompt = self.turns.iter().find(|turn| turn.role == Role::User)?;
+        let first_prompt = one_line(&first_prompt.text);
+        let messages = self.messages().count();
+        Some(Session {
+            first_prompt,
+            id: self.id,
+            provider: provider.to_string(),
+            path: self.path,
+            started_at: self.started_at,
+            updated_at: self.updated_at,
+            title: self.title,
+            messages,
+            commits: Vec::new(),
+            file: self.file,
+        })
+    }
+
+    /// Prompts and replies, without tool calls.
+    fn messages(&self) -> impl Iterator<Item = &Turn> {
+        self.turns.iter().filter(|turn| turn.role != Role::Tool)
+    }
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct ClaudeEntry {
+    #[serde(rename = "type", default)]
+    kind: String,
+    #[serde(default)]
+    cwd: String,
+    timestamp: Option<DateTime<Utc>>,
+    #[serde(default)]
+    is_meta: bool,
+    #[serde(default)]
+    is_sidechain: bool,
+    #[serde(default)]
+    summary: String,
+    message: Option<ClaudeMessage>,
+}
+
+#[derive(Debug, Deserialize)]
+struct ClaudeMessage {
+    #[serde(default)]
+    content: Value,
+}
+
+#[derive(Debug, Deserialize)]
+struct CodexEntry {
+    #[serde(rename = "type", default)]
+    kind: String,
+    timestamp: Option<DateTime<Utc>>,
+    #[serde(default)]
+    payload: Value,
+}
+
+#[derive(Debug, Default, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct GeminiChat {
+    #[serde(default)]
+    session_id: String,
+    start_time: Option<DateTime<Utc>>,
+    last_updated: Option<DateTime<Utc>>,
+    #[serde(default)]
+    messages: Vec<GeminiMessage>,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct GeminiMessage {
+    #[serde(rename = "type", default)]
+    kind: String,
+    #[serde(default)]
+    content: Value,
+    #[serde(default)]
+    tool_calls: Vec<GeminiToolCall>,
+}
+
+#[derive(Debug, Deserialize)]
+struct GeminiToolCall {
+    #[serde(default)]
+    name: String,
+    #[serde(default)]
+    args: Value,
+}
+
+/// Where one agent keeps its transcripts and how to read them.
+struct Reader {
+    provider: &'static str,
+    /// Transcript files, narrowed to a workspace where the agent's layout
+    /// allows it.
+    files: fn(Option<&str>) -> Vec<PathBuf>,
+    parse: fn(&Path, &str) -> Vec<Transcript>,
+}
+
+const READERS: &[Reader] = &[
+    Reader {
+        provider: "claude",
+        files: claude_files,
+        parse: |file, data| vec![parse_claude(&file_id(file), data)],
+    },
+    Reader {
+        provider: "codex",
+        files: |_| codex_files(),
+        parse: |file, data| vec![parse_codex(&file_id(file), data)],
+    },
+    Reader {
+        provider: "gemini",
+        files: gemini_files,
+        parse: |_, data| parse_gemini(data).into_iter().collect(),
+    },
+    Reader {
+        provider: "aider",
+        files: aider_files,
+        parse: parse_aider,
+    },
+];
+
+impl Reader {
+    fn sessions(&self, workspace: Option<&str>) -> impl Iterator<Item = Session> {
+        self.transcripts(workspace)
+            .into_iter()
+            .filter_map(|transcript| transcript.into_session(self.provider))
+    }
+
+    fn transcripts(&self, workspace: Option<&str>) -> Vec<Transcript> {
+        let workspace = workspace.map(|dir| dir.trim_end_matches('/'));
+        (self.files)(workspace)
+            .iter()
+            .flat_map(|file| self.load(file))
+            .filter_map(|mut transcript| {
+                match workspace {
+                    // Gemini files are keyed by a hash of the workspace and
+                    // do not record it.
+                    Some(dir) if transcript.path.is_empty() => transcript.path = dir.to_string(),
+                    Some(dir) if transcript.path != dir => return None,
+                    _ => {}
+                }
+                Some(transcript)
+            })
+            .collect()
+    }
+
+    fn load(&self, file: &Path) -> Vec<Transcript> {
+        let Ok(data) = fs::read_to_string(file) else {
+            return Vec::new();
+        };
+        let mut transcripts = (self.parse)(file, &data);
+        for transcript in &mut transcripts {
+            transcript.file = file.to_path_buf();
+        }
+        transcripts
+    }
+}
+
+fn reader(provider: &str) -> Option<&'static Reader> {
+    READERS.iter().find(|reader| reader.provider == provider)
+}
+
+fn agent_home(var: &str, dir: &str) -> PathBuf {
+    std::env::var_os(var)
+        .map(PathBuf::from)
+        .or_else(|| std::env::var_os("HOME").map(|home| PathBuf::from(home).join(dir)))
+        .unwrap_or_else(|| PathBuf::from(dir))
+}
+
+fn file_id(file: &Path) -> String {
+    file.file_stem()
+        .map(|stem| stem.to_string_lossy().into_owned())
+        .unwrap_or_default()
+}
+
+/// The directory name Claude stores a workspace's transcripts under: the
+/// path with every non-alphanumeric character replaced by `-`.
+pub fn project_key(path: &str) -> String {
+    path.trim_end_matches('/')
+        .chars()
+        .map(|ch| if ch.is_ascii_alphanumeric() { ch } else { '-' })
+        .collect()
+}
+
+/// Past sessions of every agent, newest first. With a workspace only its
+/// sessions are listed, whether or not a pane is still running them.
+pub fn sessions(workspace: Option<&str>) -> Vec<Session> {
+    let mut sessions: Vec<Session> = READERS
+        .iter()
+        .flat_map(|reader| reader.sessions(workspace))
+        .collect();
+    sessions.sort_by(|a, b| b.updated_at.cmp(&a.updated_at));
+    sessions
+}
+
+/// The session with this id, in whichever workspace it ran.
+pub fn find(id: &str) -> Option<Session> {
+    READERS
+        .iter()
+        .find_map(|reader| reader.sessions(None).find(|session| session.id == id))
+}
+
+/// The newest session of `provider` that ran in `path`; the one a pane
+/// there is most likely showing.
+pub fn latest(provider: &str, path: &str) -> Option<Session> {
+    reader(provider)?
+        .sessions(Some(path))
+        .max_by_key(|session| session.updated_at)
+}
+
+/// Agents often commit just after their last reply is written.
+const COMMIT_GRACE_MINS: i64 = 2;
+
+/// Looks up the commits made in each session's workspace while it ran, with
+/// one `git log` per workspace.
+pub fn attach_commits(sessions: &mut [Session]) {
+    let mut since: HashMap<String, DateTime<Utc>> = HashMap::new();
+    for session in sessions.iter() {
+        if let Some(start) = session.started_at {
+            since
+                .entry(session.path.clone())
+                .and_modify(|at| *at = (*at).min(start))
+                .or_insert(start);
+        }
+    }
+    let commits: HashMap<String, Vec<Commit>> = since
+        .into_iter()
+        .map(|(path, start)| {
+            let commits = commits_since(&path, start);
+            (path, commits)
+        })
+        .collect();
+    for session in sessions {
+        if let Some(commits) = commits.get(&session.path) {
+            session.commits = commits_during(session, commits);
+        }
+    }
+}
+
+fn commits_during(session: &Session, commits: &[Commit]) -> Vec<Commit> {
+    let (Some(start), Some(end)) = (session.started_at, session.updated_at) else {
+        return Vec::new();
+    };
+    let end = end + chrono::Duration::minutes(COMMIT_GRACE_MINS);
+    commits
+        .iter()
+        .filter(|commit| commit.at >= start && commit.at <= end)
+        .cloned()
+        .collect()
+}
+
+/// The title of the conversation a `provider` pane in `path` is most likely
+/// showing: the one in its most recently written transcript. Transcripts are
+/// only parsed again once they change, so this is cheap to poll.
+pub fn title(provider: &str, path: &str) -> Option<String> {
+    static TITLES: OnceLock<Mutex<HashMap<PathBuf, (SystemTime, String)>>> = OnceLock::new();
+
+    let reader = reader(provider)?;
+    let workspace = path.trim_end_matches('/');
+    let (modified, file) = (reader.files)(Some(workspace))
+        .into_iter()
+        .filter_map(|file| Some((fs::metadata(&file).ok()?.modified().ok()?, file)))
+        .max()?;
+    let titles = TITLES.get_or_init(Default::default);
+    let cached = titles
+        .lock()
+        .ok()
+        .and_then(|titles| titles.get(&file).cloned());
+    let title = match cached {
+        Some((at, title)) if at == modified => title,
+        _ => {
+            let title = reader
+                .load(&file)
+                .into_iter()
+                .rfind(|transcript| transcript.path.is_empty() || transcript.path == workspace)
+                .map(|transcript| transcript.title)
+                .unwrap_or_default();
+            if let Ok(mut titles) = titles.lock() {
+                titles.insert(file, (modified, title.clone()));
+            }
+            title
+        }
+    };
+    (!title.is_empty()).then_some(title)
+}
+
+/// Renders a session's transcript as Markdown: prompts and replies in
+/// full, tool calls as one line each.
+pub fn markdown(session: &Session) -> Result<String> {
+    let Some(transcript) = reader(&session.provider)
+        .into_iter()
+        .flat_map(|reader| reader.load(&session.file))
+        .find(|transcript| transcript.id == session.id)
+    else {
+        bail!("cannot read transcript {}", session.file.display());
+    };
+    Ok(render_markdown(session, &transcript))
+}
+
+/// Writes a session's Markdown to the state directory and returns the
+/// file, so it can be pasted from there.
+pub fn export(session: &Session) -> Result<PathBuf> {
+    let dir = state_dir().join("exports");
+    fs::create_dir_all(&dir).context("create exports dir")?;
+    let file = dir.join(format!("{}.md", session.id));
+    fs::write(&file, markdown(session)?).with_context(|| format!("write {}", file.display()))?;
+    Ok(file)
+}
+
+fn render_markdown(session: &Session, transcript: &Transcript) -> String {
+    let mut title: String = session.first_prompt.chars().take(72).collect();
+    if title.len() < session.first_prompt.len() {
+        title.push('…');
+    }
+    let mut out = format!("# {title}\n\n");
+    out.push_str(&format!("- Provider: {}\n", session.provider));
+    out.push_str(&format!("- Session: {}\n", session.id));
+    out.push_str(&format!("- Directory: {}\n", session.path));
+    if let Some(at) = session.started_at {
+        let at = at.with_timezone(&Local).format("%Y-%m-%d %H:%M");
+        out.push_str(&format!("- Started: {at}\n"));
+    }
+    let mut previous = None;
+    for turn in &transcript.turns {
+        let heading = match (turn.role, previous) {
+            (Role::User, _) => Some("Prompt"),
+            (_, None | Some(Role::User)) => Some("Response"),
+            _ => None,
+        };
+        if let Some(heading) = heading {
+            out.push_str(&format!("\n## {heading}\n"));
+        }
+        match turn.role {
+            Role::Tool if previous == Some(Role::Tool) => {
+                out.push_str(&format!("- {}\n", turn.text));
+            }
+            Role::Tool => out.push_str(&format!("\n- {}\n", turn.text)),
+            _ => out.push_str(&format!("\n{}\n", turn.text.trim())),
+        }
+        previous = Some(turn.role);
+    }
+    out
+}
+
+/// Sessions of every provider whose prompts or replies contain `query`,
+/// ignoring case, newest first.
+pub fn search(query: &str) -> Vec<SearchHit> {
+    let query = query.trim().to_lowercase();
+    if query.is_empty() {
+        return Vec::new();
+    }
+    let mut hits: Vec<SearchHit> = READERS
+        .iter()
+        .flat_map(|reader| {
+            reader
+                .transcripts(None)
+                .into_iter()
+                .filter_map(|transcript| search_transcript(reader.provider, transcript, &query))
+        })
+        .collect();
+    hits.sort_by(|a, b| b.session.updated_at.cmp(&a.session.updated_at));
+    hits
+}
+
+fn search_transcript(provider: &str, transcript: Transcript, query: &str) -> Option<SearchHit> {
+    let mut snippet = None;
+    let mut matches = 0;
+    for turn in transcript.messages() {
+        let text = one_line(&turn.text);
+        let lower = text.to_lowercase();
+        let count = lower.matches(query).count();
+        if count > 0 && snippet.is_none() {
+            snippet = Some(snippet_around(&text, &lower, query));
+        }
+        matches += count;
+    }
+    Some(SearchHit {
+        snippet: snippet?,
+        matches,
+        session: transcript.into_session(provider)?,
+    })
+}
+
+/// About 100 characters of `text` around the first match.
+fn snippet_around(text: &str, lower: &str, query: &str) -> String {
+    const BEFORE: usize = 30;
+    const LEN: usize = 100;
+    // Lowercasing can change byte lengths; fall back to the start then.
+    let at = match lower.find(query) {
+        Some(at) if lower.len() == text.len() => at,
+        _ => 0,
+    };
+    let mut start = at.saturating_sub(BEFORE);
+    while !text.is_char_boundary(start) {
+        start -= 1;
+    }
+    let mut snippet: String = text[start..].chars().take(LEN).collect();
+    if start > 0 {
+        snippet.insert(0, '…');
+    }
+    if text[start..].chars().nth(LEN).is_some() {
+        snippet.push('…');
+    }
+    snippet
+}
+
+fn claude_files(workspace: Option<&str>) -> Vec<PathBuf> {
+    let projects = agent_home("CLAUDE_CONFIG_DIR", ".claude").join("projects");
+    let Ok(dirs) = fs::read_dir(projects) else {
+        return Vec::new();
+    };
+    let key = workspace.map(project_key);
+    dirs.flatten()
+        .filter(|dir| key.as_deref().is_none_or(|key| dir.file_name() == key))
+        .filter_map(|dir| fs::read_dir(dir.path()).ok())
+        .flat_map(|files| files.flatten())
+        .map(|file| file.path())
+        .filter(|path| path.extension().is_some_and(|ext| ext == "jsonl"))
+        .collect()
+}
+
+/// Codex keeps one rollout file per session under `sessions/YYYY/MM/DD`.
+fn codex_files() -> Vec<PathBuf> {
+    let mut files = Vec::new();
+    let mut dirs = vec![agent_home("CODEX_HOME", ".codex").join("sessions")];
+    while let Some(dir) = dirs.pop() {
+        let Ok(entries) = fs::read_dir(&dir) else {
+            continue;
+        };
+        for path in entries.flatten().map(|entry| entry.path()) {
+            if path.is_dir() {
+                dirs.push(path);
+            } else if path.extension().is_some_and(|ext| ext == "jsonl") {
+                files.push(path);
+            }
+        }
+    }
+    files
+}
+
+/// Gemini keeps chats under `tmp/<sha256 of the workspace>/chats`.
+fn gemini_files(workspace: Option<&str>) -> Vec<PathBuf> {
+    let tmp = agent_home("GEMINI_HOME", ".gemini").join("tmp");
+    let projects = match workspace {
+        Some(dir) => {
+            let hash: String = Sha256::digest(dir.as_bytes())
+                .iter()
+                .map(|b| format!("{b:02x}"))
+                .collect();
+            vec![tmp.join(hash)]
+        }
+        None => fs::read_dir(&tmp)
+            .into_iter()
+            .flatten()
+            .flatten()
+            .map(|dir| dir.path())
+            .collect(),
+    };
+    projects
+        .iter()
+        .filter_map(|dir| fs::read_dir(dir.join("chats")).ok())
+        .flat_map(|files| files.flatten())
+        .map(|file| file.path())
+        .filter(|path| path.extension().is_some_and(|ext| ext == "json"))
+        .collect()
+}
+
+/// aider appends every chat to `.aider.chat.history.md` in the workspace,
+/// so there is nothing to find without one.
+fn aider_files(workspace: Option<&str>) -> Vec<PathBuf> {
+    workspace
+        .map(|dir| Path::new(dir).join(".aider.chat.history.md"))
+        .filter(|file| file.is_file())
+        .into_iter()
+        .collect()
+}
+
+fn parse_claude(id: &str, data: &str) -> Transcript {
+    let mut transcript = Transcript {
+        id: id.to_string(),
+        ..Transcript::default()
+    };
+    for entry in data
+        .lines()
+        .filter_map(|line| serde_json::from_str::<ClaudeEntry>(line).ok())
+    {
+        if transcript.path.is_empty() {
+            transcript.path = entry.cwd;
+        }
+        // Claude titles a conversation with `summary` entries, rewriting it
+        // as the conversation moves on.
+        if entry.kind == "summary" && !entry.summary.trim().is_empty() {
+            transcript.title = one_line(&entry.summary);
+        }
+        transcript.seen(entry.timestamp);
+        if entry.is_meta || entry.is_sidechain {
+            continue;
+        }
+        let content = entry
+            .message
+            .map(|message| message.content)
+            .unwrap_or_default();
+        let text = message_text(&content, "text");
+        match entry.kind.as_str() {
+            "user" if is_prompt(&text) => transcript.turns.push(Turn {
+                role: Role::User,
+                text,
+            }),
+            "assistant" => {
+                if !text.trim().is_empty() {
+                    transcript.turns.push(Turn {
+                        role: Role::Assistant,
+                        text,
+                    });
+                }
+                let calls = content.as_array().into_iter().flatten();
+                for call in calls.filter(|block| block["type"] == "tool_use") {
+                    transcript.turns.push(Turn {
+                        role: Role::Tool,
+                        text: tool_summary(call["name"].as_str().unwrap_or("tool"), &call["input"]),
+                    });
+                }
+            }
+            _ => {}
+        }
+    }
+    transcript
+}
+
+fn parse_codex(id: &str, data: &str) -> Transcript {
+    let mut transcript = Transcript {
+        id: id.to_string(),
+        ..Transcript::default()
+    };
+    for entry in data
+        .lines()
+        .filter_map(|line| serde_json::from_str::<CodexEntry>(line).ok())
+    {
+        transcript.seen(entry.timestamp);
+        let payload = &entry.payload;
+        match entry.kind.as_str() {
+            "session_meta" => {
+                if let Some(id) = payload["id"].as_str() {
+                    transcript.id = id.to_string();
+                }
+                transcript.path = payload["cwd"].as_str().unwrap_or_default().to_string();
+            }
+            "response_item" if payload["type"] == "message" => {
+                let (role, kind) = match payload["role"].as_str() {
+                    Some("user") => (Role::User, "input_text"),
+                    Some("assistant") => (Role::Assistant, "output_text"),
+                    _ => continue,
+                };
+                let text = message_text(&payload["content"], kind);
+                // Codex injects its instructions and environment as
+                // `<tag>…</tag>` user messages.
+                if text.trim().is_empty() || (role == Role::User && text.starts_with('<')) {
+                    continue;
+                }
+                transcript.turns.push(Turn { role, text });
+            }
+            "response_item" if payload["type"] == "function_call" => {
+                let arguments = payload["arguments"]
+                    .as_str()
+                    .and_then(|args| serde_json::from_str(args).ok())
+                    .unwrap_or_default();
+                transcript.turns.push(Turn {
+                    role: Role::Tool,
+                    text: tool_summary(payload["name"].as_str().unwrap_or("tool"), &arguments),
+                });
+            }
+            _ => {}
+        }
+    }
+    transcript
+}
+
+fn parse_gemini(data: &str) -> Option<Transcript> {
+    let chat: GeminiChat = serde_json::from_str(data).ok()?;
+    let mut transcript = Transcript {
+        id: chat.session_id,
+        started_at: chat.start_time,
+        updated_at: chat.last_updated,
+        ..Transcript::default()
+    };
+    for message in chat.messages {
+        // Content is either plain text or a list of `{text}` parts.
+        let text = match &message.content {
+            Value::String(text) => text.clone(),
+            Value::Array(parts) => parts
+                .iter()
+                .filter_map(|part| part["text"].as_str())
+                .collect::<Vec<_>>()
+                .join("\n"),
+            _ => String::new(),
+        };
+        let role = match message.kind.as_str() {
+            "user" => Role::User,
+            "gemini" => Role::Assistant,
+            _ => continue,
+        };
+        if !text.trim().is_empty() {
+            transcript.turns.push(Turn { role, text });
+        }
+        for call in &message.tool_calls {
+            transcript.turns.push(Turn {
+                role: Role::Tool,
+                text: tool_summary(&call.name, &call.args),
+            });
+        }
+    }
+    Some(transcript)
+}
+
+/// Splits aider's chat history into one transcript per `# aider chat
+/// started at` header. Prompts are the `####` lines; aider's own output is
+/// quoted with `>` and only its applied edits are kept.
+fn parse_aider(file: &Path, data: &str) -> Vec<Transcript> {
+    const HEADER: &str = "# aider chat started at ";
+    let path = file
+        .parent()
+        .map(|dir| dir.to_string_lossy().into_owned())
+        .unwrap_or_default();
+    let mut transcripts: Vec<Transcript> = Vec::new();
+    for chunk in data.split(HEADER).skip(1) {
+        let (stamp, body) = chunk.split_once('\n').unwrap_or((chunk, ""));
+        let started_at = NaiveDateTime::parse_from_str(stamp.trim(), "%Y-%m-%d %H:%M:%S")
+            .ok()
+            .and_then(|at| at.and_local_timezone(Local).single())
+            .map(|at| at.with_timezone(&Utc));
+        let mut transcript = Transcript {
+            id: format!(
+                "aider-{}",
+                stamp.replace(|ch: char| !ch.is_ascii_digit(), "")
+            ),
+            path: path.clone(),
+            started_at,
+            updated_at: started_at,
+            ..Transcript::default()
+        };
+        let mut reply = String::new();
+        let flush = |transcript: &mut Transcript, reply: &mut String| {
+            if !reply.trim().is_empty() {
+                transcript.turns.push(Turn {
+                    role: Role::Assistant,
+                    text: reply.trim().to_string(),
+                });
+            }
+            reply.clear();
+        };
+        for line in body.lines() {
+            if let Some(prompt) = line.strip_prefix("#### ") {
+                flush(&mut transcript, &mut reply);
+                match transcript.turns.last_mut() {
+                    Some(turn) if turn.role == Role::User => {
+                        turn.text.push('\n');
+                        turn.text.push_str(prompt);
+                    }
+                    _ => transcript.turns.push(Turn {
+                        role: Role::User,
+                        text: prompt.to_string(),
+                    }),
+                }
+            } else if let Some(quoted) = line.strip_prefix('>') {
+                if let Some(edit) = quoted.trim().strip_prefix("Applied edit to ") {
+                    flush(&mut transcript, &mut reply);
+                    transcript.turns.push(Turn {
+                        role: Role::Tool,
+                        text: format!("Edit: `{edit}`"),
+                    });
+                }
+            } else {
+                reply.push_str(line);
+                reply.push('\n');
+            }
+        }
+        flush(&mut transcript, &mut reply);
+        transcripts.push(transcript);
+    }
+    // Only the start of each chat is stamped; the last one ran until the
+    // file was last written.
+    if let Some(last) = transcripts.last_mut()
+        && let Ok(modified) = fs::metadata(file).and_then(|meta| meta.modified())
+    {
+        last.updated_at = Some(modified.into());
+    }
+    transcripts
+}
+
+/// The text blocks of a message. Tool calls and results are left out.
+fn message_text(content: &Value, kind: &str) -> String {
+    match content {
+        Value::String(text) => text.clone(),
+        Value::Array(blocks) => blocks
+            .iter()
+            .filter(|block| block["type"] == kind)
+            .filter_map(|block| block["text"].as_str())
+            .collect::<Vec<_>>()
+            .join("\n"),
+        _ => String::new(),
+    }
+}
+
+/// `Name: main argument`, e.g. `Bash: cargo test` or `Edit: src/main.rs`.
+fn tool_summary(name: &str, input: &Value) -> String {
+    const KEYS: [&str; 7] = [
+        "command",
+        "file_path",
+        "path",
+        "pattern",
+        "url",
+        "query",
+        "description",
+    ];
+    let arg = KEYS.iter().find_map(|key| match &input[key] {
+        Value::String(arg) => Some(arg.clone()),
+        // Codex passes shell commands as argv, usually `bash -lc <script>`.
+        Value::Array(argv) => argv.last()?.as_str().map(str::to_string),
+        _ => None,
+    });
+    match arg {
+        Some(arg) => {
+            let arg = one_line(&arg);
+            let mut short: String = arg.chars().take(80).collect();
+            if short.len() < arg.len() {
+                short.push('…');
+            }
+            format!("{name}: `{short}`")
+        }
+        None => name.to_string(),
+    }
+}
+
+/// Whether a user entry is something typed, rather than a slash command's
+/// bookkeeping or a tool result.
+fn is_prompt(text: &str) -> bool {
+    let text = text.trim();
+    !text.is_empty()
+        && !text.starts_with("<command-")
+        && !text.starts_with("<local-command-")
+        && !text.starts_with("Caveat:")
+}
+
+fn one_line(text: &str) -> String {
+    text.split_whitespace().collect::<Vec<_>>().join(" ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn summarises_a_transcript() {
+        let data = [
+            r#"{"type":"summary","summary":"Fix login"}"#,
+            r#"{"type":"user","isMeta":true,"cwd":"/src/api","timestamp":"2026-03-02T14:02:00Z","message":{"role":"user","content":"Caveat: local commands"}}"#,
+            r#"{"type":"user","cwd":"/src/api","timestamp":"2026-03-02T14:02:05Z","message":{"role":"user","content":"fix the\nflaky login test"}}"#,
+            r#"{"type":"assistant","cwd":"/src/api","timestamp":"2026-03-02T14:02:30Z","message":{"role":"assistant","content":[{"type":"text","text":"Looking."},{"type":"tool_use","name":"Bash"}]}}"#,
+            r#"{"type":"user","cwd":"/src/api","timestamp":"2026-03-02T14:02:40Z","message":{"role":"user","content":[{"type":"tool_result","content":"ok"}]}}"#,
+            r#"{"type":"assistant","cwd":"/src/api","timestamp":"2026-03-02T14:03:00Z","message":{"role":"assistant","content":[{"type":"tool_use","name":"Edit"}]}}"#,
+            "not json",
+        ]
+        .join("\n");
+
+        let session = parse_claude("abc", &data).into_session("claude").unwrap();
+
+        assert_eq!(session.path, "/src/api");
+        assert_eq!(session.title, "Fix login");
+        assert_eq!(session.first_prompt, "fix the flaky login test");
+        assert_eq!(session.messages, 2);
+        assert_eq!(
+            session.started_at.unwrap().to_rfc3339(),
+            "2026-03-02T14:02:00+00:00"
+        );
+        assert_eq!(
+            session.updated_at.unwrap().to_rfc3339(),
+            "2026-03-02T14:03:00+00:00"
+        );
+        assert_eq!(
+            parse_claude("empty", r#"{"type":"summary"}"#).into_session("claude"),
+            None
+        );
+    }
+
+    #[test]
+    fn renders_markdown_with_tool_calls_summarised() {
+        let data = [
+            r#"{"type":"user","cwd":"/src/api","message":{"role":"user","content":"fix the flaky login test"}}"#,
+            r#"{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Running it first."},{"type":"tool_use","name":"Bash","input":{"command":"cargo test login"}}]}}"#,
+            r#"{"type":"user","message":{"role":"user","content":[{"type":"tool_result","content":"1 failed"}]}}"#,
+            r#"{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","name":"Edit","input":{"file_path":"src/login.rs","old_string":"a"}}]}}"#,
+            r#"{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Fixed the race."}]}}"#,
+        ]
+        .join("\n");
+        let transcript = parse_claude("8c1f", &data);
+        let session = parse_claude("8c1f", &data).into_session("claude").unwrap();
+
+        assert_eq!(
+            render_markdown(&session, &transcript),
+            "# fix the flaky login test\n\n\
+             - Provider: claude\n\
+             - Session: 8c1f\n\
+             - Directory: /src/api\n\
+             \n## Prompt\n\
+             \nfix the flaky login test\n\
+             \n## Response\n\
+             \nRunning it first.\n\
+             \n- Bash: `cargo test login`\n\
+             - Edit: `src/login.rs`\n\
+             \nFixed the race.\n"
+        );
+    }
+
+    #[test]
+    fn searches_codex_rollouts() {
+        let data = [
+            r#"{"timestamp":"2026-03-02T09:00:00Z","type":"session_meta","payload":{"id":"c0d3","cwd":"/src/web"}}"#,
+            r#"{"timestamp":"2026-03-02T09:00:01Z","type":"response_item","payload":{"type":"message","role":"user","content":[{"type":"input_text","text":"<environment_context>flaky</environment_context>"}]}}"#,
+            r#"{"timestamp":"2026-03-02T09:00:02Z","type":"response_item","payload":{"type":"message","role":"user","content":[{"type":"input_text","text":"why is the checkout test so Flaky Test prone?"}]}}"#,
+            r#"{"timestamp":"2026-03-02T09:00:09Z","type":"response_item","payload":{"type":"message","role":"assistant","content":[{"type":"output_text","text":"The flaky test races the timer."}]}}"#,
+        ]
+        .join("\n");
+
+        let hit = search_transcript("codex", parse_codex("rollout", &data), "flaky test").unwrap();
+
+        assert_eq!(hit.session.id, "c0d3");
+        assert_eq!(hit.session.provider, "codex");
+        assert_eq!(hit.session.path, "/src/web");
+        assert_eq!(hit.session.messages, 2);
+        assert_eq!(hit.matches, 2);
+        assert_eq!(hit.snippet, "why is the checkout test so Flaky Test prone?");
+        assert!(search_transcript("codex", parse_codex("rollout", &data), "deploy").is_none());
+    }
+
+    #[test]
+    fn reads_gemini_chats() {
+        let data = r#"{
+            "sessionId": "9e1",
+            "startTime": "2026-03-02T10:00:00Z",
+            "lastUpdated": "2026-03-02T10:04:00Z",
+            "messages": [
+                {"type": "info", "content": "Authenticated"},
+                {"type": "user", "content": "rename the config flag"},
+                {"type": "gemini", "content": "", "toolCalls": [{"name": "replace", "args": {"file_path": "src/config.rs"}}]},
+                {"type": "gemini", "content": [{"text": "Renamed it."}]}
+            ]
+        }"#;
+
+        let session = parse_gemini(data).unwrap().into_session("gemini").unwrap();
+
+        assert_eq!(session.id, "9e1");
+        assert_eq!(session.first_prompt, "rename the config flag");
+        assert_eq!(session.messages, 2);
+        assert_eq!(
+            session.updated_at.unwrap().to_rfc3339(),
+            "2026-03-02T10:04:00+00:00"
+        );
+        assert!(parse_gemini("not json").is_none());
+    }
+
+    #[test]
+    fn splits_aider_history_into_chats() {
+        let data = "\
+# aider chat started at 2026-03-01 09:00:00
+
+> Aider v0.80.0
+#### add a --dry-run flag
+#### to the deploy script
+
+Sure, here is the change.
+> Applied edit to deploy.sh
+
+# aider chat started at 2026-03-02 11:30:05
+
+#### now document it
+Added a README note.
+";
+        let transcripts = parse_aider(Path::new("/src/ops/.aider.chat.history.md"), data);
+
+        assert_eq!(transcripts.len(), 2);
+        assert_eq!(transcripts[0].id, "aider-20260301090000");
+        assert_eq!(transcripts[0].path, "/src/ops");
+        let roles: Vec<Role> = transcripts[0].turns.iter().map(|turn| turn.role).collect();
+        assert_eq!(roles, [Role::User, Role::Assistant, Role::Tool]);
+        assert_eq!(
+            transcripts[0].turns[0].text,
+            "add a --dry-run flag\nto the deploy script"
+        );
+        assert_eq!(transcripts[0].turns[2].text, "Edit: `deploy.sh`");
+        let session = transcripts.into_iter().nth(1).unwrap();
+        let session = session.into_session("aider").unwrap();
+        assert_eq!(session.first_prompt, "now document it");
+        assert_eq!(session.messages, 2);
+    }
+
+    #[test]
+    fn matches_commits_to_the_session_that_made_them() {
+        let at = |time: &str| {
+            format!("2026-03-02T{time}Z")
+                .parse::<DateTime<Utc>>()
+                .unwrap()
+        };
+        let commit = |hash: &str, time: &str| Commit {
+            hash: hash.to_string(),
+            at: at(time),
+            subject: String::new(),
+        };
+        let session = Session {
+            started_at: Some(at("14:00:00")),
+            updated_at: Some(at("14:30:00")),
+            ..Session::default()
+        };
+        let commits = [
+            commit("after", "14:45:00"),
+            commit("grace", "14:31:00"),
+            commit("during", "14:10:00"),
+            commit("before", "13:59:00"),
+        ];
+
+        let hashes: Vec<String> = commits_during(&session, &commits)
+            .into_iter()
+            .map(|commit| commit.hash)
+            .collect();
+        assert_eq!(hashes, ["grace", "during"]);
+    }
+
+    #[test]
+    fn trims_long_snippets_around_the_match() {
+        let text = format!("{} needle {}", "a".repeat(50), "b".repeat(100));
+        let snippet = snippet_around(&text, &text, "needle");
+
+        assert!(snippet.starts_with("…aaa"));
+        assert!(snippet.contains("needle"));
+        assert!(snippet.ends_with('…'));
+    }
+
+    #[test]
+    fn encodes_workspace_paths_like_claude() {
+        assert_eq!(
+            project_key("/home/me/src/agent.mux/"),
+            "-home-me-src-agent-mux"
+        );
+    }
+}
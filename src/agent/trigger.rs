@@ -0,0 +1,184 @@
+use std::fmt;
+use std::process::Command;
+
+use anyhow::{Result, anyhow, bail};
+use serde::{Deserialize, Serialize};
+
+use crate::agent::events::{Event, status_changes};
+use crate::agent::exec::RunExt;
+use crate::agent::persist::{queue_prompt, take_finish_actions};
+use crate::agent::spawn::Spawn;
+use crate::agent::throttle::spawn_or_queue;
+use crate::agent::{Pane, PaneStatus, log, notify};
+
+/// Something to do once a pane stops working. Actions run once and are
+/// then removed.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(tag = "type", rename_all = "camelCase")]
+pub enum FinishAction {
+    /// Runs a shell command in the finished pane's directory.
+    Run { command: String },
+    /// Queues a prompt for another pane, sent once that pane is idle.
+    Send { pane: String, prompt: String },
+    /// Starts a new agent from a template.
+    Spawn { template: String, arg: String },
+    /// Sends a notification, even when status notifications are off.
+    Notify { message: String },
+}
+
+impl FinishAction {
+    /// Parses `run <command>`, `send <pane> <prompt>`,
+    /// `spawn <template> [arg]`, or `notify [message]`.
+    pub fn parse(s: &str) -> Result<Self> {
+        let s = s.trim();
+        let (verb, rest) = s.split_once(' ').unwrap_or((s, ""));
+        let rest = rest.trim();
+        let action = match verb {
+            "run" if !rest.is_empty() => Self::Run {
+                command: rest.to_string(),
+            },
+            "send" => {
+                let Some((pane, prompt)) = rest.split_once(' ') else {
+                    bail!("usage: send <pane> <prompt>");
+                };
+                Self::Send {
+                    pane: pane.to_string(),
+                    prompt: prompt.trim().to_string(),
+                }
+            }
+            "spawn" if !rest.is_empty() => {
+                let (template, arg) = rest.split_once(' ').unwrap_or((rest, ""));
+                Self::Spawn {
+                    template: template.to_string(),
+                    arg: arg.trim().to_string(),
+                }
+            }
+            "notify" => Self::Notify {
+                message: rest.to_string(),
+            },
+            _ => {
+                return Err(anyhow!(
+                    "expected run <command>, send <pane> <prompt>, spawn <template> [arg], \
+                     or notify [message]"
+                ));
+            }
+        };
+        Ok(action)
+    }
+}
+
+impl fmt::Display for FinishAction {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Self::Run { command } => write!(f, "run {command}"),
+            Self::Send { pane, prompt } => write!(f, "send {pane} {prompt}"),
+            Self::Spawn { template, arg } if arg.is_empty() => write!(f, "spawn {template}"),
+            Self::Spawn { template, arg } => write!(f, "spawn {template} {arg}"),
+            Self::Notify { message } if message.is_empty() => write!(f, "notify"),
+            Self::Notify { message } => write!(f, "notify {message}"),
+        }
+    }
+}
+
+/// Runs each pane's finish actions when it leaves Busy.
+pub fn run_finish_triggers(panes: &[Pane], events: &[Event]) {
+    for change in status_changes(events) {
+        if change.from != Some(PaneStatus::Busy)
+            || !matches!(change.to, PaneStatus::Idle | PaneStatus::Unread)
+        {
+            continue;
+        }
+        let Some(pane) = panes.iter().find(|pane| pane.pane_id == change.pane_id) else {
+            continue;
+        };
+        if pane.on_finish.is_empty() {
+            continue;
+        }
+        let actions = match take_finish_actions(&pane.pane_id) {
+            Ok(actions) => actions,
+            Err(err) => {
+                log::warn(
+                    "take finish actions failed",
+                    &[("pane", &pane.pane_id), ("err", &format!("{err:#}"))],
+                );
+                continue;
+            }
+        };
+        for action in actions {
+            let result = execute(&action, pane, panes);
+            log::info(
+                "ran finish action",
+                &[
+                    ("pane", &pane.pane_id),
+                    ("action", &action),
+                    ("ok", &result.is_ok()),
+                ],
+            );
+            if let Err(err) = result {
+                log::warn(
+                    "finish action failed",
+                    &[("pane", &pane.pane_id), ("err", &format!("{err:#}"))],
+                );
+            }
+        }
+    }
+}
+
+fn execute(action: &FinishAction, finished: &Pane, panes: &[Pane]) -> Result<()> {
+    match action {
+        FinishAction::Run { command } => {
+            let mut cmd = Command::new("sh");
+            cmd.arg("-c")
+                .arg(command)
+                .env("AGENT_MUX_PANE", &finished.pane_id)
+                .env("AGENT_MUX_TARGET", &finished.target)
+                .env("AGENT_MUX_PATH", &finished.path);
+            if !finished.host.is_empty() || finished.path.is_empty() {
+                cmd.current_dir(std::env::temp_dir());
+            } else {
+                cmd.current_dir(&finished.path);
+            }
+            cmd.spawn_reaped(command)?;
+            Ok(())
+        }
+        FinishAction::Send { pane, prompt } => {
+            let target = panes
+                .iter()
+                .find(|p| p.pane_id == *pane || p.target == *pane)
+                .ok_or_else(|| anyhow!("no agent pane {pane}"))?;
+            queue_prompt(target, prompt)
+        }
+        FinishAction::Spawn { template, arg } => {
+            spawn_or_queue(&Spawn::from_template(template, arg)?, panes).map(|_| ())
+        }
+        FinishAction::Notify { message } => notify::announce(finished, message),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_and_formats_actions() {
+        for text in [
+            "run make test",
+            "send %4 review the diff in ../api",
+            "spawn bugfix JIRA-9",
+            "spawn review",
+            "notify",
+            "notify review the api branch",
+        ] {
+            assert_eq!(FinishAction::parse(text).unwrap().to_string(), text);
+        }
+        assert_eq!(
+            FinishAction::parse("send %4  hi").unwrap(),
+            FinishAction::Send {
+                pane: "%4".to_string(),
+                prompt: "hi".to_string()
+            }
+        );
+        assert!(FinishAction::parse("send %4").is_err());
+        assert!(FinishAction::parse("email me").is_err());
+    }
+}
@@ -1,26 +1,66 @@
 use std::fs::{self, OpenOptions};
 use std::io::{BufRead, BufReader, Seek, SeekFrom, Write};
 use std::os::unix::net::{UnixListener, UnixStream};
+use std::panic::{self, AssertUnwindSafe};
 use std::path::PathBuf;
 use std::sync::atomic::{AtomicBool, Ordering};
 use std::sync::{Arc, Mutex, mpsc};
 use std::time::{Duration, Instant};
 
 use anyhow::{Context, Result};
+use chrono::{DateTime, Utc};
 use fs2::FileExt;
 
+use crate::agent::alert::Alerter;
+use crate::agent::approve::Approver;
+use crate::agent::config::config;
+use crate::agent::digest::DigestSender;
+use crate::agent::events::{Event, EventBus};
 use crate::agent::git::{enrich_panes, enrich_panes_fast};
-use crate::agent::ipc::{Request, Response, socket_path};
+use crate::agent::hooks::run_hooks;
+use crate::agent::ipc::{
+    PaneUpdate, Request, Response, apply_pane_update, display_panes, socket_path,
+};
+use crate::agent::notify::Notifier;
+use crate::agent::output::OutputLogger;
 use crate::agent::persist::{
-    Snapshot, cache_panes, load_snapshot, load_ui_state, panes_from_snapshot, state_dir,
-    ui_pane_state_is_empty, update_ui_state_if_changed, write_heartbeat, write_snapshot_if_changed,
+    Heartbeat, Snapshot, UiState, auto_stash, cache_panes, dismissed_panes, load_snapshot,
+    load_ui_state, panes_from_snapshot, state_dir, ui_pane_state_is_empty, update_heartbeat,
+    update_ui_state_if_changed, write_heartbeat, write_snapshot_if_changed,
+};
+use crate::agent::queue::PromptQueue;
+use crate::agent::team::TeamReporter;
+use crate::agent::throttle::{SpawnQueue, Throttle};
+use crate::agent::trigger::run_finish_triggers;
+use crate::agent::web::start_web_server;
+use crate::agent::{
+    Pane, Reconciler, kill_pane, list_panes_fast, live_tmux_pane_ids, respawn_agent,
 };
-use crate::agent::{Pane, Reconciler, list_panes_fast};
+use crate::agent::{crash, journal, log, power, tasks, tmux, transcript};
 
-type SharedSnapshot = Arc<Mutex<Option<Snapshot>>>;
+const VIEW_PRUNE_INTERVAL: Duration = Duration::from_secs(60);
+
+pub type SharedSnapshot = Arc<Mutex<Option<Snapshot>>>;
 type Subscribers = Arc<Mutex<Vec<mpsc::Sender<Response>>>>;
 
-pub fn run() -> Result<()> {
+#[derive(Debug, Clone, Copy, Default)]
+pub struct WatchOptions {
+    /// Log every reconcile decision to stderr as well as the log file.
+    pub verbose: bool,
+    /// Poll and reconcile without writing state or serving clients, logging
+    /// each status change to stderr.
+    pub dry_run: bool,
+}
+
+pub fn run(options: WatchOptions) -> Result<()> {
+    if options.verbose || options.dry_run {
+        log::set_level(log::Level::Debug);
+        log::set_stderr(true);
+    }
+    if options.dry_run {
+        return run_dry(options);
+    }
+
     fs::create_dir_all(state_dir()).context("create state dir")?;
     let mut lock = OpenOptions::new()
         .create(true)
@@ -43,7 +83,15 @@ pub fn run() -> Result<()> {
     })
     .ok();
 
+    log::info(
+        "watcher started",
+        &[("version", &env!("CARGO_PKG_VERSION"))],
+    );
+    if let Some(warning) = tmux::compatibility_warning() {
+        log::warn("old tmux", &[("warning", &warning)]);
+    }
     let mut reconciler = Reconciler::new();
+    reconciler.set_verbose(options.verbose);
     if let Some(snapshot) = load_snapshot() {
         reconciler.seed_from_snapshot(&snapshot);
     }
@@ -52,21 +100,136 @@ pub fn run() -> Result<()> {
     let subscribers = Arc::new(Mutex::new(Vec::new()));
     start_socket_server(latest_snapshot.clone(), subscribers.clone());
     start_metadata_worker(latest_snapshot.clone(), subscribers.clone());
+    start_web_server(latest_snapshot.clone());
+
+    update_heartbeat(|heartbeat| {
+        *heartbeat = Heartbeat {
+            pid: std::process::id(),
+            started_at: Some(chrono::Utc::now()),
+            ..Heartbeat::default()
+        };
+    })?;
 
+    let mut notifier = Notifier::new();
+    let mut approver = Approver::from_config();
+    let mut alerter = Alerter::from_config();
+    let mut prompt_queue = PromptQueue::new();
+    let mut spawn_queue = SpawnQueue::new();
+    let mut bus = EventBus::new();
+    let mut output_logger = OutputLogger::new();
+    let mut team_reporter = TeamReporter::new();
+    let mut digest = DigestSender::new();
     let fast_interval = Duration::from_millis(250);
+    let mut power_saving = false;
+    let mut ui_updated_at = load_ui_state().updated_at;
     while !stopped.load(Ordering::SeqCst) {
         let start = Instant::now();
-        match refresh_once_with(&mut reconciler, Some(&latest_snapshot), Some(&subscribers)) {
-            Ok(()) => {}
-            Err(err) => log_error(&format!("refresh failed: {err:#}")),
+        let refreshed = panic::catch_unwind(AssertUnwindSafe(|| {
+            refresh_once_with(&mut reconciler, Some(&latest_snapshot), Some(&subscribers))
+        }));
+        let failure = match refreshed {
+            Ok(Ok(())) => None,
+            Ok(Err(err)) => Some(format!("{err:#}")),
+            Err(_) => Some(format!(
+                "refresh panicked; see {}",
+                crash::crash_log_path().display()
+            )),
+        };
+        if let Some(err) = &failure {
+            log::error("refresh failed", &[("err", err)]);
         }
+        let mut events: Vec<Event> = bus.refreshed(failure.as_deref()).into_iter().collect();
+        let saved = update_heartbeat(|heartbeat| {
+            match failure {
+                Some(err) => {
+                    heartbeat.last_error = err;
+                    heartbeat.last_error_at = Some(chrono::Utc::now());
+                }
+                None => heartbeat.last_refresh_at = Some(chrono::Utc::now()),
+            }
+            heartbeat.problems = log::recent_problems();
+        });
+        if let Err(err) = saved {
+            log::warn("save heartbeat failed", &[("err", &format!("{err:#}"))]);
+        }
+        publish_ui_state_changes(&latest_snapshot, &subscribers, &mut ui_updated_at);
+        if let Some(snapshot) = latest_snapshot
+            .lock()
+            .ok()
+            .and_then(|latest| latest.clone())
+        {
+            let panes = display_panes(&snapshot, &load_ui_state());
+            events.extend(bus.update(&panes));
+            journal::record(&events);
+            output_logger.run(&panes);
+            team_reporter.run(&panes);
+            digest.run();
+            if config().notifications.enabled {
+                notifier.notify(&panes, &events);
+            }
+            run_hooks(&panes, &events);
+            approver.run(&panes);
+            alerter.run(&panes);
+            run_finish_triggers(&panes, &events);
+            let mut throttle = Throttle::new(&panes);
+            prompt_queue.run(&panes, &mut throttle);
+            spawn_queue.run(&panes, &mut throttle);
+            tasks::run_dispatch(&panes, &mut throttle);
+        }
+        broadcast_events(&subscribers, events);
 
+        let saving = power::power_save();
+        if saving != power_saving {
+            power_saving = saving;
+            log::info("power save", &[("on", &saving)]);
+        }
+        let interval = power::poll_interval(fast_interval);
+        let elapsed = start.elapsed();
+        if elapsed < interval {
+            std::thread::sleep(interval - elapsed);
+        }
+    }
+
+    log::info("watcher stopped", &[]);
+    Ok(())
+}
+
+fn run_dry(options: WatchOptions) -> Result<()> {
+    let stopped = Arc::new(AtomicBool::new(false));
+    let stop_flag = stopped.clone();
+    ctrlc::set_handler(move || {
+        stop_flag.store(true, Ordering::SeqCst);
+    })
+    .ok();
+
+    log::info("dry run started; no state is written", &[]);
+    let mut reconciler = Reconciler::new();
+    reconciler.set_verbose(options.verbose);
+    let mut previous = load_snapshot();
+    if let Some(snapshot) = previous.as_ref() {
+        reconciler.seed_from_snapshot(snapshot);
+    }
+
+    let fast_interval = Duration::from_millis(250);
+    while !stopped.load(Ordering::SeqCst) {
+        let start = Instant::now();
+        match reconcile_panes(&mut reconciler, previous.as_ref(), &load_ui_state()) {
+            Ok(panes) => {
+                let mut cached = cache_panes(&panes);
+                reconciler.apply_to_cache(&mut cached);
+                previous = Some(Snapshot {
+                    version: 1,
+                    panes: cached,
+                    ..Snapshot::default()
+                });
+            }
+            Err(err) => log::error("refresh failed", &[("err", &format!("{err:#}"))]),
+        }
         let elapsed = start.elapsed();
         if elapsed < fast_interval {
             std::thread::sleep(fast_interval - elapsed);
         }
     }
-
     Ok(())
 }
 
@@ -76,6 +239,7 @@ pub fn refresh_once() -> Result<()> {
         reconciler.seed_from_snapshot(&snapshot);
     }
     refresh_once_with(&mut reconciler, None, None)?;
+    write_heartbeat()?;
     let _ = refresh_metadata_snapshot()?;
     Ok(())
 }
@@ -85,11 +249,22 @@ fn refresh_once_with(
     latest_snapshot: Option<&SharedSnapshot>,
     subscribers: Option<&Subscribers>,
 ) -> Result<()> {
-    write_heartbeat()?;
-
     let previous = load_snapshot();
     let ui_state = load_ui_state();
+    let panes = reconcile_panes(reconciler, previous.as_ref(), &ui_state)?;
+    let (snapshot, changed) = write_panes_snapshot(reconciler, &panes)?;
+    publish_snapshot(latest_snapshot, subscribers, snapshot, changed);
+
+    prune_ui_state(&panes)?;
 
+    Ok(())
+}
+
+fn reconcile_panes(
+    reconciler: &mut Reconciler,
+    previous: Option<&Snapshot>,
+    ui_state: &UiState,
+) -> Result<Vec<Pane>> {
     let mut panes = list_panes_fast()?;
     for p in &mut panes {
         if let Some(ui) = ui_state
@@ -101,7 +276,7 @@ fn refresh_once_with(
         }
     }
 
-    if let Some(snapshot) = previous.as_ref() {
+    if let Some(snapshot) = previous {
         apply_cached_metadata(&mut panes, snapshot);
     }
     if panes
@@ -112,13 +287,10 @@ fn refresh_once_with(
     }
 
     reconciler.reconcile(&mut panes);
-    let (snapshot, changed) = write_panes_snapshot(reconciler, &panes)?;
-    publish_snapshot(latest_snapshot, subscribers, snapshot, changed);
-    write_heartbeat()?;
-
-    prune_ui_state(&panes)?;
-
-    Ok(())
+    reconciler.track_terminated(previous, &mut panes, &dismissed_panes(ui_state), || {
+        live_tmux_pane_ids().ok()
+    });
+    Ok(panes)
 }
 
 fn start_metadata_worker(latest_snapshot: SharedSnapshot, subscribers: Subscribers) {
@@ -126,12 +298,15 @@ fn start_metadata_worker(latest_snapshot: SharedSnapshot, subscribers: Subscribe
         let interval = Duration::from_secs(3);
         loop {
             std::thread::sleep(interval);
+            if power::power_save() {
+                continue;
+            }
             match refresh_metadata_snapshot() {
                 Ok(Some(snapshot)) => {
                     publish_snapshot(Some(&latest_snapshot), Some(&subscribers), snapshot, true)
                 }
                 Ok(None) => {}
-                Err(err) => log_error(&format!("metadata refresh failed: {err:#}")),
+                Err(err) => log::error("metadata refresh failed", &[("err", &format!("{err:#}"))]),
             }
         }
     });
@@ -143,10 +318,18 @@ fn refresh_metadata_snapshot() -> Result<Option<Snapshot>> {
     };
     let mut panes = panes_from_snapshot(&snapshot);
     enrich_panes(&mut panes);
+    enrich_titles(&mut panes);
     let metadata = cache_panes(&panes);
     merge_metadata_snapshot(&metadata)
 }
 
+/// Transcripts live on this machine, so remote panes go untitled.
+fn enrich_titles(panes: &mut [Pane]) {
+    for p in panes.iter_mut().filter(|p| p.host.is_empty()) {
+        p.title = transcript::title(&p.provider, &p.path).unwrap_or_default();
+    }
+}
+
 fn merge_metadata_snapshot(
     metadata: &[crate::agent::persist::CachedPane],
 ) -> Result<Option<Snapshot>> {
@@ -171,6 +354,7 @@ fn merge_metadata_snapshot(
         pane.project_dirty = meta.project_dirty;
         pane.git_branch = meta.git_branch.clone();
         pane.git_dirty = meta.git_dirty;
+        pane.title = meta.title.clone();
     }
     let changed = write_snapshot_if_changed(snapshot)?;
     Ok(changed.then(load_snapshot).flatten())
@@ -201,14 +385,44 @@ fn prune_ui_state(panes: &[Pane]) -> Result<()> {
         .iter()
         .flat_map(|p| [(p.pane_id.clone(), true), (p.target.clone(), true)])
         .collect();
+    let live_views = live_view_keys();
     update_ui_state_if_changed(|state| {
+        for p in panes {
+            if !p.pane_id.is_empty()
+                && !state.panes.contains_key(&p.pane_id)
+                && let Some(ui) = state.panes.remove(&p.target)
+            {
+                state.panes.insert(p.pane_id.clone(), ui);
+            }
+        }
         state
             .panes
             .retain(|id, ui| alive.contains_key(id) && !ui_pane_state_is_empty(ui));
+        state.marks.retain(|_, id| alive.contains_key(id));
+        state.preview_rates.retain(|id, _| alive.contains_key(id));
+        if let Some(live) = &live_views {
+            // The bare `pane` and `popup` keys are fallbacks, not windows.
+            state
+                .views
+                .retain(|key, _| !key.contains(':') || live.contains(key));
+        }
+        auto_stash(state, panes, config().auto_stash, Utc::now());
     })?;
     Ok(())
 }
 
+/// The saved sidebar views that may be kept, looked up at most once a
+/// minute; `None` in between, or when tmux can't list its windows.
+fn live_view_keys() -> Option<std::collections::HashSet<String>> {
+    static CHECKED: Mutex<Option<Instant>> = Mutex::new(None);
+    let mut checked = CHECKED.lock().ok()?;
+    if checked.is_some_and(|at| at.elapsed() < VIEW_PRUNE_INTERVAL) {
+        return None;
+    }
+    *checked = Some(Instant::now());
+    tmux::live_view_keys().ok()
+}
+
 fn write_panes_snapshot(reconciler: &Reconciler, panes: &[Pane]) -> Result<(Snapshot, bool)> {
     let mut cached = cache_panes(panes);
     reconciler.apply_to_cache(&mut cached);
@@ -243,6 +457,7 @@ fn apply_cached_metadata(panes: &mut [Pane], snapshot: &Snapshot) {
         p.project_dirty = cached.project_dirty;
         p.git_branch = cached.git_branch.clone();
         p.git_dirty = cached.git_dirty;
+        p.title = cached.title.clone();
     }
 }
 
@@ -253,7 +468,7 @@ fn start_socket_server(latest_snapshot: SharedSnapshot, subscribers: Subscribers
         let listener = match UnixListener::bind(&path) {
             Ok(listener) => listener,
             Err(err) => {
-                log_error(&format!("bind daemon socket failed: {err:#}"));
+                log::error("bind daemon socket failed", &[("err", &err)]);
                 return;
             }
         };
@@ -261,7 +476,7 @@ fn start_socket_server(latest_snapshot: SharedSnapshot, subscribers: Subscribers
         for stream in listener.incoming() {
             match stream {
                 Ok(stream) => handle_socket_client(stream, &latest_snapshot, &subscribers),
-                Err(err) => log_error(&format!("accept daemon socket failed: {err:#}")),
+                Err(err) => log::error("accept daemon socket failed", &[("err", &err)]),
             }
         }
     });
@@ -289,6 +504,42 @@ fn handle_socket_client(
             write_response(&mut stream, state_response(latest_snapshot));
         }
         Ok(Request::Subscribe) => subscribe_client(stream, latest_snapshot, subscribers),
+        Ok(Request::UpdatePane(_) | Request::KillPane { .. } | Request::RespawnPane { .. })
+            if config().read_only =>
+        {
+            write_response(
+                &mut stream,
+                Response::Error {
+                    message: "agent-mux is in read-only mode".to_string(),
+                },
+            );
+        }
+        // tmux commands can take a while (a kill archives the pane first),
+        // so they run off the accept loop.
+        Ok(Request::KillPane { target }) => {
+            std::thread::spawn(move || {
+                write_response(&mut stream, command_response(kill_pane(&target)));
+            });
+        }
+        Ok(Request::RespawnPane { pane_id }) => {
+            let pane = find_pane(latest_snapshot, &pane_id);
+            std::thread::spawn(move || {
+                let result = match pane {
+                    Some(pane) => respawn_agent(&pane),
+                    None => Err(anyhow::anyhow!("no pane {pane_id}")),
+                };
+                write_response(&mut stream, command_response(result));
+            });
+        }
+        Ok(Request::UpdatePane(update)) => {
+            let response = match update_pane(latest_snapshot, &update) {
+                Ok(()) => Response::Ok,
+                Err(err) => Response::Error {
+                    message: format!("{err:#}"),
+                },
+            };
+            write_response(&mut stream, response);
+        }
         Err(err) => {
             write_response(
                 &mut stream,
@@ -300,6 +551,30 @@ fn handle_socket_client(
     }
 }
 
+fn command_response(result: Result<()>) -> Response {
+    match result {
+        Ok(()) => Response::Ok,
+        Err(err) => Response::Error {
+            message: format!("{err:#}"),
+        },
+    }
+}
+
+fn find_pane(latest_snapshot: &SharedSnapshot, pane_id: &str) -> Option<Pane> {
+    let latest = latest_snapshot.lock().ok()?;
+    panes_from_snapshot(latest.as_ref()?)
+        .into_iter()
+        .find(|pane| pane.pane_id == pane_id)
+}
+
+fn update_pane(latest_snapshot: &SharedSnapshot, update: &PaneUpdate) -> Result<()> {
+    let pane = find_pane(latest_snapshot, &update.pane_id).unwrap_or_else(|| Pane {
+        pane_id: update.pane_id.clone(),
+        ..Pane::default()
+    });
+    apply_pane_update(&pane, update)
+}
+
 fn subscribe_client(
     mut stream: UnixStream,
     latest_snapshot: &SharedSnapshot,
@@ -329,6 +604,37 @@ fn state_response(latest_snapshot: &SharedSnapshot) -> Response {
     }
 }
 
+// Clients write pane fields straight to ui_state.json under its lock; the
+// watcher only relays those writes so every subscriber sees them promptly.
+fn publish_ui_state_changes(
+    latest_snapshot: &SharedSnapshot,
+    subscribers: &Subscribers,
+    seen: &mut Option<DateTime<Utc>>,
+) {
+    let updated_at = load_ui_state().updated_at;
+    if updated_at == *seen {
+        return;
+    }
+    *seen = updated_at;
+    let snapshot = latest_snapshot
+        .lock()
+        .ok()
+        .and_then(|snapshot| snapshot.clone());
+    if let Some(snapshot) = snapshot {
+        broadcast_snapshot(subscribers, snapshot);
+    }
+}
+
+fn broadcast_events(subscribers: &Subscribers, events: Vec<Event>) {
+    if events.is_empty() {
+        return;
+    }
+    let response = Response::Events { events };
+    if let Ok(mut subscribers) = subscribers.lock() {
+        subscribers.retain(|tx| tx.send(response.clone()).is_ok());
+    }
+}
+
 fn broadcast_snapshot(subscribers: &Subscribers, snapshot: Snapshot) {
     let response = Response::State {
         snapshot: Some(snapshot),
@@ -343,7 +649,7 @@ fn write_response(stream: &mut UnixStream, response: Response) -> bool {
     match serde_json::to_string(&response) {
         Ok(response) => writeln!(stream, "{response}").is_ok(),
         Err(err) => {
-            log_error(&format!("encode daemon socket response failed: {err:#}"));
+            log::error("encode daemon socket response failed", &[("err", &err)]);
             false
         }
     }
@@ -359,19 +665,11 @@ pub fn is_running() -> bool {
     }
 }
 
-pub fn log_path() -> PathBuf {
-    state_dir().join("watch.log")
-}
-
-fn log_error(message: &str) {
-    let _ = fs::create_dir_all(state_dir());
-    if let Ok(mut file) = OpenOptions::new()
-        .create(true)
-        .append(true)
-        .open(log_path())
-    {
-        let _ = writeln!(file, "{} {message}", chrono::Utc::now().to_rfc3339());
+pub fn running_pid() -> Option<u32> {
+    if !is_running() {
+        return None;
     }
+    fs::read_to_string(lock_path()).ok()?.trim().parse().ok()
 }
 
 pub fn lock_path() -> PathBuf {
@@ -0,0 +1,239 @@
+use std::collections::HashMap;
+use std::io::{BufRead, BufReader, Read, Write};
+use std::net::{TcpListener, TcpStream};
+use std::sync::OnceLock;
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::time::Duration;
+
+use regex::Regex;
+
+use crate::agent::backend::percent_decode;
+use crate::agent::capture_pane;
+use crate::agent::config::config;
+use crate::agent::ipc::display_panes;
+use crate::agent::log;
+use crate::agent::persist::load_ui_state;
+use crate::agent::watch::SharedSnapshot;
+
+const INDEX_HTML: &str = include_str!("web.html");
+/// Requests are a request line and a few headers; anything longer is cut.
+const MAX_REQUEST_BYTES: u64 = 8 * 1024;
+const MAX_CLIENTS: usize = 16;
+const CLIENT_TIMEOUT: Duration = Duration::from_secs(10);
+
+static CLIENTS: AtomicUsize = AtomicUsize::new(0);
+
+/// Holds one of the `MAX_CLIENTS` slots until the connection is done.
+struct ClientSlot;
+
+impl ClientSlot {
+    fn take() -> Option<Self> {
+        CLIENTS
+            .fetch_update(Ordering::SeqCst, Ordering::SeqCst, |n| {
+                (n < MAX_CLIENTS).then_some(n + 1)
+            })
+            .ok()
+            .map(|_| Self)
+    }
+}
+
+impl Drop for ClientSlot {
+    fn drop(&mut self) {
+        CLIENTS.fetch_sub(1, Ordering::SeqCst);
+    }
+}
+
+pub fn start_web_server(latest_snapshot: SharedSnapshot) {
+    let listen = config().web.listen.clone();
+    if listen.is_empty() {
+        return;
+    }
+    std::thread::spawn(move || {
+        let listener = match TcpListener::bind(&listen) {
+            Ok(listener) => listener,
+            Err(err) => {
+                log::error(
+                    "bind web dashboard failed",
+                    &[("listen", &listen), ("err", &err)],
+                );
+                return;
+            }
+        };
+        let loopback = listener
+            .local_addr()
+            .is_ok_and(|addr| addr.ip().is_loopback());
+        if !loopback && config().web.token.is_empty() {
+            log::error(
+                "web dashboard needs a token to listen beyond localhost",
+                &[("listen", &listen)],
+            );
+            return;
+        }
+        for stream in listener.incoming() {
+            match stream {
+                Ok(mut stream) => {
+                    stream.set_write_timeout(Some(CLIENT_TIMEOUT)).ok();
+                    let Some(slot) = ClientSlot::take() else {
+                        respond(&mut stream, "503 Service Unavailable", "text/plain", "busy");
+                        continue;
+                    };
+                    let latest_snapshot = latest_snapshot.clone();
+                    std::thread::spawn(move || {
+                        let _slot = slot;
+                        handle_client(stream, &latest_snapshot);
+                    });
+                }
+                Err(err) => log::error("accept web dashboard failed", &[("err", &err)]),
+            }
+        }
+    });
+}
+
+fn handle_client(mut stream: TcpStream, latest_snapshot: &SharedSnapshot) {
+    stream.set_read_timeout(Some(CLIENT_TIMEOUT)).ok();
+    let Ok(read_stream) = stream.try_clone() else {
+        return;
+    };
+    let mut reader = BufReader::new(read_stream.take(MAX_REQUEST_BYTES));
+    let mut request_line = String::new();
+    if reader.read_line(&mut request_line).is_err() {
+        return;
+    }
+    loop {
+        let mut header = String::new();
+        match reader.read_line(&mut header) {
+            Ok(0) | Err(_) => break,
+            Ok(_) if header.trim().is_empty() => break,
+            Ok(_) => {}
+        }
+    }
+
+    let mut parts = request_line.split_whitespace();
+    let (Some(method), Some(uri)) = (parts.next(), parts.next()) else {
+        respond(&mut stream, "400 Bad Request", "text/plain", "bad request");
+        return;
+    };
+    if method != "GET" {
+        respond(
+            &mut stream,
+            "405 Method Not Allowed",
+            "text/plain",
+            "read-only",
+        );
+        return;
+    }
+    let (path, query) = uri.split_once('?').unwrap_or((uri, ""));
+    let query = parse_query(query);
+    let token = &config().web.token;
+    if !token.is_empty() && query.get("token") != Some(token) {
+        respond(
+            &mut stream,
+            "401 Unauthorized",
+            "text/plain",
+            "missing token",
+        );
+        return;
+    }
+
+    match path {
+        "/" => respond(
+            &mut stream,
+            "200 OK",
+            "text/html; charset=utf-8",
+            INDEX_HTML,
+        ),
+        "/api/panes" => {
+            let panes = latest_snapshot
+                .lock()
+                .ok()
+                .and_then(|snapshot| snapshot.clone())
+                .map(|snapshot| display_panes(&snapshot, &load_ui_state()))
+                .unwrap_or_default();
+            let body = serde_json::to_string(&panes).unwrap_or_else(|_| "[]".into());
+            respond(&mut stream, "200 OK", "application/json", &body);
+        }
+        "/api/preview" => {
+            let pane_id = query.get("pane").cloned().unwrap_or_default();
+            let known = latest_snapshot
+                .lock()
+                .ok()
+                .and_then(|snapshot| snapshot.clone())
+                .and_then(|snapshot| {
+                    snapshot
+                        .panes
+                        .into_iter()
+                        .find(|pane| pane.pane_key() == pane_id)
+                });
+            let Some(pane) = known else {
+                respond(&mut stream, "404 Not Found", "text/plain", "unknown pane");
+                return;
+            };
+            match capture_pane(&pane.target, 200) {
+                Ok(content) => respond(
+                    &mut stream,
+                    "200 OK",
+                    "text/plain; charset=utf-8",
+                    &strip_ansi(&content),
+                ),
+                Err(err) => respond(
+                    &mut stream,
+                    "502 Bad Gateway",
+                    "text/plain",
+                    &format!("{err:#}"),
+                ),
+            }
+        }
+        _ => respond(&mut stream, "404 Not Found", "text/plain", "not found"),
+    }
+}
+
+fn respond(stream: &mut TcpStream, status: &str, content_type: &str, body: &str) {
+    let _ = write!(
+        stream,
+        "HTTP/1.1 {status}\r\nContent-Type: {content_type}\r\nContent-Length: {}\r\nCache-Control: no-store\r\nConnection: close\r\n\r\n{body}",
+        body.len()
+    );
+}
+
+fn parse_query(query: &str) -> HashMap<String, String> {
+    query
+        .split('&')
+        .filter_map(|pair| {
+            let (key, value) = pair.split_once('=').unwrap_or((pair, ""));
+            (!key.is_empty()).then(|| (url_decode(key), url_decode(value)))
+        })
+        .collect()
+}
+
+fn url_decode(s: &str) -> String {
+    percent_decode(&s.replace('+', " "))
+}
+
+pub fn strip_ansi(s: &str) -> String {
+    static RE: OnceLock<Regex> = OnceLock::new();
+    RE.get_or_init(|| {
+        Regex::new(r"\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-_]")
+            .expect("valid ansi regex")
+    })
+    .replace_all(s, "")
+    .into_owned()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn decodes_query_parameters() {
+        let query = parse_query("pane=%2512&token=a+b&flag");
+
+        assert_eq!(query.get("pane").map(String::as_str), Some("%12"));
+        assert_eq!(query.get("token").map(String::as_str), Some("a b"));
+        assert_eq!(query.get("flag").map(String::as_str), Some(""));
+    }
+
+    #[test]
+    fn strips_ansi_sequences() {
+        assert_eq!(strip_ansi("\x1b[1;31mred\x1b[0m plain"), "red plain");
+    }
+}
@@ -0,0 +1,144 @@
+use std::collections::HashSet;
+use std::process::Command;
+
+use anyhow::{Context, Result, anyhow};
+use serde::Deserialize;
+
+use crate::agent::Pane;
+use crate::agent::backend::percent_decode;
+use crate::agent::exec::{COMMAND_TIMEOUT, RunExt};
+use crate::agent::provider::{ProcessTable, resolve};
+
+#[derive(Debug, Deserialize)]
+struct WeztermPane {
+    tab_id: u64,
+    pane_id: u64,
+    #[serde(default)]
+    workspace: String,
+    #[serde(default)]
+    title: String,
+    #[serde(default)]
+    cwd: String,
+    #[serde(default)]
+    is_active: bool,
+    #[serde(default)]
+    tty_name: Option<String>,
+}
+
+pub fn list_panes(pt: &ProcessTable) -> Vec<Pane> {
+    let _g = smelt_perf::perf::begin("wezterm.list_panes");
+    let Ok(out) = Command::new("wezterm")
+        .args(["cli", "list", "--format", "json"])
+        .output_within(COMMAND_TIMEOUT)
+    else {
+        return Vec::new();
+    };
+    if !out.status.success() {
+        return Vec::new();
+    }
+    let Ok(panes) = serde_json::from_slice::<Vec<WeztermPane>>(&out.stdout) else {
+        return Vec::new();
+    };
+    panes
+        .into_iter()
+        .filter_map(|p| {
+            let shell_pid = p.tty_name.as_deref().and_then(tty_shell_pid)?;
+            let cmd = pt.comm.get(&shell_pid).cloned().unwrap_or_default();
+            let matched = resolve(&cmd, shell_pid, pt)?;
+            let target = format!("wezterm:{}", p.pane_id);
+            Some(Pane {
+                pane_id: target.clone(),
+                target,
+                session: p.workspace,
+                window: p.tab_id.to_string(),
+                window_name: p.title,
+                pane: p.pane_id.to_string(),
+                path: path_from_cwd_url(&p.cwd),
+                pid: shell_pid,
+                provider_pid: matched.pid,
+                provider: matched.name,
+                window_active: p.is_active,
+                ..Pane::default()
+            })
+        })
+        .collect()
+}
+
+fn tty_shell_pid(tty: &str) -> Option<i32> {
+    let tty = tty.strip_prefix("/dev/").unwrap_or(tty);
+    let out = Command::new("ps")
+        .args(["-o", "pid=,ppid=", "-t", tty])
+        .output_within(COMMAND_TIMEOUT)
+        .ok()?;
+    let procs: Vec<(i32, i32)> = String::from_utf8_lossy(&out.stdout)
+        .lines()
+        .filter_map(|line| {
+            let mut fields = line.split_whitespace();
+            Some((fields.next()?.parse().ok()?, fields.next()?.parse().ok()?))
+        })
+        .collect();
+    let pids: HashSet<i32> = procs.iter().map(|(pid, _)| *pid).collect();
+    procs
+        .iter()
+        .find(|(_, ppid)| !pids.contains(ppid))
+        .map(|(pid, _)| *pid)
+}
+
+fn path_from_cwd_url(cwd: &str) -> String {
+    let Some(rest) = cwd.strip_prefix("file://") else {
+        return cwd.to_string();
+    };
+    let path = rest.find('/').map(|idx| &rest[idx..]).unwrap_or("/");
+    percent_decode(path)
+}
+
+pub fn capture_pane(id: &str, lines: usize, escapes: bool) -> Result<String> {
+    let mut cmd = Command::new("wezterm");
+    cmd.args(["cli", "get-text", "--pane-id", id])
+        .arg("--start-line")
+        .arg(format!("-{lines}"));
+    if escapes {
+        cmd.arg("--escapes");
+    }
+    let out = cmd
+        .output_within(COMMAND_TIMEOUT)
+        .with_context(|| format!("wezterm get-text {id}"))?;
+    if !out.status.success() {
+        return Err(anyhow!("wezterm get-text {id} exited with {}", out.status));
+    }
+    Ok(String::from_utf8_lossy(&out.stdout).into_owned())
+}
+
+pub fn switch_to_pane(id: &str) -> Result<()> {
+    run_wezterm(&["cli", "activate-pane", "--pane-id", id])
+}
+
+pub fn kill_pane(id: &str) -> Result<()> {
+    run_wezterm(&["cli", "kill-pane", "--pane-id", id])
+}
+
+fn run_wezterm(args: &[&str]) -> Result<()> {
+    let status = Command::new("wezterm")
+        .args(args)
+        .status_within(COMMAND_TIMEOUT)
+        .context("wezterm")?;
+    if status.success() {
+        Ok(())
+    } else {
+        Err(anyhow!("wezterm exited with {status}"))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_cwd_urls() {
+        assert_eq!(
+            path_from_cwd_url("file://devbox/home/me/my%20repo"),
+            "/home/me/my repo"
+        );
+        assert_eq!(path_from_cwd_url("/plain/path"), "/plain/path");
+    }
+}
@@ -0,0 +1,822 @@
+use std::io::{self, Write};
+use std::os::unix::process::CommandExt;
+
+use anyhow::{Result, anyhow, bail};
+use chrono::{DateTime, Local, Utc};
+use serde::Serialize;
+use serde_json::json;
+
+use crate::agent::cleanup;
+use crate::agent::config::config;
+use crate::agent::digest;
+use crate::agent::editor::open_workspace;
+use crate::agent::events::{StatusChange, status_changes};
+use crate::agent::journal;
+use crate::agent::layout::{self, Restored};
+use crate::agent::output;
+use crate::agent::persist::{load_heartbeat, load_snapshot, load_tasks, load_ui_state};
+use crate::agent::provider::providers;
+use crate::agent::record;
+use crate::agent::service::{install_service, uninstall_service};
+use crate::agent::simulate;
+use crate::agent::spawn::{self, Spawn};
+use crate::agent::tasks::{self, TaskState};
+use crate::agent::throttle::spawn_or_queue;
+use crate::agent::trigger::FinishAction;
+use crate::agent::{
+    Pane, PaneStatus, expand_home, format_age, ipc, stop_watch_process, switch_to_pane, watch,
+};
+use crate::agent::{tmux, transcript};
+
+#[derive(Debug, Default, PartialEq, Serialize)]
+struct StatusCounts {
+    busy: usize,
+    attention: usize,
+    unread: usize,
+    idle: usize,
+    error: usize,
+    disconnected: usize,
+}
+
+impl StatusCounts {
+    fn from_panes(panes: &[Pane]) -> Self {
+        let mut counts = Self::default();
+        for pane in panes.iter().filter(|pane| !pane.stashed) {
+            match pane.status {
+                PaneStatus::Busy => counts.busy += 1,
+                PaneStatus::NeedsAttention => counts.attention += 1,
+                PaneStatus::Unread => counts.unread += 1,
+                PaneStatus::Idle => counts.idle += 1,
+                PaneStatus::Error => counts.error += 1,
+                PaneStatus::Disconnected => counts.disconnected += 1,
+            }
+        }
+        counts
+    }
+}
+
+pub fn events(args: &[String]) -> Result<()> {
+    let follow = args.iter().any(|arg| arg == "--follow" || arg == "-f");
+    let json = args.iter().any(|arg| arg == "--json");
+
+    let mut out = io::stdout().lock();
+    let now = Utc::now();
+    for pane in ipc::load_panes() {
+        write_change(&mut out, &StatusChange::from_pane(&pane, None, now), json)?;
+    }
+    out.flush()?;
+    if !follow {
+        return Ok(());
+    }
+
+    ipc::follow_with(
+        |_, _| {},
+        |events| {
+            for change in status_changes(&events) {
+                if write_change(&mut out, change, json)
+                    .and_then(|()| out.flush())
+                    .is_err()
+                {
+                    std::process::exit(0);
+                }
+            }
+        },
+    )
+}
+
+fn write_change(out: &mut impl Write, change: &StatusChange, json: bool) -> io::Result<()> {
+    if json {
+        let line = serde_json::to_string(change).map_err(io::Error::other)?;
+        return writeln!(out, "{line}");
+    }
+    let from = change.from.map(|status| status.as_str()).unwrap_or("new");
+    writeln!(
+        out,
+        "{} {} {} {} -> {} {}",
+        change.at.with_timezone(&Local).format("%Y-%m-%d %H:%M:%S"),
+        change.target,
+        change.provider,
+        from,
+        change.to.as_str(),
+        change.path
+    )
+}
+
+pub fn prompt_segment(args: &[String]) -> Result<()> {
+    let Some(snapshot) = load_snapshot() else {
+        return Ok(());
+    };
+    let counts = StatusCounts::from_panes(&ipc::display_panes(&snapshot, &load_ui_state()));
+    if args.iter().any(|arg| arg == "--json") {
+        println!("{}", serde_json::to_string(&counts)?);
+    } else {
+        println!(
+            "busy={} attention={} unread={}",
+            counts.busy, counts.attention, counts.unread
+        );
+    }
+    Ok(())
+}
+
+pub fn list(args: &[String]) -> Result<()> {
+    let format = flag_value(args, "--format").unwrap_or("text");
+    let panes = ipc::load_panes();
+    match format {
+        "text" => {
+            for pane in &panes {
+                println!(
+                    "{}\t{}\t{}\t{}",
+                    pane.target,
+                    pane.status.as_str(),
+                    pane.provider,
+                    pane.path
+                );
+            }
+        }
+        "json" => println!("{}", serde_json::to_string(&panes)?),
+        "alfred" => println!("{}", alfred_items(&panes)),
+        other => bail!("unknown list format {other}"),
+    }
+    Ok(())
+}
+
+pub fn switch(args: &[String]) -> Result<()> {
+    switch_to_pane(&find_pane(args)?.target)
+}
+
+/// Opens a pane's workspace in the editor. `--editor` names the default
+/// action; `--files` also opens the files the agent modified.
+pub fn open(args: &[String]) -> Result<()> {
+    let mut with_files = false;
+    for arg in args.iter().filter(|arg| arg.starts_with('-')) {
+        match arg.as_str() {
+            "--editor" => {}
+            "--files" => with_files = true,
+            _ => bail!("usage: agent-mux open <target> [--editor] [--files]"),
+        }
+    }
+    open_workspace(&find_pane(args)?, with_files, false)
+}
+
+pub fn mark_read(args: &[String]) -> Result<()> {
+    ipc::set_pane_manual_status(&find_pane(args)?, PaneStatus::Idle)
+}
+
+pub fn spawn(args: &[String]) -> Result<()> {
+    const FLAGS: [&str; 5] = ["--template", "--provider", "--dir", "--prompt", "--name"];
+    let mut positional = Vec::new();
+    let mut iter = args.iter();
+    while let Some(arg) = iter.next() {
+        if FLAGS.contains(&arg.as_str()) {
+            iter.next();
+        } else if arg.starts_with("--") {
+            bail!("unknown flag {arg}");
+        } else {
+            positional.push(arg.as_str());
+        }
+    }
+    let arg = positional.join(" ");
+    let mut request = match flag_value(args, "--template") {
+        Some(name) => Spawn::from_template(name, &arg)?,
+        None => Spawn {
+            command: "claude".to_string(),
+            directory: std::env::current_dir()?.to_string_lossy().into_owned(),
+            prompt: arg,
+            ..Spawn::default()
+        },
+    };
+    if let Some(provider) = flag_value(args, "--provider") {
+        request.command = provider.to_string();
+    }
+    if let Some(dir) = flag_value(args, "--dir") {
+        request.directory = expand_home(dir);
+    }
+    if let Some(prompt) = flag_value(args, "--prompt") {
+        request.prompt = prompt.to_string();
+    }
+    if let Some(name) = flag_value(args, "--name") {
+        request.window_name = name.to_string();
+    }
+    match spawn_or_queue(&request, &ipc::load_panes())? {
+        Some(pane_id) => println!("{pane_id}"),
+        None => println!("queued: concurrency limit"),
+    }
+    Ok(())
+}
+
+pub fn on_finish(args: &[String]) -> Result<()> {
+    let pane = find_pane(args.get(..1).unwrap_or_default())?;
+    match args.get(1).map(String::as_str) {
+        None => {
+            for action in &pane.on_finish {
+                println!("{action}");
+            }
+            Ok(())
+        }
+        Some("--clear") => ipc::set_finish_action(&pane, None),
+        Some(_) => ipc::set_finish_action(&pane, Some(FinishAction::parse(&args[1..].join(" "))?)),
+    }
+}
+
+pub fn alert(args: &[String]) -> Result<()> {
+    let pane = find_pane(args.get(..1).unwrap_or_default())?;
+    match args.get(1).map(String::as_str) {
+        None => {
+            for pattern in &pane.alerts {
+                println!("{pattern}");
+            }
+            Ok(())
+        }
+        Some("--clear") => ipc::set_pane_alert(&pane, None),
+        Some(_) => {
+            let pattern = args[1..].join(" ");
+            regex::Regex::new(&pattern)?;
+            ipc::set_pane_alert(&pane, Some(&pattern))
+        }
+    }
+}
+
+pub fn broadcast(args: &[String]) -> Result<()> {
+    let mut workspace = None;
+    let mut pane_keys = Vec::new();
+    let mut all = false;
+    let mut words = Vec::new();
+    let mut iter = args.iter();
+    while let Some(arg) = iter.next() {
+        match arg.as_str() {
+            "--workspace" => workspace = iter.next().map(|dir| expand_home(dir)),
+            "--pane" => pane_keys.extend(iter.next().cloned()),
+            "--all" => all = true,
+            _ => words.push(arg.as_str()),
+        }
+    }
+    let prompt = words.join(" ");
+    if prompt.trim().is_empty() {
+        bail!("missing prompt");
+    }
+    if workspace.is_none() && pane_keys.is_empty() && !all {
+        bail!("choose panes with --workspace <dir>, --pane <target>, or --all");
+    }
+    let workspace = workspace.map(|dir| dir.trim_end_matches('/').to_string());
+    let panes: Vec<Pane> = ipc::load_panes()
+        .into_iter()
+        .filter(|pane| !pane.terminated)
+        .filter(|pane| {
+            all || pane_keys
+                .iter()
+                .any(|key| *key == pane.pane_id || *key == pane.target)
+                || workspace
+                    .as_ref()
+                    .is_some_and(|dir| *dir == pane.project_root || *dir == pane.path)
+        })
+        .collect();
+    if panes.is_empty() {
+        bail!("no agent panes matched");
+    }
+    for pane in &panes {
+        ipc::queue_prompt(pane, prompt.trim())?;
+        println!("{}", pane.target);
+    }
+    Ok(())
+}
+
+pub fn snapshot(args: &[String]) -> Result<()> {
+    match (args.first().map(String::as_str), args.get(1)) {
+        (Some("save"), Some(name)) => {
+            let count = layout::save(name)?;
+            println!("saved {count} agents to {name}");
+        }
+        (Some("restore"), Some(name)) => {
+            for restored in layout::restore(name)? {
+                match restored {
+                    Restored::Started { target, pane_id } => {
+                        println!("started  {target} ({pane_id})")
+                    }
+                    Restored::AlreadyRunning { target } => println!("running  {target}"),
+                    Restored::Queued { target } => println!("queued   {target}"),
+                }
+            }
+        }
+        (Some("list"), None) | (None, None) => {
+            for name in layout::list() {
+                println!("{name}");
+            }
+        }
+        _ => bail!("usage: agent-mux snapshot save|restore <name> | list"),
+    }
+    Ok(())
+}
+
+pub fn history(args: &[String]) -> Result<()> {
+    let workspace = match args.iter().find(|arg| !arg.starts_with("--")) {
+        Some(dir) => Some(expand_home(dir)),
+        None if args.iter().any(|arg| arg == "--all") => None,
+        None => Some(std::env::current_dir()?.to_string_lossy().into_owned()),
+    };
+    let mut sessions = transcript::sessions(workspace.as_deref());
+    let json = args.iter().any(|arg| arg == "--json");
+    let commits = args.iter().any(|arg| arg == "--commits");
+    if json || commits {
+        transcript::attach_commits(&mut sessions);
+    }
+    if json {
+        println!("{}", serde_json::to_string(&sessions)?);
+        return Ok(());
+    }
+    for session in &sessions {
+        println!(
+            "{}\t{}\t{}\t{}\t{}",
+            local_time(session.updated_at),
+            session.messages,
+            session.id,
+            session.path,
+            session.first_prompt
+        );
+        for commit in &session.commits {
+            println!("  {} {}", commit.hash, commit.subject);
+        }
+    }
+    Ok(())
+}
+
+pub fn resume(args: &[String]) -> Result<()> {
+    let Some(id) = args.first() else {
+        bail!("usage: agent-mux resume <session-id>");
+    };
+    let session = transcript::find(id).ok_or_else(|| anyhow!("no session {id}"))?;
+    println!("{}", spawn::spawn(&Spawn::resume(&session)?)?);
+    Ok(())
+}
+
+pub fn export(args: &[String]) -> Result<()> {
+    let Some(key) = args.first().filter(|arg| !arg.starts_with("--")) else {
+        bail!("usage: agent-mux export <pane|session-id> [--output <file>]");
+    };
+    let session = match ipc::load_panes()
+        .into_iter()
+        .find(|pane| &pane.pane_id == key || &pane.target == key)
+    {
+        Some(pane) => transcript::latest(&pane.provider, &pane.path)
+            .ok_or_else(|| anyhow!("no {} transcript for {}", pane.provider, pane.target))?,
+        None => transcript::find(key).ok_or_else(|| anyhow!("no pane or session {key}"))?,
+    };
+    let markdown = transcript::markdown(&session)?;
+    match flag_value(args, "--output") {
+        Some(file) => std::fs::write(expand_home(file), markdown)?,
+        None => print!("{markdown}"),
+    }
+    Ok(())
+}
+
+/// Prints the digest of the last day, or sends it now with `--send`.
+pub fn digest(args: &[String]) -> Result<()> {
+    let since = Utc::now() - chrono::Duration::days(1);
+    if args.iter().any(|arg| arg == "--send") {
+        return digest::send(since);
+    }
+    println!("{}\n", digest::subject());
+    print!("{}", digest::digest(&journal::since(since)));
+    Ok(())
+}
+
+/// Runs a fake agent in this terminal. Its command line names the provider
+/// it stands in for, which is how panes are matched to providers.
+pub fn simulate(args: &[String]) -> Result<()> {
+    let Some(provider) = args.first().filter(|arg| !arg.starts_with("--")) else {
+        let err = std::process::Command::new(std::env::current_exe()?)
+            .args(["simulate", "claude"])
+            .args(args)
+            .exec();
+        return Err(err.into());
+    };
+    if !providers().any(|name| name == provider) {
+        bail!("unknown provider {provider}");
+    }
+    let script = flag_value(args, "--script").unwrap_or(simulate::DEFAULT_SCRIPT);
+    simulate::run(script, args.iter().any(|arg| arg == "--once"))
+}
+
+/// The sink tmux `pipe-pane` runs for output logging; not meant to be run
+/// by hand.
+pub fn pipe_log(args: &[String]) -> Result<()> {
+    let Some(file) = args.first() else {
+        bail!("usage: agent-mux pipe-log <file>");
+    };
+    output::sink(std::path::Path::new(file))
+}
+
+/// The sink tmux `pipe-pane` runs while a pane is being recorded.
+pub fn pipe_cast(args: &[String]) -> Result<()> {
+    let Some(file) = args.first() else {
+        bail!("usage: agent-mux pipe-cast <file>");
+    };
+    record::sink(std::path::Path::new(file))
+}
+
+pub fn record(args: &[String]) -> Result<()> {
+    let Some(key) = args.first().filter(|arg| !arg.starts_with("--")) else {
+        bail!("usage: agent-mux record <pane> [--stop]");
+    };
+    let pane = ipc::load_panes()
+        .into_iter()
+        .find(|pane| &pane.pane_id == key || &pane.target == key)
+        .ok_or_else(|| anyhow!("no pane {key}"))?;
+    let stop = args.iter().any(|arg| arg == "--stop");
+    if stop != tmux::recording_file(&pane.pane_id).is_some() {
+        bail!(
+            "{} is {}",
+            pane.target,
+            if stop {
+                "not being recorded"
+            } else {
+                "already being recorded"
+            }
+        );
+    }
+    let (file, _) = record::toggle(&pane)?;
+    println!("{}", file.display());
+    Ok(())
+}
+
+pub fn search(args: &[String]) -> Result<()> {
+    let query = args
+        .iter()
+        .filter(|arg| !arg.starts_with("--"))
+        .cloned()
+        .collect::<Vec<_>>()
+        .join(" ");
+    if query.trim().is_empty() {
+        bail!("usage: agent-mux search <text> [--json]");
+    }
+    let hits = transcript::search(&query);
+    if args.iter().any(|arg| arg == "--json") {
+        println!("{}", serde_json::to_string(&hits)?);
+        return Ok(());
+    }
+    for hit in &hits {
+        let session = &hit.session;
+        println!(
+            "{}\t{}\t{}\t{}\t{}",
+            local_time(session.updated_at),
+            session.provider,
+            session.id,
+            session.path,
+            hit.snippet
+        );
+    }
+    Ok(())
+}
+
+fn local_time(at: Option<DateTime<Utc>>) -> String {
+    at.map(|at| {
+        at.with_timezone(&Local)
+            .format("%Y-%m-%d %H:%M")
+            .to_string()
+    })
+    .unwrap_or_default()
+}
+
+pub fn cleanup(args: &[String]) -> Result<()> {
+    let policy = config().cleanup;
+    if policy.idle_hours == 0 {
+        bail!("cleanup is disabled; set cleanup.idleHours in the config");
+    }
+    let kill = args.iter().any(|arg| arg == "--kill");
+    let now = Utc::now();
+    let panes = ipc::load_panes();
+    let eligible = cleanup::candidates(&panes, policy, now);
+    for pane in &eligible {
+        let idle = pane
+            .last_active
+            .map(|at| format_age((now - at).num_seconds()))
+            .unwrap_or_default();
+        println!(
+            "{}\t{}\t{}\t{idle}\t{}",
+            pane.target,
+            pane.status.as_str(),
+            pane.provider,
+            pane.path
+        );
+    }
+    if !kill {
+        if !eligible.is_empty() {
+            eprintln!(
+                "{} panes eligible for cleanup; run with --kill to close them",
+                eligible.len()
+            );
+        }
+        return Ok(());
+    }
+    for pane in eligible {
+        ipc::kill_pane(&pane.target)?;
+    }
+    Ok(())
+}
+
+pub fn queue(args: &[String]) -> Result<()> {
+    let pane = find_pane(args.get(..1).unwrap_or_default())?;
+    let prompt = args[1..].join(" ");
+    if prompt.trim().is_empty() {
+        bail!("missing prompt");
+    }
+    ipc::queue_prompt(&pane, prompt.trim())
+}
+
+pub fn task(args: &[String]) -> Result<()> {
+    match args.first().map(String::as_str) {
+        Some("add") => {
+            let mut directory = None;
+            let mut words = Vec::new();
+            let mut iter = args[1..].iter();
+            while let Some(arg) = iter.next() {
+                match arg.as_str() {
+                    "--dir" => directory = iter.next().map(|dir| expand_home(dir)),
+                    _ => words.push(arg.as_str()),
+                }
+            }
+            let directory = match directory {
+                Some(dir) => dir,
+                None => std::env::current_dir()?.to_string_lossy().into_owned(),
+            };
+            let task = tasks::add(&words.join(" "), directory.trim_end_matches('/'))?;
+            println!("{}", task.id);
+            Ok(())
+        }
+        Some("new") => {
+            let mut directory = None;
+            let mut template = None;
+            let mut words = Vec::new();
+            let mut iter = args[1..].iter();
+            while let Some(arg) = iter.next() {
+                match arg.as_str() {
+                    "--dir" => directory = iter.next().map(|dir| expand_home(dir)),
+                    "--template" => template = iter.next().map(String::as_str),
+                    _ => words.push(arg.as_str()),
+                }
+            }
+            let directory = match directory {
+                Some(dir) => dir,
+                None => std::env::current_dir()?.to_string_lossy().into_owned(),
+            };
+            let task = tasks::start_in_worktree(&words.join(" "), &directory, template)?;
+            if task.pane_id.is_empty() {
+                eprintln!(
+                    "task {} on {} in {}, queued by the concurrency limit",
+                    task.id, task.branch, task.workspace
+                );
+            } else {
+                println!("{}", task.pane_id);
+                eprintln!("task {} on {} in {}", task.id, task.branch, task.workspace);
+            }
+            Ok(())
+        }
+        Some("list") | None => {
+            let tasks = load_tasks();
+            if args.iter().any(|arg| arg == "--json") {
+                println!("{}", serde_json::to_string(&tasks)?);
+                return Ok(());
+            }
+            for task in &tasks {
+                println!(
+                    "{}\t{}\t{}\t{}",
+                    task.id,
+                    task.state.as_str(),
+                    task.workspace,
+                    task.prompt.lines().next().unwrap_or_default()
+                );
+            }
+            let open = tasks.iter().filter(|task| task.state.is_open()).count();
+            let failed = tasks
+                .iter()
+                .filter(|task| task.state == TaskState::Failed)
+                .count();
+            eprintln!(
+                "{} of {} done, {open} open, {failed} failed",
+                tasks.len() - open - failed,
+                tasks.len()
+            );
+            Ok(())
+        }
+        Some("cancel") => {
+            let Some(id) = args.get(1).and_then(|id| id.parse().ok()) else {
+                bail!("usage: agent-mux task cancel <id>");
+            };
+            tasks::cancel(id)
+        }
+        Some("clear") => tasks::clear_finished(),
+        Some(other) => bail!("unknown task command {other}"),
+    }
+}
+
+#[derive(Debug, Serialize)]
+#[serde(rename_all = "camelCase")]
+struct WatchStatus {
+    running: bool,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pid: Option<u32>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    started_at: Option<DateTime<Utc>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    last_refresh_at: Option<DateTime<Utc>>,
+    #[serde(skip_serializing_if = "String::is_empty")]
+    last_error: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    last_error_at: Option<DateTime<Utc>>,
+}
+
+pub fn watch(args: &[String]) -> Result<()> {
+    match args.first().map(String::as_str) {
+        Some("status") => watch_status(&args[1..]),
+        Some("stop") => watch_stop(),
+        Some("install-service") => {
+            let file = install_service()?;
+            println!("installed and started {}", file.display());
+            Ok(())
+        }
+        Some("uninstall-service") => {
+            let file = uninstall_service()?;
+            println!("removed {}", file.display());
+            Ok(())
+        }
+        _ => bail!(
+            "usage: agent-mux watch [status [--json] | stop | install-service | uninstall-service]"
+        ),
+    }
+}
+
+fn watch_status(args: &[String]) -> Result<()> {
+    let pid = watch::running_pid();
+    let heartbeat = load_heartbeat().unwrap_or_default();
+    let running = pid.is_some() || watch::is_running();
+    let status = WatchStatus {
+        running,
+        pid,
+        started_at: heartbeat.started_at.filter(|_| running),
+        last_refresh_at: heartbeat.last_refresh_at,
+        last_error: heartbeat.last_error,
+        last_error_at: heartbeat.last_error_at,
+    };
+    if args.iter().any(|arg| arg == "--json") {
+        println!("{}", serde_json::to_string(&status)?);
+    } else {
+        print!("{}", format_watch_status(&status, Utc::now()));
+    }
+    if !running {
+        std::process::exit(1);
+    }
+    Ok(())
+}
+
+fn format_watch_status(status: &WatchStatus, now: DateTime<Utc>) -> String {
+    let ago = |t: Option<DateTime<Utc>>| match t {
+        Some(t) => format!("{} ago", format_age((now - t).num_seconds())),
+        None => "never".to_string(),
+    };
+    let mut out = match status.pid {
+        Some(pid) => format!("watcher      running (pid {pid})\n"),
+        None if status.running => "watcher      running\n".to_string(),
+        None => "watcher      not running\n".to_string(),
+    };
+    if let Some(started_at) = status.started_at {
+        out.push_str(&format!(
+            "uptime       {}\n",
+            format_age((now - started_at).num_seconds())
+        ));
+    }
+    out.push_str(&format!("last refresh {}\n", ago(status.last_refresh_at)));
+    if status.last_error.is_empty() {
+        out.push_str("last error   none\n");
+    } else {
+        out.push_str(&format!(
+            "last error   {} ({})\n",
+            status.last_error,
+            ago(status.last_error_at)
+        ));
+    }
+    out
+}
+
+fn watch_stop() -> Result<()> {
+    if !watch::is_running() {
+        println!("watcher is not running");
+        return Ok(());
+    }
+    stop_watch_process();
+    for _ in 0..40 {
+        if !watch::is_running() {
+            println!("watcher stopped");
+            return Ok(());
+        }
+        std::thread::sleep(std::time::Duration::from_millis(50));
+    }
+    bail!("watcher did not stop within 2s")
+}
+
+fn find_pane(args: &[String]) -> Result<Pane> {
+    let key = args
+        .iter()
+        .find(|arg| !arg.starts_with('-'))
+        .ok_or_else(|| anyhow!("missing pane target"))?;
+    ipc::load_panes()
+        .into_iter()
+        .find(|pane| &pane.pane_id == key || &pane.target == key)
+        .ok_or_else(|| anyhow!("no agent pane {key}"))
+}
+
+fn flag_value<'a>(args: &'a [String], flag: &str) -> Option<&'a str> {
+    args.iter()
+        .position(|arg| arg == flag)
+        .and_then(|idx| args.get(idx + 1))
+        .map(String::as_str)
+}
+
+fn alfred_items(panes: &[Pane]) -> serde_json::Value {
+    let items: Vec<_> = panes
+        .iter()
+        .filter(|pane| !pane.stashed)
+        .map(|pane| {
+            let name = if pane.project_short.is_empty() {
+                &pane.short_path
+            } else {
+                &pane.project_short
+            };
+            let branch = if pane.git_branch.is_empty() {
+                String::new()
+            } else {
+                format!(" [{}]", pane.git_branch)
+            };
+            json!({
+                "uid": pane.pane_id,
+                "title": format!("{name}{branch} — {}", pane.status.as_str()),
+                "subtitle": format!("{} · {} · {}", pane.target, pane.provider, pane.path),
+                "arg": pane.target,
+                "autocomplete": name,
+                "match": format!("{name} {} {} {}", pane.provider, pane.target, pane.git_branch),
+                "variables": { "action": "switch" },
+                "mods": {
+                    "cmd": {
+                        "arg": pane.target,
+                        "subtitle": "Mark as read",
+                        "variables": { "action": "mark-read" },
+                    },
+                },
+            })
+        })
+        .collect();
+    json!({ "items": items })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn pane(status: PaneStatus, stashed: bool) -> Pane {
+        let mut pane = Pane::default();
+        pane.status = status;
+        pane.stashed = stashed;
+        pane
+    }
+
+    #[test]
+    fn counts_statuses_of_visible_panes() {
+        let counts = StatusCounts::from_panes(&[
+            pane(PaneStatus::Busy, false),
+            pane(PaneStatus::NeedsAttention, false),
+            pane(PaneStatus::Unread, false),
+            pane(PaneStatus::Unread, true),
+        ]);
+
+        assert_eq!(
+            counts,
+            StatusCounts {
+                busy: 1,
+                attention: 1,
+                unread: 1,
+                idle: 0,
+                error: 0,
+                disconnected: 0,
+            }
+        );
+    }
+
+    #[test]
+    fn formats_watch_status() {
+        let now = Utc::now();
+        let status = WatchStatus {
+            running: true,
+            pid: Some(42),
+            started_at: Some(now - chrono::Duration::hours(3)),
+            last_refresh_at: Some(now - chrono::Duration::seconds(2)),
+            last_error: "tmux list-panes exited with 1".to_string(),
+            last_error_at: Some(now - chrono::Duration::minutes(5)),
+        };
+
+        assert_eq!(
+            format_watch_status(&status, now),
+            "watcher      running (pid 42)\n\
+             uptime       3h\n\
+             last refresh 2s ago\n\
+             last error   tmux list-panes exited with 1 (5m ago)\n"
+        );
+    }
+}
@@ -0,0 +1,28 @@
+//! Finds the AI coding agents running in tmux, kitty and WezTerm panes and
+//! tells what each one is doing.
+//!
+//! ```no_run
+//! # fn main() -> anyhow::Result<()> {
+//! let mut reconciler = agent_mux::Reconciler::new();
+//! loop {
+//!     let mut panes = agent_mux::list_panes()?;
+//!     reconciler.reconcile(&mut panes);
+//!     for pane in &panes {
+//!         println!("{} {} {}", pane.target, pane.provider, pane.status.as_str());
+//!     }
+//!     std::thread::sleep(std::time::Duration::from_secs(1));
+//! }
+//! # }
+//! ```
+//!
+//! The re-exports below are the whole public API. The `agent` module is
+//! what the `agent-mux` binary is built from; it is hidden from the docs and
+//! may change between releases.
+
+#[doc(hidden)]
+pub mod agent;
+
+pub use agent::provider::providers;
+pub use agent::{
+    Pane, PaneStatus, Reconciler, kill_pane, list_panes, list_panes_fast, switch_to_pane,
+};
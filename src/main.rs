@@ -1,19 +1,61 @@
-mod agent;
+mod cli;
+mod rpc;
 mod tui;
 
 #[global_allocator]
 static ALLOC: smelt_perf::alloc::Counting = smelt_perf::alloc::Counting;
 
+use agent_mux::agent;
 use anyhow::{Result, bail};
 
 fn main() -> Result<()> {
-    if std::env::var_os("TMUX").is_none() {
-        bail!("agent-mux must be run inside tmux");
+    agent::crash::install();
+    let args = agent::log::init_from_args(std::env::args().skip(1).collect())?;
+    if let Err(err) = agent::config::load_config() {
+        agent::log::error("invalid config", &[("err", &format!("{err:#}"))]);
+        return Err(err);
+    }
+    match args.first().map(String::as_str) {
+        Some("rpc") => return rpc::run(args.iter().any(|arg| arg == "--read-only")),
+        Some("events") => return cli::events(&args[1..]),
+        Some("prompt-segment") => return cli::prompt_segment(&args[1..]),
+        Some("list") => return cli::list(&args[1..]),
+        Some("switch") => return cli::switch(&args[1..]),
+        Some("mark-read") => return cli::mark_read(&args[1..]),
+        Some("queue") => return cli::queue(&args[1..]),
+        Some("task") => return cli::task(&args[1..]),
+        Some("broadcast") => return cli::broadcast(&args[1..]),
+        Some("spawn") => return cli::spawn(&args[1..]),
+        Some("on-finish") => return cli::on_finish(&args[1..]),
+        Some("alert") => return cli::alert(&args[1..]),
+        Some("snapshot") => return cli::snapshot(&args[1..]),
+        Some("cleanup") => return cli::cleanup(&args[1..]),
+        Some("open") => return cli::open(&args[1..]),
+        Some("history") => return cli::history(&args[1..]),
+        Some("search") => return cli::search(&args[1..]),
+        Some("resume") => return cli::resume(&args[1..]),
+        Some("export") => return cli::export(&args[1..]),
+        Some("digest") => return cli::digest(&args[1..]),
+        Some("simulate") => return cli::simulate(&args[1..]),
+        Some("pipe-log") => return cli::pipe_log(&args[1..]),
+        Some("record") => return cli::record(&args[1..]),
+        Some("pipe-cast") => return cli::pipe_cast(&args[1..]),
+        Some("watch")
+            if matches!(
+                args.get(1).map(String::as_str),
+                Some("status" | "stop" | "install-service" | "uninstall-service")
+            ) =>
+        {
+            return cli::watch(&args[1..]);
+        }
+        _ => {}
     }
 
-    let args: Vec<String> = std::env::args().skip(1).collect();
     if args.iter().any(|arg| arg == "watch") {
-        return agent::watch::run();
+        return agent::watch::run(agent::watch::WatchOptions {
+            verbose: args.iter().any(|arg| arg == "--verbose"),
+            dry_run: args.iter().any(|arg| arg == "--dry-run"),
+        });
     }
     if args.iter().any(|arg| arg == "refresh") {
         return agent::watch::refresh_once();
@@ -26,10 +68,23 @@ fn main() -> Result<()> {
         return run_bench(&args);
     }
 
+    if agent::config::config().backend_enabled("tmux") && std::env::var_os("TMUX").is_none() {
+        bail!("agent-mux must be run inside tmux");
+    }
+
     let tmux = std::env::var("TMUX").unwrap_or_default();
     let session_id = tmux.rsplit('/').next().unwrap_or(&tmux).to_string();
-    let _ = agent::start_watch();
-    tui::run(session_id)
+    if let Err(err) = agent::start_watch() {
+        agent::log::warn("start watcher failed", &[("err", &format!("{err:#}"))]);
+    }
+    tui::run(
+        session_id,
+        tui::SidebarOptions {
+            read_only: args.iter().any(|arg| arg == "--read-only"),
+            inline: args.iter().any(|arg| arg == "--inline"),
+            accessible: args.iter().any(|arg| arg == "--accessible"),
+        },
+    )
 }
 
 fn run_bench(args: &[String]) -> Result<()> {
@@ -0,0 +1,247 @@
+use std::io::{self, BufRead, Write};
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{Arc, Mutex};
+use std::thread;
+
+use anyhow::{Result, anyhow};
+use chrono::{DateTime, Utc};
+use serde::Deserialize;
+use serde_json::{Value, json};
+
+use crate::agent::config::config;
+use crate::agent::events::Event;
+use crate::agent::ipc;
+use crate::agent::{Pane, PaneStatus, capture_pane, switch_to_pane};
+
+const PARSE_ERROR: i64 = -32700;
+const METHOD_NOT_FOUND: i64 = -32601;
+const INVALID_PARAMS: i64 = -32602;
+const SERVER_ERROR: i64 = -32000;
+
+type Output = Arc<Mutex<io::Stdout>>;
+
+#[derive(Debug, Deserialize)]
+struct RpcRequest {
+    #[serde(default)]
+    id: Option<Value>,
+    method: String,
+    #[serde(default)]
+    params: Value,
+}
+
+#[derive(Debug, Default, Deserialize)]
+#[serde(rename_all = "camelCase", default)]
+struct PaneParams {
+    pane_id: String,
+    target: String,
+    lines: Option<usize>,
+    stashed: Option<bool>,
+    text: String,
+}
+
+struct RpcError {
+    code: i64,
+    message: String,
+}
+
+impl From<anyhow::Error> for RpcError {
+    fn from(err: anyhow::Error) -> Self {
+        Self {
+            code: SERVER_ERROR,
+            message: format!("{err:#}"),
+        }
+    }
+}
+
+/// Methods a read-only client may still call.
+const READ_METHODS: &[&str] = &[
+    "panes.list",
+    "panes.get",
+    "subscribe",
+    "unsubscribe",
+    "pane.capture",
+    "pane.switch",
+];
+
+pub fn run(read_only: bool) -> Result<()> {
+    let read_only = read_only || config().read_only;
+    let out: Output = Arc::new(Mutex::new(io::stdout()));
+    let subscribed = Arc::new(AtomicBool::new(false));
+    let mut watching = false;
+
+    for line in io::stdin().lock().lines() {
+        let line = line?;
+        if line.trim().is_empty() {
+            continue;
+        }
+        let request = match serde_json::from_str::<RpcRequest>(&line) {
+            Ok(request) => request,
+            Err(err) => {
+                write_message(
+                    &out,
+                    &error_message(Value::Null, PARSE_ERROR, &err.to_string()),
+                );
+                continue;
+            }
+        };
+        if request.method == "subscribe" && !watching {
+            spawn_subscription(out.clone(), subscribed.clone());
+            watching = true;
+        }
+        let result = if read_only && !READ_METHODS.contains(&request.method.as_str()) {
+            Err(RpcError {
+                code: SERVER_ERROR,
+                message: format!("{} is not allowed in read-only mode", request.method),
+            })
+        } else {
+            handle(&request, &subscribed)
+        };
+        let Some(id) = request.id else {
+            continue;
+        };
+        let message = match result {
+            Ok(result) => json!({ "jsonrpc": "2.0", "id": id, "result": result }),
+            Err(err) => error_message(id, err.code, &err.message),
+        };
+        write_message(&out, &message);
+    }
+    Ok(())
+}
+
+fn handle(request: &RpcRequest, subscribed: &AtomicBool) -> Result<Value, RpcError> {
+    match request.method.as_str() {
+        "panes.list" => Ok(json!(ipc::load_panes())),
+        "panes.get" => Ok(json!(find_pane(&params(request)?)?)),
+        "subscribe" => {
+            subscribed.store(true, Ordering::SeqCst);
+            Ok(Value::Bool(true))
+        }
+        "unsubscribe" => {
+            subscribed.store(false, Ordering::SeqCst);
+            Ok(Value::Bool(true))
+        }
+        "pane.capture" => {
+            let params = params(request)?;
+            let pane = find_pane(&params)?;
+            let content = capture_pane(&pane.target, params.lines.unwrap_or(50))?;
+            Ok(json!({ "paneId": pane.pane_id, "content": content }))
+        }
+        "pane.switch" => {
+            switch_to_pane(&find_pane(&params(request)?)?.target)?;
+            Ok(Value::Bool(true))
+        }
+        "pane.kill" => {
+            ipc::kill_pane(&find_pane(&params(request)?)?.target)?;
+            Ok(Value::Bool(true))
+        }
+        "pane.stash" => {
+            let params = params(request)?;
+            ipc::set_pane_stashed(&find_pane(&params)?, params.stashed.unwrap_or(true))?;
+            Ok(Value::Bool(true))
+        }
+        "pane.markRead" => {
+            ipc::set_pane_manual_status(&find_pane(&params(request)?)?, PaneStatus::Idle)?;
+            Ok(Value::Bool(true))
+        }
+        "pane.queue" => {
+            let params = params(request)?;
+            if params.text.trim().is_empty() {
+                return Err(RpcError {
+                    code: INVALID_PARAMS,
+                    message: "missing text".to_string(),
+                });
+            }
+            ipc::queue_prompt(&find_pane(&params)?, params.text.trim())?;
+            Ok(Value::Bool(true))
+        }
+        "pane.markUnread" => {
+            ipc::set_pane_manual_status(&find_pane(&params(request)?)?, PaneStatus::Unread)?;
+            Ok(Value::Bool(true))
+        }
+        method => Err(RpcError {
+            code: METHOD_NOT_FOUND,
+            message: format!("unknown method {method}"),
+        }),
+    }
+}
+
+fn params(request: &RpcRequest) -> Result<PaneParams, RpcError> {
+    if request.params.is_null() {
+        return Ok(PaneParams::default());
+    }
+    serde_json::from_value(request.params.clone()).map_err(|err| RpcError {
+        code: INVALID_PARAMS,
+        message: err.to_string(),
+    })
+}
+
+fn find_pane(params: &PaneParams) -> Result<Pane, RpcError> {
+    if params.pane_id.is_empty() && params.target.is_empty() {
+        return Err(RpcError {
+            code: INVALID_PARAMS,
+            message: "paneId or target is required".into(),
+        });
+    }
+    ipc::load_panes()
+        .into_iter()
+        .find(|pane| {
+            (!params.pane_id.is_empty() && pane.pane_id == params.pane_id)
+                || (!params.target.is_empty() && pane.target == params.target)
+        })
+        .ok_or_else(|| anyhow!("pane not found").into())
+}
+
+fn spawn_subscription(out: Output, subscribed: Arc<AtomicBool>) {
+    thread::spawn(move || {
+        let mut last: Option<(u64, Option<DateTime<Utc>>)> = None;
+        ipc::follow_with(
+            |snapshot, ui_state| {
+                let version = (snapshot.generation, ui_state.updated_at);
+                let unchanged = last == Some(version);
+                last = Some(version);
+                if unchanged || !subscribed.load(Ordering::SeqCst) {
+                    return;
+                }
+                let panes = ipc::display_panes(&snapshot, &ui_state);
+                write_message(
+                    &out,
+                    &notification("panes.changed", json!({ "panes": panes })),
+                );
+            },
+            |events| {
+                if !subscribed.load(Ordering::SeqCst) {
+                    return;
+                }
+                for event in &events {
+                    write_message(&out, &event_notification(event));
+                }
+            },
+        )
+    });
+}
+
+fn event_notification(event: &Event) -> Value {
+    match event {
+        Event::PaneAdded { .. } => notification("pane.added", json!(event)),
+        Event::PaneRemoved { .. } => notification("pane.removed", json!(event)),
+        Event::StatusChanged(change) => notification("pane.statusChanged", json!(change)),
+        Event::Error { message, at } => {
+            notification("watcher.error", json!({ "message": message, "at": at }))
+        }
+    }
+}
+
+fn notification(method: &str, params: Value) -> Value {
+    json!({ "jsonrpc": "2.0", "method": method, "params": params })
+}
+
+fn error_message(id: Value, code: i64, message: &str) -> Value {
+    json!({ "jsonrpc": "2.0", "id": id, "error": { "code": code, "message": message } })
+}
+
+fn write_message(out: &Output, message: &Value) {
+    if let Ok(mut out) = out.lock() {
+        let _ = writeln!(out, "{message}");
+        let _ = out.flush();
+    }
+}
@@ -1,44 +1,76 @@
+use std::cmp::Reverse;
 use std::collections::{HashMap, HashSet};
-use std::io::{self, BufRead, BufReader, Write};
-use std::os::unix::net::UnixStream;
-use std::sync::mpsc;
+use std::io::{self, Write};
+use std::sync::{OnceLock, mpsc};
 use std::thread;
 use std::time::{Duration, Instant};
 
 use anyhow::Result;
+use chrono::{DateTime, Local, Utc};
 use crossterm::event::{
     self, Event, KeyCode, KeyEvent, KeyEventKind, KeyModifiers, MouseButton, MouseEvent,
     MouseEventKind,
 };
+use crossterm::terminal::LeaveAlternateScreen;
+use crossterm::{cursor, execute};
 use smelt_ansi::{AnsiSpan, parse_ansi_lines};
 use smelt_term::grid::{Color, GridSlice, Style};
 use smelt_term::{Constraint, HitRegistry, LayoutTree, PaintId, Surface, TerminalSession};
-use unicode_width::{UnicodeWidthChar, UnicodeWidthStr};
+use unicode_width::UnicodeWidthChar;
 
+use crate::agent::backend::{Backend, backend_of};
+use crate::agent::cleanup;
+use crate::agent::config::{Emphasis, PaneColumn, StashPlacement, Truncation, config};
+use crate::agent::editor::open_workspace;
+use crate::agent::events::{self, StatusChange, status_changes};
+use crate::agent::git::Commit;
 use crate::agent::ipc;
 use crate::agent::persist::{
-    LastPosition, Snapshot, UiState, apply_ui_state, has_manual_status, load_snapshot,
-    load_ui_state, panes_from_snapshot, ui_pane_state_is_empty, update_ui_state,
+    LastPosition, PaneFilter, PaneSort, PaneTree, PreviewRate, Snapshot, UiState, ViewState,
+    apply_ui_state, has_manual_status, load_heartbeat, load_tasks, load_ui_state,
+    panes_from_snapshot, parse_tags, set_mark, set_pane_tags, tag_key, update_ui_state,
 };
-use crate::agent::{Pane, PaneStatus, capture_pane, kill_pane, restart_watch, switch_to_pane};
+use crate::agent::provider::providers;
+use crate::agent::record;
+use crate::agent::remote::{shell_join, shell_quote};
+use crate::agent::review::{self, Verdict};
+use crate::agent::spawn::{self, Spawn};
+use crate::agent::tasks::{Task, TaskState};
+use crate::agent::throttle::{Throttle, provider_of, spawn_or_queue};
+use crate::agent::transcript::{self, Session};
+use crate::agent::trigger::FinishAction;
+use crate::agent::{
+    Pane, PaneStatus, capture_pane, copy_text, format_age, load_buffer, origin_pane, restart_watch,
+    start_watch, switch_to_pane,
+};
+use crate::agent::{archive, crash, journal, log, power, tmux, watch};
 
 const SIDEBAR: PaintId = PaintId(1);
 const SEPARATOR: PaintId = PaintId(2);
 const PREVIEW: PaintId = PaintId(3);
+const BOARD: PaintId = PaintId(4);
 const MIN_SIDEBAR: u16 = 20;
 const MIN_PREVIEW: u16 = 20;
 const SYNCING_MSG: &str = "syncing agent-mux snapshot";
+/// Transitions shown in the pane details.
+const HISTORY_LEN: usize = 8;
 
 #[derive(Clone, Debug)]
 enum Hit {
     Separator,
 }
 
-#[derive(Clone, Debug)]
+#[derive(Clone, Debug, PartialEq)]
 enum TreeItem {
     SectionHeader(Option<String>),
     Workspace(String),
     ProjectGroup(String),
+    /// A tmux session in the tmux tree, by its first pane.
+    Session(String),
+    /// A tmux window in the tmux tree, by its first pane.
+    Window(String),
+    /// A pane's first tag in the tag tree, by its first pane.
+    Tag(String),
     Pane(String),
 }
 
@@ -47,32 +79,101 @@ enum Msg {
     PanesLoaded {
         panes: Vec<Pane>,
         snapshot_generation: u64,
-        ui_state: UiState,
+        ui_state: Box<UiState>,
+        tasks: Vec<Task>,
         err: Option<String>,
         live: bool,
     },
     PreviewLoaded {
         pane_id: String,
         content: String,
+        history: Vec<StatusChange>,
         preview_seq: u64,
+        /// The pane's window activity when it was captured; 0 on failure.
+        activity: u64,
     },
     PaneKilled {
         pane_id: String,
         err: Option<String>,
     },
+    ListLoaded {
+        source: ListSource,
+        rows: Vec<(ListItem, String)>,
+    },
+    ReviewLoaded(Vec<review::Workspace>),
+    CheckpointDone {
+        workspace: Box<review::Workspace>,
+        result: Result<String, String>,
+    },
+    WorkspaceOpened {
+        err: Option<String>,
+    },
     SubscriptionEnded,
+    Events(Vec<events::Event>),
+}
+
+#[derive(Debug, Clone, Copy, Default)]
+pub struct SidebarOptions {
+    /// Refuse keys that change panes or shared state.
+    pub read_only: bool,
+    /// Draw on the normal screen instead of the alternate one, so the last
+    /// frame stays in the scrollback on exit.
+    pub inline: bool,
+    /// Spell out statuses and keep the terminal cursor on the selected row
+    /// for screen readers.
+    pub accessible: bool,
 }
 
-pub fn run(tmux_session: String) -> Result<()> {
+pub fn run(tmux_session: String, options: SidebarOptions) -> Result<()> {
     let mut term = TerminalSession::builder()
         .buffer_capacity(128 * 1024)
         .enter_stdout()?;
     let (w, h) = term.size()?;
+    if options.inline {
+        // Scroll what was on screen into the scrollback rather than drawing
+        // over it.
+        let writer = term.writer();
+        execute!(writer, LeaveAlternateScreen)?;
+        writer.write_all("\r\n".repeat(h as usize).as_bytes())?;
+        execute!(writer, cursor::MoveTo(0, 0))?;
+    }
     let mut surface = Surface::new(w, h);
 
-    let mut app = App::new(tmux_session);
+    let origin = origin_pane();
+    let mut app = App::new(tmux_session, tmux::view_key());
+    app.origin = origin;
+    app.read_only = options.read_only || config().read_only;
+    app.accessible = options.accessible || config().accessible;
+    app.notice = tmux::compatibility_warning();
     app.resize(w, h);
-    run_loop(&mut surface, term.writer(), &mut app).map_err(Into::into)
+    crash::set_terminal_active(true);
+    let result = run_loop(&mut surface, term.writer(), &mut app);
+    crash::set_terminal_active(false);
+    if options.inline {
+        // Leave the shell prompt below the last frame.
+        let (_, h) = term.size()?;
+        execute!(term.writer(), cursor::MoveTo(0, h.saturating_sub(1)))?;
+        term.writer().write_all(b"\r\n")?;
+        term.writer().flush()?;
+    }
+    result.map_err(Into::into)
+}
+
+/// The tmux command that opens this sidebar again the way it was opened:
+/// in a popup from a popup, else in a new window.
+fn reopen_command() -> String {
+    let exe = std::env::current_exe()
+        .map(|exe| exe.to_string_lossy().into_owned())
+        .unwrap_or_else(|_| "agent-mux".to_string());
+    let args: Vec<String> = std::env::args().skip(1).collect();
+    let mut command = vec![exe.as_str()];
+    command.extend(args.iter().map(String::as_str));
+    let command = shell_quote(&shell_join(&command));
+    if std::env::var_os("TMUX_PANE").is_none() {
+        format!("display-popup -E {command}")
+    } else {
+        format!("new-window {command}")
+    }
 }
 
 fn run_loop<W: Write>(surface: &mut Surface, writer: &mut W, app: &mut App) -> io::Result<()> {
@@ -82,6 +183,7 @@ fn run_loop<W: Write>(surface: &mut Surface, writer: &mut W, app: &mut App) -> i
     let mut last_panes = Instant::now() - Duration::from_millis(500);
     let mut last_preview = Instant::now();
     let mut last_subscribe = Instant::now() - Duration::from_secs(1);
+    let mut last_watch_start = Instant::now();
     let mut panes_pending = false;
     let mut preview_pending = false;
     let mut subscribed = false;
@@ -97,6 +199,7 @@ fn run_loop<W: Write>(surface: &mut Surface, writer: &mut W, app: &mut App) -> i
                     mut panes,
                     snapshot_generation,
                     ui_state,
+                    tasks,
                     err,
                     live,
                 } => {
@@ -106,14 +209,17 @@ fn run_loop<W: Write>(surface: &mut Surface, writer: &mut W, app: &mut App) -> i
                     } else {
                         panes_pending = false;
                     }
-                    let mut changed = false;
+                    let mut changed = tasks != app.tasks;
+                    app.tasks = tasks;
                     if let Some(err) = err {
                         if err == SYNCING_MSG && app.has_display_snapshot() {
                             if app.err.as_deref() == Some(SYNCING_MSG) {
                                 app.err = None;
                                 changed = true;
                             }
-                        } else if app.err.as_deref() != Some(&err) {
+                        } else if app.err.as_deref() != Some(&err)
+                            && app.dismissed_err.as_deref() != Some(&err)
+                        {
                             app.err = Some(err);
                             changed = true;
                         }
@@ -122,19 +228,26 @@ fn run_loop<W: Write>(surface: &mut Surface, writer: &mut W, app: &mut App) -> i
                             app.err = None;
                             changed = true;
                         }
+                        app.dismissed_err = None;
                         app.hide_pending_kills(&mut panes);
                         let ui_is_older = ui_state_is_older_than(&ui_state, &app.ui_state);
                         let ui_changed =
                             !ui_is_older && ui_state.updated_at != app.ui_state.updated_at;
                         if ui_changed {
-                            app.ui_state = ui_state;
+                            app.ui_state = *ui_state;
                         } else if ui_is_older {
                             apply_ui_state(&mut panes, &app.ui_state);
                         }
                         if snapshot_generation != app.snapshot_generation || ui_changed {
+                            crash::record(format!(
+                                "panes loaded generation={snapshot_generation} count={}",
+                                panes.len()
+                            ));
                             app.snapshot_generation = snapshot_generation;
                             app.replace_panes(panes);
                             changed = true;
+                        } else {
+                            app.note_activity(&panes);
                         }
                     }
                     dirty |= changed;
@@ -142,13 +255,18 @@ fn run_loop<W: Write>(surface: &mut Surface, writer: &mut W, app: &mut App) -> i
                 Msg::PreviewLoaded {
                     pane_id,
                     content,
+                    history,
                     preview_seq,
+                    activity,
                 } => {
                     preview_pending = false;
+                    let lines = parse_ansi_lines(content.trim_end_matches('\n'));
+                    app.cache_preview(&pane_id, activity, &lines);
                     if preview_seq >= app.preview_applied_gen {
                         app.preview_applied_gen = preview_seq;
                         app.preview_for = pane_id;
-                        app.preview_lines = parse_ansi_lines(content.trim_end_matches('\n'));
+                        app.preview_history = history;
+                        app.preview_lines = lines;
                         dirty = true;
                     }
                 }
@@ -162,9 +280,47 @@ fn run_loop<W: Write>(surface: &mut Surface, writer: &mut W, app: &mut App) -> i
                     }
                     dirty = true;
                 }
+                Msg::ListLoaded { source, rows } => {
+                    if let Some(list) = app.list_view.as_mut().filter(|list| list.source == source)
+                    {
+                        list.rows = rows;
+                        list.loading = false;
+                        dirty = true;
+                    }
+                }
+                Msg::Events(events) => {
+                    if app.show_detail {
+                        for change in status_changes(&events) {
+                            dirty |= app.record_history(change);
+                        }
+                    }
+                }
+                Msg::ReviewLoaded(workspaces) => {
+                    if let Some(view) = app.review.as_mut() {
+                        view.cursor = view.cursor.min(workspaces.len().saturating_sub(1));
+                        view.workspaces = workspaces;
+                        view.loading = false;
+                        dirty = true;
+                    }
+                }
+                Msg::CheckpointDone { workspace, result } => {
+                    app.checkpoint_done(*workspace, result);
+                    dirty = true;
+                }
+                Msg::WorkspaceOpened { err } => {
+                    if err.is_some() {
+                        app.err = err;
+                        dirty = true;
+                    }
+                }
                 Msg::SubscriptionEnded => {
                     subscribed = false;
                     subscribe_pending = false;
+                    if last_watch_start.elapsed() >= Duration::from_secs(5) && !watch::is_running()
+                    {
+                        last_watch_start = Instant::now();
+                        spawn_start_watch();
+                    }
                 }
             }
         }
@@ -175,13 +331,27 @@ fn run_loop<W: Write>(surface: &mut Surface, writer: &mut W, app: &mut App) -> i
             last_subscribe = Instant::now();
         }
 
+        for (pane_id, target) in app.due_kills(Instant::now()) {
+            let tx = tx.clone();
+            thread::spawn(move || {
+                let err = ipc::kill_pane(&target).err().map(|e| e.to_string());
+                let _ = tx.send(Msg::PaneKilled { pane_id, err });
+            });
+            dirty = true;
+        }
+
         if !subscribed && last_panes.elapsed() >= Duration::from_millis(500) && !panes_pending {
             spawn_load_panes(&tx);
             panes_pending = true;
             last_panes = Instant::now();
         }
 
-        if last_preview.elapsed() >= Duration::from_millis(100) && !preview_pending {
+        app.power_save = power::power_save();
+        if app
+            .preview_interval()
+            .is_some_and(|interval| last_preview.elapsed() >= interval)
+            && !preview_pending
+        {
             app.preview_for.clear();
             spawn_preview(&tx, app);
             preview_pending = true;
@@ -199,25 +369,43 @@ fn run_loop<W: Write>(surface: &mut Surface, writer: &mut W, app: &mut App) -> i
             .max(Duration::from_millis(1));
         if event::poll(poll_for)? {
             match event::read()? {
-                Event::Key(key) if key.kind == KeyEventKind::Press => {
-                    match app.handle_key(key, &tx) {
-                        Action::Quit => return Ok(()),
-                        Action::Redraw => dirty = true,
-                        Action::Preview => {
+                Event::Key(key) if key.kind == KeyEventKind::Press => match app.handle_key(key) {
+                    Action::Quit => {
+                        app.flush_kills();
+                        return Ok(());
+                    }
+                    Action::Redraw => dirty = true,
+                    Action::Preview => {
+                        if !app.cached_preview() {
                             spawn_preview(&tx, app);
                             preview_pending = true;
-                            dirty = true;
                         }
-                        Action::LoadPanes => {
-                            if !panes_pending {
-                                spawn_load_panes(&tx);
-                                panes_pending = true;
-                            }
-                            dirty = true;
+                        dirty = true;
+                    }
+                    Action::LoadPanes => {
+                        if !panes_pending {
+                            spawn_load_panes(&tx);
+                            panes_pending = true;
                         }
-                        Action::None => {}
+                        dirty = true;
                     }
-                }
+                    Action::LoadList => {
+                        if let Some(list) = &app.list_view {
+                            spawn_list(&tx, list.source.clone());
+                        }
+                        dirty = true;
+                    }
+                    Action::LoadReview => {
+                        spawn_review(&tx, app.panes.values().cloned().collect());
+                        dirty = true;
+                    }
+                    Action::Checkpoint(workspace) => {
+                        spawn_checkpoint(&tx, *workspace);
+                        dirty = true;
+                    }
+                    Action::OpenWorkspace(pane) => spawn_open_workspace(&tx, *pane),
+                    Action::None => {}
+                },
                 Event::Mouse(mouse) => {
                     if app.handle_mouse(mouse) {
                         dirty = true;
@@ -234,35 +422,28 @@ fn run_loop<W: Write>(surface: &mut Surface, writer: &mut W, app: &mut App) -> i
     }
 }
 
-fn load_pane_state() -> (Option<Snapshot>, UiState) {
-    match ipc::get_state() {
-        Ok((Some(snapshot), ui_state)) => (Some(snapshot), ui_state),
-        Ok((None, ui_state)) => (load_snapshot(), ui_state),
-        Err(_) => (load_snapshot(), load_ui_state()),
-    }
+fn spawn_start_watch() {
+    thread::spawn(|| {
+        log::info("watcher not running; starting it", &[]);
+        if let Err(err) = start_watch() {
+            log::warn("start watcher failed", &[("err", &format!("{err:#}"))]);
+        }
+    });
 }
 
 fn spawn_subscribe_panes(tx: &mpsc::Sender<Msg>) {
     let tx = tx.clone();
     thread::spawn(move || {
-        let result = subscribe_panes(&tx);
-        if result.is_err() {
+        if let Err(err) = subscribe_panes(&tx) {
+            log::debug("daemon subscription ended", &[("err", &format!("{err:#}"))]);
             let _ = tx.send(Msg::SubscriptionEnded);
         }
     });
 }
 
 fn subscribe_panes(tx: &mpsc::Sender<Msg>) -> Result<()> {
-    let mut stream = UnixStream::connect(ipc::socket_path())?;
-    let request = serde_json::to_string(&ipc::Request::Subscribe)?;
-    writeln!(stream, "{request}")?;
-    let mut reader = BufReader::new(stream);
-    loop {
-        let mut line = String::new();
-        if reader.read_line(&mut line)? == 0 {
-            break;
-        }
-        match serde_json::from_str::<ipc::Response>(&line)? {
+    ipc::subscribe(|response| {
+        match response {
             ipc::Response::State { snapshot, ui_state } => {
                 send_panes_loaded(tx, snapshot, ui_state, true);
             }
@@ -270,14 +451,19 @@ fn subscribe_panes(tx: &mpsc::Sender<Msg>) -> Result<()> {
                 let _ = tx.send(Msg::PanesLoaded {
                     panes: Vec::new(),
                     snapshot_generation: 0,
-                    ui_state: load_ui_state(),
+                    ui_state: Box::new(load_ui_state()),
+                    tasks: load_tasks(),
                     err: Some(message),
                     live: true,
                 });
             }
+            ipc::Response::Events { events } => {
+                let _ = tx.send(Msg::Events(events));
+            }
+            ipc::Response::Ok => {}
         }
-    }
-    Ok(())
+        true
+    })
 }
 
 fn send_panes_loaded(
@@ -290,7 +476,8 @@ fn send_panes_loaded(
         let _ = tx.send(Msg::PanesLoaded {
             panes: Vec::new(),
             snapshot_generation: 0,
-            ui_state,
+            ui_state: Box::new(ui_state),
+            tasks: load_tasks(),
             err: Some(SYNCING_MSG.into()),
             live,
         });
@@ -302,7 +489,8 @@ fn send_panes_loaded(
     let _ = tx.send(Msg::PanesLoaded {
         panes,
         snapshot_generation,
-        ui_state,
+        ui_state: Box::new(ui_state),
+        tasks: load_tasks(),
         err: None,
         live,
     });
@@ -311,7 +499,7 @@ fn send_panes_loaded(
 fn spawn_load_panes(tx: &mpsc::Sender<Msg>) {
     let tx = tx.clone();
     thread::spawn(move || {
-        let (snapshot, ui_state) = load_pane_state();
+        let (snapshot, ui_state) = ipc::load_state();
         send_panes_loaded(&tx, snapshot, ui_state, false);
     });
 }
@@ -320,11 +508,22 @@ fn load_preview(app: &mut App) {
     let Some(p) = app.current_pane() else { return };
     let target = p.target.clone();
     let pane_id = p.pane_id.clone();
+    let activity = p.window_activity;
     let lines = app.height.max(50) as usize;
-    let content = capture_pane(&target, lines).unwrap_or_else(|err| format!("error: {err}"));
+    let (content, activity) = match capture_pane(&target, lines) {
+        Ok(content) => (content, activity),
+        Err(err) => (format!("error: {err}"), 0),
+    };
+    let lines = parse_ansi_lines(content.trim_end_matches('\n'));
+    app.cache_preview(&pane_id, activity, &lines);
+    app.preview_history = if app.show_detail {
+        journal::history(&pane_id, HISTORY_LEN)
+    } else {
+        Vec::new()
+    };
     app.preview_for = pane_id;
     app.preview_applied_gen = app.preview_gen;
-    app.preview_lines = parse_ansi_lines(content.trim_end_matches('\n'));
+    app.preview_lines = lines;
 }
 
 fn spawn_preview(tx: &mpsc::Sender<Msg>, app: &App) {
@@ -332,18 +531,121 @@ fn spawn_preview(tx: &mpsc::Sender<Msg>, app: &App) {
     let target = p.target.clone();
     let pane_id = p.pane_id.clone();
     let lines = app.height.max(50) as usize;
+    let activity = p.window_activity;
     let preview_seq = app.preview_gen;
+    let show_detail = app.show_detail;
     let tx = tx.clone();
     thread::spawn(move || {
-        let content = capture_pane(&target, lines).unwrap_or_else(|err| format!("error: {err}"));
+        let (content, activity) = match capture_pane(&target, lines) {
+            Ok(content) => (content, activity),
+            Err(err) => (format!("error: {err}"), 0),
+        };
+        let history = if show_detail {
+            journal::history(&pane_id, HISTORY_LEN)
+        } else {
+            Vec::new()
+        };
         let _ = tx.send(Msg::PreviewLoaded {
             pane_id,
             content,
+            history,
             preview_seq,
+            activity,
         });
     });
 }
 
+fn spawn_list(tx: &mpsc::Sender<Msg>, source: ListSource) {
+    let tx = tx.clone();
+    thread::spawn(move || {
+        let rows = match &source {
+            ListSource::History(workspace) => {
+                let mut sessions = transcript::sessions(Some(workspace));
+                transcript::attach_commits(&mut sessions);
+                sessions
+                    .into_iter()
+                    .flat_map(|session| {
+                        let commits: Vec<(ListItem, String)> = session
+                            .commits
+                            .iter()
+                            .map(|commit| {
+                                let subject = format!("  {}", commit.subject);
+                                (ListItem::Commit(commit.clone()), subject)
+                            })
+                            .collect();
+                        let prompt = session.first_prompt.clone();
+                        std::iter::once((ListItem::Session(session), prompt)).chain(commits)
+                    })
+                    .collect()
+            }
+            ListSource::Search(query) => transcript::search(query)
+                .into_iter()
+                .map(|hit| (ListItem::Session(hit.session), hit.snippet))
+                .collect(),
+            ListSource::Archive => archive::list()
+                .into_iter()
+                .map(|entry| {
+                    let path = entry.path.clone();
+                    (ListItem::Archive(entry), path)
+                })
+                .collect(),
+            ListSource::Diagnostics => {
+                let watcher = load_heartbeat().unwrap_or_default().problems;
+                let mut problems: Vec<(&str, log::Problem)> = watcher
+                    .into_iter()
+                    .map(|problem| ("watcher", problem))
+                    .chain(log::recent_problems().into_iter().map(|p| ("sidebar", p)))
+                    .collect();
+                problems.sort_by(|a, b| b.1.at.cmp(&a.1.at));
+                problems
+                    .into_iter()
+                    .map(|(process, problem)| {
+                        let message = problem.message.clone();
+                        (ListItem::Problem(process, problem), message)
+                    })
+                    .collect()
+            }
+            ListSource::Tasks => load_tasks()
+                .into_iter()
+                .map(|task| {
+                    let line = format!("{} · {}", task.workspace, task.prompt);
+                    (ListItem::Task(task), line)
+                })
+                .collect(),
+        };
+        let _ = tx.send(Msg::ListLoaded { source, rows });
+    });
+}
+
+fn spawn_review(tx: &mpsc::Sender<Msg>, panes: Vec<Pane>) {
+    let tx = tx.clone();
+    thread::spawn(move || {
+        let _ = tx.send(Msg::ReviewLoaded(review::dirty_workspaces(&panes)));
+    });
+}
+
+fn spawn_checkpoint(tx: &mpsc::Sender<Msg>, workspace: review::Workspace) {
+    let tx = tx.clone();
+    thread::spawn(move || {
+        let result = review::checkpoint(&workspace).map_err(|err| format!("{err:#}"));
+        let _ = tx.send(Msg::CheckpointDone {
+            workspace: Box::new(workspace),
+            result,
+        });
+    });
+}
+
+/// Runs `git status` and the editor or URI opener, which may be slow.
+fn spawn_open_workspace(tx: &mpsc::Sender<Msg>, pane: Pane) {
+    let tx = tx.clone();
+    thread::spawn(move || {
+        let err = open_workspace(&pane, true, true)
+            .err()
+            .map(|err| err.to_string());
+        let _ = tx.send(Msg::WorkspaceOpened { err });
+    });
+}
+
 fn ui_state_is_older_than(incoming: &UiState, current: &UiState) -> bool {
     match (incoming.updated_at, current.updated_at) {
         (Some(incoming), Some(current)) => incoming < current,
@@ -358,16 +660,166 @@ enum Action {
     Redraw,
     Preview,
     LoadPanes,
+    LoadList,
+    LoadReview,
+    /// Commits a reviewed workspace off the render loop.
+    Checkpoint(Box<review::Workspace>),
+    /// Opens a pane's workspace in an editor off the render loop.
+    OpenWorkspace(Box<Pane>),
     Quit,
 }
 
+enum InputKind {
+    QueuePrompt { pane_id: String },
+    Broadcast { pane_ids: Vec<String> },
+    OnFinish { pane_id: String },
+    Spawn,
+    Search,
+    Tags { pane_id: String },
+    TagFilter,
+}
+
+struct LineInput {
+    kind: InputKind,
+    text: String,
+}
+
+impl LineInput {
+    fn label(&self) -> &'static str {
+        match self.kind {
+            InputKind::QueuePrompt { .. } => "queue",
+            InputKind::Broadcast { .. } => "broadcast",
+            InputKind::OnFinish { .. } => "on finish",
+            InputKind::Spawn => "template",
+            InputKind::Search => "search",
+            InputKind::Tags { .. } => "tags",
+            InputKind::TagFilter => "show tag",
+        }
+    }
+}
+
+/// How long a killed pane may stay listed before it is shown again.
+const KILL_SETTLE: Duration = Duration::from_secs(5);
+
+/// A pane hidden by `dd`. The kill is sent once `due` passes, so it can be
+/// undone until then, together with the rest of its `batch`.
+struct PendingKill {
+    pane: Pane,
+    due: Instant,
+    sent: Option<Instant>,
+    batch: u64,
+}
+
+#[derive(Debug, Clone, PartialEq)]
+enum ListSource {
+    /// The past sessions of one workspace, opened with `h`.
+    History(String),
+    /// Sessions whose transcripts match a `/` search.
+    Search(String),
+    /// The saved output of killed panes, opened with `A`.
+    Archive,
+    /// Recent warnings and errors from the watcher and the sidebar, opened
+    /// with `E`.
+    Diagnostics,
+    /// The task queue, opened with `Q`.
+    Tasks,
+}
+
+#[derive(Debug, Clone)]
+enum ListItem {
+    Session(Session),
+    /// A commit made during the session listed above it.
+    Commit(Commit),
+    Archive(archive::Entry),
+    /// A warning or error and the process that hit it.
+    Problem(&'static str, log::Problem),
+    Task(Task),
+}
+
+/// Dirty workspaces in an overlay, with the diff of the selected one below
+/// them.
+#[derive(Debug, Default)]
+struct ReviewView {
+    workspaces: Vec<review::Workspace>,
+    loading: bool,
+    cursor: usize,
+    /// How far the diff is scrolled.
+    scroll: usize,
+    /// The changes hash a `c` is waiting on a second `c` to commit.
+    confirm: Option<String>,
+    /// Whether a checkpoint commit is running.
+    committing: bool,
+}
+
+/// Past sessions, archived outputs or problems in an overlay, each with the
+/// line to show for it.
+struct ListView {
+    source: ListSource,
+    rows: Vec<(ListItem, String)>,
+    loading: bool,
+    cursor: usize,
+    scroll: usize,
+}
+
+impl ListView {
+    fn new(source: ListSource) -> Self {
+        Self {
+            source,
+            rows: Vec::new(),
+            loading: true,
+            cursor: 0,
+            scroll: 0,
+        }
+    }
+}
+
+/// An action `.` can repeat, with the count it last ran with.
+#[derive(Debug, Clone, Copy)]
+enum Repeat {
+    ToggleAttention,
+    Stash(usize),
+    Snooze,
+    Kill(usize),
+}
+
+/// The selected card on the status board, by column and row.
+#[derive(Debug, Clone, Copy, Default)]
+struct BoardCursor {
+    column: usize,
+    row: usize,
+}
+
+const BOARD_COLUMNS: [&str; 4] = ["Busy", "Attention", "Unread", "Idle"];
+
+fn board_column(status: PaneStatus) -> usize {
+    match status {
+        PaneStatus::Busy => 0,
+        PaneStatus::NeedsAttention | PaneStatus::Error => 1,
+        PaneStatus::Unread => 2,
+        PaneStatus::Idle | PaneStatus::Disconnected => 3,
+    }
+}
+
 struct App {
     panes: HashMap<String, Pane>,
     items: Vec<TreeItem>,
     cursor: usize,
     scroll_start: usize,
+    list_height: usize,
     preview_for: String,
     preview_lines: Vec<Vec<AnsiSpan>>,
+    preview_history: Vec<StatusChange>,
+    /// Captured previews by pane id, with the window activity they were
+    /// taken at, so moving back to an unchanged pane skips the capture.
+    preview_cache: HashMap<String, (u64, Vec<Vec<AnsiSpan>>)>,
+    show_detail: bool,
+    /// The status board, shown instead of the sidebar and preview.
+    board: Option<BoardCursor>,
+    /// The task queue, for the progress footer.
+    tasks: Vec<Task>,
+    /// Observer mode: keys that change panes or shared state are refused.
+    read_only: bool,
+    accessible: bool,
     preview_gen: u64,
     preview_applied_gen: u64,
     snapshot_generation: u64,
@@ -377,20 +829,51 @@ struct App {
     sidebar_width: u16,
     dragging: bool,
     show_help: bool,
-    pending_d: bool,
+    help_scroll: usize,
+    list_view: Option<ListView>,
+    /// The review of uncommitted agent work, opened with `V`.
+    review: Option<ReviewView>,
+    pending_d: Option<usize>,
     pending_g: bool,
+    pending_prefix: Option<char>,
     count: usize,
     err: Option<String>,
+    dismissed_err: Option<String>,
+    notice: Option<String>,
+    /// On battery, or forced: the preview only refreshes on navigation.
+    power_save: bool,
+    input: Option<LineInput>,
+    marked: HashSet<String>,
     ui_state: UiState,
-    pending_manual_statuses: HashMap<String, PaneStatus>,
-    pending_kills: HashMap<String, Pane>,
+    confirm_kill: Option<Vec<String>>,
+    cleanup_dismissed: bool,
+    pending_kills: HashMap<String, PendingKill>,
+    /// The last batch of kills requested, so one `u` undoes a whole
+    /// `[count]dd`.
+    kill_batch: u64,
     hits: HitRegistry<Hit>,
+    previous_pane: Option<String>,
+    last_action: Option<Repeat>,
+    origin: Option<String>,
+    /// Where this sidebar's cursor and width are saved, by `tmux::view_key`.
+    view_key: String,
     _tmux_session: String,
 }
 
 impl App {
-    fn new(tmux_session: String) -> Self {
-        let (snapshot, ui_state) = load_pane_state();
+    fn new(tmux_session: String, view_key: String) -> Self {
+        let (snapshot, ui_state) = ipc::load_state();
+        Self::with_state(tmux_session, view_key, snapshot, ui_state)
+    }
+
+    /// A sidebar showing `snapshot`, without loading any state itself.
+    /// `view_key` picks its saved cursor and width out of `ui_state`.
+    fn with_state(
+        tmux_session: String,
+        view_key: String,
+        snapshot: Option<Snapshot>,
+        ui_state: UiState,
+    ) -> Self {
         let snapshot_generation = snapshot
             .as_ref()
             .map(|snapshot| snapshot.generation)
@@ -400,47 +883,71 @@ impl App {
             .map(panes_from_snapshot)
             .unwrap_or_default();
         apply_ui_state(&mut panes, &ui_state);
+        let view = ui_state.view(&view_key);
         let mut app = Self {
             panes: panes.into_iter().map(|p| (p.pane_id.clone(), p)).collect(),
             items: Vec::new(),
             cursor: 0,
             scroll_start: 0,
+            list_height: 0,
             preview_for: String::new(),
             preview_lines: Vec::new(),
+            preview_history: Vec::new(),
+            preview_cache: HashMap::new(),
+            show_detail: false,
+            board: None,
+            tasks: Vec::new(),
+            read_only: false,
+            accessible: false,
             preview_gen: 1,
             preview_applied_gen: 0,
             snapshot_generation,
             project_win_width: HashMap::new(),
             width: 0,
             height: 0,
-            sidebar_width: ui_state.sidebar_width,
+            sidebar_width: view.sidebar_width,
             dragging: false,
             show_help: false,
-            pending_d: false,
+            help_scroll: 0,
+            list_view: None,
+            review: None,
+            pending_d: None,
             pending_g: false,
+            pending_prefix: None,
             count: 0,
             err: snapshot.is_none().then(|| SYNCING_MSG.to_string()),
+            dismissed_err: None,
+            notice: None,
+            power_save: false,
+            input: None,
+            marked: HashSet::new(),
             ui_state,
-            pending_manual_statuses: HashMap::new(),
+            confirm_kill: None,
+            cleanup_dismissed: false,
             pending_kills: HashMap::new(),
+            kill_batch: 0,
             hits: HitRegistry::new(),
+            previous_pane: None,
+            last_action: None,
+            origin: None,
+            view_key,
             _tmux_session: tmux_session,
         };
         app.rebuild_items();
         if let Some(att) = app.first_attention_pane() {
             app.cursor = att;
-        } else if !app.ui_state.last_position.pane_id.is_empty()
-            || !app.ui_state.last_position.pane_target.is_empty()
+        } else if !view.last_position.pane_id.is_empty()
+            || !view.last_position.pane_target.is_empty()
         {
-            let id = if app.ui_state.last_position.pane_id.is_empty() {
-                app.ui_state.last_position.pane_target.clone()
+            let id = if view.last_position.pane_id.is_empty() {
+                &view.last_position.pane_target
             } else {
-                app.ui_state.last_position.pane_id.clone()
+                &view.last_position.pane_id
             };
             app.cursor = app
-                .find_pane_by_id(&id)
+                .find_pane_by_id(id)
                 .unwrap_or_else(|| first_pane(&app.items).unwrap_or(0));
-            app.scroll_start = app.ui_state.last_position.scroll_start;
+            app.scroll_start = view.last_position.scroll_start;
         } else {
             app.cursor = first_pane(&app.items).unwrap_or(0);
         }
@@ -459,12 +966,21 @@ impl App {
     }
 
     fn replace_panes(&mut self, panes: Vec<Pane>) {
-        let selected = self.current_pane().map(|p| p.pane_id.clone());
+        let selected = self.items.get(self.cursor).cloned();
+        let screen_row = self.cursor.checked_sub(self.scroll_start);
         self.panes = panes.into_iter().map(|p| (p.pane_id.clone(), p)).collect();
         self.rebuild_items();
         self.cursor = selected
-            .and_then(|id| self.find_pane_by_id(&id))
+            .and_then(|item| self.items.iter().position(|it| *it == item))
             .unwrap_or_else(|| nearest_pane(&self.items, self.cursor));
+        if let Some(row) = screen_row {
+            self.scroll_start = self.cursor.saturating_sub(row);
+        }
+        self.preview_cache.retain(|id, (activity, _)| {
+            self.panes
+                .get(id)
+                .is_some_and(|p| p.window_activity == *activity)
+        });
         if self.current_pane().is_none() {
             self.preview_for.clear();
             self.preview_lines.clear();
@@ -472,18 +988,65 @@ impl App {
         }
     }
 
+    /// Takes in window activity from a refresh that changed nothing else.
+    fn note_activity(&mut self, panes: &[Pane]) {
+        for pane in panes {
+            if let Some(p) = self.panes.get_mut(&pane.pane_id) {
+                p.window_activity = pane.window_activity;
+            }
+        }
+    }
+
+    fn cache_preview(&mut self, pane_id: &str, activity: u64, lines: &[Vec<AnsiSpan>]) {
+        if activity == 0 {
+            self.preview_cache.remove(pane_id);
+            return;
+        }
+        self.preview_cache
+            .insert(pane_id.to_string(), (activity, lines.to_vec()));
+    }
+
+    /// Shows the current pane's cached preview if its window has seen no
+    /// output since the capture. Returns whether it did.
+    fn cached_preview(&mut self) -> bool {
+        let Some(p) = self.current_pane() else {
+            return false;
+        };
+        let Some((_, lines)) = self
+            .preview_cache
+            .get(&p.pane_id)
+            .filter(|(activity, _)| *activity == p.window_activity)
+        else {
+            return false;
+        };
+        let pane_id = p.pane_id.clone();
+        self.preview_lines = lines.clone();
+        self.preview_history = if self.show_detail {
+            journal::history(&pane_id, HISTORY_LEN)
+        } else {
+            Vec::new()
+        };
+        self.preview_for = pane_id;
+        self.preview_applied_gen = self.preview_gen;
+        true
+    }
+
     fn rebuild_items(&mut self) {
-        let panes: Vec<&Pane> = self.panes.values().collect();
+        let panes: Vec<&Pane> = self
+            .panes
+            .values()
+            .filter(|p| self.ui_state.shows(p))
+            .collect();
         let mut grouped_projects = HashSet::new();
         for p in &panes {
-            if !p.project_root.is_empty() && p.path != p.project_root {
+            if p.host.is_empty() && !p.project_root.is_empty() && p.path != p.project_root {
                 grouped_projects.insert(p.project_root.clone());
             }
         }
 
         let mut project_win_width: HashMap<String, usize> = HashMap::new();
         for p in &panes {
-            if grouped_projects.contains(&p.project_root) {
+            if p.host.is_empty() && grouped_projects.contains(&p.project_root) {
                 let label = pane_label(p);
                 let width = display_width(&label);
                 project_win_width
@@ -497,7 +1060,7 @@ impl App {
         #[derive(Clone, Debug, Eq, Hash, Ord, PartialEq, PartialOrd)]
         enum GroupKey {
             Project(String),
-            Workspace(String),
+            Workspace(String, String),
         }
 
         struct Group<'a> {
@@ -508,19 +1071,46 @@ impl App {
         }
 
         let mut items = Vec::new();
-        for stashed in [false, true] {
+        for section in [None, Some("stashed"), Some("terminated")] {
+            let section_panes: Vec<&Pane> = panes
+                .iter()
+                .copied()
+                .filter(|p| pane_section(p) == section)
+                .collect();
+            if section_panes.is_empty() {
+                continue;
+            }
+            if let Some(title) = section {
+                items.push(TreeItem::SectionHeader(None));
+                items.push(TreeItem::SectionHeader(Some(title.into())));
+            }
+            match self.ui_state.tree {
+                PaneTree::Tmux => {
+                    self.push_tmux_tree(&mut items, section_panes);
+                    continue;
+                }
+                PaneTree::Tags => {
+                    self.push_tag_tree(&mut items, section_panes);
+                    continue;
+                }
+                PaneTree::Paths => {}
+            }
+
             let mut groups: Vec<Group<'_>> = Vec::new();
             let mut group_index: HashMap<GroupKey, usize> = HashMap::new();
-            for p in panes.iter().copied().filter(|p| p.stashed == stashed) {
-                let key = if grouped_projects.contains(&p.project_root) {
+            for p in section_panes {
+                let key = if p.host.is_empty() && grouped_projects.contains(&p.project_root) {
                     GroupKey::Project(p.project_root.clone())
                 } else {
-                    GroupKey::Workspace(p.path.clone())
+                    GroupKey::Workspace(p.host.clone(), p.path.clone())
                 };
                 if let Some(&idx) = group_index.get(&key) {
                     let group = &mut groups[idx];
                     if p.order < group.sort_order {
                         group.sort_order = p.order;
+                    }
+                    let header = &self.panes[&group.header_id];
+                    if (p.stashed, p.order) < (header.stashed, header.order) {
                         group.header_id = p.pane_id.clone();
                     }
                     group.panes.push(p);
@@ -535,23 +1125,30 @@ impl App {
                 }
             }
 
-            if groups.is_empty() {
-                continue;
-            }
-            if stashed {
-                items.push(TreeItem::SectionHeader(None));
-                items.push(TreeItem::SectionHeader(Some("stashed".into())));
-            }
-
-            groups.sort_by(|a, b| a.sort_order.cmp(&b.sort_order).then(a.key.cmp(&b.key)));
-            for mut group in groups {
+            let sort = self.ui_state.sort;
+            for group in &mut groups {
                 group
                     .panes
                     .sort_by(|a, b| a.order.cmp(&b.order).then(a.target.cmp(&b.target)));
-                if matches!(&group.key, GroupKey::Project(_)) {
-                    items.push(TreeItem::ProjectGroup(group.header_id));
+                if sort == PaneSort::Status {
+                    group.panes.sort_by_key(|p| status_rank(p));
+                }
+                group.panes.sort_by_key(|p| p.stashed);
+            }
+            groups.sort_by(|a, b| a.sort_order.cmp(&b.sort_order).then(a.key.cmp(&b.key)));
+            if sort == PaneSort::Status {
+                groups.sort_by_key(|group| group.panes.first().map(|p| status_rank(p)));
+            }
+            for group in groups {
+                let header = if matches!(&group.key, GroupKey::Project(_)) {
+                    TreeItem::ProjectGroup(group.header_id)
                 } else {
-                    items.push(TreeItem::Workspace(group.header_id));
+                    TreeItem::Workspace(group.header_id)
+                };
+                let collapsed = self.is_collapsed(&header);
+                items.push(header);
+                if collapsed {
+                    continue;
                 }
                 items.extend(
                     group
@@ -564,6 +1161,90 @@ impl App {
         self.items = items;
     }
 
+    /// Nests `panes` under their windows under their sessions, each in the
+    /// order of its first pane.
+    fn push_tmux_tree(&self, items: &mut Vec<TreeItem>, mut panes: Vec<&Pane>) {
+        panes.sort_by(|a, b| a.order.cmp(&b.order).then(a.target.cmp(&b.target)));
+        if self.ui_state.sort == PaneSort::Status {
+            panes.sort_by_key(|p| status_rank(p));
+        }
+        panes.sort_by_key(|p| p.stashed);
+        let mut sessions: Vec<Vec<Vec<&Pane>>> = Vec::new();
+        for p in panes {
+            let session = match sessions.iter().position(|windows| {
+                windows[0][0].host == p.host && windows[0][0].session == p.session
+            }) {
+                Some(i) => &mut sessions[i],
+                None => {
+                    sessions.push(Vec::new());
+                    sessions.last_mut().expect("just pushed")
+                }
+            };
+            match session
+                .iter_mut()
+                .find(|window| window[0].window == p.window)
+            {
+                Some(window) => window.push(p),
+                None => session.push(vec![p]),
+            }
+        }
+        for windows in sessions {
+            let session = TreeItem::Session(windows[0][0].pane_id.clone());
+            let collapsed = self.is_collapsed(&session);
+            items.push(session);
+            if collapsed {
+                continue;
+            }
+            for window_panes in windows {
+                let window = TreeItem::Window(window_panes[0].pane_id.clone());
+                let collapsed = self.is_collapsed(&window);
+                items.push(window);
+                if !collapsed {
+                    items.extend(
+                        window_panes
+                            .iter()
+                            .map(|p| TreeItem::Pane(p.pane_id.clone())),
+                    );
+                }
+            }
+        }
+    }
+
+    /// Groups `panes` under their first tag, in tag order, with untagged
+    /// panes last.
+    fn push_tag_tree(&self, items: &mut Vec<TreeItem>, mut panes: Vec<&Pane>) {
+        panes.sort_by(|a, b| a.order.cmp(&b.order).then(a.target.cmp(&b.target)));
+        if self.ui_state.sort == PaneSort::Status {
+            panes.sort_by_key(|p| status_rank(p));
+        }
+        panes.sort_by_key(|p| (p.tags.is_empty(), p.tags.first().cloned(), p.stashed));
+        let mut groups: Vec<Vec<&Pane>> = Vec::new();
+        for p in panes {
+            match groups.last_mut() {
+                Some(group) if group[0].tags.first() == p.tags.first() => group.push(p),
+                _ => groups.push(vec![p]),
+            }
+        }
+        for group in groups {
+            let header = TreeItem::Tag(group[0].pane_id.clone());
+            let collapsed = self.is_collapsed(&header);
+            items.push(header);
+            if !collapsed {
+                items.extend(group.iter().map(|p| TreeItem::Pane(p.pane_id.clone())));
+            }
+        }
+    }
+
+    fn is_collapsed(&self, header: &TreeItem) -> bool {
+        self.collapse_key(header)
+            .is_some_and(|key| self.ui_state.collapsed.contains(&key))
+    }
+
+    /// The `collapsed` key of a header row.
+    fn collapse_key(&self, header: &TreeItem) -> Option<String> {
+        Some(header_key(header, self.panes.get(header_id(header)?)?))
+    }
+
     fn current_pane(&self) -> Option<&Pane> {
         match self.items.get(self.cursor)? {
             TreeItem::Pane(id) => self.panes.get(id),
@@ -579,6 +1260,87 @@ impl App {
         self.panes.get_mut(&id)
     }
 
+    /// The panes under the selected header, folded away or not, or `None`
+    /// when the cursor is on a pane.
+    fn header_panes(&self) -> Option<Vec<String>> {
+        let header = self.items.get(self.cursor)?;
+        self.collapse_key(header)?;
+        if let Some(panes) = self.folded_panes(header) {
+            return Some(panes.into_iter().map(|p| p.pane_id.clone()).collect());
+        }
+        let session = matches!(header, TreeItem::Session(_));
+        Some(
+            self.items[self.cursor + 1..]
+                .iter()
+                .take_while(|item| {
+                    matches!(item, TreeItem::Pane(_))
+                        || (session && matches!(item, TreeItem::Window(_)))
+                })
+                .filter_map(|item| match item {
+                    TreeItem::Pane(id) => Some(id.clone()),
+                    _ => None,
+                })
+                .collect(),
+        )
+    }
+
+    /// The panes hidden under `header`, in tmux order, when it is folded.
+    fn folded_panes(&self, header: &TreeItem) -> Option<Vec<&Pane>> {
+        let key = self.collapse_key(header)?;
+        if !self.ui_state.collapsed.contains(&key) {
+            return None;
+        }
+        let section = pane_section(self.panes.get(header_id(header)?)?);
+        let mut panes: Vec<&Pane> = self
+            .panes
+            .values()
+            .filter(|p| self.ui_state.shows(p) && pane_section(p) == section)
+            .filter(|p| header_key(header, p) == key)
+            .collect();
+        panes.sort_by(|a, b| a.order.cmp(&b.order).then(a.target.cmp(&b.target)));
+        Some(panes)
+    }
+
+    /// Folds (`Some(true)`), unfolds (`Some(false)`) or toggles the selected
+    /// header, or the innermost header above the selected pane, which the
+    /// cursor then moves to.
+    fn collapse(&mut self, fold: Option<bool>) -> Action {
+        let end = (self.cursor + 1).min(self.items.len());
+        let Some(at) = self.items[..end]
+            .iter()
+            .rposition(|item| self.collapse_key(item).is_some())
+        else {
+            return Action::None;
+        };
+        let Some(key) = self.collapse_key(&self.items[at]) else {
+            return Action::None;
+        };
+        let fold = fold.unwrap_or(!self.ui_state.collapsed.contains(&key));
+        self.cursor = at;
+        let result = update_ui_state(|state| {
+            if fold {
+                state.collapsed.insert(key.clone());
+            } else {
+                state.collapsed.remove(&key);
+            }
+        });
+        self.ui_state_written(result);
+        self.replace_panes(self.panes.values().cloned().collect());
+        self.preview_gen += 1;
+        Action::Preview
+    }
+
+    /// Adds a transition of the previewed pane to its detail timeline.
+    fn record_history(&mut self, change: &StatusChange) -> bool {
+        if change.pane_id != self.preview_for {
+            return false;
+        }
+        self.preview_history.push(change.clone());
+        let skip = self.preview_history.len().saturating_sub(HISTORY_LEN);
+        self.preview_history.drain(..skip);
+        true
+    }
+
     fn find_pane_by_id(&self, pane_id: &str) -> Option<usize> {
         self.items
             .iter()
@@ -589,22 +1351,74 @@ impl App {
         self.items.iter().enumerate().find_map(|(i, it)| {
             let TreeItem::Pane(id) = it else { return None };
             let p = self.panes.get(id)?;
-            (!p.stashed && matches!(p.status, PaneStatus::NeedsAttention | PaneStatus::Unread))
-                .then_some(i)
+            (!p.stashed && p.shown_status().wants_attention()).then_some(i)
         })
     }
 
+    fn jump_to_attention(&mut self, forward: bool) -> Action {
+        let wants_attention = |id: &str| {
+            self.panes
+                .get(id)
+                .is_some_and(|p| !p.stashed && p.shown_status().wants_attention())
+        };
+        let Some(next) = find_pane_wrapping(&self.items, self.cursor, forward, wants_attention)
+        else {
+            return Action::None;
+        };
+        self.cursor = next;
+        self.preview_gen += 1;
+        Action::Preview
+    }
+
+    fn set_mark(&mut self, letter: char) -> Action {
+        let Some(pane_id) = self.current_pane().map(|p| p.pane_id.clone()) else {
+            return Action::None;
+        };
+        let result = set_mark(letter, &pane_id);
+        self.ui_state_written(result);
+        Action::Redraw
+    }
+
+    fn jump_to_mark(&mut self, letter: char) -> Action {
+        let Some(index) = self
+            .ui_state
+            .marks
+            .get(&letter.to_string())
+            .and_then(|id| self.find_pane_by_id(id))
+        else {
+            self.err = Some(format!("mark {letter} is not set"));
+            return Action::Redraw;
+        };
+        self.cursor = index;
+        self.preview_gen += 1;
+        Action::Preview
+    }
+
+    fn mark_of(&self, pane_id: &str) -> Option<&str> {
+        self.ui_state
+            .marks
+            .iter()
+            .find(|(_, id)| *id == pane_id)
+            .map(|(letter, _)| letter.as_str())
+    }
+
     fn has_display_snapshot(&self) -> bool {
         self.snapshot_generation > 0 || !self.panes.is_empty() || !self.pending_kills.is_empty()
     }
 
-    fn remove_current_pane(&mut self) -> Option<(String, String)> {
-        let pane = self.current_pane()?.clone();
+    fn remove_pane(&mut self, pane_id: &str, delay: Duration) -> Option<(String, String)> {
+        let pane = self.panes.remove(pane_id)?;
         let pane_id = pane.pane_id.clone();
         let target = pane.target.clone();
-        self.pending_manual_statuses.remove(&pane_id);
-        self.pending_kills.insert(pane_id.clone(), pane);
-        self.panes.remove(&pane_id);
+        self.pending_kills.insert(
+            pane_id.clone(),
+            PendingKill {
+                pane,
+                due: Instant::now() + delay,
+                sent: None,
+                batch: self.kill_batch,
+            },
+        );
         self.rebuild_items();
         self.cursor = nearest_pane(&self.items, self.cursor);
         if self.preview_for == pane_id {
@@ -616,10 +1430,10 @@ impl App {
     }
 
     fn restore_pending_kill(&mut self, pane_id: &str) {
-        let Some(pane) = self.pending_kills.remove(pane_id) else {
+        let Some(kill) = self.pending_kills.remove(pane_id) else {
             return;
         };
-        self.panes.insert(pane_id.to_string(), pane);
+        self.panes.insert(pane_id.to_string(), kill.pane);
         self.rebuild_items();
         self.cursor = self
             .find_pane_by_id(pane_id)
@@ -627,56 +1441,262 @@ impl App {
         self.preview_gen += 1;
     }
 
+    /// Drops pending kills whose pane is gone, and shows a pane again with
+    /// its metadata if it is still listed well after the kill was sent.
     fn hide_pending_kills(&mut self, panes: &mut Vec<Pane>) {
-        let alive: HashMap<String, bool> = panes
+        let alive: HashSet<&str> = panes.iter().map(|pane| pane.pane_id.as_str()).collect();
+        self.pending_kills.retain(|id, kill| {
+            alive.contains(id.as_str()) && kill.sent.is_none_or(|at| at.elapsed() < KILL_SETTLE)
+        });
+        panes.retain(|pane| !self.pending_kills.contains_key(&pane.pane_id));
+    }
+
+    /// Marks the kills whose undo window has passed as sent and returns their
+    /// pane ids and targets.
+    fn due_kills(&mut self, now: Instant) -> Vec<(String, String)> {
+        self.pending_kills
+            .iter_mut()
+            .filter(|(_, kill)| kill.sent.is_none() && kill.due <= now)
+            .map(|(id, kill)| {
+                kill.sent = Some(now);
+                (id.clone(), kill.pane.target.clone())
+            })
+            .collect()
+    }
+
+    fn waiting_kills(&self) -> Vec<&PendingKill> {
+        let mut waiting: Vec<&PendingKill> = self
+            .pending_kills
+            .values()
+            .filter(|kill| kill.sent.is_none())
+            .collect();
+        waiting.sort_by_key(|kill| kill.due);
+        waiting
+    }
+
+    /// The waiting kills of the most recent batch.
+    fn last_kill_batch(&self) -> Vec<&PendingKill> {
+        let waiting = self.waiting_kills();
+        let Some(batch) = waiting.last().map(|kill| kill.batch) else {
+            return Vec::new();
+        };
+        waiting
+            .into_iter()
+            .filter(|kill| kill.batch == batch)
+            .collect()
+    }
+
+    /// Restores every pane of the most recent batch of kills.
+    fn undo_kill(&mut self) -> bool {
+        let pane_ids: Vec<String> = self
+            .last_kill_batch()
             .iter()
-            .map(|pane| (pane.pane_id.clone(), true))
+            .map(|kill| kill.pane.pane_id.clone())
             .collect();
-        self.pending_kills.retain(|id, _| alive.contains_key(id));
-        panes.retain(|pane| !self.pending_kills.contains_key(&pane.pane_id));
+        for pane_id in &pane_ids {
+            self.restore_pending_kill(pane_id);
+        }
+        !pane_ids.is_empty()
     }
 
-    fn handle_key(&mut self, key: KeyEvent, tx: &mpsc::Sender<Msg>) -> Action {
-        let ctrl = key.modifiers.contains(KeyModifiers::CONTROL);
-        if key.code == KeyCode::Esc
-            || key.code == KeyCode::Char('q')
-            || (ctrl && matches!(key.code, KeyCode::Char('c') | KeyCode::Char('d')))
-        {
-            self.save_state();
-            return Action::Quit;
+    /// Sends kills still inside their undo window; called on quit.
+    fn flush_kills(&mut self) {
+        let now = Instant::now();
+        for kill in self.pending_kills.values_mut() {
+            if kill.sent.is_some() {
+                continue;
+            }
+            kill.sent = Some(now);
+            if let Err(err) = ipc::kill_pane(&kill.pane.target) {
+                log::warn(
+                    "kill pane failed",
+                    &[("target", &kill.pane.target), ("err", &format!("{err:#}"))],
+                );
+            }
         }
-        if let KeyCode::Char(ch) = key.code
-            && ch.is_ascii_digit()
-            && (self.count > 0 || ch != '0')
-        {
-            self.count = self
-                .count
+    }
+
+    /// Hides the panes and queues their kills as one batch, undone
+    /// together.
+    fn request_kills(&mut self, pane_ids: &[String]) -> Action {
+        let delay = Duration::from_secs(config().kill_undo_secs);
+        self.kill_batch += 1;
+        let mut action = Action::None;
+        for pane_id in pane_ids {
+            if self.remove_pane(pane_id, delay).is_some() {
+                action = Action::Preview;
+            }
+        }
+        action
+    }
+
+    fn handle_key(&mut self, key: KeyEvent) -> Action {
+        let before = self.current_pane().map(|p| p.pane_id.clone());
+        let action = self.handle_key_inner(key);
+        let after = self.current_pane().map(|p| p.pane_id.clone());
+        if before.is_some() && after != before {
+            self.previous_pane = before;
+        }
+        action
+    }
+
+    fn handle_key_inner(&mut self, key: KeyEvent) -> Action {
+        crash::record(format!("key {:?} {:?}", key.code, key.modifiers));
+        let ctrl = key.modifiers.contains(KeyModifiers::CONTROL);
+        if self.input.is_some() {
+            return self.handle_input_key(key, ctrl);
+        }
+        if self.show_help && !ctrl {
+            let max = help_max_scroll(self.height);
+            match key.code {
+                KeyCode::Char('j') | KeyCode::Down => {
+                    self.help_scroll = (self.help_scroll + 1).min(max)
+                }
+                KeyCode::Char('k') | KeyCode::Up => {
+                    self.help_scroll = self.help_scroll.min(max).saturating_sub(1)
+                }
+                KeyCode::Char('g') => self.help_scroll = 0,
+                KeyCode::Char('G') => self.help_scroll = max,
+                KeyCode::Char('?' | 'q') | KeyCode::Esc => {
+                    self.show_help = false;
+                    self.help_scroll = 0;
+                }
+                _ => return Action::None,
+            }
+            return Action::Redraw;
+        }
+        if self.read_only && !ctrl && self.mutates(key.code) {
+            self.pending_prefix = None;
+            self.notice = Some("read-only".to_string());
+            return Action::Redraw;
+        }
+        if self.list_view.is_some() && !ctrl {
+            return self.handle_list_key(key);
+        }
+        if self.review.is_some() && !ctrl {
+            return self.handle_review_key(key.code);
+        }
+        if let Some(pane_ids) = self.confirm_kill.take() {
+            if key.code != KeyCode::Char('y') {
+                return Action::Redraw;
+            }
+            self.marked.retain(|id| !pane_ids.contains(id));
+            return match self.request_kills(&pane_ids) {
+                Action::None => Action::Redraw,
+                action => action,
+            };
+        }
+        if self.board.is_some()
+            && !ctrl
+            && let Some(action) = self.handle_board_key(key.code)
+        {
+            return action;
+        }
+        if key.code == KeyCode::Esc
+            || key.code == KeyCode::Char('q')
+            || (ctrl && key.code == KeyCode::Char('c'))
+        {
+            self.save_state();
+            return Action::Quit;
+        }
+        if ctrl && matches!(key.code, KeyCode::Char('d' | 'u')) {
+            return self.half_page(key.code == KeyCode::Char('d'));
+        }
+        if ctrl && matches!(key.code, KeyCode::Char('6' | '^')) {
+            let Some(index) = self
+                .previous_pane
+                .as_deref()
+                .and_then(|id| self.find_pane_by_id(id))
+            else {
+                return Action::None;
+            };
+            self.cursor = index;
+            self.preview_gen += 1;
+            return Action::Preview;
+        }
+        if config().quick_switch
+            && let KeyCode::Char(ch @ '1'..='9') = key.code
+        {
+            let Some(index) = self
+                .items
+                .iter()
+                .enumerate()
+                .filter(|(_, item)| matches!(item, TreeItem::Pane(_)))
+                .nth((ch as u8 - b'1') as usize)
+                .map(|(i, _)| i)
+            else {
+                return Action::None;
+            };
+            self.cursor = index;
+            return self.switch_to_current();
+        }
+        if let KeyCode::Char(ch) = key.code
+            && ch.is_ascii_digit()
+            && (self.count > 0 || ch != '0')
+        {
+            self.count = self
+                .count
                 .saturating_mul(10)
                 .saturating_add((ch as u8 - b'0') as usize);
             return Action::None;
         }
+        let counted = self.count > 0;
         let count = self.count.max(1);
         self.count = 0;
 
-        if key.code == KeyCode::Char('d') {
-            if self.pending_d {
-                self.pending_d = false;
-                self.pending_g = false;
-                if let Some((pane_id, target)) = self.remove_current_pane() {
-                    let tx = tx.clone();
-                    thread::spawn(move || {
-                        let err = kill_pane(&target).err().map(|e| e.to_string());
-                        let _ = tx.send(Msg::PaneKilled { pane_id, err });
+        if let Some(prefix) = self.pending_prefix.take()
+            && let KeyCode::Char(ch) = key.code
+        {
+            match (prefix, ch) {
+                ('m', 'a'..='z') | ('z', 'a' | 'o' | 'c' | 'R') if self.read_only => {
+                    self.notice = Some("read-only".to_string());
+                    return Action::Redraw;
+                }
+                (']' | '[', 'a') => return self.jump_to_attention(prefix == ']'),
+                ('m', 'a'..='z') => return self.set_mark(ch),
+                ('\'', 'a'..='z') => return self.jump_to_mark(ch),
+                ('y', 't' | 'p' | 'b') => return self.yank(ch),
+                ('z', 'a' | 'o' | 'c') => {
+                    return self.collapse(match ch {
+                        'o' => Some(false),
+                        'c' => Some(true),
+                        _ => None,
                     });
-                    return Action::Preview;
                 }
-                return Action::None;
+                ('z', 'R') => {
+                    let result = update_ui_state(|state| state.collapsed.clear());
+                    self.ui_state_written(result);
+                    self.replace_panes(self.panes.values().cloned().collect());
+                    return Action::Redraw;
+                }
+                ('z', 'z' | 't' | 'b') => {
+                    let h = self.list_height.max(1);
+                    self.scroll_start = match ch {
+                        'z' => self.cursor.saturating_sub(h / 2),
+                        't' => self.cursor,
+                        _ => (self.cursor + 1).saturating_sub(h),
+                    };
+                    return Action::Redraw;
+                }
+                _ => {}
             }
-            self.pending_d = true;
+        }
+        if let KeyCode::Char(ch @ ('[' | ']' | 'm' | '\'' | 'z' | 'y')) = key.code {
+            self.pending_prefix = Some(ch);
+            self.pending_d = None;
+            self.pending_g = false;
+            return Action::None;
+        }
+
+        if key.code == KeyCode::Char('d') {
             self.pending_g = false;
+            if let Some(first) = self.pending_d.take() {
+                return self.kill_panes(first * count);
+            }
+            self.pending_d = Some(count);
             return Action::None;
         }
-        self.pending_d = false;
+        self.pending_d = None;
 
         if key.code == KeyCode::Char('g') {
             if self.pending_g {
@@ -692,7 +1712,7 @@ impl App {
 
         match key.code {
             KeyCode::Char('?') => {
-                self.show_help = !self.show_help;
+                self.show_help = true;
                 Action::Redraw
             }
             KeyCode::Char('G') => {
@@ -700,59 +1720,288 @@ impl App {
                 self.preview_gen += 1;
                 Action::Preview
             }
-            KeyCode::Char(' ') => {
-                let mut changed = None;
-                if let Some(p) = self.current_pane_mut() {
-                    match p.status {
-                        PaneStatus::Idle => p.status = PaneStatus::Unread,
-                        PaneStatus::NeedsAttention | PaneStatus::Unread => {
-                            p.status = PaneStatus::Idle
-                        }
-                        PaneStatus::Busy => return Action::None,
-                    }
-                    changed = Some((p.pane_id.clone(), p.status));
-                }
-                if let Some((id, status)) = changed {
-                    self.pending_manual_statuses.insert(id, status);
-                    self.save_state();
+            KeyCode::Char(' ') => self.toggle_attention(),
+            KeyCode::Char('s') => self.stash_panes(count),
+            KeyCode::Char('.') => match self.last_action {
+                Some(Repeat::ToggleAttention) => self.toggle_attention(),
+                Some(Repeat::Snooze) => self.toggle_snooze(),
+                Some(Repeat::Stash(n)) => self.stash_panes(if counted { count } else { n }),
+                Some(Repeat::Kill(n)) => self.kill_panes(if counted { count } else { n }),
+                None => Action::None,
+            },
+            KeyCode::Char('u') => {
+                // The selected pane's stash wins over undoing a kill, so `u`
+                // never brings back some other pane instead.
+                let stashed = self.current_pane().is_some_and(|p| p.stashed);
+                if !stashed && self.undo_kill() {
+                    return Action::Preview;
                 }
-                Action::Redraw
-            }
-            KeyCode::Char('s') => {
                 let mut selected = None;
-                if let Some(p) = self.current_pane_mut() {
-                    p.stashed = !p.stashed;
-                    selected = Some(p.pane_id.clone());
+                if let Some(p) = self.current_pane_mut()
+                    && p.stashed
+                {
+                    p.stashed = false;
+                    selected = Some(p.clone());
                 }
-                if let Some(id) = selected {
+                if let Some(p) = selected {
                     self.rebuild_items();
                     self.cursor = self
-                        .find_pane_by_id(&id)
+                        .find_pane_by_id(&p.pane_id)
                         .unwrap_or_else(|| nearest_pane(&self.items, self.cursor));
-                    self.save_state();
+                    let result = ipc::set_pane_stashed(&p, false);
+                    self.ui_state_written(result);
+                    return Action::Redraw;
+                }
+                Action::None
+            }
+            KeyCode::Char('v') => {
+                if let Some(id) = self.current_pane().map(|p| p.pane_id.clone())
+                    && !self.marked.remove(&id)
+                {
+                    self.marked.insert(id);
                 }
                 Action::Redraw
             }
-            KeyCode::Char('u') => {
+            KeyCode::Char('h') => {
+                let Some(workspace) = self.history_workspace() else {
+                    return Action::None;
+                };
+                self.list_view = Some(ListView::new(ListSource::History(workspace)));
+                Action::LoadList
+            }
+            KeyCode::Char('e') => {
+                let Some(p) = self.current_pane() else {
+                    return Action::None;
+                };
+                match transcript::latest(&p.provider, &p.path) {
+                    Some(session) => self.export_session(&session),
+                    None => {
+                        self.err = Some(format!("no {} transcript for {}", p.provider, p.target));
+                        Action::Redraw
+                    }
+                }
+            }
+            KeyCode::Char('W') => {
+                let Some(p) = self.current_pane() else {
+                    return Action::None;
+                };
+                match record::toggle(p) {
+                    Ok((file, true)) => {
+                        self.notice = Some(format!("recording to {}", file.display()))
+                    }
+                    Ok((file, false)) => self.notice = Some(format!("saved {}", file.display())),
+                    Err(err) => self.err = Some(format!("{err:#}")),
+                }
+                Action::Redraw
+            }
+            KeyCode::Char('A') => {
+                self.list_view = Some(ListView::new(ListSource::Archive));
+                Action::LoadList
+            }
+            KeyCode::Char('D') => {
+                self.list_view = Some(ListView::new(ListSource::Diagnostics));
+                Action::LoadList
+            }
+            KeyCode::Char('Q') => {
+                self.list_view = Some(ListView::new(ListSource::Tasks));
+                Action::LoadList
+            }
+            KeyCode::Char('V') => {
+                self.review = Some(ReviewView {
+                    loading: true,
+                    ..ReviewView::default()
+                });
+                Action::LoadReview
+            }
+            KeyCode::Char('/') => {
+                self.input = Some(LineInput {
+                    kind: InputKind::Search,
+                    text: String::new(),
+                });
+                Action::Redraw
+            }
+            KeyCode::Char('b') => {
+                self.board = Some(self.board_cursor_at_current());
+                Action::Redraw
+            }
+            KeyCode::Char('i') => {
+                self.show_detail = !self.show_detail;
+                self.preview_gen += 1;
+                Action::Preview
+            }
+            KeyCode::Char('f') => {
+                let filter = self.ui_state.filter.next();
+                let result = update_ui_state(|state| state.filter = filter);
+                self.ui_state_written(result);
+                self.rebuild_items();
+                self.cursor = nearest_pane(&self.items, self.cursor);
+                self.preview_gen += 1;
+                Action::Preview
+            }
+            KeyCode::Char('S') => {
+                let sort = self.ui_state.sort.next();
+                let result = update_ui_state(|state| state.sort = sort);
+                self.ui_state_written(result);
+                self.replace_panes(self.panes.values().cloned().collect());
+                self.preview_gen += 1;
+                Action::Preview
+            }
+            KeyCode::Char('p') => {
+                let Some(p) = self.current_pane() else {
+                    return Action::None;
+                };
+                let pane_id = p.pane_id.clone();
+                let rate = self.preview_rate(&pane_id).next();
+                let result = update_ui_state(|state| {
+                    if rate == PreviewRate::Normal {
+                        state.preview_rates.remove(&pane_id);
+                    } else {
+                        state.preview_rates.insert(pane_id.clone(), rate);
+                    }
+                });
+                self.ui_state_written(result);
+                Action::Redraw
+            }
+            KeyCode::Char('T') => {
+                let tree = self.ui_state.tree.next();
+                let result = update_ui_state(|state| state.tree = tree);
+                self.ui_state_written(result);
+                self.replace_panes(self.panes.values().cloned().collect());
+                self.preview_gen += 1;
+                Action::Preview
+            }
+            KeyCode::Char('#') => {
+                if let Some(p) = self.current_pane() {
+                    self.input = Some(LineInput {
+                        kind: InputKind::Tags {
+                            pane_id: p.pane_id.clone(),
+                        },
+                        text: p.tags.join(" "),
+                    });
+                    return Action::Redraw;
+                }
+                Action::None
+            }
+            KeyCode::Char('+') => {
+                self.input = Some(LineInput {
+                    kind: InputKind::TagFilter,
+                    text: self.ui_state.tag_filter.clone(),
+                });
+                Action::Redraw
+            }
+            KeyCode::Char('C') => {
+                let ids = self.cleanup_candidates();
+                if ids.is_empty() {
+                    return Action::None;
+                }
+                self.marked = ids.into_iter().collect();
+                Action::Redraw
+            }
+            KeyCode::Char('K') => {
+                let ids: Vec<String> = self
+                    .marked
+                    .iter()
+                    .filter(|id| self.panes.contains_key(*id))
+                    .cloned()
+                    .collect();
+                if ids.is_empty() {
+                    return Action::None;
+                }
+                self.confirm_kill = Some(ids);
+                Action::Redraw
+            }
+            KeyCode::Char('B') => {
+                let pane_ids = self.broadcast_targets();
+                if pane_ids.is_empty() {
+                    return Action::None;
+                }
+                self.input = Some(LineInput {
+                    kind: InputKind::Broadcast { pane_ids },
+                    text: String::new(),
+                });
+                Action::Redraw
+            }
+            KeyCode::Char('F') => {
+                if let Some(p) = self.current_pane() {
+                    self.input = Some(LineInput {
+                        kind: InputKind::OnFinish {
+                            pane_id: p.pane_id.clone(),
+                        },
+                        text: String::new(),
+                    });
+                    return Action::Redraw;
+                }
+                Action::None
+            }
+            KeyCode::Char('n') => {
+                self.input = Some(LineInput {
+                    kind: InputKind::Spawn,
+                    text: String::new(),
+                });
+                Action::Redraw
+            }
+            KeyCode::Char('P') => {
+                if let Some(p) = self.current_pane() {
+                    self.input = Some(LineInput {
+                        kind: InputKind::QueuePrompt {
+                            pane_id: p.pane_id.clone(),
+                        },
+                        text: String::new(),
+                    });
+                    return Action::Redraw;
+                }
+                Action::None
+            }
+            KeyCode::Char('Z') => self.toggle_snooze(),
+            KeyCode::Char('x') => {
+                if let Some(err) = self.err.take() {
+                    self.dismissed_err = Some(err);
+                    return Action::Redraw;
+                }
+                if self.notice.take().is_some() {
+                    return Action::Redraw;
+                }
+                if !self.cleanup_dismissed && !self.cleanup_candidates().is_empty() {
+                    self.cleanup_dismissed = true;
+                    return Action::Redraw;
+                }
+                Action::None
+            }
+            KeyCode::Char('r') => {
+                if let Some(p) = self.current_pane()
+                    && p.terminated
+                    && let Err(err) = ipc::respawn_pane(p)
+                {
+                    self.err = Some(format!("{err:#}"));
+                }
+                Action::Redraw
+            }
+            KeyCode::Char('X') => {
                 let mut selected = None;
-                if let Some(p) = self.current_pane_mut()
-                    && p.stashed
+                if let Some(p) = self.current_pane()
+                    && p.terminated
                 {
-                    p.stashed = false;
-                    selected = Some(p.pane_id.clone());
+                    selected = Some(p.clone());
                 }
-                if let Some(id) = selected {
+                if let Some(p) = selected {
+                    self.panes.remove(&p.pane_id);
                     self.rebuild_items();
-                    self.cursor = self
-                        .find_pane_by_id(&id)
-                        .unwrap_or_else(|| nearest_pane(&self.items, self.cursor));
-                    self.save_state();
-                    return Action::Redraw;
+                    self.cursor = nearest_pane(&self.items, self.cursor);
+                    self.preview_gen += 1;
+                    let result = ipc::dismiss_pane(&p);
+                    self.ui_state_written(result);
+                    return Action::Preview;
                 }
                 Action::None
             }
+            KeyCode::Char('o') => match self.current_pane() {
+                Some(p) => Action::OpenWorkspace(Box::new(p.clone())),
+                None => Action::None,
+            },
             KeyCode::Char('R') => {
-                let _ = restart_watch();
+                if let Err(err) = restart_watch() {
+                    log::warn("restart watcher failed", &[("err", &format!("{err:#}"))]);
+                }
                 Action::LoadPanes
             }
             KeyCode::Char('H') => {
@@ -770,7 +2019,7 @@ impl App {
             }
             KeyCode::Char('j') | KeyCode::Down => {
                 for _ in 0..count {
-                    let next = next_pane(&self.items, self.cursor);
+                    let next = next_row(&self.items, self.cursor);
                     if next == self.cursor {
                         break;
                     }
@@ -781,7 +2030,7 @@ impl App {
             }
             KeyCode::Char('k') | KeyCode::Up => {
                 for _ in 0..count {
-                    let prev = prev_pane(&self.items, self.cursor);
+                    let prev = prev_row(&self.items, self.cursor);
                     if prev == self.cursor {
                         break;
                     }
@@ -790,17 +2039,15 @@ impl App {
                 self.preview_gen += 1;
                 Action::Preview
             }
-            KeyCode::Enter => {
-                if let Some(p) = self.current_pane() {
-                    let pane_id = p.pane_id.clone();
-                    let target = p.target.clone();
-                    let was_unread = p.status == PaneStatus::Unread
-                        && !has_manual_status(&self.ui_state, &pane_id, &target);
-                    if was_unread {
-                        self.pending_manual_statuses
-                            .insert(pane_id, PaneStatus::Idle);
-                    }
-                    let _ = switch_to_pane(&target);
+            KeyCode::Enter => self.switch_to_current(),
+            KeyCode::Char('-') => {
+                if let Some(origin) = &self.origin
+                    && let Err(err) = switch_to_pane(origin)
+                {
+                    log::warn(
+                        "switch failed",
+                        &[("target", origin), ("err", &format!("{err:#}"))],
+                    );
                 }
                 self.save_state();
                 Action::Quit
@@ -809,6 +2056,803 @@ impl App {
         }
     }
 
+    /// The directory whose past sessions `h` lists: the selected pane's, or
+    /// that of the first pane under the selected header.
+    fn history_workspace(&self) -> Option<String> {
+        let pane = match self.current_pane() {
+            Some(pane) => pane,
+            None => self.panes.get(self.header_panes()?.first()?)?,
+        };
+        Some(pane.path.clone())
+    }
+
+    /// `name` with `▸` and the number of hidden panes when `header` is
+    /// folded. Tmux tree headers show `▾` when open.
+    fn fold_label(&self, header: &TreeItem, name: &str) -> String {
+        let indent = name.len() - name.trim_start().len();
+        let (indent, name) = name.split_at(indent);
+        match self.folded_panes(header) {
+            Some(panes) => format!("{indent}▸ {name} ({})", panes.len()),
+            None if matches!(header, TreeItem::Session(_) | TreeItem::Window(_)) => {
+                format!("{indent}▾ {name}")
+            }
+            None => format!("{indent}{name}"),
+        }
+    }
+
+    /// How many panes of `header`'s workspace, or of its project when
+    /// `project`, are stashed away in the stashed section. Only counted for
+    /// headers outside it.
+    fn stashed_under(&self, header: &Pane, project: bool) -> usize {
+        if header.stashed
+            || header.terminated
+            || config().stash_placement == StashPlacement::Workspace
+        {
+            return 0;
+        }
+        self.panes
+            .values()
+            .filter(|p| p.stashed && !p.terminated)
+            .filter(|p| {
+                if project {
+                    p.host.is_empty() && p.project_root == header.project_root
+                } else {
+                    p.host == header.host && p.path == header.path
+                }
+            })
+            .count()
+    }
+
+    fn preview_rate(&self, pane_id: &str) -> PreviewRate {
+        self.ui_state
+            .preview_rates
+            .get(pane_id)
+            .copied()
+            .unwrap_or_default()
+    }
+
+    /// How often to recapture the preview unasked: by the previewed pane's
+    /// rate, and never in power-save mode.
+    fn preview_interval(&self) -> Option<Duration> {
+        if self.power_save {
+            return None;
+        }
+        let rate = self
+            .current_pane()
+            .map_or(PreviewRate::Normal, |p| self.preview_rate(&p.pane_id));
+        let ms = match rate {
+            PreviewRate::Fast => config().preview.fast_refresh_ms,
+            PreviewRate::Normal => config().preview.refresh_ms,
+            PreviewRate::Paused => return None,
+        };
+        Some(Duration::from_millis(ms))
+    }
+
+    /// Whether the pane's queued prompts wait on the concurrency limit
+    /// rather than on the agent.
+    fn held(&self, p: &Pane) -> bool {
+        !p.queued_prompts.is_empty()
+            && matches!(p.status, PaneStatus::Idle | PaneStatus::Unread)
+            && !Throttle::new(self.panes.values()).admits(&p.provider)
+    }
+
+    /// Whether agents under `header`, or under its project when `project`,
+    /// may be editing the same checkout at once.
+    fn conflicted(&self, header: &Pane, project: bool) -> bool {
+        if header.stashed || header.terminated {
+            return false;
+        }
+        let across_worktrees = config().header_marks.conflict_across_worktrees;
+        let shared = shared_workspaces(self.panes.values(), across_worktrees);
+        if project {
+            self.panes.values().any(|p| {
+                p.host == header.host
+                    && p.project_root == header.project_root
+                    && shared.contains(&workspace_key(p, across_worktrees))
+            })
+        } else {
+            shared.contains(&workspace_key(header, across_worktrees))
+        }
+    }
+
+    /// Steps through the dirty workspaces: `j`/`k` pick one, `J`/`K` and
+    /// `space` scroll its diff, and `a`/`f`/`c` approve it, flag it for
+    /// follow-up, or commit it as a checkpoint. Any key but `c` cancels a
+    /// pending commit confirmation.
+    fn handle_review_key(&mut self, code: KeyCode) -> Action {
+        let Some(view) = self.review.as_mut() else {
+            return Action::None;
+        };
+        if code != KeyCode::Char('c') && view.confirm.take().is_some() {
+            self.notice = None;
+        }
+        let (_, page) = review_rows(self.height, view.workspaces.len());
+        let last = view.workspaces.len().saturating_sub(1);
+        match code {
+            KeyCode::Char('j') | KeyCode::Down => {
+                view.cursor = (view.cursor + 1).min(last);
+                view.scroll = 0;
+            }
+            KeyCode::Char('k') | KeyCode::Up => {
+                view.cursor = view.cursor.saturating_sub(1);
+                view.scroll = 0;
+            }
+            KeyCode::Char('J') => view.scroll += 1,
+            KeyCode::Char('K') => view.scroll = view.scroll.saturating_sub(1),
+            KeyCode::Char(' ') | KeyCode::PageDown => view.scroll += page,
+            KeyCode::PageUp => view.scroll = view.scroll.saturating_sub(page),
+            KeyCode::Char('a') => return self.review_verdict(Verdict::Approved),
+            KeyCode::Char('f') => return self.review_verdict(Verdict::FollowUp),
+            KeyCode::Char('c') => return self.review_checkpoint(),
+            KeyCode::Char('r') => {
+                view.loading = true;
+                return Action::LoadReview;
+            }
+            KeyCode::Enter => {
+                let pane_id = view.workspaces.get(view.cursor).map(|w| w.pane_id.clone());
+                self.review = None;
+                return self.switch_to(pane_id.as_deref());
+            }
+            KeyCode::Char('V' | 'q') | KeyCode::Esc => {
+                self.review = None;
+                return Action::Redraw;
+            }
+            _ => return Action::None,
+        }
+        if let Some(workspace) = view.workspaces.get(view.cursor) {
+            let lines = review_diff_lines(workspace).len();
+            view.scroll = view.scroll.min(lines.saturating_sub(page));
+        }
+        Action::Redraw
+    }
+
+    /// Gives the selected workspace a verdict, or takes it back when it
+    /// already has that one, and moves on to the next workspace.
+    fn review_verdict(&mut self, verdict: Verdict) -> Action {
+        let Some(view) = self.review.as_mut() else {
+            return Action::None;
+        };
+        let Some(workspace) = view.workspaces.get(view.cursor) else {
+            return Action::None;
+        };
+        let verdict =
+            Some(verdict).filter(|v| review::verdict(&self.ui_state, workspace) != Some(*v));
+        let result = review::set_verdict(workspace, verdict);
+        if verdict.is_some() && result.is_ok() && view.cursor + 1 < view.workspaces.len() {
+            view.cursor += 1;
+            view.scroll = 0;
+        }
+        self.ui_state_written(result);
+        Action::Redraw
+    }
+
+    /// Commits the selected workspace once its changes are approved or a
+    /// second `c` confirms them. Refused while one of its agents is busy.
+    fn review_checkpoint(&mut self) -> Action {
+        let Some(view) = self.review.as_mut() else {
+            return Action::None;
+        };
+        let Some(workspace) = view.workspaces.get(view.cursor) else {
+            return Action::None;
+        };
+        if view.committing {
+            self.notice = Some("a checkpoint is already running".to_string());
+            return Action::Redraw;
+        }
+        let busy = workspace.pane_ids.iter().any(|id| {
+            self.panes
+                .get(id)
+                .is_some_and(|p| p.status == PaneStatus::Busy)
+        });
+        if busy {
+            view.confirm = None;
+            self.err = Some(format!(
+                "an agent is still busy in {}",
+                workspace.short_path
+            ));
+            return Action::Redraw;
+        }
+        let approved = review::verdict(&self.ui_state, workspace) == Some(Verdict::Approved);
+        if !approved && view.confirm.as_ref() != Some(&workspace.changes) {
+            view.confirm = Some(workspace.changes.clone());
+            let noun = if workspace.files.len() == 1 {
+                "file"
+            } else {
+                "files"
+            };
+            self.notice = Some(format!(
+                "press c again to commit {} {noun} in {}",
+                workspace.files.len(),
+                workspace.short_path
+            ));
+            return Action::Redraw;
+        }
+        view.confirm = None;
+        view.committing = true;
+        self.notice = Some(format!("committing {}…", workspace.short_path));
+        Action::Checkpoint(Box::new(workspace.clone()))
+    }
+
+    fn checkpoint_done(&mut self, workspace: review::Workspace, result: Result<String, String>) {
+        let committed = result.is_ok();
+        match result {
+            Ok(hash) => {
+                self.notice = Some(format!("committed {hash} in {}", workspace.short_path));
+                self.ui_state = load_ui_state();
+            }
+            Err(err) => {
+                self.notice = None;
+                self.err = Some(err);
+            }
+        }
+        let Some(view) = self.review.as_mut() else {
+            return;
+        };
+        view.committing = false;
+        if committed {
+            view.workspaces.retain(|w| w.path != workspace.path);
+            view.cursor = view.cursor.min(view.workspaces.len().saturating_sub(1));
+            view.scroll = 0;
+        }
+    }
+
+    fn handle_list_key(&mut self, key: KeyEvent) -> Action {
+        let Some(list) = self.list_view.as_mut() else {
+            return Action::None;
+        };
+        let last = list.rows.len().saturating_sub(1);
+        match key.code {
+            KeyCode::Char('j') | KeyCode::Down => list.cursor = (list.cursor + 1).min(last),
+            KeyCode::Char('k') | KeyCode::Up => list.cursor = list.cursor.saturating_sub(1),
+            KeyCode::Char('g') => list.cursor = 0,
+            KeyCode::Char('G') => list.cursor = last,
+            KeyCode::Enter => {
+                let workspace = match &list.source {
+                    ListSource::History(workspace) => workspace.clone(),
+                    _ => String::new(),
+                };
+                return match list.rows.get(list.cursor).cloned() {
+                    Some((ListItem::Session(session), _)) => self.jump_to_session(&session),
+                    Some((ListItem::Commit(commit), _)) => self.view_output(
+                        format!("git show {}", commit.hash),
+                        &commit.hash,
+                        &workspace,
+                    ),
+                    Some((ListItem::Archive(entry), _)) => {
+                        self.view_output(archive::view_command(&entry.file), "archive", "")
+                    }
+                    Some((ListItem::Task(task), _)) if self.panes.contains_key(&task.pane_id) => {
+                        self.switch_to(Some(&task.pane_id))
+                    }
+                    Some((ListItem::Problem(..) | ListItem::Task(_), _)) | None => Action::None,
+                };
+            }
+            KeyCode::Char('e') => {
+                let Some((ListItem::Session(session), _)) = list.rows.get(list.cursor).cloned()
+                else {
+                    return Action::None;
+                };
+                self.list_view = None;
+                return self.export_session(&session);
+            }
+            KeyCode::Char('r') => {
+                let Some((ListItem::Session(session), _)) = list.rows.get(list.cursor) else {
+                    return Action::None;
+                };
+                let result = Spawn::resume(session).and_then(|request| spawn::spawn(&request));
+                if let Err(err) = result {
+                    self.err = Some(format!("{err:#}"));
+                    return Action::Redraw;
+                }
+                self.list_view = None;
+                return Action::LoadPanes;
+            }
+            KeyCode::Char('h' | 'A' | 'D' | 'Q' | 'q') | KeyCode::Esc => {
+                self.list_view = None;
+                return Action::Redraw;
+            }
+            _ => return Action::None,
+        }
+        let rows = list_rows(self.height, list.rows.len());
+        list.scroll = keep_visible(list.rows.len(), list.cursor, list.scroll, rows);
+        Action::Redraw
+    }
+
+    /// Runs a pager command in a new focused window, e.g. over an archived
+    /// output or a commit.
+    fn view_output(&mut self, command: String, window_name: &str, directory: &str) -> Action {
+        let request = Spawn {
+            command,
+            window_name: window_name.to_string(),
+            directory: directory.to_string(),
+            focus: true,
+            ..Spawn::default()
+        };
+        if let Err(err) = spawn::spawn(&request) {
+            self.err = Some(format!("{err:#}"));
+            return Action::Redraw;
+        }
+        self.save_state();
+        Action::Quit
+    }
+
+    /// Copies the selected pane's target (`yt`), directory (`yp`) or branch
+    /// (`yb`).
+    fn yank(&mut self, what: char) -> Action {
+        let Some(p) = self.current_pane() else {
+            return Action::None;
+        };
+        let (label, text) = match what {
+            't' => ("target", p.target.clone()),
+            'p' => ("path", p.path.clone()),
+            _ if !p.git_branch.is_empty() => ("branch", p.git_branch.clone()),
+            _ => ("branch", p.project_branch.clone()),
+        };
+        if text.is_empty() {
+            self.err = Some(format!("no {label} for {}", p.target));
+            return Action::Redraw;
+        }
+        match copy_text(&text) {
+            Ok(()) => self.notice = Some(format!("copied {text}")),
+            Err(err) => self.err = Some(format!("{err:#}")),
+        }
+        Action::Redraw
+    }
+
+    /// Writes the session as Markdown and copies it to the tmux buffer.
+    fn export_session(&mut self, session: &Session) -> Action {
+        let result = transcript::export(session).and_then(|file| {
+            load_buffer(&file)?;
+            Ok(file)
+        });
+        match result {
+            Ok(file) => self.notice = Some(format!("copied {}", file.display())),
+            Err(err) => self.err = Some(format!("{err:#}")),
+        }
+        Action::Redraw
+    }
+
+    /// Switches to the live pane running the session's agent in its
+    /// directory, if there is one.
+    fn jump_to_session(&mut self, session: &Session) -> Action {
+        let index = self
+            .panes
+            .values()
+            .filter(|p| !p.terminated && p.provider == session.provider && p.path == session.path)
+            .find_map(|p| self.find_pane_by_id(&p.pane_id));
+        let Some(index) = index else {
+            self.err = Some(format!(
+                "no {} pane open in {}",
+                session.provider, session.path
+            ));
+            return Action::Redraw;
+        };
+        self.list_view = None;
+        self.cursor = index;
+        self.switch_to_current()
+    }
+
+    /// The selected pane and the panes below it, up to `count`.
+    fn panes_from_cursor(&self, count: usize) -> Vec<String> {
+        self.items
+            .iter()
+            .skip(self.cursor)
+            .filter_map(|item| match item {
+                TreeItem::Pane(id) => Some(id.clone()),
+                _ => None,
+            })
+            .take(count)
+            .collect()
+    }
+
+    fn toggle_attention(&mut self) -> Action {
+        if let Some(ids) = self.header_panes() {
+            return self.mark_read(&ids);
+        }
+        let Some(p) = self.current_pane_mut() else {
+            return Action::None;
+        };
+        if p.do_not_disturb || p.status == PaneStatus::Busy {
+            p.do_not_disturb = !p.do_not_disturb;
+            let p = p.clone();
+            let result = ipc::set_pane_do_not_disturb(&p, p.do_not_disturb);
+            self.ui_state_written(result);
+            self.last_action = Some(Repeat::ToggleAttention);
+            return Action::Redraw;
+        }
+        match p.status {
+            PaneStatus::Idle => p.status = PaneStatus::Unread,
+            PaneStatus::NeedsAttention | PaneStatus::Unread | PaneStatus::Error => {
+                p.status = PaneStatus::Idle
+            }
+            PaneStatus::Busy | PaneStatus::Disconnected => return Action::None,
+        }
+        let p = p.clone();
+        let result = ipc::set_pane_manual_status(&p, p.status);
+        self.ui_state_written(result);
+        self.last_action = Some(Repeat::ToggleAttention);
+        Action::Redraw
+    }
+
+    /// Clears attention and unread on every pane in `ids`.
+    fn mark_read(&mut self, ids: &[String]) -> Action {
+        let mut result = Ok(());
+        for id in ids {
+            let Some(p) = self.panes.get_mut(id) else {
+                continue;
+            };
+            if !p.status.wants_attention() {
+                continue;
+            }
+            p.status = PaneStatus::Idle;
+            let p = p.clone();
+            result = result.and(ipc::set_pane_manual_status(&p, PaneStatus::Idle));
+        }
+        self.ui_state_written(result);
+        Action::Redraw
+    }
+
+    /// Toggles stash on `count` panes from the cursor, all to the opposite of
+    /// the selected pane's state. The cursor stays put, so the next pane is
+    /// selected afterwards.
+    fn stash_panes(&mut self, count: usize) -> Action {
+        let header = self
+            .header_panes()
+            .map(|ids| (self.items[self.cursor].clone(), ids));
+        let (ids, stashed) = if let Some((_, ids)) = &header {
+            let any_shown = ids
+                .iter()
+                .any(|id| self.panes.get(id).is_some_and(|p| !p.stashed));
+            (ids.clone(), any_shown)
+        } else {
+            let ids = self.panes_from_cursor(count);
+            let Some(stashed) = ids
+                .first()
+                .and_then(|id| self.panes.get(id))
+                .map(|p| !p.stashed)
+            else {
+                return Action::None;
+            };
+            (ids, stashed)
+        };
+        let mut result = Ok(());
+        for id in &ids {
+            let Some(p) = self.panes.get_mut(id) else {
+                continue;
+            };
+            p.stashed = stashed;
+            let p = p.clone();
+            result = result.and(ipc::set_pane_stashed(&p, stashed));
+        }
+        self.rebuild_items();
+        self.cursor = header
+            .and_then(|(item, _)| self.items.iter().position(|it| *it == item))
+            .unwrap_or_else(|| nearest_pane(&self.items, self.cursor));
+        self.preview_gen += 1;
+        self.ui_state_written(result);
+        self.last_action = Some(Repeat::Stash(count));
+        Action::Preview
+    }
+
+    fn toggle_snooze(&mut self) -> Action {
+        let Some(p) = self.current_pane_mut() else {
+            return Action::None;
+        };
+        let minutes = if p.snoozed_until.is_some() {
+            p.snoozed_until = None;
+            0
+        } else {
+            let minutes = config().snooze_minutes;
+            p.snoozed_until =
+                Some(chrono::Utc::now() + chrono::Duration::minutes(i64::from(minutes)));
+            minutes
+        };
+        let p = p.clone();
+        let result = ipc::snooze_pane(&p, minutes);
+        self.ui_state_written(result);
+        self.last_action = Some(Repeat::Snooze);
+        Action::Redraw
+    }
+
+    fn kill_panes(&mut self, count: usize) -> Action {
+        if let Some(ids) = self.header_panes() {
+            if ids.is_empty() {
+                return Action::None;
+            }
+            self.confirm_kill = Some(ids);
+            return Action::Redraw;
+        }
+        let ids = self.panes_from_cursor(count);
+        if ids.is_empty() {
+            return Action::None;
+        }
+        self.last_action = Some(Repeat::Kill(count));
+        if config().confirm_kill {
+            self.confirm_kill = Some(ids);
+            return Action::Redraw;
+        }
+        self.request_kills(&ids);
+        Action::Preview
+    }
+
+    /// The status board's columns: listed panes neither stashed nor
+    /// terminated, most urgent and then most recent first.
+    fn board_columns(&self) -> [Vec<&Pane>; 4] {
+        let mut columns: [Vec<&Pane>; 4] = Default::default();
+        for p in self.panes.values() {
+            if self.ui_state.shows(p) && !p.stashed && !p.terminated {
+                columns[board_column(p.shown_status())].push(p);
+            }
+        }
+        for column in &mut columns {
+            column.sort_by(|a, b| a.order.cmp(&b.order).then(a.target.cmp(&b.target)));
+            column.sort_by_key(|p| status_rank(p));
+        }
+        columns
+    }
+
+    fn board_pane(&self) -> Option<&Pane> {
+        let cursor = self.board?;
+        let column = &self.board_columns()[cursor.column];
+        column
+            .get(cursor.row.min(column.len().saturating_sub(1)))
+            .copied()
+    }
+
+    /// Where the sidebar's selected pane sits on the board.
+    fn board_cursor_at_current(&self) -> BoardCursor {
+        let Some(current) = self.current_pane() else {
+            return BoardCursor::default();
+        };
+        let column = board_column(current.shown_status());
+        let row = self.board_columns()[column]
+            .iter()
+            .position(|p| p.pane_id == current.pane_id)
+            .unwrap_or(0);
+        BoardCursor { column, row }
+    }
+
+    /// Moves around the status board. Keys it leaves alone (`None`) act on
+    /// the selected card as they would in the list.
+    fn handle_board_key(&mut self, code: KeyCode) -> Option<Action> {
+        let mut cursor = self.board?;
+        let columns = self.board_columns();
+        let len = |column: usize| columns[column].len();
+        match code {
+            KeyCode::Char('b') | KeyCode::Esc => {
+                self.board = None;
+                return Some(Action::Redraw);
+            }
+            KeyCode::Enter => {
+                let pane_id = self.board_pane().map(|p| p.pane_id.clone());
+                return Some(self.switch_to(pane_id.as_deref()));
+            }
+            KeyCode::Char('h') | KeyCode::Left => cursor.column = cursor.column.saturating_sub(1),
+            KeyCode::Char('l') | KeyCode::Right => {
+                cursor.column = (cursor.column + 1).min(BOARD_COLUMNS.len() - 1)
+            }
+            KeyCode::Char('j') | KeyCode::Down => cursor.row += 1,
+            KeyCode::Char('k') | KeyCode::Up => cursor.row = cursor.row.saturating_sub(1),
+            KeyCode::Char('g') => cursor.row = 0,
+            KeyCode::Char('G') => cursor.row = len(cursor.column).saturating_sub(1),
+            _ => return None,
+        }
+        cursor.row = cursor.row.min(len(cursor.column).saturating_sub(1));
+        // Keep the list cursor on the card so other keys act on it.
+        let pane_id = columns[cursor.column]
+            .get(cursor.row)
+            .map(|p| p.pane_id.clone());
+        self.board = Some(cursor);
+        if let Some(index) = pane_id.and_then(|id| self.find_pane_by_id(&id)) {
+            self.cursor = index;
+        }
+        self.preview_gen += 1;
+        Some(Action::Preview)
+    }
+
+    /// Moves the cursor and the view by half the list height, like vim's
+    /// ctrl-d and ctrl-u.
+    fn half_page(&mut self, down: bool) -> Action {
+        if self.items.is_empty() {
+            return Action::None;
+        }
+        let step = (self.list_height / 2).max(1);
+        let target = if down {
+            (self.cursor + step).min(self.items.len() - 1)
+        } else {
+            self.cursor.saturating_sub(step)
+        };
+        self.scroll_start = if down {
+            self.scroll_start + step
+        } else {
+            self.scroll_start.saturating_sub(step)
+        };
+        self.cursor = nearest_pane(&self.items, target);
+        self.preview_gen += 1;
+        Action::Preview
+    }
+
+    fn switch_to_current(&mut self) -> Action {
+        let pane_id = self.current_pane().map(|p| p.pane_id.clone());
+        self.switch_to(pane_id.as_deref())
+    }
+
+    fn switch_to(&mut self, pane_id: Option<&str>) -> Action {
+        if let Some(p) = pane_id.and_then(|id| self.panes.get(id)) {
+            let was_unread = p.status == PaneStatus::Unread
+                && !self.read_only
+                && !has_manual_status(&self.ui_state, &p.pane_id, &p.target);
+            if was_unread && let Err(err) = ipc::set_pane_manual_status(p, PaneStatus::Idle) {
+                log::warn("mark read failed", &[("err", &format!("{err:#}"))]);
+            }
+            if let Err(err) = switch_to_pane(&p.target) {
+                log::warn(
+                    "switch failed",
+                    &[("target", &p.target), ("err", &format!("{err:#}"))],
+                );
+            } else if !config().return_key.is_empty()
+                && backend_of(&p.target) == Backend::Tmux
+                && let Err(err) = tmux::bind_once(&config().return_key, &reopen_command())
+            {
+                log::warn("bind return key failed", &[("err", &format!("{err:#}"))]);
+            }
+        }
+        self.save_state();
+        Action::Quit
+    }
+
+    /// The 1-based quick-switch number shown next to the first nine panes.
+    fn quick_index(&self, pane_id: &str) -> Option<usize> {
+        self.items
+            .iter()
+            .filter(|item| matches!(item, TreeItem::Pane(_)))
+            .take(9)
+            .position(|item| matches!(item, TreeItem::Pane(id) if id == pane_id))
+            .map(|i| i + 1)
+    }
+
+    fn cleanup_candidates(&self) -> Vec<String> {
+        let panes: Vec<Pane> = self.panes.values().cloned().collect();
+        cleanup::candidates(&panes, config().cleanup, chrono::Utc::now())
+            .into_iter()
+            .map(|pane| pane.pane_id.clone())
+            .collect()
+    }
+
+    /// Marked panes, the panes under the selected header, or every live pane
+    /// in the selected pane's workspace.
+    fn broadcast_targets(&self) -> Vec<String> {
+        let marked: Vec<String> = self
+            .marked
+            .iter()
+            .filter(|id| self.panes.contains_key(*id))
+            .cloned()
+            .collect();
+        if !marked.is_empty() {
+            return marked;
+        }
+        if let Some(ids) = self.header_panes() {
+            return ids
+                .into_iter()
+                .filter(|id| self.panes.get(id).is_some_and(|p| !p.terminated))
+                .collect();
+        }
+        let Some(current) = self.current_pane() else {
+            return Vec::new();
+        };
+        self.panes
+            .values()
+            .filter(|p| !p.terminated && p.host == current.host && same_workspace(p, current))
+            .map(|p| p.pane_id.clone())
+            .collect()
+    }
+
+    fn handle_input_key(&mut self, key: KeyEvent, ctrl: bool) -> Action {
+        let Some(input) = self.input.as_mut() else {
+            return Action::None;
+        };
+        match key.code {
+            KeyCode::Esc => self.input = None,
+            KeyCode::Enter => {
+                if let Some(input) = self.input.take() {
+                    self.submit_input(input);
+                }
+                if self.list_view.as_ref().is_some_and(|list| list.loading) {
+                    return Action::LoadList;
+                }
+            }
+            KeyCode::Backspace => {
+                input.text.pop();
+            }
+            KeyCode::Char('u') if ctrl => input.text.clear(),
+            KeyCode::Char(ch) if !ctrl => input.text.push(ch),
+            _ => return Action::None,
+        }
+        Action::Redraw
+    }
+
+    fn submit_input(&mut self, input: LineInput) {
+        let text = input.text.trim();
+        // Tags are cleared by submitting nothing.
+        match input.kind {
+            InputKind::Tags { pane_id } => {
+                let Some(p) = self.panes.get(&pane_id).cloned() else {
+                    return;
+                };
+                let tags = parse_tags(text);
+                let key = tag_key(&p);
+                for pane in self.panes.values_mut().filter(|pane| tag_key(pane) == key) {
+                    pane.tags = tags.clone();
+                }
+                let result = set_pane_tags(&p, tags);
+                self.ui_state_written(result);
+                self.replace_panes(self.panes.values().cloned().collect());
+                return;
+            }
+            InputKind::TagFilter => {
+                let tag = text.trim_start_matches('#').to_string();
+                let result = update_ui_state(|state| state.tag_filter = tag.clone());
+                self.ui_state_written(result);
+                self.replace_panes(self.panes.values().cloned().collect());
+                self.preview_gen += 1;
+                return;
+            }
+            _ if text.is_empty() => return,
+            _ => {}
+        }
+        match input.kind {
+            InputKind::QueuePrompt { pane_id } => {
+                let Some(p) = self.panes.get_mut(&pane_id) else {
+                    return;
+                };
+                p.queued_prompts.push(text.to_string());
+                let p = p.clone();
+                let result = ipc::queue_prompt(&p, text);
+                self.ui_state_written(result);
+            }
+            InputKind::Broadcast { pane_ids } => {
+                let mut result = Ok(());
+                for pane_id in pane_ids {
+                    let Some(p) = self.panes.get_mut(&pane_id) else {
+                        continue;
+                    };
+                    p.queued_prompts.push(text.to_string());
+                    let p = p.clone();
+                    result = result.and(ipc::queue_prompt(&p, text));
+                }
+                self.marked.clear();
+                self.ui_state_written(result);
+            }
+            InputKind::OnFinish { pane_id } => {
+                let Some(p) = self.panes.get(&pane_id).cloned() else {
+                    return;
+                };
+                let result = if text == "clear" {
+                    ipc::set_finish_action(&p, None)
+                } else {
+                    FinishAction::parse(text)
+                        .and_then(|action| ipc::set_finish_action(&p, Some(action)))
+                };
+                self.ui_state_written(result);
+            }
+            InputKind::Search => {
+                self.list_view = Some(ListView::new(ListSource::Search(text.to_string())));
+            }
+            InputKind::Spawn => {
+                let (name, arg) = text.split_once(' ').unwrap_or((text, ""));
+                let panes: Vec<Pane> = self.panes.values().cloned().collect();
+                let result = Spawn::from_template(name, arg.trim())
+                    .and_then(|request| spawn_or_queue(&request, &panes));
+                match result {
+                    Ok(Some(_)) => {}
+                    Ok(None) => self.notice = Some("queued: concurrency limit".to_string()),
+                    Err(err) => self.err = Some(format!("{err:#}")),
+                }
+            }
+            InputKind::Tags { .. } | InputKind::TagFilter => {}
+        }
+    }
+
     fn handle_mouse(&mut self, mouse: MouseEvent) -> bool {
         match mouse.kind {
             MouseEventKind::Down(MouseButton::Left) => {
@@ -835,7 +2879,23 @@ impl App {
         false
     }
 
+    /// Whether a key would kill, prompt, respawn, or change state other
+    /// sidebars share. Marks (`m`) and folds (`za`/`zo`/`zc`/`zR`) are
+    /// refused once their second key is read.
+    fn mutates(&self, code: KeyCode) -> bool {
+        const MUTATING: &str = " .suZPnfvBdCKrXWRFSTp#+";
+        match code {
+            KeyCode::Char(ch) if self.list_view.is_some() => ch == 'r',
+            KeyCode::Char(ch) if self.review.is_some() => "afc".contains(ch),
+            KeyCode::Char(ch) => MUTATING.contains(ch),
+            _ => false,
+        }
+    }
+
     fn save_state(&mut self) {
+        if self.read_only {
+            return;
+        }
         let mut cursor = self.cursor;
         let mut scroll_start = self.scroll_start;
         if let Some(att) = self.first_attention_pane() {
@@ -851,80 +2911,169 @@ impl App {
             })
             .map(|p| (p.pane_id.clone(), p.target.clone()))
             .unwrap_or_default();
-        let pane_ids: std::collections::HashMap<String, bool> = self
-            .items
-            .iter()
-            .filter_map(|it| match it {
-                TreeItem::Pane(id) => Some((id.clone(), true)),
-                _ => None,
-            })
-            .collect();
-        let panes: Vec<Pane> = pane_ids
-            .keys()
-            .filter_map(|id| self.panes.get(id).cloned())
-            .collect();
-        let pending = self.pending_manual_statuses.clone();
         let sidebar_width = self.sidebar_width;
-        if update_ui_state(|state| {
-            for p in &panes {
-                if !state.panes.contains_key(&p.pane_id)
-                    && let Some(ui) = state.panes.remove(&p.target)
-                {
-                    state.panes.insert(p.pane_id.clone(), ui);
-                }
-            }
-            state.panes.retain(|id, _| pane_ids.contains_key(id));
-            for p in &panes {
-                let entry = state.panes.entry(p.pane_id.clone()).or_default();
-                entry.stashed = p.stashed;
-                if let Some(status) = pending.get(&p.pane_id) {
-                    entry.manual_status = Some(status.as_i32());
-                    entry.manual_status_base_hash = p.content_hash.clone();
-                }
+        let view_key = self.view_key.clone();
+        let result = update_ui_state(|state| {
+            let view = ViewState {
+                last_position: LastPosition {
+                    pane_id: pane_id.clone(),
+                    pane_target: pane_target.clone(),
+                    cursor,
+                    scroll_start,
+                },
+                sidebar_width,
+            };
+            state.views.insert(view_key.clone(), view);
+        });
+        self.ui_state_written(result);
+    }
+
+    // Pane fields are written one at a time as they change, so edits made
+    // by other clients or the watcher in between are never overwritten.
+    fn ui_state_written(&mut self, result: Result<()>) {
+        match result {
+            Ok(()) => self.ui_state = load_ui_state(),
+            Err(err) => self.err = Some(format!("{err:#}")),
+        }
+    }
+}
+
+fn render<W: Write>(surface: &mut Surface, app: &mut App, out: &mut W) -> io::Result<()> {
+    app.hits.clear();
+    if app.board.is_some() {
+        surface.set_layout(LayoutTree::leaf(BOARD));
+    } else {
+        surface.set_layout(LayoutTree::hbox(vec![
+            (
+                Constraint::Length(app.sidebar_width),
+                LayoutTree::leaf(SIDEBAR),
+            ),
+            (Constraint::Length(1), LayoutTree::leaf(SEPARATOR)),
+            (Constraint::Fill, LayoutTree::leaf(PREVIEW)),
+        ]));
+    }
+    surface.render(out, |id, slice, _theme| {
+        let offset_x = if id == BOARD {
+            render_board(slice, app);
+            0
+        } else if id == SIDEBAR {
+            render_sidebar(slice, app);
+            0
+        } else if id == SEPARATOR {
+            render_separator(slice, app);
+            app.sidebar_width
+        } else if id == PREVIEW {
+            render_preview(slice, app);
+            app.sidebar_width + 1
+        } else {
+            return;
+        };
+        if app.show_help {
+            render_help_overlay(slice, app, offset_x);
+        } else if app.list_view.is_some() {
+            render_list(slice, app, offset_x);
+        } else if app.review.is_some() {
+            render_review(slice, app, offset_x);
+        }
+    })?;
+    if app.accessible {
+        // Screen readers follow the terminal cursor, so park it on the
+        // selected row or card.
+        let at = match app.board {
+            Some(board) => {
+                let col_w = app.width / BOARD_COLUMNS.len() as u16;
+                let row = board.row - board_start(board.row, board_cards(app.height));
+                Some((board.column as u16 * col_w, 2 + row as u16 * 2))
             }
-            state.panes.retain(|_, ui| !ui_pane_state_is_empty(ui));
-            state.last_position = LastPosition {
-                pane_id: pane_id.clone(),
-                pane_target: pane_target.clone(),
-                cursor,
-                scroll_start,
+            None => app
+                .cursor
+                .checked_sub(app.scroll_start)
+                .filter(|&row| row < app.list_height)
+                .map(|row| (0, row as u16)),
+        };
+        match at.filter(|_| !app.show_help && app.list_view.is_none() && app.review.is_none()) {
+            Some((x, y)) => execute!(out, cursor::MoveTo(x, y), cursor::Show)?,
+            None => execute!(out, cursor::Hide)?,
+        }
+    }
+    Ok(())
+}
+
+/// Draws the status board: a column of two-line cards per status.
+fn render_board(slice: &mut GridSlice<'_>, app: &App) {
+    let Some(cursor) = app.board else {
+        return;
+    };
+    let columns = app.board_columns();
+    let col_w = slice.width() / BOARD_COLUMNS.len() as u16;
+    if col_w < 6 {
+        return;
+    }
+    let cards = board_cards(slice.height());
+    let dim = Style::new().fg(palette().muted);
+    for (i, (title, panes)) in BOARD_COLUMNS.iter().zip(&columns).enumerate() {
+        let x = i as u16 * col_w;
+        let status = match i {
+            0 => PaneStatus::Busy,
+            1 => PaneStatus::NeedsAttention,
+            2 => PaneStatus::Unread,
+            _ => PaneStatus::Idle,
+        };
+        let heading = format!(" {title} ({})", panes.len());
+        let heading_style = Style::new().fg(status_color(status, true)).bold();
+        put_clipped(
+            slice,
+            x,
+            0,
+            &fit_width(&heading, col_w as usize),
+            heading_style,
+        );
+        put_clipped(slice, x, 1, &"─".repeat(col_w as usize - 1), dim);
+
+        let selected =
+            (cursor.column == i).then_some(cursor.row.min(panes.len().saturating_sub(1)));
+        let start = selected.map_or(0, |row| board_start(row, cards));
+        for (n, p) in panes.iter().skip(start).take(cards).enumerate() {
+            let y = 2 + n as u16 * 2;
+            let is_selected = selected == Some(start + n);
+            let (style, sub_style) = if is_selected {
+                let style = Style::new().fg(palette().text).bg(palette().selection);
+                fill_spaces(slice, x, y, col_w - 1, style);
+                fill_spaces(slice, x, y + 1, col_w - 1, style);
+                (style.bold(), style)
+            } else {
+                (provider_style(&p.provider), dim)
             };
-            state.sidebar_width = sidebar_width;
-        })
-        .is_ok()
-        {
-            self.ui_state = load_ui_state();
-            self.pending_manual_statuses.clear();
+            let avail = (col_w as usize).saturating_sub(4);
+            let icon_style = style.fg(status_color(p.shown_status(), is_selected));
+            let icon = if app.accessible {
+                format!("{} ", status_word(p))
+            } else {
+                "● ".to_string()
+            };
+            let col = put_clipped(slice, x + 1, y, &icon, icon_style);
+            put_clipped(slice, col, y, &fit_width(&pane_label(p), avail), style);
+            let detail = format!("{}  {}", elapsed_label(p), p.short_path);
+            put_clipped(slice, x + 3, y + 1, &fit_width(&detail, avail), sub_style);
         }
     }
 }
 
-fn render<W: Write>(surface: &mut Surface, app: &mut App, out: &mut W) -> io::Result<()> {
-    app.hits.clear();
-    surface.set_layout(LayoutTree::hbox(vec![
-        (
-            Constraint::Length(app.sidebar_width),
-            LayoutTree::leaf(SIDEBAR),
-        ),
-        (Constraint::Length(1), LayoutTree::leaf(SEPARATOR)),
-        (Constraint::Fill, LayoutTree::leaf(PREVIEW)),
-    ]));
-    surface.render(out, |id, slice, _theme| {
-        if id == SIDEBAR {
-            render_sidebar(slice, app);
-        } else if id == SEPARATOR {
-            render_separator(slice, app);
-        } else if id == PREVIEW {
-            render_preview(slice, app);
-        }
-    })
+/// How many two-line cards fit under a board column's heading.
+fn board_cards(height: u16) -> usize {
+    (height as usize).saturating_sub(2) / 2
+}
+
+/// The first card shown in a column so that card `row` is visible.
+fn board_start(row: usize, cards: usize) -> usize {
+    (row + 1).saturating_sub(cards)
 }
 
 fn render_separator(slice: &mut GridSlice<'_>, app: &mut App) {
     let style = Style::new().fg(if app.dragging {
-        Color::Grey
+        palette().body
     } else {
-        Color::DarkGrey
+        palette().muted
     });
     for y in 0..slice.height() {
         slice.set(0, y, '│', style);
@@ -932,28 +3081,122 @@ fn render_separator(slice: &mut GridSlice<'_>, app: &mut App) {
     app.hits.record(slice.grid_rect(), Hit::Separator);
 }
 
-fn render_sidebar(slice: &mut GridSlice<'_>, app: &App) {
+fn render_sidebar(slice: &mut GridSlice<'_>, app: &mut App) {
+    let mut footer = None;
     if let Some(err) = &app.err {
-        let (message, style) = if err == SYNCING_MSG {
-            (err.clone(), Style::new().fg(Color::DarkGrey))
-        } else {
-            (format!("Error: {err}"), Style::new().fg(Color::Red))
+        if err == SYNCING_MSG {
+            put_clipped(slice, 0, 0, err, Style::new().fg(palette().muted));
+            return;
+        }
+        if !app.has_display_snapshot() {
+            put_clipped(
+                slice,
+                0,
+                0,
+                &format!("Error: {err}"),
+                Style::new().fg(Color::Red),
+            );
+            return;
+        }
+        footer = Some(err);
+    }
+    let mut h = slice.height() as usize;
+    if let Some(input) = &app.input {
+        h = h.saturating_sub(1);
+        render_input_footer(slice, h as u16, input);
+    } else if let Some(pane_ids) = &app.confirm_kill {
+        h = h.saturating_sub(1);
+        let message = match pane_ids.as_slice() {
+            [id] => format!(
+                "kill {}?",
+                app.panes.get(id).map_or(id.as_str(), |p| p.target.as_str())
+            ),
+            ids => format!("kill {} panes?", ids.len()),
         };
-        put_clipped(slice, 0, 0, &message, style);
-        return;
+        render_notice_footer(slice, h as u16, &message, "y/n");
+    } else if let kills @ [.., kill] = app.last_kill_batch().as_slice() {
+        h = h.saturating_sub(1);
+        let secs = kill.due.saturating_duration_since(Instant::now()).as_secs() + 1;
+        let message = match kills.len() {
+            1 => format!("killing {}", kill.pane.target),
+            n => format!("killing {n} panes"),
+        };
+        render_notice_footer(slice, h as u16, &message, &format!("u undo {secs}s"));
+    } else if app.marked.is_empty() && !app.cleanup_dismissed {
+        let eligible = app.cleanup_candidates().len();
+        if eligible > 0 {
+            h = h.saturating_sub(1);
+            let noun = if eligible == 1 { "pane" } else { "panes" };
+            render_notice_footer(
+                slice,
+                h as u16,
+                &format!("{eligible} {noun} eligible for cleanup"),
+                "C review",
+            );
+        }
+    }
+    if let Some(err) = footer {
+        h = h.saturating_sub(1);
+        render_error_footer(slice, h as u16, err);
+    }
+    if let Some(notice) = &app.notice {
+        h = h.saturating_sub(1);
+        render_notice_footer(slice, h as u16, notice, "x");
+    }
+    if app.read_only {
+        h = h.saturating_sub(1);
+        render_notice_footer(slice, h as u16, "read-only", "");
+    }
+    if app.power_save {
+        h = h.saturating_sub(1);
+        render_notice_footer(slice, h as u16, "power save", "");
+    }
+    let filter = app.ui_state.filter;
+    if filter != PaneFilter::All {
+        h = h.saturating_sub(1);
+        render_notice_footer(slice, h as u16, &format!("filter: {}", filter.label()), "F");
+    }
+    if app.ui_state.sort == PaneSort::Status {
+        h = h.saturating_sub(1);
+        render_notice_footer(slice, h as u16, "sorted by status", "S");
+    }
+    match app.ui_state.tree {
+        PaneTree::Tmux => {
+            h = h.saturating_sub(1);
+            render_notice_footer(slice, h as u16, "tmux tree", "T");
+        }
+        PaneTree::Tags => {
+            h = h.saturating_sub(1);
+            render_notice_footer(slice, h as u16, "grouped by tag", "T");
+        }
+        PaneTree::Paths => {}
+    }
+    if let Some(progress) = task_progress(&app.tasks) {
+        h = h.saturating_sub(1);
+        render_notice_footer(slice, h as u16, &progress, "Q");
+    }
+    if !app.ui_state.tag_filter.is_empty() {
+        h = h.saturating_sub(1);
+        let tag = format!("tag: #{}", app.ui_state.tag_filter);
+        render_notice_footer(slice, h as u16, &tag, "+");
     }
     if app.items.is_empty() {
         put_clipped(
             slice,
             2,
             1,
-            "No active sessions",
-            Style::new().fg(Color::DarkGrey),
+            if filter == PaneFilter::All && app.ui_state.tag_filter.is_empty() {
+                "No active sessions"
+            } else {
+                "No panes match the filter"
+            },
+            Style::new().fg(palette().muted),
         );
         return;
     }
-    let h = slice.height() as usize;
-    let start = visible_start(app.items.len(), app.cursor, h);
+    app.list_height = h;
+    app.scroll_start = keep_visible(app.items.len(), app.cursor, app.scroll_start, h);
+    let start = app.scroll_start;
     let end = (start + h).min(app.items.len());
     for (row, idx) in (start..end).enumerate() {
         render_tree_item(
@@ -967,6 +3210,118 @@ fn render_sidebar(slice: &mut GridSlice<'_>, app: &App) {
     }
 }
 
+/// The checkout a pane works in: its directory, or its repository when
+/// worktrees of one repository count as one workspace.
+fn workspace_key(p: &Pane, across_worktrees: bool) -> (String, String) {
+    let dir = if across_worktrees && !p.project_root.is_empty() {
+        &p.project_root
+    } else {
+        &p.path
+    };
+    (p.host.clone(), dir.clone())
+}
+
+/// The workspaces where two or more active agents work while at least one
+/// of them is busy, so their edits can collide.
+fn shared_workspaces<'a>(
+    panes: impl Iterator<Item = &'a Pane>,
+    across_worktrees: bool,
+) -> HashSet<(String, String)> {
+    let mut agents: HashMap<(String, String), (usize, bool)> = HashMap::new();
+    for p in panes.filter(|p| !p.stashed && !p.terminated && !p.path.is_empty()) {
+        let entry = agents
+            .entry(workspace_key(p, across_worktrees))
+            .or_default();
+        entry.0 += 1;
+        entry.1 |= p.status == PaneStatus::Busy;
+    }
+    agents
+        .into_iter()
+        .filter(|(_, (count, busy))| *count > 1 && *busy)
+        .map(|(key, _)| key)
+        .collect()
+}
+
+/// A summary of the task queue while any task is still open.
+fn task_progress(tasks: &[Task]) -> Option<String> {
+    let count = |state: TaskState| tasks.iter().filter(|task| task.state == state).count();
+    let running = count(TaskState::Assigned) + count(TaskState::Running);
+    let pending = count(TaskState::Pending) + count(TaskState::Ready);
+    if running + pending == 0 {
+        return None;
+    }
+    let mut progress = format!(
+        "tasks {}/{} · {running} running · {pending} queued",
+        count(TaskState::Done),
+        tasks.len()
+    );
+    match count(TaskState::Failed) {
+        0 => {}
+        failed => progress.push_str(&format!(" · {failed} failed")),
+    }
+    Some(progress)
+}
+
+fn render_input_footer(slice: &mut GridSlice<'_>, row: u16, input: &LineInput) {
+    let style = Style::new().fg(palette().text).bg(palette().selection);
+    let width = slice.width();
+    fill_spaces(slice, 0, row, width, style);
+    let label = format!(" {}› ", input.label());
+    let col = put_clipped(slice, 0, row, &label, style.bold());
+    let avail = (width as usize).saturating_sub(display_width(&label) + 1);
+    let mut tail = Vec::new();
+    let mut used = 0;
+    for ch in input.text.chars().rev() {
+        used += char_width(ch);
+        if used > avail {
+            break;
+        }
+        tail.push(ch);
+    }
+    let text: String = tail.into_iter().rev().collect();
+    let col = put_clipped(slice, col, row, &text, style);
+    let _ = put_clipped(slice, col, row, "▏", style);
+}
+
+fn render_notice_footer(slice: &mut GridSlice<'_>, row: u16, message: &str, hint: &str) {
+    let style = Style::new().fg(palette().text).bg(palette().selection);
+    let width = slice.width();
+    fill_spaces(slice, 0, row, width, style);
+    let hint = format!(" {hint} ");
+    let avail = (width as usize).saturating_sub(display_width(&hint) + 1);
+    put_clipped(
+        slice,
+        0,
+        row,
+        &fit_width(&format!(" {message}"), avail),
+        style,
+    );
+    let _ = put_clipped(
+        slice,
+        width.saturating_sub(display_width(&hint) as u16),
+        row,
+        &hint,
+        style.bold(),
+    );
+}
+
+fn render_error_footer(slice: &mut GridSlice<'_>, row: u16, err: &str) {
+    let style = Style::new().fg(Color::White).bg(Color::DarkRed);
+    let width = slice.width();
+    fill_spaces(slice, 0, row, width, style);
+    let hint = " x ";
+    let avail = (width as usize).saturating_sub(display_width(hint) + 1);
+    let message = fit_width(&format!(" {err}"), avail);
+    put_clipped(slice, 0, row, &message, style);
+    let _ = put_clipped(
+        slice,
+        width.saturating_sub(display_width(hint) as u16),
+        row,
+        hint,
+        style.bold(),
+    );
+}
+
 fn render_tree_item(
     slice: &mut GridSlice<'_>,
     row: u16,
@@ -982,13 +3337,43 @@ fn render_tree_item(
             let mut text = format!("─{label}");
             let fill = width.saturating_sub(display_width(&text) as u16);
             text.push_str(&"─".repeat(fill as usize));
-            put_clipped(
-                slice,
-                0,
-                row,
-                &text,
-                Style::new().fg(Color::AnsiValue(242)).dim(),
-            );
+            put_clipped(slice, 0, row, &text, Style::new().fg(palette().faint).dim());
+        }
+        TreeItem::Tag(id) => {
+            if let Some(p) = app.panes.get(id) {
+                let name = match p.tags.first() {
+                    Some(tag) => format!("#{tag}"),
+                    None => "untagged".to_string(),
+                };
+                render_header_row(
+                    slice,
+                    row,
+                    width,
+                    HeaderRow::new(&app.fold_label(item, &name), "", false, 0, p.stashed)
+                        .highlighted(selected),
+                );
+            }
+        }
+        TreeItem::Session(id) | TreeItem::Window(id) => {
+            if let Some(p) = app.panes.get(id) {
+                let name = match item {
+                    TreeItem::Session(_) if p.host.is_empty() => p.session.clone(),
+                    TreeItem::Session(_) => format!("{}/{}", p.host, p.session),
+                    _ if p.window_name.is_empty() => format!("  {}", p.window),
+                    _ => format!("  {}:{}", p.window, p.window_name),
+                };
+                let (branch, dirty) = match item {
+                    TreeItem::Window(_) => (p.git_branch.as_str(), p.git_dirty),
+                    _ => ("", false),
+                };
+                render_header_row(
+                    slice,
+                    row,
+                    width,
+                    HeaderRow::new(&app.fold_label(item, &name), branch, dirty, 0, p.stashed)
+                        .highlighted(selected),
+                );
+            }
         }
         TreeItem::Workspace(id) => {
             if let Some(p) = app.panes.get(id) {
@@ -996,21 +3381,15 @@ fn render_tree_item(
                     slice,
                     row,
                     width,
-                    HeaderRow {
-                        name: &p.short_path,
-                        branch: &p.git_branch,
-                        dirty: p.git_dirty,
-                        style: if p.stashed {
-                            Style::new().fg(Color::DarkGrey)
-                        } else {
-                            Style::new().fg(Color::White).bold()
-                        },
-                        branch_style: if p.stashed {
-                            Style::new().fg(Color::AnsiValue(242))
-                        } else {
-                            Style::new().fg(Color::Green)
-                        },
-                    },
+                    HeaderRow::new(
+                        &app.fold_label(item, &p.short_path),
+                        &p.git_branch,
+                        p.git_dirty,
+                        app.stashed_under(p, false),
+                        p.stashed,
+                    )
+                    .conflicted(app.conflicted(p, false))
+                    .highlighted(selected),
                 );
             }
         }
@@ -1025,21 +3404,15 @@ fn render_tree_item(
                     slice,
                     row,
                     width,
-                    HeaderRow {
-                        name,
-                        branch: &p.project_branch,
-                        dirty: p.project_dirty,
-                        style: if p.stashed {
-                            Style::new().fg(Color::DarkGrey)
-                        } else {
-                            Style::new().fg(Color::White).bold()
-                        },
-                        branch_style: if p.stashed {
-                            Style::new().fg(Color::AnsiValue(242))
-                        } else {
-                            Style::new().fg(Color::Green)
-                        },
-                    },
+                    HeaderRow::new(
+                        &app.fold_label(item, name),
+                        &p.project_branch,
+                        p.project_dirty,
+                        app.stashed_under(p, true),
+                        p.stashed,
+                    )
+                    .conflicted(app.conflicted(p, true))
+                    .highlighted(selected),
                 );
             }
         }
@@ -1055,8 +3428,61 @@ struct HeaderRow<'a> {
     name: &'a str,
     branch: &'a str,
     dirty: bool,
+    /// Panes of this workspace stashed away in the stashed section.
+    stashed: usize,
+    /// Several agents share the workspace and one of them is busy.
+    conflict: bool,
     style: Style,
     branch_style: Style,
+    dirty_style: Style,
+    stash_style: Style,
+    conflict_style: Style,
+}
+
+impl<'a> HeaderRow<'a> {
+    /// A header in the stashed section (`muted`) is grey throughout.
+    fn new(name: &'a str, branch: &'a str, dirty: bool, stashed: usize, muted: bool) -> Self {
+        let (style, branch_style, dirty_style) = if muted {
+            let grey = Style::new().fg(palette().faint);
+            (Style::new().fg(palette().muted), grey, grey)
+        } else {
+            let dirty_color =
+                parse_color(&config().header_marks.dirty_color).unwrap_or(Color::Green);
+            (
+                Style::new().fg(palette().text).bold(),
+                Style::new().fg(Color::Green),
+                Style::new().fg(dirty_color),
+            )
+        };
+        Self {
+            name,
+            branch,
+            dirty,
+            stashed,
+            conflict: false,
+            style,
+            branch_style,
+            dirty_style,
+            stash_style: Style::new().fg(palette().faint),
+            conflict_style: Style::new().fg(Color::Red).bold(),
+        }
+    }
+
+    fn conflicted(mut self, conflict: bool) -> Self {
+        self.conflict = conflict;
+        self
+    }
+
+    fn highlighted(mut self, selected: bool) -> Self {
+        if selected {
+            self.style = self.style.bg(palette().selection);
+            self.branch_style = self.branch_style.bg(palette().selection);
+            self.dirty_style = self.dirty_style.bg(palette().selection);
+            self.stash_style = self.stash_style.bg(palette().selection);
+            self.conflict_style = self.conflict_style.bg(palette().selection);
+        }
+        self
+    }
 }
 
 fn render_header_row(slice: &mut GridSlice<'_>, row: u16, width: u16, header: HeaderRow<'_>) {
@@ -1064,39 +3490,66 @@ fn render_header_row(slice: &mut GridSlice<'_>, row: u16, width: u16, header: He
         name,
         branch,
         dirty,
+        stashed,
+        conflict,
         style,
         branch_style,
+        dirty_style,
+        stash_style,
+        conflict_style,
     } = header;
+    let marks = &config().header_marks;
     let avail = width.saturating_sub(2) as usize;
     let mut branch = branch.to_string();
-    if !branch.is_empty() && dirty {
-        branch.push('*');
-    }
+    let dirty_mark = if !branch.is_empty() && dirty {
+        marks.dirty.as_str()
+    } else {
+        ""
+    };
+    let stash_mark = if stashed > 0 && !marks.stashed.is_empty() {
+        format!(" {}{stashed}", marks.stashed)
+    } else {
+        String::new()
+    };
+    let conflict_mark = if conflict && !marks.conflict.is_empty() {
+        format!(" {}", marks.conflict)
+    } else {
+        String::new()
+    };
+    let marks_width = display_width(&conflict_mark) + display_width(&stash_mark);
     let mut name = name.to_string();
+    let name_width = display_width(&name) + marks_width;
     if !branch.is_empty() {
-        let needed = display_width(&name) + 1 + display_width(&branch);
+        let needed = name_width + 1 + display_width(&branch) + display_width(dirty_mark);
         if needed > avail {
-            let branch_avail = avail.saturating_sub(display_width(&name) + 1);
+            let branch_avail = avail.saturating_sub(name_width + 1 + display_width(dirty_mark));
             if branch_avail >= 4 {
-                branch = truncate_width(&branch, branch_avail);
+                branch = fit_width(&branch, branch_avail);
             } else {
                 branch.clear();
             }
         }
     }
     if branch.is_empty() {
-        name = truncate_width(&name, avail);
+        name = fit_width(&name, avail.saturating_sub(marks_width));
     }
     let mut col = put_clipped(slice, 0, row, " ", style);
     col = put_clipped(slice, col, row, &name, style);
+    if !conflict_mark.is_empty() {
+        col = put_clipped(slice, col, row, &conflict_mark, conflict_style);
+    }
+    if !stash_mark.is_empty() {
+        col = put_clipped(slice, col, row, &stash_mark, stash_style);
+    }
     if !branch.is_empty() {
         let pad = width
             .saturating_sub(col)
-            .saturating_sub(display_width(&branch) as u16)
+            .saturating_sub((display_width(&branch) + display_width(dirty_mark)) as u16)
             .saturating_sub(1);
         fill_spaces(slice, col, row, pad, style);
         col += pad;
         col = put_clipped(slice, col, row, &branch, branch_style);
+        col = put_clipped(slice, col, row, dirty_mark, dirty_style);
         let _ = put_clipped(slice, col, row, " ", branch_style);
     } else {
         fill_spaces(slice, col, row, width.saturating_sub(col), style);
@@ -1112,11 +3565,15 @@ fn render_pane_row(
     app: &App,
 ) {
     const PREFIX: &str = "   ";
-    const ELAPSED_SLOT_W: usize = 5;
+    const MARKED_PREFIX: &str = " * ";
+    const SELECTED_PREFIX: &str = " > ";
 
-    let selected_style = Style::new().fg(Color::White).bg(Color::DarkGrey).bold();
-    let stashed_style = Style::new().fg(Color::DarkGrey);
-    let normal_dim = Style::new().fg(Color::DarkGrey);
+    let selected_style = Style::new()
+        .fg(palette().text)
+        .bg(palette().selection)
+        .bold();
+    let stashed_style = Style::new().fg(palette().muted);
+    let normal_dim = Style::new().fg(palette().muted);
     let fill_style = if selected {
         selected_style
     } else if p.stashed {
@@ -1126,118 +3583,495 @@ fn render_pane_row(
     };
     fill_spaces(slice, 0, row, width, fill_style);
 
-    let mut win_label = pane_label(p);
-    let mut worktree = if !p.short_path.is_empty() && p.path != p.project_root {
-        p.short_path.clone()
-    } else {
-        String::new()
-    };
-
-    let mut elapsed = String::new();
-    if p.status != PaneStatus::Busy {
-        elapsed = elapsed_label(p);
-        if !elapsed.is_empty() {
-            elapsed = format!(" {elapsed} ");
-            if display_width(&elapsed) > ELAPSED_SLOT_W {
-                elapsed = truncate_width(&elapsed, ELAPSED_SLOT_W);
-            }
-            let pad = ELAPSED_SLOT_W.saturating_sub(display_width(&elapsed));
-            elapsed = format!("{}{elapsed}", " ".repeat(pad));
-        }
-    }
-    if elapsed.is_empty() {
-        elapsed = " ".repeat(ELAPSED_SLOT_W);
-    }
-
-    let prefix_w = display_width(PREFIX);
-    let middle_avail = (width as usize)
-        .saturating_sub(prefix_w)
-        .saturating_sub(2)
-        .saturating_sub(ELAPSED_SLOT_W);
-    if display_width(&win_label) > middle_avail {
-        win_label = truncate_width(&win_label, middle_avail);
-    }
-    let remaining = middle_avail.saturating_sub(display_width(&win_label));
-
-    let mut sep_w = 2usize;
-    if let Some(target_w) = app.project_win_width.get(&p.project_root)
-        && *target_w > display_width(&win_label)
-    {
-        let aligned = 2 + *target_w - display_width(&win_label);
-        if remaining >= aligned + 2 {
-            sep_w = aligned;
-        }
-    }
-
-    let mut worktree_rendered = String::new();
-    if !worktree.is_empty() && remaining >= sep_w + 2 {
-        let avail = remaining - sep_w;
-        if display_width(&worktree) > avail {
-            worktree = truncate_width(&worktree, avail);
-        }
-        worktree_rendered = format!("{}{}", " ".repeat(sep_w), worktree);
-    }
-    let gap = remaining.saturating_sub(display_width(&worktree_rendered));
-
     let icon_color = if p.stashed && !selected {
-        Color::AnsiValue(242)
+        palette().faint
     } else {
-        match p.status {
-            PaneStatus::Busy => Color::Rgb {
-                r: 217,
-                g: 119,
-                b: 6,
-            },
-            PaneStatus::NeedsAttention | PaneStatus::Unread => Color::Rgb {
-                r: 155,
-                g: 155,
-                b: 245,
-            },
-            PaneStatus::Idle if selected => Color::White,
-            PaneStatus::Idle => Color::DarkGrey,
-        }
+        status_color(p.shown_status(), selected)
     };
-    let icon = if matches!(p.status, PaneStatus::Idle) {
+    let icon = if p.snoozed_until.is_some() {
+        'z'
+    } else if p.do_not_disturb {
+        '■'
+    } else if p.status == PaneStatus::Disconnected {
+        '×'
+    } else if matches!(p.status, PaneStatus::Idle) {
         '○'
     } else {
         '●'
     };
 
-    let text_style = if selected {
+    let mut icon_style = fill_style.fg(icon_color);
+    let mut text_style = if selected {
         selected_style
     } else if p.stashed {
         stashed_style
     } else {
         provider_style(&p.provider)
     };
+    let now = Utc::now();
+    let decay = decay_level(p, &config().status_style.decay_mins, now);
+    if !selected && !p.stashed && decay > 0 {
+        let shades = palette().decay;
+        let shade = shades[decay.min(shades.len()) - 1];
+        text_style = Style::new().fg(Color::AnsiValue(shade));
+    }
+    if !selected && escalated(p, now) {
+        let reversed = Style::new().fg(Color::Black).bg(icon_color).bold();
+        (icon_style, text_style) = match config().status_style.escalate {
+            Emphasis::Bold => (icon_style.bold(), text_style.bold()),
+            Emphasis::Reverse => (reversed, reversed),
+            Emphasis::Blink if now.timestamp() % 2 == 0 => (reversed, reversed),
+            Emphasis::Blink => (icon_style.bold(), text_style.bold()),
+        };
+    }
     let dim_style = if selected {
         selected_style
     } else if p.stashed {
-        Style::new().fg(Color::AnsiValue(242))
+        Style::new().fg(palette().faint)
     } else {
         normal_dim
     };
 
-    let mut col = 0;
-    col = put_clipped(
-        slice,
-        col,
-        row,
-        PREFIX,
-        if selected { selected_style } else { dim_style },
-    );
-    slice.set(col, row, icon, fill_style.fg(icon_color));
-    col += 1;
-    col = put_clipped(slice, col, row, " ", fill_style);
-    col = put_clipped(slice, col, row, &win_label, text_style);
-    if !worktree_rendered.is_empty() {
-        col = put_clipped(slice, col, row, &worktree_rendered, dim_style);
+    let quick_index = config()
+        .quick_switch
+        .then(|| app.quick_index(&p.pane_id))
+        .flatten()
+        .map(|n| format!(" {n} "));
+    let bookmark = app.mark_of(&p.pane_id).map(|letter| format!(" {letter} "));
+    let prefix = if app.marked.contains(&p.pane_id) {
+        MARKED_PREFIX
+    } else if selected && app.accessible {
+        SELECTED_PREFIX
+    } else {
+        quick_index
+            .as_deref()
+            .or(bookmark.as_deref())
+            .unwrap_or(PREFIX)
+    };
+    // In the tmux tree panes sit one level deeper, under their window.
+    let prefix = match app.ui_state.tree {
+        PaneTree::Tmux => format!("  {prefix}"),
+        PaneTree::Paths | PaneTree::Tags => prefix.to_string(),
+    };
+    let prefix = prefix.as_str();
+
+    let cells: Vec<RowCell> = config()
+        .pane_columns
+        .iter()
+        .filter_map(|&column| {
+            let (text, style) = match column {
+                PaneColumn::Icon if app.accessible => {
+                    (format!("{:<9}", status_word(p)), icon_style)
+                }
+                PaneColumn::Icon => (icon.to_string(), icon_style),
+                PaneColumn::Provider => {
+                    let w = providers().map(display_width).max().unwrap_or(0);
+                    let provider = truncate_width(&p.provider, w);
+                    let pad = w.saturating_sub(display_width(&provider));
+                    (format!("{provider}{}", " ".repeat(pad)), text_style)
+                }
+                PaneColumn::Label => (pane_label(p), text_style),
+                PaneColumn::Target => (p.target.clone(), dim_style),
+                PaneColumn::Path if !p.short_path.is_empty() && p.path != p.project_root => {
+                    (p.short_path.clone(), dim_style)
+                }
+                PaneColumn::Path => return None,
+                PaneColumn::Tags if !p.tags.is_empty() => {
+                    let tags: Vec<String> = p.tags.iter().map(|tag| format!("#{tag}")).collect();
+                    let style = if selected || p.stashed {
+                        dim_style
+                    } else {
+                        Style::new().fg(Color::Cyan)
+                    };
+                    (tags.join(" "), style)
+                }
+                PaneColumn::Tags => return None,
+                PaneColumn::Elapsed if app.held(p) => (
+                    slot(&format!("q{}", p.queued_prompts.len())),
+                    if selected {
+                        dim_style
+                    } else {
+                        Style::new().fg(Color::Yellow)
+                    },
+                ),
+                PaneColumn::Elapsed => {
+                    let elapsed = if !p.queued_prompts.is_empty() {
+                        format!("+{}", p.queued_prompts.len())
+                    } else {
+                        elapsed_label(p)
+                    };
+                    (slot(&elapsed), dim_style)
+                }
+                PaneColumn::Busy => {
+                    let busy = match p.busy_since {
+                        Some(since) if p.status == PaneStatus::Busy => {
+                            format_age((now - since).num_seconds())
+                        }
+                        _ => String::new(),
+                    };
+                    (slot(&busy), dim_style)
+                }
+                PaneColumn::Clock => {
+                    let clock = p.last_active.map(|at| clock_label(at, now));
+                    (wide_slot(&clock.unwrap_or_default(), 7), dim_style)
+                }
+                PaneColumn::Since => {
+                    let since = p
+                        .status_since
+                        .map(|since| format_age((now - since).num_seconds()));
+                    (slot(&since.unwrap_or_default()), dim_style)
+                }
+                PaneColumn::Dirty => {
+                    let mark = &config().header_marks.dirty;
+                    let text = if p.git_dirty {
+                        mark.clone()
+                    } else {
+                        " ".repeat(display_width(mark))
+                    };
+                    let style = match parse_color(&config().header_marks.dirty_color) {
+                        Some(color) if !selected && !p.stashed => Style::new().fg(color),
+                        _ => dim_style,
+                    };
+                    (text, style)
+                }
+            };
+            Some(RowCell {
+                column,
+                text,
+                style,
+            })
+        })
+        .collect();
+    let aligned = app
+        .project_win_width
+        .get(&p.project_root)
+        .map(|target_w| 2 + target_w.saturating_sub(display_width(&pane_label(p))));
+    let shown = fit_row_cells(cells, width as usize, display_width(prefix), aligned);
+
+    let mut col = put_clipped(slice, 0, row, prefix, dim_style);
+    let last_flexible = shown
+        .iter()
+        .rposition(|(_, cell)| cell.column.is_flexible());
+    let used = display_width(prefix)
+        + shown
+            .iter()
+            .map(|(sep, cell)| sep + display_width(&cell.text))
+            .sum::<usize>();
+    for (i, (sep, cell)) in shown.iter().enumerate() {
+        col = put_clipped(slice, col, row, &" ".repeat(*sep), dim_style);
+        col = put_clipped(slice, col, row, &cell.text, cell.style);
+        if Some(i) == last_flexible {
+            let gap = (width as usize).saturating_sub(used);
+            col = put_clipped(slice, col, row, &" ".repeat(gap), dim_style);
+        }
+    }
+}
+
+/// One column of a pane row, before it is fitted to the sidebar.
+struct RowCell {
+    column: PaneColumn,
+    text: String,
+    style: Style,
+}
+
+/// Fits `cells` into `width` after a prefix, returning each shown cell with
+/// the spaces before it. The label is fitted first, then the target and the
+/// path, which are dropped when fewer than two columns are left for them.
+/// `aligned` is the gap before a path that lines paths up across a project,
+/// used when there is room for it.
+fn fit_row_cells(
+    mut cells: Vec<RowCell>,
+    width: usize,
+    prefix_w: usize,
+    aligned: Option<usize>,
+) -> Vec<(usize, RowCell)> {
+    let droppable = |column| {
+        matches!(
+            column,
+            PaneColumn::Target | PaneColumn::Path | PaneColumn::Tags
+        )
+    };
+    let mut kept: Vec<bool> = cells.iter().map(|cell| !droppable(cell.column)).collect();
+    let mut path_sep = 2;
+    if let Some(i) = cells.iter().position(|c| c.column == PaneColumn::Label) {
+        let others = row_width(&cells, &kept, path_sep, prefix_w) - display_width(&cells[i].text);
+        cells[i].text = fit_width(&cells[i].text, width.saturating_sub(others));
+    }
+    for column in [PaneColumn::Target, PaneColumn::Path, PaneColumn::Tags] {
+        let Some(i) = cells.iter().position(|c| c.column == column) else {
+            continue;
+        };
+        kept[i] = true;
+        let text_w = display_width(&cells[i].text);
+        let others = |path_sep| row_width(&cells, &kept, path_sep, prefix_w) - text_w;
+        if column == PaneColumn::Path
+            && let Some(aligned) = aligned
+            && width >= others(aligned) + 2
+        {
+            path_sep = aligned;
+        }
+        let others = others(path_sep);
+        if width < others + 2 {
+            kept[i] = false;
+        } else if text_w > width - others {
+            cells[i].text = fit_width(&cells[i].text, width - others);
+        }
+    }
+
+    let seps = row_seps(&cells, &kept, path_sep);
+    cells
+        .into_iter()
+        .zip(kept)
+        .zip(seps)
+        .filter(|((_, kept), _)| *kept)
+        .map(|((cell, _), sep)| (sep, cell))
+        .collect()
+}
+
+/// The spaces before each kept cell: none around slots, a gap of
+/// `path_sep` between a label and its path, two before any other path, and
+/// one otherwise.
+fn row_seps(cells: &[RowCell], kept: &[bool], path_sep: usize) -> Vec<usize> {
+    let mut prev: Option<PaneColumn> = None;
+    cells
+        .iter()
+        .zip(kept)
+        .map(|(cell, kept)| {
+            if !kept {
+                return 0;
+            }
+            let sep = match prev {
+                None => 0,
+                Some(prev) if prev.is_slot() || cell.column.is_slot() => 0,
+                Some(PaneColumn::Label) if cell.column == PaneColumn::Path => path_sep,
+                Some(_) if cell.column == PaneColumn::Path => 2,
+                Some(_) => 1,
+            };
+            prev = Some(cell.column);
+            sep
+        })
+        .collect()
+}
+
+fn row_width(cells: &[RowCell], kept: &[bool], path_sep: usize, prefix_w: usize) -> usize {
+    let seps = row_seps(cells, kept, path_sep);
+    prefix_w
+        + cells
+            .iter()
+            .zip(kept)
+            .zip(seps)
+            .filter(|((_, kept), _)| **kept)
+            .map(|((cell, _), sep)| sep + display_width(&cell.text))
+            .sum::<usize>()
+}
+
+/// Right-aligns `text` with a trailing space in a five-column slot.
+fn slot(text: &str) -> String {
+    wide_slot(text, 5)
+}
+
+fn wide_slot(text: &str, width: usize) -> String {
+    if text.is_empty() {
+        return " ".repeat(width);
+    }
+    let text = truncate_width(&format!(" {text} "), width);
+    let pad = width.saturating_sub(display_width(&text));
+    format!("{}{text}", " ".repeat(pad))
+}
+
+/// The local time of `at`, or its date when it was before today.
+fn clock_label(at: DateTime<Utc>, now: DateTime<Utc>) -> String {
+    let at = at.with_timezone(&Local);
+    if at.date_naive() == now.with_timezone(&Local).date_naive() {
+        at.format("%H:%M").to_string()
+    } else {
+        at.format("%m/%d").to_string()
+    }
+}
+
+fn status_color(status: PaneStatus, selected: bool) -> Color {
+    if let Some(color) = config()
+        .status_style
+        .colors
+        .get(&status)
+        .and_then(|name| parse_color(name))
+    {
+        return color;
+    }
+    match status {
+        PaneStatus::Busy => Color::Rgb {
+            r: 217,
+            g: 119,
+            b: 6,
+        },
+        PaneStatus::NeedsAttention | PaneStatus::Unread => Color::Rgb {
+            r: 155,
+            g: 155,
+            b: 245,
+        },
+        PaneStatus::Error => Color::Rgb {
+            r: 220,
+            g: 38,
+            b: 38,
+        },
+        PaneStatus::Idle | PaneStatus::Disconnected if selected => palette().text,
+        PaneStatus::Idle | PaneStatus::Disconnected => palette().muted,
+    }
+}
+
+/// Parses `#rrggbb`, a basic color name, or a 256-color index.
+fn parse_color(s: &str) -> Option<Color> {
+    if let Some(hex) = s.strip_prefix('#') {
+        if hex.len() != 6 {
+            return None;
+        }
+        let channel = |i: usize| u8::from_str_radix(hex.get(i..i + 2)?, 16).ok();
+        return Some(Color::Rgb {
+            r: channel(0)?,
+            g: channel(2)?,
+            b: channel(4)?,
+        });
+    }
+    if let Ok(index) = s.parse::<u8>() {
+        return Some(Color::AnsiValue(index));
+    }
+    let color = match s.to_ascii_lowercase().replace(['-', '_'], "").as_str() {
+        "black" => Color::Black,
+        "red" => Color::Red,
+        "green" => Color::Green,
+        "yellow" => Color::Yellow,
+        "blue" => Color::Blue,
+        "magenta" => Color::Magenta,
+        "cyan" => Color::Cyan,
+        "white" => Color::White,
+        "grey" | "gray" => Color::Grey,
+        "darkgrey" | "darkgray" => Color::DarkGrey,
+        _ => return None,
+    };
+    Some(color)
+}
+
+/// What the status icon stands for, for the accessible mode.
+fn status_word(p: &Pane) -> &'static str {
+    if p.snoozed_until.is_some() {
+        return "snoozed";
+    }
+    if p.do_not_disturb {
+        return "dnd";
+    }
+    match p.status {
+        PaneStatus::Idle => "idle",
+        PaneStatus::Busy => "busy",
+        PaneStatus::NeedsAttention => "attention",
+        PaneStatus::Unread => "unread",
+        PaneStatus::Error => "error",
+        PaneStatus::Disconnected => "gone",
+    }
+}
+
+/// The colors the sidebar draws its own text with. Status and provider
+/// colors read on either background and are shared.
+struct Palette {
+    /// Names and titles.
+    text: Color,
+    /// Secondary text such as timestamps and paths.
+    body: Color,
+    /// Hints, separators, and idle or stashed panes.
+    muted: Color,
+    /// Headers and icons in the stashed section.
+    faint: Color,
+    /// Behind the selected row and footer notices.
+    selection: Color,
+    /// Behind the preview header.
+    bar: Color,
+    /// Greys for idle panes past each decay threshold, nearest the
+    /// foreground first.
+    decay: [u8; 3],
+}
+
+const DARK: Palette = Palette {
+    text: Color::White,
+    body: Color::Grey,
+    muted: Color::DarkGrey,
+    faint: Color::AnsiValue(242),
+    selection: Color::DarkGrey,
+    bar: Color::AnsiValue(236),
+    decay: [248, 244, 240],
+};
+
+const LIGHT: Palette = Palette {
+    text: Color::Black,
+    body: Color::AnsiValue(238),
+    muted: Color::AnsiValue(244),
+    faint: Color::AnsiValue(248),
+    selection: Color::AnsiValue(252),
+    bar: Color::AnsiValue(254),
+    decay: [242, 246, 250],
+};
+
+fn palette() -> &'static Palette {
+    static LIGHT_BACKGROUND: OnceLock<bool> = OnceLock::new();
+    if *LIGHT_BACKGROUND.get_or_init(|| config().theme.is_light()) {
+        &LIGHT
+    } else {
+        &DARK
+    }
+}
+
+/// How many of the `thresholds` (in minutes) an idle pane's idle time has
+/// passed.
+fn decay_level(p: &Pane, thresholds: &[u64], now: DateTime<Utc>) -> usize {
+    if !matches!(
+        p.shown_status(),
+        PaneStatus::Idle | PaneStatus::Disconnected
+    ) {
+        return 0;
+    }
+    let Some(since) = p.last_active else {
+        return 0;
+    };
+    let idle_mins = (now - since).num_minutes().max(0) as u64;
+    thresholds.iter().filter(|&&mins| idle_mins >= mins).count()
+}
+
+/// Whether a pane has needed attention long enough to be emphasized.
+fn escalated(p: &Pane, now: DateTime<Utc>) -> bool {
+    let after = config().status_style.escalate_after_mins;
+    after > 0
+        && !p.stashed
+        && p.shown_status() == PaneStatus::NeedsAttention
+        && p.last_active
+            .is_some_and(|since| now - since >= chrono::Duration::minutes(after as i64))
+}
+
+fn same_workspace(a: &Pane, b: &Pane) -> bool {
+    if a.project_root.is_empty() || b.project_root.is_empty() {
+        a.path == b.path
+    } else {
+        a.project_root == b.project_root
+    }
+}
+
+fn pane_section(p: &Pane) -> Option<&'static str> {
+    if p.terminated {
+        Some("terminated")
+    } else if p.stashed && config().stash_placement == StashPlacement::Section {
+        Some("stashed")
+    } else {
+        None
     }
-    col = put_clipped(slice, col, row, &" ".repeat(gap), dim_style);
-    let _ = put_clipped(slice, col, row, &elapsed, dim_style);
 }
 
+/// A window named by hand wins; otherwise the conversation title says more
+/// than the command tmux named the window after. With `windowNameLabels`, a
+/// telling window name is the whole label.
 fn pane_label(p: &Pane) -> String {
+    if config().window_name_labels && telling_window_name(p) {
+        return p.window_name.clone();
+    }
+    if !p.window_named && !p.title.is_empty() {
+        return p.title.clone();
+    }
     let mut label = if p.window_name.is_empty() {
         format!("{}:{}", p.session, p.window)
     } else {
@@ -1250,30 +4084,113 @@ fn pane_label(p: &Pane) -> String {
     label
 }
 
+/// Whether the window name is more than tmux's default: not a shell, not
+/// the agent's program, and not the version number some agents set as
+/// their process title.
+fn telling_window_name(p: &Pane) -> bool {
+    const SHELLS: [&str; 9] = [
+        "bash", "zsh", "fish", "sh", "dash", "ksh", "nu", "node", "tmux",
+    ];
+    let name = p.window_name.trim();
+    !name.is_empty()
+        && !SHELLS.contains(&name)
+        && name != p.provider
+        && name != provider_of(&p.command)
+        && !name.chars().all(|ch| ch.is_ascii_digit() || ch == '.')
+}
+
 fn render_preview(slice: &mut GridSlice<'_>, app: &App) {
-    if app.show_help {
-        render_help(slice);
-        return;
-    }
     if app.current_pane().is_none() {
         render_empty_preview(slice, app);
         return;
     }
+    let mut top = render_preview_header(slice, app);
     if app.preview_lines.is_empty() {
         put_clipped(
             slice,
             1,
-            1,
+            top as u16 + 1,
             "loading preview…",
-            Style::new().fg(Color::DarkGrey),
+            Style::new().fg(palette().muted),
         );
         return;
     }
-    let h = slice.height() as usize;
+    if app.show_detail {
+        top += render_detail(slice, app, top as u16);
+    }
+    let h = (slice.height() as usize).saturating_sub(top);
     let start = app.preview_lines.len().saturating_sub(h);
     for (row, line) in app.preview_lines.iter().skip(start).take(h).enumerate() {
-        put_ansi_spans(slice, 0, row as u16, line);
+        put_ansi_spans(slice, 0, (top + row) as u16, line);
+    }
+}
+
+/// Draws a bar naming the previewed pane and returns the number of rows
+/// used, so the output below can't be mistaken for another pane's.
+fn render_preview_header(slice: &mut GridSlice<'_>, app: &App) -> usize {
+    let Some(p) = app.current_pane() else {
+        return 0;
+    };
+    let bg = palette().bar;
+    let width = slice.width();
+    fill_spaces(slice, 0, 0, width, Style::new().bg(bg));
+    let mut segments = vec![
+        (pane_label(p), Style::new().fg(palette().text).bg(bg).bold()),
+        (p.provider.clone(), provider_style(&p.provider).bg(bg)),
+        (
+            p.status.as_str().to_string(),
+            Style::new().fg(status_color(p.status, false)).bg(bg),
+        ),
+    ];
+    if !p.git_branch.is_empty() {
+        segments.push((p.git_branch.clone(), Style::new().fg(Color::Green).bg(bg)));
+    }
+    let rate = app.preview_rate(&p.pane_id);
+    if rate != PreviewRate::Normal {
+        segments.push((
+            format!("refresh {}", rate.label()),
+            Style::new().fg(palette().muted).bg(bg),
+        ));
+    }
+    let mut col = 1;
+    for (text, style) in segments {
+        col = put_clipped(slice, col, 0, &text, style);
+        col = put_clipped(slice, col, 0, "  ", Style::new().bg(bg));
+    }
+    let avail = (width as usize).saturating_sub(col as usize + 1);
+    put_clipped(
+        slice,
+        col,
+        0,
+        &truncate_middle(&p.short_path, avail),
+        Style::new().fg(palette().body).bg(bg),
+    );
+    1
+}
+
+/// Draws the selected pane's details from row `top` and returns the number
+/// of rows used. The header bar above already names the pane.
+fn render_detail(slice: &mut GridSlice<'_>, app: &App, top: u16) -> usize {
+    let Some(p) = app.current_pane() else {
+        return 0;
+    };
+    let dim = Style::new().fg(palette().muted);
+    put_clipped(slice, 1, top, &format!("{}  {}", p.target, p.path), dim);
+    let mut row = top + 1;
+    if p.status == PaneStatus::NeedsAttention && !p.attention_reason.is_empty() {
+        let waiting = format!("Waiting: '{}'", p.attention_reason);
+        let style = Style::new().fg(status_color(PaneStatus::NeedsAttention, false));
+        put_clipped(slice, 1, row, &waiting, style);
+        row += 1;
     }
+    let history = if app.preview_for == p.pane_id && !app.preview_history.is_empty() {
+        journal::timeline(&app.preview_history)
+    } else {
+        "no recorded transitions".to_string()
+    };
+    put_clipped(slice, 1, row, &history, Style::new().fg(palette().body));
+    put_clipped(slice, 0, row + 1, &"─".repeat(slice.width() as usize), dim);
+    (row + 2 - top) as usize
 }
 
 fn render_empty_preview(slice: &mut GridSlice<'_>, app: &App) {
@@ -1283,8 +4200,8 @@ fn render_empty_preview(slice: &mut GridSlice<'_>, app: &App) {
         "No active sessions"
     };
     let detail = "Start a supported agent in tmux and it will appear here.";
-    put_clipped(slice, 2, 1, title, Style::new().fg(Color::White).bold());
-    put_clipped(slice, 2, 3, detail, Style::new().fg(Color::DarkGrey));
+    put_clipped(slice, 2, 1, title, Style::new().fg(palette().text).bold());
+    put_clipped(slice, 2, 3, detail, Style::new().fg(palette().muted));
 }
 
 fn put_ansi_spans(slice: &mut GridSlice<'_>, mut x: u16, y: u16, spans: &[AnsiSpan]) -> u16 {
@@ -1297,30 +4214,460 @@ fn put_ansi_spans(slice: &mut GridSlice<'_>, mut x: u16, y: u16, spans: &[AnsiSp
     x
 }
 
-fn render_help(slice: &mut GridSlice<'_>) {
-    let title = Style::new().fg(Color::White).bold();
+/// Every key the sidebar handles, by section. The help overlay is built
+/// from this table, so add new bindings here.
+const KEYMAP: &[(&str, &[(&str, &str)])] = &[
+    (
+        "Navigation",
+        &[
+            ("j/k", "move down/up"),
+            ("[n]j/k", "move down/up n times"),
+            ("gg/G", "go to first/last"),
+            ("ctrl-d/u", "half page down/up"),
+            ("zz/zt/zb", "scroll pane to middle/top/bottom"),
+            ("]a/[a", "next/previous needing attention"),
+            ("ctrl-^", "flip to previously selected"),
+            ("m{a-z}", "set bookmark"),
+            ("'{a-z}", "jump to bookmark"),
+            ("enter", "switch to pane"),
+            ("1-9", "switch to pane N (quickSwitch)"),
+            ("-", "go back to where you came from"),
+        ],
+    ),
+    (
+        "Actions",
+        &[
+            ("space", "toggle attention / do not disturb"),
+            (".", "repeat last change ([n]. for n panes)"),
+            ("[n]s/u", "stash n panes/unstash"),
+            ("Z", "snooze/unsnooze"),
+            ("P", "queue a prompt"),
+            ("n", "spawn from template"),
+            ("F", "add on-finish action"),
+            ("v", "mark for broadcast"),
+            ("B", "broadcast a prompt"),
+            ("[n]dd", "kill n panes"),
+            ("u", "undo a pending kill (off a stashed pane)"),
+            ("C", "mark cleanup candidates"),
+            ("K", "kill marked panes"),
+            ("o", "open workspace in editor"),
+            ("r", "respawn terminated agent"),
+            ("X", "dismiss terminated pane"),
+        ],
+    ),
+    (
+        "View",
+        &[
+            ("f", "cycle filter"),
+            ("S", "sort by status/tmux order"),
+            ("T", "group by path/tmux session/tag"),
+            ("#", "edit pane tags"),
+            ("+", "show only a tag"),
+            ("za/zo/zc", "toggle/open/fold header"),
+            ("zR", "open every header"),
+            ("x", "dismiss error or notice"),
+            ("H/L", "resize sidebar"),
+            ("drag", "resize sidebar"),
+            ("i", "toggle pane details"),
+            ("p", "cycle preview refresh rate"),
+            ("b", "status board (hjkl, enter)"),
+            ("h", "past sessions"),
+            ("/", "search agent transcripts"),
+            ("e", "export transcript as Markdown"),
+            ("yt/yp/yb", "copy target/path/branch"),
+            ("W", "start/stop recording (asciicast)"),
+            ("A", "browse output of killed panes"),
+            ("D", "recent warnings and errors"),
+            ("Q", "task queue"),
+            ("V", "review uncommitted agent work"),
+            ("?", "toggle help"),
+            ("q/esc", "quit"),
+        ],
+    ),
+    ("Daemon", &[("R", "reload watch")]),
+];
+
+const HELP_WIDTH: u16 = 50;
+
+enum HelpLine {
+    Section(&'static str),
+    Key(&'static str, &'static str),
+    Blank,
+}
+
+fn help_lines() -> Vec<HelpLine> {
+    let mut lines = Vec::new();
+    for (i, (section, keys)) in KEYMAP.iter().enumerate() {
+        if i > 0 {
+            lines.push(HelpLine::Blank);
+        }
+        lines.push(HelpLine::Section(section));
+        lines.extend(keys.iter().map(|(key, action)| HelpLine::Key(key, action)));
+    }
+    lines
+}
+
+/// The help box's column, row, width, and height, centred on the terminal.
+fn help_box(width: u16, height: u16, lines: usize) -> (u16, u16, u16, u16) {
+    let w = HELP_WIDTH.min(width.saturating_sub(2));
+    let h = (lines as u16 + 2).min(height.saturating_sub(2));
+    ((width - w) / 2, (height - h) / 2, w, h)
+}
+
+fn help_max_scroll(height: u16) -> usize {
+    let lines = help_lines().len();
+    let (_, _, _, h) = help_box(HELP_WIDTH, height, lines);
+    lines.saturating_sub(h.saturating_sub(2) as usize)
+}
+
+/// Paints the part of the help overlay that falls inside a layout leaf
+/// starting at column `offset_x`.
+fn render_help_overlay(slice: &mut GridSlice<'_>, app: &App, offset_x: u16) {
+    let lines = help_lines();
+    let rect = help_box(app.width, app.height, lines.len());
+    let (_, _, w, h) = rect;
+    if w < 4 || h < 3 {
+        return;
+    }
+    let scroll = app.help_scroll.min(help_max_scroll(app.height));
+    let title = Style::new().fg(palette().text).bold();
     let key = Style::new().fg(Color::Yellow).bold();
-    let dim = Style::new().fg(Color::DarkGrey);
-    put_clipped(slice, 2, 1, "Keybindings", title);
-    let rows = [
-        ("j/k", "move down/up"),
-        ("[n]j/k", "move down/up n times"),
-        ("enter", "switch to pane"),
-        ("space", "toggle attention"),
-        ("s/u", "stash/unstash"),
-        ("dd", "kill pane"),
-        ("gg", "go to first"),
-        ("G", "go to last"),
-        ("R", "reload watch"),
-        ("H/L", "resize sidebar"),
-        ("drag", "resize sidebar"),
-        ("?", "toggle help"),
-        ("q/esc", "quit"),
-    ];
-    for (i, (k, desc)) in rows.iter().enumerate() {
-        let y = i as u16 + 3;
-        put_clipped(slice, 2, y, &format!("{k:<8}"), key);
-        put_clipped(slice, 12, y, desc, dim);
+    let dim = Style::new().fg(palette().body);
+    let hint = if lines.len() > h as usize - 2 {
+        " j/k scroll · ? close "
+    } else {
+        " ? close "
+    };
+    let body: Vec<Vec<(char, Style)>> = lines
+        .iter()
+        .skip(scroll)
+        .map(|line| match line {
+            HelpLine::Section(name) => cells(&format!(" {name}"), title),
+            HelpLine::Key(k, action) => {
+                let mut row = cells(&format!("   {k:<8} "), key);
+                row.extend(cells(action, dim));
+                row
+            }
+            HelpLine::Blank => Vec::new(),
+        })
+        .collect();
+    render_box(slice, offset_x, rect, " Keys ", hint, &body);
+}
+
+const LIST_WIDTH: u16 = 100;
+
+/// The list's column, row, width, and height, centred on the
+/// terminal.
+fn list_box(width: u16, height: u16, rows: usize) -> (u16, u16, u16, u16) {
+    let w = LIST_WIDTH.min(width.saturating_sub(2));
+    let h = (rows.max(1) as u16 + 2).min(height.saturating_sub(2));
+    ((width - w) / 2, (height - h) / 2, w, h)
+}
+
+/// Rows the list shows at a terminal height.
+fn list_rows(height: u16, rows: usize) -> usize {
+    let (_, _, _, h) = list_box(LIST_WIDTH, height, rows);
+    h.saturating_sub(2) as usize
+}
+
+fn render_list(slice: &mut GridSlice<'_>, app: &App, offset_x: u16) {
+    let Some(list) = &app.list_view else {
+        return;
+    };
+    let rect = list_box(app.width, app.height, list.rows.len());
+    let (_, _, w, h) = rect;
+    if w < 4 || h < 3 {
+        return;
+    }
+    let dim = Style::new().fg(palette().muted);
+    let body: Vec<Vec<(char, Style)>> = if list.rows.is_empty() {
+        let note = match &list.source {
+            _ if list.loading => " loading…",
+            ListSource::History(_) => " no past sessions",
+            ListSource::Search(_) => " no matching transcripts",
+            ListSource::Archive => " no archived output yet",
+            ListSource::Diagnostics => " no warnings or errors",
+            ListSource::Tasks => " no tasks queued",
+        };
+        vec![cells(note, dim)]
+    } else {
+        list.rows
+            .iter()
+            .enumerate()
+            .skip(list.scroll)
+            .map(|(i, (item, text))| {
+                let bg = |style: Style| {
+                    if i == list.cursor {
+                        style.bg(palette().selection)
+                    } else {
+                        style
+                    }
+                };
+                let (at, tag, tag_style, count) = match item {
+                    ListItem::Session(session) => (
+                        session.updated_at,
+                        session.provider.as_str(),
+                        provider_style(&session.provider),
+                        session.messages.to_string(),
+                    ),
+                    ListItem::Commit(commit) => (
+                        Some(commit.at),
+                        commit.hash.as_str(),
+                        Style::new().fg(Color::Yellow),
+                        String::new(),
+                    ),
+                    ListItem::Archive(entry) => (
+                        Some(entry.at),
+                        entry.target.as_str(),
+                        Style::new().fg(palette().body),
+                        entry.lines.to_string(),
+                    ),
+                    ListItem::Problem(process, problem) => (
+                        Some(problem.at),
+                        *process,
+                        if problem.level == "error" {
+                            Style::new().fg(Color::Red)
+                        } else {
+                            Style::new().fg(Color::Yellow)
+                        },
+                        match problem.count {
+                            1 => String::new(),
+                            count => format!("×{count}"),
+                        },
+                    ),
+                    ListItem::Task(task) => (
+                        Some(task.finished_at.unwrap_or(task.created_at)),
+                        task.state.as_str(),
+                        match task.state {
+                            TaskState::Running | TaskState::Assigned => {
+                                Style::new().fg(Color::Cyan)
+                            }
+                            TaskState::Done => Style::new().fg(Color::Green),
+                            TaskState::Failed => Style::new().fg(Color::Red),
+                            TaskState::Pending | TaskState::Ready => {
+                                Style::new().fg(palette().muted)
+                            }
+                        },
+                        format!("#{}", task.id),
+                    ),
+                };
+                let at = at
+                    .map(|at| at.with_timezone(&Local).format("%m-%d %H:%M").to_string())
+                    .unwrap_or_default();
+                let mut row = cells(&format!(" {at:<11} "), bg(Style::new().fg(palette().body)));
+                row.extend(cells(
+                    &format!("{:<8} ", truncate_width(tag, 8)),
+                    bg(tag_style),
+                ));
+                row.extend(cells(
+                    &format!("{count:>5}  "),
+                    bg(Style::new().fg(palette().muted)),
+                ));
+                row.extend(cells(text, bg(Style::new().fg(palette().text))));
+                if i == list.cursor {
+                    row.resize(w as usize - 1, (' ', bg(Style::new())));
+                }
+                row
+            })
+            .collect()
+    };
+    let title = match &list.source {
+        ListSource::History(workspace) => format!(" History · {workspace} "),
+        ListSource::Search(query) => format!(" Search · {query} "),
+        ListSource::Archive => " Archived output ".to_string(),
+        ListSource::Diagnostics => " Diagnostics ".to_string(),
+        ListSource::Tasks => " Tasks ".to_string(),
+    };
+    let hint = match list.source {
+        ListSource::Archive => " j/k move · enter view · esc close ",
+        ListSource::Diagnostics => " j/k move · esc close ",
+        ListSource::Tasks => " j/k move · enter switch · esc close ",
+        _ => " j/k move · enter switch/show · r resume · e export · esc close ",
+    };
+    render_box(slice, offset_x, rect, &title, hint, &body);
+}
+
+const REVIEW_WIDTH: u16 = 120;
+
+/// Rows for the workspace list and for the diff below it, at a terminal
+/// height. The list takes up to a third of the box.
+fn review_rows(height: u16, workspaces: usize) -> (usize, usize) {
+    let inner = height.saturating_sub(4) as usize;
+    let list = workspaces.clamp(1, (inner / 3).max(1));
+    (list, inner.saturating_sub(list + 1))
+}
+
+/// The changed files, then the patch.
+fn review_diff_lines(workspace: &review::Workspace) -> Vec<&str> {
+    let mut lines: Vec<&str> = workspace.files.iter().map(String::as_str).collect();
+    if !workspace.diff.is_empty() {
+        lines.push("");
+        lines.extend(workspace.diff.lines());
+    }
+    lines
+}
+
+fn diff_style(line: &str) -> Style {
+    if line.starts_with("+++") || line.starts_with("---") || line.starts_with("diff ") {
+        Style::new().fg(palette().text).bold()
+    } else if line.starts_with('+') {
+        Style::new().fg(Color::Green)
+    } else if line.starts_with('-') {
+        Style::new().fg(Color::Red)
+    } else if line.starts_with("@@") {
+        Style::new().fg(Color::Cyan)
+    } else {
+        Style::new().fg(palette().body)
+    }
+}
+
+fn render_review(slice: &mut GridSlice<'_>, app: &App, offset_x: u16) {
+    let Some(view) = &app.review else {
+        return;
+    };
+    let w = REVIEW_WIDTH.min(app.width.saturating_sub(2));
+    let h = app.height.saturating_sub(2);
+    if w < 4 || h < 4 {
+        return;
+    }
+    let rect = ((app.width - w) / 2, 1, w, h);
+    let inner = (w - 2) as usize;
+    let dim = Style::new().fg(palette().muted);
+    let (list_rows, diff_rows) = review_rows(app.height, view.workspaces.len());
+    let mut body: Vec<Vec<(char, Style)>> = Vec::new();
+    if view.workspaces.is_empty() {
+        let note = if view.loading {
+            " loading…"
+        } else {
+            " no uncommitted agent work"
+        };
+        body.push(cells(note, dim));
+    }
+    let start = view.cursor.saturating_sub(list_rows.saturating_sub(1));
+    for (i, workspace) in view
+        .workspaces
+        .iter()
+        .enumerate()
+        .skip(start)
+        .take(list_rows)
+    {
+        let bg = |style: Style| {
+            if i == view.cursor {
+                style.bg(palette().selection)
+            } else {
+                style
+            }
+        };
+        let (mark, mark_style) = match review::verdict(&app.ui_state, workspace) {
+            Some(Verdict::Approved) => ("✓", Style::new().fg(Color::Green)),
+            Some(Verdict::FollowUp) => ("!", Style::new().fg(Color::Yellow)),
+            None => ("·", dim),
+        };
+        let mut row = cells(&format!(" {mark} "), bg(mark_style.bold()));
+        row.extend(cells(
+            &workspace.short_path,
+            bg(Style::new().fg(palette().text)),
+        ));
+        row.extend(cells(
+            &format!(" {}", workspace.branch),
+            bg(Style::new().fg(Color::Green)),
+        ));
+        let noun = if workspace.files.len() == 1 {
+            "file"
+        } else {
+            "files"
+        };
+        let agents = if workspace.pane_ids.len() == 1 {
+            "agent"
+        } else {
+            "agents"
+        };
+        row.extend(cells(
+            &format!(
+                "  {} {noun} · {} {agents}",
+                workspace.files.len(),
+                workspace.pane_ids.len()
+            ),
+            bg(dim),
+        ));
+        if i == view.cursor {
+            row.resize(inner, (' ', bg(Style::new())));
+        }
+        body.push(row);
+    }
+    body.resize(list_rows, Vec::new());
+    body.push(cells(&"─".repeat(inner), dim));
+    if let Some(workspace) = view.workspaces.get(view.cursor) {
+        for line in review_diff_lines(workspace)
+            .into_iter()
+            .skip(view.scroll)
+            .take(diff_rows)
+        {
+            body.push(cells(
+                &format!(" {}", line.replace('\t', "    ")),
+                diff_style(line),
+            ));
+        }
+    }
+    let title = match view.workspaces.len() {
+        0 => " Review ".to_string(),
+        n => format!(" Review · {} of {n} ", view.cursor + 1),
+    };
+    let hint = " j/k workspace · J/K/space scroll · a approve · f follow-up · c checkpoint · enter switch · esc close ";
+    render_box(slice, offset_x, rect, &title, hint, &body);
+}
+
+fn cells(text: &str, style: Style) -> Vec<(char, Style)> {
+    text.chars().map(|ch| (ch, style)).collect()
+}
+
+/// Paints a bordered box with a title, a hint on the bottom edge, and
+/// `body` rows inside, clipped to a layout leaf starting at column
+/// `offset_x`.
+fn render_box(
+    slice: &mut GridSlice<'_>,
+    offset_x: u16,
+    (x, y, w, h): (u16, u16, u16, u16),
+    title: &str,
+    hint: &str,
+    body: &[Vec<(char, Style)>],
+) {
+    let border = Style::new().fg(palette().muted);
+    let title_style = Style::new().fg(palette().text).bold();
+    let inner = (w - 2) as usize;
+    for row in 0..h {
+        let mut line: Vec<(char, Style)> = Vec::with_capacity(w as usize);
+        let (left, fill, right) = if row == 0 {
+            ('┌', '─', '┐')
+        } else if row == h - 1 {
+            ('└', '─', '┘')
+        } else {
+            ('│', ' ', '│')
+        };
+        line.push((left, border));
+        if row == 0 {
+            line.extend(cells(
+                &format!("─{}", fit_width(title, inner - 1)),
+                title_style,
+            ));
+        } else if row == h - 1 {
+            line.extend(cells(
+                &format!("─{}", fit_width(hint, inner - 1)),
+                title_style,
+            ));
+        } else if let Some(cells) = body.get(row as usize - 1) {
+            line.extend_from_slice(cells);
+        }
+        line.truncate(inner + 1);
+        line.resize(inner + 1, (fill, border));
+        line.push((right, border));
+        for (i, (ch, style)) in line.into_iter().enumerate() {
+            let col = x + i as u16;
+            if col < offset_x || col - offset_x >= slice.width() {
+                continue;
+            }
+            slice.set(col - offset_x, y + row, ch, style);
+        }
     }
 }
 
@@ -1356,7 +4703,7 @@ fn provider_style(provider: &str) -> Style {
             g: 179,
             b: 8,
         },
-        _ => Color::DarkGrey,
+        _ => palette().muted,
     };
     Style::new().fg(color)
 }
@@ -1368,25 +4715,29 @@ fn elapsed_label(p: &Pane) -> String {
     let Some(t) = p.last_active else {
         return String::new();
     };
-    let secs = (chrono::Utc::now() - t).num_seconds().max(0);
-    if secs < 60 {
-        format!("{}s", secs)
-    } else if secs < 3600 {
-        format!("{}m", secs / 60)
-    } else if secs < 86_400 {
-        format!("{}h", secs / 3600)
-    } else {
-        format!("{}d", secs / 86_400)
-    }
+    format_age((chrono::Utc::now() - t).num_seconds())
 }
 
 fn put_clipped(slice: &mut GridSlice<'_>, mut x: u16, y: u16, text: &str, style: Style) -> u16 {
+    let mut last = None;
     for ch in text.chars() {
-        let w = ch.width().unwrap_or(1).max(1) as u16;
+        let w = char_width(ch) as u16;
+        if w == 0 {
+            // A cell holds one char, so a combining mark goes onto the cell
+            // before it as the precomposed char, where there is one.
+            if let Some((col, base)) = last
+                && let Some(composed) = compose(base, ch)
+            {
+                slice.set(col, y, composed, style);
+                last = Some((col, composed));
+            }
+            continue;
+        }
         if x + w > slice.width() || y >= slice.height() {
             break;
         }
         slice.set(x, y, ch, style);
+        last = Some((x, ch));
         x += w;
     }
     x
@@ -1398,15 +4749,41 @@ fn fill_spaces(slice: &mut GridSlice<'_>, x: u16, y: u16, width: u16, style: Sty
     }
 }
 
+// Combining marks and control characters occupy no cell; measuring per char
+// keeps widths consistent with what put_clipped actually draws.
+fn char_width(ch: char) -> usize {
+    ch.width().unwrap_or(0)
+}
+
+/// Common Latin letters with a combining mark, by mark: the bases and, at
+/// the same positions, the chars they compose to.
+const COMPOSED: &[(char, &str, &str)] = &[
+    ('\u{300}', "aeiouAEIOU", "àèìòùÀÈÌÒÙ"),
+    ('\u{301}', "aeiouyAEIOUYcnszCNSZ", "áéíóúýÁÉÍÓÚÝćńśźĆŃŚŹ"),
+    ('\u{302}', "aeiouAEIOU", "âêîôûÂÊÎÔÛ"),
+    ('\u{303}', "anoANO", "ãñõÃÑÕ"),
+    ('\u{308}', "aeiouyAEIOUY", "äëïöüÿÄËÏÖÜŸ"),
+    ('\u{30a}', "auAU", "åůÅŮ"),
+    ('\u{30c}', "cenrszCENRSZ", "čěňřšžČĚŇŘŠŽ"),
+    ('\u{327}', "csCS", "çşÇŞ"),
+];
+
+/// `base` with the combining `mark` on it, when that is a single char.
+fn compose(base: char, mark: char) -> Option<char> {
+    let (_, bases, composed) = COMPOSED.iter().find(|(m, _, _)| *m == mark)?;
+    let i = bases.chars().position(|ch| ch == base)?;
+    composed.chars().nth(i)
+}
+
 fn display_width(s: &str) -> usize {
-    UnicodeWidthStr::width(s)
+    s.chars().map(char_width).sum()
 }
 
 fn truncate_width(s: &str, max: usize) -> String {
     let mut out = String::new();
     let mut width = 0;
     for ch in s.chars() {
-        let w = ch.width().unwrap_or(1).max(1);
+        let w = char_width(ch);
         if width + w > max {
             break;
         }
@@ -1416,13 +4793,51 @@ fn truncate_width(s: &str, max: usize) -> String {
     out
 }
 
-fn visible_start(len: usize, cursor: usize, height: usize) -> usize {
-    if len <= height || cursor < height / 2 {
-        0
-    } else if cursor + height / 2 >= len {
-        len - height
+fn fit_width(s: &str, max: usize) -> String {
+    match config().truncation {
+        Truncation::End => truncate_width(s, max),
+        Truncation::Middle => truncate_middle(s, max),
+    }
+}
+
+fn truncate_middle(s: &str, max: usize) -> String {
+    if display_width(s) <= max {
+        return s.to_string();
+    }
+    if max == 0 {
+        return String::new();
+    }
+    let head_w = (max - 1) / 2;
+    let tail_w = max - 1 - head_w;
+    let mut tail = Vec::new();
+    let mut width = 0;
+    for ch in s.chars().rev() {
+        let w = char_width(ch);
+        if width + w > tail_w {
+            break;
+        }
+        tail.push(ch);
+        width += w;
+    }
+    let mut out = truncate_width(s, head_w);
+    out.push('…');
+    out.extend(tail.into_iter().rev());
+    out
+}
+
+/// The first visible row: `start` unless the cursor would be off screen or
+/// the list would end above the bottom edge.
+fn keep_visible(len: usize, cursor: usize, start: usize, height: usize) -> usize {
+    if len <= height || height == 0 {
+        return 0;
+    }
+    let start = start.min(len - height);
+    if cursor < start {
+        cursor
+    } else if cursor >= start + height {
+        cursor + 1 - height
     } else {
-        cursor - height / 2
+        start
     }
 }
 
@@ -1430,38 +4845,92 @@ fn first_pane(items: &[TreeItem]) -> Option<usize> {
     items.iter().position(|it| matches!(it, TreeItem::Pane(_)))
 }
 
+fn header_id(header: &TreeItem) -> Option<&String> {
+    match header {
+        TreeItem::Workspace(id)
+        | TreeItem::ProjectGroup(id)
+        | TreeItem::Session(id)
+        | TreeItem::Window(id)
+        | TreeItem::Tag(id) => Some(id),
+        TreeItem::SectionHeader(_) | TreeItem::Pane(_) => None,
+    }
+}
+
+/// Names the group `header` stands for by what any of its panes share, so
+/// a folded header stays folded when its first pane changes.
+fn header_key(header: &TreeItem, p: &Pane) -> String {
+    match header {
+        TreeItem::Session(_) => format!("session:{}:{}", p.host, p.session),
+        TreeItem::Window(_) => format!("window:{}:{}:{}", p.host, p.session, p.window),
+        TreeItem::ProjectGroup(_) => format!("project:{}", p.project_root),
+        TreeItem::Tag(_) => format!("tag:{}", p.tags.first().map_or("", String::as_str)),
+        _ => format!("path:{}:{}", p.host, p.path),
+    }
+}
+
+/// Sort key for the status order: most urgent first, then most recently
+/// active.
+fn status_rank(p: &Pane) -> (u8, Reverse<Option<DateTime<Utc>>>) {
+    (p.shown_status().priority(), Reverse(p.last_active))
+}
+
 fn last_pane(items: &[TreeItem]) -> Option<usize> {
     items.iter().rposition(|it| matches!(it, TreeItem::Pane(_)))
 }
 
-fn next_pane(items: &[TreeItem], from: usize) -> usize {
+/// Rows `j` and `k` stop on: panes and the workspace headers above them.
+fn selectable(item: &TreeItem) -> bool {
+    !matches!(item, TreeItem::SectionHeader(_))
+}
+
+fn next_row(items: &[TreeItem], from: usize) -> usize {
     for (i, item) in items.iter().enumerate().skip(from + 1) {
-        if matches!(item, TreeItem::Pane(_)) {
+        if selectable(item) {
             return i;
         }
     }
     for (i, item) in items.iter().enumerate().take(from.min(items.len())) {
-        if matches!(item, TreeItem::Pane(_)) {
+        if selectable(item) {
             return i;
         }
     }
     from
 }
 
-fn prev_pane(items: &[TreeItem], from: usize) -> usize {
+fn prev_row(items: &[TreeItem], from: usize) -> usize {
     for i in (0..from).rev() {
-        if matches!(items[i], TreeItem::Pane(_)) {
+        if selectable(&items[i]) {
             return i;
         }
     }
     for i in ((from + 1)..items.len()).rev() {
-        if matches!(items[i], TreeItem::Pane(_)) {
+        if selectable(&items[i]) {
             return i;
         }
     }
     from
 }
 
+/// The next (or previous) pane after `from` matching `wanted`, wrapping
+/// around the list. `from` itself is only returned if nothing else matches.
+fn find_pane_wrapping(
+    items: &[TreeItem],
+    from: usize,
+    forward: bool,
+    wanted: impl Fn(&str) -> bool,
+) -> Option<usize> {
+    let len = items.len();
+    (1..=len)
+        .map(|step| {
+            if forward {
+                (from + step) % len
+            } else {
+                (from + len - step % len) % len
+            }
+        })
+        .find(|&i| matches!(&items[i], TreeItem::Pane(id) if wanted(id)))
+}
+
 fn nearest_pane(items: &[TreeItem], from: usize) -> usize {
     if items.is_empty() {
         return 0;
@@ -1480,3 +4949,375 @@ fn nearest_pane(items: &[TreeItem], from: usize) -> usize {
     }
     0
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use chrono::TimeZone;
+
+    #[test]
+    fn help_box_fits_and_scrolls_on_short_terminals() {
+        let lines = help_lines().len();
+
+        let (x, y, w, h) = help_box(120, 100, lines);
+        assert_eq!((w, h as usize), (HELP_WIDTH, lines + 2));
+        assert_eq!((x, y), ((120 - HELP_WIDTH) / 2, (100 - h) / 2));
+        assert_eq!(help_max_scroll(100), 0);
+
+        let (_, _, w, h) = help_box(30, 12, lines);
+        assert_eq!((w, h), (28, 10));
+        assert_eq!(help_max_scroll(12), lines - 8);
+    }
+
+    #[test]
+    fn view_scrolls_only_to_keep_the_cursor_visible() {
+        assert_eq!(keep_visible(5, 4, 3, 10), 0);
+        assert_eq!(keep_visible(50, 12, 5, 10), 5);
+        assert_eq!(keep_visible(50, 2, 5, 10), 2);
+        assert_eq!(keep_visible(50, 20, 5, 10), 11);
+        assert_eq!(keep_visible(50, 49, 45, 10), 40);
+    }
+
+    #[test]
+    fn finds_matching_panes_with_wraparound() {
+        let items = vec![
+            TreeItem::Pane("%1".to_string()),
+            TreeItem::Pane("%2".to_string()),
+            TreeItem::Pane("%3".to_string()),
+        ];
+        let wanted = |id: &str| id != "%2";
+
+        assert_eq!(find_pane_wrapping(&items, 0, true, wanted), Some(2));
+        assert_eq!(find_pane_wrapping(&items, 2, true, wanted), Some(0));
+        assert_eq!(find_pane_wrapping(&items, 0, false, wanted), Some(2));
+        assert_eq!(find_pane_wrapping(&items, 1, true, |_| false), None);
+        assert_eq!(find_pane_wrapping(&[], 0, true, wanted), None);
+    }
+
+    #[test]
+    fn status_sort_puts_urgent_and_recent_panes_first() {
+        let now = Utc::now();
+        let pane = |id: &str, status, mins: i64| {
+            let mut p = Pane::default();
+            p.pane_id = id.to_string();
+            p.status = status;
+            p.last_active = Some(now - chrono::Duration::minutes(mins));
+            p
+        };
+        let mut panes = [
+            pane("idle", PaneStatus::Idle, 1),
+            pane("old-unread", PaneStatus::Unread, 30),
+            pane("busy", PaneStatus::Busy, 0),
+            pane("new-unread", PaneStatus::Unread, 5),
+            pane("attention", PaneStatus::NeedsAttention, 60),
+        ];
+
+        panes.sort_by_key(status_rank);
+
+        let order: Vec<&str> = panes.iter().map(|p| p.pane_id.as_str()).collect();
+        assert_eq!(
+            order,
+            ["attention", "new-unread", "old-unread", "busy", "idle"]
+        );
+    }
+
+    #[test]
+    fn navigation_stops_on_headers_but_not_sections() {
+        let items = vec![
+            TreeItem::Workspace("%1".to_string()),
+            TreeItem::Pane("%1".to_string()),
+            TreeItem::SectionHeader(None),
+            TreeItem::SectionHeader(Some("stashed".to_string())),
+            TreeItem::ProjectGroup("%2".to_string()),
+            TreeItem::Pane("%2".to_string()),
+        ];
+
+        assert_eq!(next_row(&items, 0), 1);
+        assert_eq!(next_row(&items, 1), 4);
+        assert_eq!(prev_row(&items, 4), 1);
+        assert_eq!(next_row(&items, 5), 0);
+    }
+
+    #[test]
+    fn idle_panes_decay_past_each_threshold() {
+        let now = Utc::now();
+        let pane = |status, mins| {
+            let mut p = Pane::default();
+            p.status = status;
+            p.last_active = Some(now - chrono::Duration::minutes(mins));
+            p
+        };
+        let thresholds = [30, 120, 480];
+
+        assert_eq!(
+            decay_level(&pane(PaneStatus::Idle, 10), &thresholds, now),
+            0
+        );
+        assert_eq!(
+            decay_level(&pane(PaneStatus::Idle, 45), &thresholds, now),
+            1
+        );
+        assert_eq!(
+            decay_level(&pane(PaneStatus::Idle, 600), &thresholds, now),
+            3
+        );
+        assert_eq!(
+            decay_level(&pane(PaneStatus::Unread, 600), &thresholds, now),
+            0
+        );
+        assert_eq!(decay_level(&pane(PaneStatus::Idle, 600), &[], now), 0);
+    }
+
+    #[test]
+    fn parses_configured_colors() {
+        assert_eq!(
+            parse_color("#ff8000"),
+            Some(Color::Rgb {
+                r: 255,
+                g: 128,
+                b: 0
+            })
+        );
+        assert_eq!(parse_color("208"), Some(Color::AnsiValue(208)));
+        assert_eq!(parse_color("dark-grey"), Some(Color::DarkGrey));
+        assert_eq!(parse_color("#fff"), None);
+        assert_eq!(parse_color("orange"), None);
+    }
+
+    #[test]
+    fn clock_shows_the_time_today_and_the_date_before() {
+        let now = Local
+            .with_ymd_and_hms(2026, 3, 2, 18, 0, 0)
+            .unwrap()
+            .with_timezone(&Utc);
+        let at = |day, hour, min| {
+            Local
+                .with_ymd_and_hms(2026, 3, day, hour, min, 0)
+                .unwrap()
+                .with_timezone(&Utc)
+        };
+
+        assert_eq!(clock_label(at(2, 9, 5), now), "09:05");
+        assert_eq!(clock_label(at(1, 23, 59), now), "03/01");
+        assert_eq!(wide_slot("09:05", 7), " 09:05 ");
+    }
+
+    #[test]
+    fn row_cells_shrink_the_label_and_drop_the_path() {
+        let cells = || {
+            [
+                (PaneColumn::Icon, "●".to_string()),
+                (PaneColumn::Label, "1:claude".to_string()),
+                (PaneColumn::Path, "api/wt".to_string()),
+                (PaneColumn::Elapsed, slot("5m")),
+            ]
+            .into_iter()
+            .map(|(column, text)| RowCell {
+                column,
+                text,
+                style: Style::new(),
+            })
+            .collect::<Vec<_>>()
+        };
+        let fit = |width, aligned| {
+            fit_row_cells(cells(), width, 3, aligned)
+                .into_iter()
+                .map(|(sep, cell)| (sep, cell.text))
+                .collect::<Vec<_>>()
+        };
+
+        let row = fit(30, None);
+        assert_eq!(
+            row.iter().map(|(sep, _)| *sep).collect::<Vec<_>>(),
+            [0, 1, 2, 0]
+        );
+        assert_eq!(fit(40, Some(5))[2], (5, "api/wt".to_string()));
+        assert_eq!(fit(20, None).len(), 3);
+        assert_eq!(display_width(&fit(14, None)[1].1), 4);
+    }
+
+    #[test]
+    fn middle_truncation_keeps_both_ends() {
+        assert_eq!(truncate_middle("feat/add-retry-logic", 12), "feat/…-logic");
+        assert_eq!(truncate_middle("short", 12), "short");
+        assert_eq!(truncate_middle("abcdef", 1), "…");
+    }
+
+    #[test]
+    fn combining_marks_compose_onto_their_letter() {
+        assert_eq!(compose('e', '\u{301}'), Some('é'));
+        assert_eq!(compose('N', '\u{303}'), Some('Ñ'));
+        assert_eq!(compose('x', '\u{301}'), None);
+        assert_eq!(display_width("cafe\u{301}"), 4);
+    }
+
+    #[test]
+    fn middle_truncation_respects_wide_chars() {
+        let out = truncate_middle("日本語のブランチ名", 9);
+
+        assert_eq!(out, "日本…チ名");
+        assert!(display_width(&out) <= 9);
+    }
+
+    #[test]
+    fn conversation_titles_replace_automatic_window_names() {
+        let mut p = Pane::default();
+        p.session = "main".to_string();
+        p.window = "3".to_string();
+        p.window_name = "claude".to_string();
+        p.pane = "1".to_string();
+        p.title = "Fix flaky login test".to_string();
+        assert_eq!(pane_label(&p), "Fix flaky login test");
+
+        p.window_named = true;
+        assert_eq!(pane_label(&p), "3:claude.1");
+    }
+
+    #[test]
+    fn tells_task_window_names_from_default_ones() {
+        let window = |name: &str| {
+            let mut p = Pane::default();
+            p.window_name = name.to_string();
+            p.provider = "claude".to_string();
+            p.command = "/opt/bin/codex-cli --full-auto".to_string();
+            p
+        };
+
+        assert!(telling_window_name(&window("fix-login")));
+        for name in ["", "zsh", "claude", "codex-cli", "2.1.3"] {
+            assert!(!telling_window_name(&window(name)), "{name}");
+        }
+    }
+
+    #[test]
+    fn fold_keys_follow_the_group_not_its_first_pane() {
+        let pane = |id: &str, session: &str, window: &str| {
+            let mut p = Pane::default();
+            p.pane_id = id.to_string();
+            p.session = session.to_string();
+            p.window = window.to_string();
+            p.path = "/src/app".to_string();
+            p
+        };
+        let window = TreeItem::Window("%1".to_string());
+        let session = TreeItem::Session("%1".to_string());
+
+        assert_eq!(
+            header_key(&window, &pane("%1", "main", "1")),
+            header_key(&window, &pane("%2", "main", "1"))
+        );
+        assert_ne!(
+            header_key(&window, &pane("%1", "main", "1")),
+            header_key(&window, &pane("%3", "work", "1"))
+        );
+        assert_eq!(
+            header_key(&session, &pane("%1", "main", "1")),
+            header_key(&session, &pane("%4", "main", "2"))
+        );
+        assert_ne!(
+            header_key(&session, &pane("%1", "main", "1")),
+            header_key(
+                &TreeItem::Workspace("%1".to_string()),
+                &pane("%1", "main", "1")
+            )
+        );
+    }
+
+    #[test]
+    fn board_scrolls_to_the_selected_card() {
+        assert_eq!(board_cards(24), 11);
+        assert_eq!(board_start(3, 11), 0);
+        assert_eq!(board_start(11, 11), 1);
+        assert_eq!(
+            board_column(PaneStatus::Error),
+            board_column(PaneStatus::NeedsAttention)
+        );
+        assert_eq!(
+            board_column(PaneStatus::Disconnected),
+            BOARD_COLUMNS.len() - 1
+        );
+    }
+
+    #[test]
+    fn warns_when_agents_share_a_checkout_while_one_is_busy() {
+        let pane = |path: &str, status| {
+            let mut p = Pane::default();
+            p.path = path.to_string();
+            p.project_root = "/src/api".to_string();
+            p.status = status;
+            p
+        };
+        let busy = [
+            pane("/src/api", PaneStatus::Busy),
+            pane("/src/api", PaneStatus::Idle),
+            pane("/src/api-fix", PaneStatus::Idle),
+        ];
+        let key = |dir: &str| (String::new(), dir.to_string());
+
+        let shared = shared_workspaces(busy.iter(), false);
+        assert_eq!(shared, HashSet::from([key("/src/api")]));
+
+        let worktrees = [busy[0].clone(), busy[2].clone()];
+        assert!(shared_workspaces(worktrees.iter(), false).is_empty());
+        assert_eq!(
+            shared_workspaces(worktrees.iter(), true),
+            HashSet::from([key("/src/api")])
+        );
+
+        let quiet = [busy[1].clone(), busy[1].clone()];
+        assert!(shared_workspaces(quiet.iter(), false).is_empty());
+        let mut stashed = busy[1].clone();
+        stashed.stashed = true;
+        assert!(shared_workspaces([busy[0].clone(), stashed].iter(), false).is_empty());
+    }
+
+    #[test]
+    fn read_only_refuses_marks_and_folds() {
+        let mut app = App::with_state(String::new(), "pane".to_string(), None, UiState::default());
+        let mut pane = Pane::default();
+        pane.pane_id = "%1".to_string();
+        pane.target = "s:1.1".to_string();
+        pane.path = "/src/api".to_string();
+        pane.status = PaneStatus::Unread;
+        app.replace_panes(vec![pane]);
+        app.read_only = true;
+        app.cursor = app.find_pane_by_id("%1").unwrap();
+        let mut press = |keys: &str| {
+            for ch in keys.chars() {
+                app.handle_key(KeyEvent::new(KeyCode::Char(ch), KeyModifiers::NONE));
+            }
+            app.notice.take()
+        };
+
+        for keys in ["ma", "za", "zo", "zc", "zR"] {
+            assert_eq!(press(keys).as_deref(), Some("read-only"), "{keys}");
+        }
+        assert_eq!(press("zz"), None);
+        assert!(app.ui_state.marks.is_empty());
+        assert!(app.ui_state.collapsed.is_empty());
+    }
+
+    #[test]
+    fn one_undo_restores_the_whole_batch_of_kills() {
+        let mut app = App::with_state(String::new(), "pane".to_string(), None, UiState::default());
+        let pane = |id: &str| {
+            let mut p = Pane::default();
+            p.pane_id = id.to_string();
+            p.target = format!("s:1.{id}");
+            p.path = "/src/api".to_string();
+            p
+        };
+        app.replace_panes(vec![pane("%1"), pane("%2"), pane("%3")]);
+
+        app.request_kills(&["%1".to_string()]);
+        app.request_kills(&["%2".to_string(), "%3".to_string()]);
+        assert_eq!(app.last_kill_batch().len(), 2);
+
+        assert!(app.undo_kill());
+        assert!(app.panes.contains_key("%2") && app.panes.contains_key("%3"));
+        assert!(!app.panes.contains_key("%1"));
+        assert!(app.undo_kill());
+        assert!(app.panes.contains_key("%1"));
+        assert!(!app.undo_kill());
+    }
+}
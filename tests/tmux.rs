@@ -0,0 +1,161 @@
+//! Drives pane discovery, the reconciler, switching and killing against a
+//! private tmux server running scripted fake agents. Skipped when tmux is
+//! not installed.
+
+use std::fs;
+use std::path::PathBuf;
+use std::process::{Child, Command, Stdio};
+use std::thread;
+use std::time::{Duration, Instant};
+
+use agent_mux::{Pane, PaneStatus, Reconciler, kill_pane, list_panes, switch_to_pane};
+
+/// Prints changing output until `$DIR/done` exists, then asks a question
+/// and waits, like an agent that stops to ask for permission.
+const ASKING_AGENT: &str = r#"
+echo "working on it"
+while [ ! -e "$DIR/done" ]; do date +%s%N; sleep 0.1; done
+clear
+echo "Do you want to proceed?"
+exec sleep 600
+"#;
+
+struct Fixture {
+    socket: String,
+    dir: PathBuf,
+    client: Option<Child>,
+}
+
+impl Fixture {
+    fn start() -> Option<Self> {
+        if Command::new("tmux").arg("-V").output().is_err() {
+            eprintln!("tmux not installed; skipping");
+            return None;
+        }
+        let socket = format!("agent-mux-test-{}", std::process::id());
+        let dir = std::env::temp_dir().join(&socket);
+        fs::create_dir_all(&dir).unwrap();
+        // SAFETY: this file has a single test, which sets these before any
+        // other thread reads the environment.
+        unsafe {
+            std::env::set_var("AGENT_MUX_TMUX_SOCKET", &socket);
+            std::env::set_var("HOME", &dir);
+            // The config is looked up here before `HOME`, and a real one
+            // could reach remotes, other backends or the archive.
+            std::env::set_var("XDG_CONFIG_HOME", dir.join(".config"));
+        }
+        let mut fixture = Self {
+            socket,
+            dir,
+            client: None,
+        };
+        fixture.tmux(&["-f", "/dev/null", "new-session", "-d", "-s", "test"]);
+        fixture.tmux(&["resize-window", "-t", "test", "-x", "120", "-y", "40"]);
+        // switch-client needs a client; a control-mode one needs no terminal.
+        let client = Command::new("tmux")
+            .args(["-L", &fixture.socket, "-C", "attach", "-t", "test"])
+            .stdin(Stdio::piped())
+            .stdout(Stdio::null())
+            .spawn()
+            .unwrap();
+        fixture.client = Some(client);
+        Some(fixture)
+    }
+
+    fn tmux(&self, args: &[&str]) -> String {
+        let out = Command::new("tmux")
+            .args(["-L", &self.socket])
+            .args(args)
+            .output()
+            .unwrap();
+        assert!(out.status.success(), "tmux {args:?} failed");
+        String::from_utf8_lossy(&out.stdout).trim().to_string()
+    }
+
+    /// Runs `script` as a fake `name` agent in a new background window and
+    /// returns its pane id.
+    fn agent(&self, name: &str, script: &str) -> String {
+        let path = self.dir.join(name);
+        fs::write(&path, script).unwrap();
+        let command = format!(
+            "DIR={} sh {}; sleep 600",
+            self.dir.display(),
+            path.display()
+        );
+        self.tmux(&[
+            "new-window",
+            "-d",
+            "-P",
+            "-F",
+            "#{pane_id}",
+            "-t",
+            "test:",
+            "-n",
+            name,
+            &command,
+        ])
+    }
+
+    fn pane(&self, pane_id: &str) -> Option<Pane> {
+        list_panes()
+            .unwrap()
+            .into_iter()
+            .find(|pane| pane.pane_id == pane_id)
+    }
+}
+
+impl Drop for Fixture {
+    fn drop(&mut self) {
+        let _ = Command::new("tmux")
+            .args(["-L", &self.socket, "kill-server"])
+            .status();
+        if let Some(mut client) = self.client.take() {
+            let _ = client.kill();
+            let _ = client.wait();
+        }
+        let _ = fs::remove_dir_all(&self.dir);
+    }
+}
+
+/// Polls like the watcher until `pane_id` reaches `status`.
+fn poll_until(reconciler: &mut Reconciler, pane_id: &str, status: PaneStatus) -> Pane {
+    let deadline = Instant::now() + Duration::from_secs(15);
+    let mut last = None;
+    while Instant::now() < deadline {
+        let mut panes = list_panes().unwrap();
+        reconciler.reconcile(&mut panes);
+        if let Some(pane) = panes.into_iter().find(|pane| pane.pane_id == pane_id) {
+            if pane.status == status {
+                return pane;
+            }
+            last = Some(pane.status);
+        }
+        thread::sleep(Duration::from_millis(250));
+    }
+    panic!("{pane_id} never became {status:?}; last {last:?}");
+}
+
+#[test]
+fn fake_agents_end_to_end() {
+    let Some(fixture) = Fixture::start() else {
+        return;
+    };
+    let pane_id = fixture.agent("claude", ASKING_AGENT);
+
+    let mut reconciler = Reconciler::new();
+    let pane = poll_until(&mut reconciler, &pane_id, PaneStatus::Busy);
+    assert_eq!(pane.provider, "claude");
+    assert_eq!(pane.window_name, "claude");
+    fs::write(fixture.dir.join("done"), "").unwrap();
+    let pane = poll_until(&mut reconciler, &pane_id, PaneStatus::NeedsAttention);
+    assert!(pane.attention_reason.contains("Do you want to proceed?"));
+
+    switch_to_pane(&pane.target).unwrap();
+    assert_eq!(
+        fixture.tmux(&["display", "-p", "-t", &pane_id, "#{window_active}"]),
+        "1"
+    );
+
+    kill_pane(&pane.target).unwrap();
+    assert!(fixture.pane(&pane_id).is_none());
+}